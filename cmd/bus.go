@@ -0,0 +1,67 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	busCmd = &cobra.Command{
+		Use:   "bus",
+		Short: "Run a NATS server as message bus",
+		Long: `Runs a NATS server with JetStream, publishers and subscribers connect to it with a nats:// URL instead of
+a tcp:// URL. The messages are kept in a stream so subscribers can replay them, no proxy is needed.`,
+		Run: doBus,
+	}
+	busListenURL      string
+	busStoreDirectory string
+	busMaxAge         time.Duration
+	busMaxBytes       int64
+)
+
+func init() {
+	rootCmd.AddCommand(busCmd)
+	busCmd.Flags().StringVarP(&busListenURL, "listenURL", "l", "nats://127.0.0.1:4222", "NATS URL, the server listens for connections on this URL.")
+	busCmd.Flags().StringVar(&busStoreDirectory, "storeDirectory", "", "directory where the messages are stored, the messages are kept in memory when empty")
+	busCmd.Flags().DurationVar(&busMaxAge, "maxAge", 24*time.Hour, "messages older than this are removed from the stream, messages are not removed by age when zero")
+	busCmd.Flags().Int64Var(&busMaxBytes, "maxBytes", 0, "the oldest messages are removed when the stream is bigger than this, no limit when zero")
+}
+
+func doBus(cmd *cobra.Command, args []string) {
+	s, err := nanomsg.StartNATSServer(busListenURL, busStoreDirectory, busMaxAge, busMaxBytes)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not start the NATS server",
+			zap.String("URL", busListenURL),
+			zap.String("Error", err.Error()),
+		)
+	}
+	logger.GetLogger().Info(
+		"NATS server is ready",
+		zap.String("URL", s.ClientURL()),
+		zap.String("Stream", nanomsg.NATSStream),
+	)
+	<-commandContext(cmd).Done()
+	logger.GetLogger().Info("Stopping the NATS server")
+	s.Shutdown()
+}
@@ -85,28 +85,34 @@ func doConnect(cmd *cobra.Command, args []string) {
 		)
 	}
 
+	url := subscribeURL
+	publisher := nanomsg.NewPublisher[message.Raw](publishURL, publisherFormat[message.Raw]())
+	ctx := commandContext(cmd)
 	go func() {
-		if subscribeURL == "" {
+		if url == "" {
 			return // nothing to subscribe to
 		}
-		for {
+		for ctx.Err() == nil {
 			subscriber, err := nanomsg.NewSubscriber[message.Raw](
-				subscribeURL,
+				url,
 				[]byte{},
 			)
 			if err == nil {
-				conn.Subscribe(subscriber)
+				conn.Subscribe(ctx, subscriber)
 				return // subscriber has been added
 			}
 
 			logger.GetLogger().Warn(
 				"Could not subscribe, sleeping",
-				zap.String("URL", subscribeURL),
+				zap.String("URL", url),
 				zap.String("Error", err.Error()),
 			)
-			time.Sleep(RETRY_SUBSCRIPTION_SLEEP * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(RETRY_SUBSCRIPTION_SLEEP * time.Second):
+			}
 		}
 	}()
 
-	conn.Publish(nanomsg.NewPublisher[message.Raw](publishURL))
+	conn.Publish(ctx, publisher)
 }
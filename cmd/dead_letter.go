@@ -0,0 +1,46 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+)
+
+const deadLetterBufferSize = 1 << 12
+
+var (
+	deadLetterURL    string
+	deadLetterFormat string
+)
+
+// publishes the messages that could not be mapped or are rejected on the dead letter URL, the dead letters are nil when
+// the URL is not set. Set the dead letters on the mapper, each mapper has its own. The returned function sends the
+// remaining dead letters, call it when the mapper stopped.
+func enableDeadLetters(mapperName string) (*mapper.DeadLetters, func()) {
+	if deadLetterURL == "" {
+		return nil, func() {}
+	}
+	publisher := nanomsg.NewPublisher[message.DeadLetter](deadLetterURL, nanomsg.WithPublisherFormat[message.DeadLetter](deadLetterSocketFormat))
+	buffer := make(chan *message.DeadLetter, deadLetterBufferSize)
+	go publisher.Send(buffer)
+	return mapper.NewDeadLetters(mapperName, buffer), func() {
+		close(buffer)
+		<-publisher.Done()
+	}
+}
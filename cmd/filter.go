@@ -23,6 +23,8 @@ func init() {
 	filterCmd.MarkFlagRequired("subscribeURL")
 	filterCmd.Flags().StringVarP(&publishURL, "publishURL", "p", "", "Nanomsg URL, the URL is used to publish the data on. It listens for connections.")
 	filterCmd.MarkFlagRequired("publishURL")
+	filterCmd.Flags().StringVarP(&deadLetterURL, "deadLetterURL", "d", "", "Nanomsg URL, the URL is used to publish the messages that could not be mapped or are rejected. It listens for connections.")
+	filterCmd.Flags().StringVar(&deadLetterFormat, "deadLetterFormat", "", "format of the published dead letters, json or binary, the publish format is used when empty")
 }
 
 func doFilter(cmd *cobra.Command, args []string) {
@@ -34,8 +36,11 @@ func doFilter(cmd *cobra.Command, args []string) {
 			zap.String("Error", err.Error()),
 		)
 	}
-	publisher := nanomsg.NewPublisher[message.Mapped](publishURL)
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
+	deadLetters, stopDeadLetters := enableDeadLetters("filter")
+	defer stopDeadLetters()
 	c := config.NewExpressionMappingConfig(cfgFile)
 	f, _ := mapper.NewExpressionFilter(c)
-	f.Map(subscriber, publisher)
+	f.SetDeadLetters(deadLetters)
+	f.WithReloadConfig(config.NewReloadConfig(cfgFile)).Map(commandContext(cmd), subscriber, publisher)
 }
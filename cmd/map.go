@@ -17,7 +17,10 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/database"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/mapper"
 	"github.com/munnik/gosk/message"
@@ -40,14 +43,39 @@ func init() {
 	mapCmd.MarkFlagRequired("subscribeURL")
 	mapCmd.Flags().StringVarP(&publishURL, "publishURL", "p", "", "Nanomsg URL, the URL is used to publish the data on. It listens for connections.")
 	mapCmd.MarkFlagRequired("publishURL")
+	mapCmd.Flags().StringVarP(&deadLetterURL, "deadLetterURL", "d", "", "Nanomsg URL, the URL is used to publish the messages that could not be mapped or are rejected. It listens for connections.")
+	mapCmd.Flags().StringVar(&deadLetterFormat, "deadLetterFormat", "", "format of the published dead letters, json or binary, the publish format is used when empty")
+}
+
+// a mapper of raw data and a mapper of signalk data, the mapper for the protocol has to be one of these
+type rawMapper interface {
+	mapper.Mapper[message.Raw, message.Mapped]
+	mapper.RealMapper[message.Raw]
+	SetDeadLetters(*mapper.DeadLetters)
+}
+
+type mappedMapper interface {
+	mapper.Mapper[message.Mapped, message.Mapped]
+	mapper.RealMapper[message.Mapped]
+	SetDeadLetters(*mapper.DeadLetters)
 }
 
 func doMap(cmd *cobra.Command, args []string) {
-	publisher := nanomsg.NewPublisher[message.Mapped](publishURL)
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
 
 	c := config.NewMapperConfig(cfgFile)
-	switch c.Protocol {
-	case config.CSVType:
+	deadLetters, stopDeadLetters := enableDeadLetters("map/" + c.Protocol)
+	defer stopDeadLetters()
+	rm, mm, _, err := newMapper(c)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Error while creating the mapper",
+			zap.String("Config file", cfgFile),
+			zap.String("Protocol", c.Protocol),
+			zap.String("Error", err.Error()),
+		)
+	}
+	if rm != nil {
 		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
 		if err != nil {
 			logger.GetLogger().Fatal(
@@ -56,155 +84,85 @@ func doMap(cmd *cobra.Command, args []string) {
 				zap.String("Error", err.Error()),
 			)
 		}
-		c2 := config.NewCSVMapperConfig(cfgFile)
+		rm.SetDeadLetters(deadLetters)
+		rm.Map(commandContext(cmd), subscriber, publisher)
+		return
+	}
+	subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not subscribe",
+			zap.String("URL", subscribeURL),
+			zap.String("Error", err.Error()),
+		)
+	}
+	mm.SetDeadLetters(deadLetters)
+	mm.Map(commandContext(cmd), subscriber, publisher)
+}
+
+// Creates the mapper for the protocol, either the raw or the mapped mapper is returned, the mappings are the paths the mapper maps to
+func newMapper(c config.MapperConfig) (rawMapper, mappedMapper, []string, error) {
+	mappings := make([]string, 0)
+	switch c.Protocol {
+	case config.CSVType:
 		cmc := config.NewCSVMappingConfig(cfgFile)
-		m, err := mapper.NewCSVMapper(c2, cmc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
+		for _, m := range cmc {
+			mappings = append(mappings, m.Path)
 		}
-		m.Map(subscriber, publisher)
+		m, err := mapper.NewCSVMapper(config.NewCSVMapperConfig(cfgFile), cmc)
+		return m, nil, mappings, err
 	case config.JSONType:
-		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
 		jmc := config.NewJSONMappingConfig(cfgFile)
-		m, err := mapper.NewJSONMapper(c, jmc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
+		for _, m := range jmc {
+			mappings = append(mappings, m.Path)
 		}
-		m.Map(subscriber, publisher)
+		m, err := mapper.NewJSONMapper(c, jmc)
+		return m, nil, mappings, err
 	case config.ModbusType:
-		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
 		rmc := config.NewModbusMappingsConfig(cfgFile)
-		m, err := mapper.NewModbusMapper(c, rmc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
+		for _, m := range rmc {
+			mappings = append(mappings, m.Path)
 		}
-		m.Map(subscriber, publisher)
+		m, err := mapper.NewModbusMapper(c, rmc)
+		return m, nil, mappings, err
 	case config.NMEA0183Type:
-		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
 		m, err := mapper.NewNmea0183Mapper(c)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
-		}
-		m.Map(subscriber, publisher)
+		return m, nil, m.Paths(), err
 	case config.CanBusType:
-		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
-		c2 := config.NewCanBusMapperConfig(cfgFile)
 		cmc := config.NewCanBusMappingConfig(cfgFile)
-		m, err := mapper.NewCanBusMapper(c2, cmc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
-		}
-		m.Map(subscriber, publisher)
-	case config.SignalKType:
-		subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
-		amc := config.NewExpressionMappingConfig(cfgFile)
-		m, err := mapper.NewAggregateMapper(c, amc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
+		for _, m := range cmc {
+			mappings = append(mappings, m.Path)
 		}
-		m.Map(subscriber, publisher)
-	case config.FftType:
-		subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
-		fftc := config.NewFftConfig(cfgFile)
-		m, err := mapper.NewFftMapper(c, fftc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
-		}
-		m.Map(subscriber, publisher)
+		m, err := mapper.NewCanBusMapper(config.NewCanBusMapperConfig(cfgFile), cmc)
+		return m, nil, mappings, err
 	case config.BinaryType:
-		subscriber, err := nanomsg.NewSubscriber[message.Raw](subscribeURL, []byte{})
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Could not subscribe",
-				zap.String("URL", subscribeURL),
-				zap.String("Error", err.Error()),
-			)
-		}
 		mc := config.NewMappingConfig(cfgFile)
+		for _, m := range mc {
+			mappings = append(mappings, m.Path)
+		}
 		m, err := mapper.NewBinaryMapper(c, mc)
-		if err != nil {
-			logger.GetLogger().Fatal(
-				"Error while creating the mapper",
-				zap.String("Config file", cfgFile),
-				zap.String("Error", err.Error()),
-			)
+		return m, nil, mappings, err
+	case config.SignalKType:
+		amc := config.NewExpressionMappingConfig(cfgFile)
+		for _, m := range amc {
+			mappings = append(mappings, m.Path)
 		}
-		m.Map(subscriber, publisher)
-	default:
-		logger.GetLogger().Fatal(
-			"Not a supported protocol",
-			zap.String("Protocol", c.Protocol),
-		)
-		return
+		m, err := mapper.NewAggregateMapper(c, amc)
+		return nil, m, mappings, err
+	case config.FftType:
+		m, err := mapper.NewFftMapper(c, config.NewFftConfig(cfgFile))
+		return nil, m, m.Paths(), err
+	case config.DerivedType:
+		m, err := mapper.NewDerivedMapper(c, config.NewDerivedConfig(cfgFile))
+		return nil, m, m.Paths(), err
+	case config.AlarmType:
+		ac := config.NewAlarmsConfig(cfgFile)
+		var history mapper.AlarmHistory
+		if ac.PostgresqlConfig.URLString != "" {
+			history = database.NewPostgresqlDatabase(ac.PostgresqlConfig)
+		}
+		m, err := mapper.NewAlarmMapper(c, ac, history)
+		return nil, m, m.Paths(), err
 	}
+	return nil, nil, nil, fmt.Errorf("not a supported protocol %s", c.Protocol)
 }
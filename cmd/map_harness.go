@@ -0,0 +1,202 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	mapTestCmd = &cobra.Command{
+		Use:   "test",
+		Short: "Test a mapping file with recorded data",
+		Long: `Run the configured mapper offline over recorded raw or mapped messages and compare the output with the expected output,
+the uuids are ignored. The coverage of the mappings is printed, the command exits with a non zero exit code when the output differs`,
+		Run: doMapTest,
+	}
+	inputFile        string
+	expectFile       string
+	updateExpected   bool
+	ignoreTimestamps bool
+)
+
+func init() {
+	mapCmd.AddCommand(mapTestCmd)
+	mapTestCmd.Flags().StringVarP(&inputFile, "input", "i", "", "File with the recorded messages, one json message per line.")
+	mapTestCmd.MarkFlagRequired("input")
+	mapTestCmd.Flags().StringVarP(&expectFile, "expect", "e", "", "File with the expected mapped messages, one json message per line.")
+	mapTestCmd.MarkFlagRequired("expect")
+	mapTestCmd.Flags().BoolVar(&updateExpected, "update", false, "Rewrite the file with the expected messages with the output of the mapper.")
+	mapTestCmd.Flags().BoolVar(&ignoreTimestamps, "ignoreTimestamps", false, "Ignore the timestamps when comparing the output.")
+}
+
+func doMapTest(cmd *cobra.Command, args []string) {
+	c := config.NewMapperConfig(cfgFile)
+	rm, mm, mappings, err := newMapper(c)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Error while creating the mapper",
+			zap.String("Config file", cfgFile),
+			zap.String("Protocol", c.Protocol),
+			zap.String("Error", err.Error()),
+		)
+	}
+	var report *mapper.HarnessReport
+	if rm != nil {
+		report = mapper.NewHarness[message.Raw](rm, mappings).Run(readMessages[message.Raw](inputFile))
+	} else {
+		report = mapper.NewHarness[message.Mapped](mm, mappings).Run(readMessages[message.Mapped](inputFile))
+	}
+	printCoverage(report)
+
+	if updateExpected {
+		writeMessages(expectFile, report.Output)
+		fmt.Printf("%d messages written to %s\n", len(report.Output), expectFile)
+		return
+	}
+	diff, err := mapper.DiffMapped(readMessages[message.Mapped](expectFile), report.Output, ignoreTimestamps)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not compare the output",
+			zap.String("Error", err.Error()),
+		)
+	}
+	for _, d := range diff {
+		fmt.Println(d)
+	}
+	if len(diff) > 0 {
+		fmt.Printf("%d of %d messages differ\n", len(diff), len(report.Output))
+		os.Exit(1)
+	}
+	fmt.Printf("%d messages match\n", len(report.Output))
+}
+
+func printCoverage(report *mapper.HarnessReport) {
+	fmt.Println("Mapped values per path:")
+	for _, path := range sortedKeys(report.Fired) {
+		fmt.Printf("  %6d %s\n", report.Fired[path], path)
+	}
+	if len(report.NeverFired) > 0 {
+		fmt.Println("Mappings that never fired:")
+		for _, path := range report.NeverFired {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if len(report.Errors) > 0 {
+		fmt.Println("Errors per mapping:")
+		for _, mapping := range sortedKeys(report.Errors) {
+			name := mapping
+			if name == "" {
+				name = "(no mapping)"
+			}
+			fmt.Printf("  %6d %s, last error: %s\n", report.Errors[mapping], name, report.LastErrors[mapping])
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// one json message per line, empty lines are skipped
+func readMessages[T nanomsg.Message](path string) []*T {
+	f, err := os.Open(path)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not open the file",
+			zap.String("File", path),
+			zap.String("Error", err.Error()),
+		)
+	}
+	defer f.Close()
+
+	result := make([]*T, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var m T
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			logger.GetLogger().Fatal(
+				"Could not read the message",
+				zap.String("File", path),
+				zap.Int("Line", line),
+				zap.String("Error", err.Error()),
+			)
+		}
+		result = append(result, &m)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.GetLogger().Fatal(
+			"Could not read the file",
+			zap.String("File", path),
+			zap.String("Error", err.Error()),
+		)
+	}
+	return result
+}
+
+func writeMessages(path string, messages []*message.Mapped) {
+	f, err := os.Create(path)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not create the file",
+			zap.String("File", path),
+			zap.String("Error", err.Error()),
+		)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, m := range messages {
+		line, err := mapper.NormalizeMapped(m, false)
+		if err != nil {
+			logger.GetLogger().Fatal(
+				"Could not write the message",
+				zap.String("File", path),
+				zap.String("Error", err.Error()),
+			)
+		}
+		fmt.Fprintln(w, line)
+	}
+	if err := w.Flush(); err != nil {
+		logger.GetLogger().Fatal(
+			"Could not write the file",
+			zap.String("File", path),
+			zap.String("Error", err.Error()),
+		)
+	}
+}
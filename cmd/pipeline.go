@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Filter, rate limit and map data in one process",
+	Long:  `Chain filters, rate limiters and mappers of signalk data in one process, only the result of the last stage is published`,
+	Run:   doPipeline,
+}
+
+func init() {
+	rootCmd.AddCommand(pipelineCmd)
+	pipelineCmd.Flags().StringVarP(&subscribeURL, "subscribeURL", "s", "", "Nanomsg URL, the URL is used to listen for subscribed data.")
+	pipelineCmd.MarkFlagRequired("subscribeURL")
+	pipelineCmd.Flags().StringVarP(&publishURL, "publishURL", "p", "", "Nanomsg URL, the URL is used to publish the data on. It listens for connections.")
+	pipelineCmd.MarkFlagRequired("publishURL")
+}
+
+func doPipeline(cmd *cobra.Command, args []string) {
+	subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not subscribe",
+			zap.String("URL", subscribeURL),
+			zap.String("Error", err.Error()),
+		)
+	}
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
+	c := config.NewPipelineConfig(cfgFile)
+	p, err := mapper.NewPipelineFromConfig(c)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Error while creating the pipeline",
+			zap.String("Config file", cfgFile),
+			zap.String("Error", err.Error()),
+		)
+	}
+	p.Map(commandContext(cmd), subscriber, publisher)
+}
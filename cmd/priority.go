@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var priorityCmd = &cobra.Command{
+	Use:   "priority",
+	Short: "Pass the values of the preferred source",
+	Long:  `Pass only the values of the highest priority source that is fresh, fail over to another source when it goes stale`,
+	Run:   doPriority,
+}
+
+func init() {
+	rootCmd.AddCommand(priorityCmd)
+	priorityCmd.Flags().StringVarP(&subscribeURL, "subscribeURL", "s", "", "Nanomsg URL, the URL is used to listen for subscribed data.")
+	priorityCmd.MarkFlagRequired("subscribeURL")
+	priorityCmd.Flags().StringVarP(&publishURL, "publishURL", "p", "", "Nanomsg URL, the URL is used to publish the data on. It listens for connections.")
+	priorityCmd.MarkFlagRequired("publishURL")
+}
+
+func doPriority(cmd *cobra.Command, args []string) {
+	subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not subscribe",
+			zap.String("URL", subscribeURL),
+			zap.String("Error", err.Error()),
+		)
+	}
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
+	c := config.NewSourcePrioritiesConfig(cfgFile)
+	f, _ := mapper.NewSourcePriorityFilter(c)
+	f.Map(commandContext(cmd), subscriber, publisher)
+}
@@ -17,18 +17,28 @@ limitations under the License.
 package cmd
 
 import (
-	"sync"
+	"context"
+	"os"
+	ossignal "os/signal"
+	"slices"
+	"syscall"
+	"time"
 
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/nanomsg"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 var (
 	proxyCmd = &cobra.Command{
 		Use:   "proxy",
 		Short: "Proxy for Nanomsg",
-		Long:  `This proxy can connect to multiple publishers and serve multiple subscribers`,
-		Run:   doProxy,
+		Long: `This proxy can connect to multiple publishers and serve multiple subscribers. The optional config file
+adds upstreams, include and exclude rules and context rewrites, it is reloaded on a SIGHUP so upstreams
+can be added and removed without restarting.`,
+		Run: doProxy,
 	}
 	proxySubscribeURLs []string
 )
@@ -41,12 +51,94 @@ func init() {
 }
 
 func doProxy(cmd *cobra.Command, args []string) {
+	c := config.NewProxyConfig(cfgFile)
 	proxy := nanomsg.NewProxy(publishURL)
 	defer proxy.Close()
-	var wg sync.WaitGroup
-	wg.Add(len(proxySubscribeURLs))
-	for _, proxySubscribeURL := range proxySubscribeURLs {
-		go proxy.SubscribeTo(proxySubscribeURL, &wg)
+	if serveSnapshotURL != "" {
+		if err := proxy.ServeSnapshot(serveSnapshotURL); err != nil {
+			logger.GetLogger().Fatal(
+				"Could not serve the snapshot on the URL",
+				zap.String("URL", serveSnapshotURL),
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+	applyProxyConfig(proxy, c)
+	if len(proxy.Upstreams()) == 0 && c.ConfigFile == "" {
+		logger.GetLogger().Fatal("No upstreams were configured, use subscribeURL or a config file with upstreams")
+	}
+	reloadProxyConfig(commandContext(cmd), proxy, c.ReloadConfig)
+}
+
+func applyProxyConfig(proxy *nanomsg.Proxy, c *config.ProxyConfig) {
+	rules := make([]nanomsg.ProxyRule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		rules = append(rules, nanomsg.ProxyRule{
+			Exclude:   r.Action == config.ProxyRuleExclude,
+			Context:   r.Context,
+			Path:      r.Path,
+			Connector: r.Connector,
+			Type:      r.Type,
+		})
+	}
+	rewrites := make(map[string]string, len(c.ContextRewrites))
+	for _, r := range c.ContextRewrites {
+		rewrites[r.From] = r.To
+	}
+	proxy.SetFilter(nanomsg.NewProxyFilter(rules, rewrites))
+	proxy.SetLivenessTimeout(c.LivenessTimeout)
+
+	upstreams := slices.Clone(proxySubscribeURLs)
+	for _, u := range c.Upstreams {
+		if !slices.Contains(upstreams, u) {
+			upstreams = append(upstreams, u)
+		}
+	}
+	proxy.SetUpstreams(upstreams)
+}
+
+// Reloads the configuration on a SIGHUP and when the config file changes, blocks until the context is done
+func reloadProxyConfig(ctx context.Context, proxy *nanomsg.Proxy, c config.ReloadConfig) {
+	signals := make(chan os.Signal, 1)
+	ossignal.Notify(signals, syscall.SIGHUP)
+	var tick <-chan time.Time
+	var modTime time.Time
+	if c.ConfigFile != "" && c.WatchInterval > 0 {
+		if info, err := os.Stat(c.ConfigFile); err == nil {
+			modTime = info.ModTime()
+		}
+		ticker := time.NewTicker(c.WatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-tick:
+			info, err := os.Stat(c.ConfigFile)
+			if err != nil || !info.ModTime().After(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+		}
+		if c.ConfigFile == "" {
+			continue
+		}
+		reloaded, err := config.LoadProxyConfig(c.ConfigFile)
+		if err != nil {
+			logger.GetLogger().Warn(
+				"Rejected the new configuration, keeping the running configuration",
+				zap.String("Config file", c.ConfigFile),
+				zap.String("Error", err.Error()),
+			)
+			continue
+		}
+		applyProxyConfig(proxy, reloaded)
+		logger.GetLogger().Info(
+			"Reloaded the configuration",
+			zap.String("Config file", c.ConfigFile),
+		)
 	}
-	wg.Wait()
 }
@@ -34,8 +34,8 @@ func doRateLimit(cmd *cobra.Command, args []string) {
 			zap.String("Error", err.Error()),
 		)
 	}
-	publisher := nanomsg.NewPublisher[message.Mapped](publishURL)
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
 	c := config.NewRateLimitConfig(cfgFile)
 	f, _ := mapper.NewRateLimitFilter(c)
-	f.Map(subscriber, publisher)
+	f.Map(commandContext(cmd), subscriber, publisher)
 }
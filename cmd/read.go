@@ -49,5 +49,6 @@ func init() {
 func doMQTTRead(cmd *cobra.Command, args []string) {
 	c := config.NewMQTTConfig(cfgFile)
 	r := reader.NewMqttReader(c)
-	r.ReadMapped(nanomsg.NewPublisher[message.Mapped](publishURL))
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
+	r.ReadMapped(commandContext(cmd), publisher)
 }
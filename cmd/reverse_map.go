@@ -39,12 +39,16 @@ func init() {
 	reverseMapCmd.MarkFlagRequired("subscribeURL")
 	reverseMapCmd.Flags().StringVarP(&publishURL, "publishURL", "p", "", "Nanomsg URL, the URL is used to publish the data on. It listens for connections.")
 	reverseMapCmd.MarkFlagRequired("publishURL")
+	reverseMapCmd.Flags().StringVarP(&deadLetterURL, "deadLetterURL", "d", "", "Nanomsg URL, the URL is used to publish the messages that could not be mapped or are rejected. It listens for connections.")
+	reverseMapCmd.Flags().StringVar(&deadLetterFormat, "deadLetterFormat", "", "format of the published dead letters, json or binary, the publish format is used when empty")
 }
 
 func doReverseMap(cmd *cobra.Command, args []string) {
-	publisher := nanomsg.NewPublisher[message.Raw](publishURL)
+	publisher := nanomsg.NewPublisher[message.Raw](publishURL, publisherFormat[message.Raw]())
 
 	c := config.NewMapperConfig(cfgFile)
+	deadLetters, stopDeadLetters := enableDeadLetters("reverseMap/" + c.Protocol)
+	defer stopDeadLetters()
 	switch c.Protocol {
 	case config.ModbusType:
 		subscriber, err := nanomsg.NewSubscriber[message.Mapped](subscribeURL, []byte{})
@@ -64,7 +68,8 @@ func doReverseMap(cmd *cobra.Command, args []string) {
 				zap.String("Error", err.Error()),
 			)
 		}
-		m.Map(subscriber, publisher)
+		m.SetDeadLetters(deadLetters)
+		m.Map(commandContext(cmd), subscriber, publisher)
 	default:
 		logger.GetLogger().Fatal(
 			"Not a supported protocol",
@@ -17,11 +17,20 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/nanomsg"
 	"github.com/munnik/gosk/version"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -37,6 +46,17 @@ var (
 	profilingAndMetricsPort string
 	subscribeURL            string
 	publishURL              string
+	publishFormat           string
+	publishTopicKey         string
+	subscribeTopics         []string
+	dropPolicy              string
+	spillDirectory          string
+	spillMaxBytes           int64
+	serveSnapshotURL        string
+	snapshotURL             string
+	snapshotMaxAge          time.Duration
+	shutdownTimeout         time.Duration
+	unhealthyAfter          time.Duration
 	gosk_info_gauge         prometheus.Gauge
 )
 
@@ -55,7 +75,19 @@ data can be published in different ways (e.g. HTTP or Websocket).`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleSignals(cancel)
+	var shutdown atomic.Int64
+	context.AfterFunc(ctx, func() { shutdown.Store(time.Now().UnixNano()) })
+	health.Register("shutdown", func() error {
+		if since := shutdown.Load(); since != 0 {
+			return health.FailingSince(time.Unix(0, since), errors.New("shutting down"))
+		}
+		return nil
+	})
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		logger.GetLogger().Fatal(
 			"Could not execute the Cobra root command",
 			zap.String("Error", err.Error()),
@@ -63,9 +95,55 @@ func Execute() {
 	}
 }
 
+type startedKey struct{}
+
+// The context of the command, commands call this when they have read their flags. The run command starts the next component
+// in this process when it is called, the flags change then.
+func commandContext(cmd *cobra.Command) context.Context {
+	ctx := cmd.Context()
+	if started, ok := ctx.Value(startedKey{}).(func()); ok {
+		started()
+	}
+	return ctx
+}
+
+// The first SIGINT or SIGTERM cancels the context of the command so it stops receiving and sends or writes the data it
+// already received. The process exits when the command doesn't stop within the shutdown timeout or when a second signal
+// is received.
+func handleSignals(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	s := <-signals
+	logger.GetLogger().Info(
+		"Received a signal from the OS to stop the application, shutting down",
+		zap.String("Signal", s.String()),
+		zap.Duration("Shutdown timeout", shutdownTimeout),
+	)
+	cancel()
+
+	select {
+	case s = <-signals:
+		logger.GetLogger().Error(
+			"Received a second signal, stopping immediately",
+			zap.String("Signal", s.String()),
+		)
+	case <-time.After(shutdownTimeout):
+		logger.GetLogger().Error(
+			"Could not shut down within the shutdown timeout, stopping immediately",
+			zap.Duration("Shutdown timeout", shutdownTimeout),
+		)
+	}
+	os.Exit(1)
+}
+
 func init() {
 	cobra.OnInitialize(
 		initConfig,
+		initSchema,
+		initPublishFormat,
+		initTopics,
+		initDropPolicy,
+		initSnapshot,
 		initProfilingAndMetrics,
 	)
 
@@ -74,7 +152,19 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "path to config file")
-	rootCmd.PersistentFlags().StringVar(&profilingAndMetricsPort, "pmport", "", "port to run the http server for pprof and prometheus")
+	rootCmd.PersistentFlags().StringVar(&schemaFile, "schema", "", "path to a file with SignalK paths that are added to the built in schema")
+	rootCmd.PersistentFlags().StringVar(&publishFormat, "publishFormat", nanomsg.FormatNameJSON, "format of the messages published on the publish URL, json or binary, subscribers accept both formats")
+	rootCmd.PersistentFlags().StringVar(&publishTopicKey, "publishTopic", "", "routing key that is put in front of the published messages, message, context, path, connector or type")
+	rootCmd.PersistentFlags().StringSliceVar(&subscribeTopics, "topic", []string{}, "only receive the messages with a routing key that starts with one of these topics, e.g. navigation.")
+	rootCmd.PersistentFlags().StringVar(&dropPolicy, "dropPolicy", "", "what subscribers do when their buffer is full, block, dropNewest, dropOldest or spill, each command has its own default")
+	rootCmd.PersistentFlags().StringVar(&spillDirectory, "spillDirectory", "", "directory for the messages of subscribers with the spill policy, the temporary directory is used when empty")
+	rootCmd.PersistentFlags().Int64Var(&spillMaxBytes, "spillMaxBytes", 1<<30, "maximum size of the spilled messages of a subscriber, messages are dropped when the size is reached, the file can grow to twice this size")
+	rootCmd.PersistentFlags().StringVar(&serveSnapshotURL, "serveSnapshotURL", "", "Nanomsg URL, the last value of each context and path is served on this URL so subscribers that start late get the current state")
+	rootCmd.PersistentFlags().DurationVar(&snapshotMaxAge, "snapshotMaxAge", time.Hour, "values that are not updated for this long are removed from the served snapshot, they are kept forever when 0")
+	rootCmd.PersistentFlags().StringVar(&snapshotURL, "snapshotURL", "", "Nanomsg URL, subscribers fetch the last values from this URL before they receive the published data")
+	rootCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdownTimeout", 10*time.Second, "maximum time to send and write the received data after SIGINT or SIGTERM, the process stops immediately after this time or on a second signal")
+	rootCmd.PersistentFlags().StringVar(&profilingAndMetricsPort, "pmport", "", "port to run the http server for pprof, prometheus and the /healthz and /readyz endpoints")
+	rootCmd.PersistentFlags().DurationVar(&unhealthyAfter, "unhealthyAfter", 5*time.Minute, "the /healthz endpoint reports the command as unhealthy when a readiness check fails for this long")
 	gosk_info_gauge = promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_info", Help: "general information about this gosk process", ConstLabels: prometheus.Labels{"version": version.Version, "commit": version.Commit}})
 	gosk_info_gauge.Set(1)
 }
@@ -94,9 +184,99 @@ func initConfig() {
 	}
 }
 
+// the formats of the sockets of the command
+var publishSocketFormat, deadLetterSocketFormat nanomsg.Format
+
+func initPublishFormat() {
+	f, err := nanomsg.ParseFormat(publishFormat)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Invalid publish format",
+			zap.String("Error", err.Error()),
+		)
+	}
+	nanomsg.SetDefaultFormat(f)
+	publishSocketFormat = f
+	deadLetterSocketFormat = f
+	if deadLetterFormat != "" {
+		if deadLetterSocketFormat, err = nanomsg.ParseFormat(deadLetterFormat); err != nil {
+			logger.GetLogger().Fatal(
+				"Invalid dead letter format",
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+}
+
+// The format of the publisher on the publish URL of a command
+func publisherFormat[T nanomsg.Message]() nanomsg.PublisherOption[T] {
+	return nanomsg.WithPublisherFormat[T](publishSocketFormat)
+}
+
+func initTopics() {
+	k, err := nanomsg.ParseTopicKey(publishTopicKey)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Invalid publish topic",
+			zap.String("Error", err.Error()),
+		)
+	}
+	nanomsg.SetDefaultTopicKey(k)
+	nanomsg.SetDefaultTopics(subscribeTopics)
+}
+
+func initDropPolicy() {
+	// the default is set again when the flag is empty, a component that runs in the run process doesn't get the policy
+	// of the component that was started before it
+	p := nanomsg.DefaultDropPolicy
+	if dropPolicy != "" {
+		var err error
+		if p, err = nanomsg.ParseDropPolicy(dropPolicy); err != nil {
+			logger.GetLogger().Fatal(
+				"Invalid drop policy",
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+	nanomsg.SetDefaultDropPolicy(p)
+	nanomsg.SetSpill(spillDirectory, spillMaxBytes)
+}
+
+func initSnapshot() {
+	nanomsg.SetDefaultSnapshotServeURL(serveSnapshotURL)
+	nanomsg.SetDefaultSnapshotFetchURL(snapshotURL)
+	nanomsg.SetDefaultSnapshotMaxAge(snapshotMaxAge)
+}
+
+// The drop policy of the subscriber of a command, the policy from the flag is used when it is one of the allowed policies. The
+// default of the command is used when the flag is not set.
+func subscriberDropPolicy[T nanomsg.Message](componentDefault nanomsg.DropPolicy, allowed ...nanomsg.DropPolicy) nanomsg.SubscriberOption[T] {
+	if dropPolicy == "" {
+		return nanomsg.WithSubscriberDropPolicy[T](componentDefault)
+	}
+	p, _ := nanomsg.ParseDropPolicy(dropPolicy)
+	if len(allowed) == 0 {
+		return nanomsg.WithSubscriberDropPolicy[T](p)
+	}
+	for _, a := range allowed {
+		if p == a {
+			return nanomsg.WithSubscriberDropPolicy[T](p)
+		}
+	}
+	logger.GetLogger().Fatal(
+		"The drop policy is not allowed for this command",
+		zap.String("Drop policy", dropPolicy),
+		zap.Any("Allowed", allowed),
+	)
+	return nil
+}
+
 func initProfilingAndMetrics() {
 	if profilingAndMetricsPort != "" {
 		http.Handle("/metrics", promhttp.Handler())
+		health.SetUnhealthyAfter(unhealthyAfter)
+		http.Handle("/healthz", health.HealthHandler())
+		http.Handle("/readyz", health.ReadinessHandler())
 		go func() {
 			err := http.ListenAndServe(profilingAndMetricsPort, nil)
 			if err != nil {
@@ -0,0 +1,361 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/health"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/munnik/gosk/supervisor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run a pipeline of components from one config file",
+	Long: `Starts the connectors, mappers, filters, proxies and writers of the config file and wires them together,
+components only name the components they subscribe to. By default each component runs in a child process, the
+goroutine mode runs each component in a goroutine of this command. A component that stops is restarted with a
+backoff. The goroutine mode is only suitable for components that don't depend on process wide state: the
+components share the schema and the metrics registry, and a fatal error in a helper goroutine of a component
+stops only that goroutine so the supervisor doesn't restart the component. The status of the components and
+the combined metrics are served on the status address.
+
+Mangos sockets on sequential ports are used to connect the components unless a nats:// bus URL is
+configured, then a NATS server is started and all components publish and subscribe on it.`,
+	Run: doRun,
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
+
+func doRun(cmd *cobra.Command, args []string) {
+	c := config.NewRunConfig(cfgFile)
+
+	busURL := c.Bus.URL
+	var natsServer *nanomsg.NATSServer
+	if busURL != "" {
+		var err error
+		natsServer, err = nanomsg.StartNATSServer(busURL, c.Bus.StoreDirectory, c.Bus.MaxAge, 0)
+		if err != nil {
+			logger.GetLogger().Fatal(
+				"Could not start the NATS server",
+				zap.String("URL", busURL),
+				zap.String("Error", err.Error()),
+			)
+		}
+		busURL = natsServer.ClientURL()
+		logger.GetLogger().Info("NATS server is ready", zap.String("URL", busURL))
+	}
+
+	components, err := runComponents(c, busURL)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not wire the components",
+			zap.String("Config file", cfgFile),
+			zap.String("Error", err.Error()),
+		)
+	}
+	s := supervisor.NewSupervisor(components, c.MinBackoff, c.MaxBackoff, shutdownTimeout)
+	if c.StatusAddress != "" {
+		if err := s.Serve(c.StatusAddress); err != nil {
+			logger.GetLogger().Fatal(
+				"Could not serve the status",
+				zap.String("Address", c.StatusAddress),
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+	if c.Mode == config.RunModeGoroutine {
+		logger.GetLogger().Warn(
+			"The components run in goroutines and share the process wide state, use the process mode unless the components are independent",
+			zap.String("Config file", cfgFile),
+		)
+		// a fatal error of a component stops its goroutine instead of this process, the supervisor restarts the component
+		logger.SetLogger(logger.GetLogger().WithOptions(zap.WithFatalHook(zapcore.WriteThenGoexit)))
+		// a subscriber that is started before its publisher doesn't block the start of the other components
+		nanomsg.SetAsyncDial(true)
+	}
+	s.Start()
+	for _, component := range components {
+		health.Register("component "+component.Name, runComponentCheck(s, component.Name))
+	}
+
+	<-cmd.Context().Done()
+	logger.GetLogger().Info("Stopping the components")
+	s.Stop()
+	if natsServer != nil {
+		natsServer.Shutdown()
+	}
+}
+
+// the component is not ready when it is not running, e.g. when it waits to be restarted
+func runComponentCheck(s *supervisor.Supervisor, name string) health.Check {
+	return func() error {
+		for _, status := range s.Statuses() {
+			if status.Name != name || status.State == supervisor.StateRunning {
+				continue
+			}
+			if status.LastExit != "" {
+				return health.FailingSince(status.Since, fmt.Errorf("the component is %s, the last exit was %s", status.State, status.LastExit))
+			}
+			return health.FailingSince(status.Since, fmt.Errorf("the component is %s", status.State))
+		}
+		return nil
+	}
+}
+
+// the arguments of each component, the publishers get a url on the bus and the subscribers get the urls of the components
+// they subscribe to
+func runComponents(c *config.RunConfig, busURL string) ([]supervisor.Component, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]*cobra.Command, len(c.Components))
+	publishURLs := make(map[string]string, len(c.Components))
+	deadLetterURLs := make(map[string]string, len(c.Components))
+	port := c.Bus.BasePort
+	nextURL := func() string {
+		if busURL != "" {
+			return busURL
+		}
+		result := fmt.Sprintf("tcp://%s:%d", c.Bus.Host, port)
+		port++
+		return result
+	}
+	for i, rc := range c.Components {
+		words := strings.Fields(rc.Command)
+		found, rest, err := rootCmd.Find(words)
+		if err != nil || len(rest) > 0 || !found.Runnable() || found.Name() == "run" || found.Name() == "bus" {
+			return nil, fmt.Errorf("%s of component %s is not a command that can be run", rc.Command, rc.Name)
+		}
+		if busURL != "" && found == proxyCmd {
+			return nil, fmt.Errorf("component %s is a proxy, a NATS bus doesn't need a proxy", rc.Name)
+		}
+		commands[i] = found
+		if found.Flag("publishURL") != nil {
+			publishURLs[rc.Name] = nextURL()
+		}
+		if rc.DeadLetters {
+			if found.Flag("deadLetterURL") == nil {
+				return nil, fmt.Errorf("component %s does not publish dead letters", rc.Name)
+			}
+			deadLetterURLs[rc.Name] = nextURL()
+		}
+	}
+
+	result := make([]supervisor.Component, 0, len(c.Components))
+	for i, rc := range c.Components {
+		found := commands[i]
+		args := []string{}
+		if rc.ConfigFile != "" {
+			args = append(args, "--config", rc.ConfigFile)
+		}
+		if u, ok := publishURLs[rc.Name]; ok {
+			args = append(args, "--publishURL", u)
+		}
+		if u, ok := deadLetterURLs[rc.Name]; ok {
+			args = append(args, "--deadLetterURL", u)
+		}
+		formats, err := runFormats(rc, found)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, formats...)
+
+		subscribeURLs, err := runSubscribeURLs(rc, publishURLs, deadLetterURLs, busURL)
+		if err != nil {
+			return nil, err
+		}
+		if len(subscribeURLs) > 0 {
+			flag := found.Flag("subscribeURL")
+			if flag == nil {
+				return nil, fmt.Errorf("component %s does not subscribe", rc.Name)
+			}
+			if len(subscribeURLs) > 1 && flag.Value.Type() != "stringSlice" {
+				return nil, fmt.Errorf("component %s can only subscribe to one component, add a proxy", rc.Name)
+			}
+			for _, u := range subscribeURLs {
+				args = append(args, "--subscribeURL", u)
+			}
+		}
+
+		// the components get the same time to send and write the received data as this command
+		args = append(args, "--shutdownTimeout", shutdownTimeout.String())
+		component := supervisor.Component{Name: rc.Name, Path: executable}
+		if c.Mode == config.RunModeGoroutine {
+			args = append(args, rc.Args...)
+			component.Run = runInProcess(rc.Name, found, args)
+			component.Args = append(strings.Fields(rc.Command), args...)
+			result = append(result, component)
+			continue
+		}
+		if c.MetricsBasePort > 0 {
+			address := "127.0.0.1:" + strconv.Itoa(c.MetricsBasePort+i)
+			args = append(args, "--pmport", address)
+			component.MetricsURL = "http://" + address + "/metrics"
+		}
+		component.Args = append(append(strings.Fields(rc.Command), args...), rc.Args...)
+		result = append(result, component)
+	}
+	return result, nil
+}
+
+// the arguments of the formats of the sockets of the component
+func runFormats(rc *config.RunComponentConfig, found *cobra.Command) ([]string, error) {
+	result := []string{}
+	for _, f := range []struct {
+		key    string
+		format string
+		flag   string
+		socket string
+	}{
+		{"format", rc.Format, "publishFormat", "publishURL"},
+		{"deadLetterFormat", rc.DeadLetterFormat, "deadLetterFormat", "deadLetterURL"},
+	} {
+		if f.format == "" {
+			continue
+		}
+		if _, err := nanomsg.ParseFormat(f.format); err != nil {
+			return nil, fmt.Errorf("component %s: %w", rc.Name, err)
+		}
+		if found.Flag(f.socket) == nil || (f.socket == "deadLetterURL" && !rc.DeadLetters) {
+			return nil, fmt.Errorf("component %s has a %s but does not publish on a %s", rc.Name, f.key, f.socket)
+		}
+		result = append(result, "--"+f.flag, f.format)
+	}
+	return result, nil
+}
+
+func runSubscribeURLs(rc *config.RunComponentConfig, publishURLs map[string]string, deadLetterURLs map[string]string, busURL string) ([]string, error) {
+	if busURL != "" {
+		// the messages on the bus are selected by subject, not by the component that published them
+		if len(rc.Subscribe) == 0 && len(rc.Subjects) == 0 {
+			return nil, nil
+		}
+		if len(rc.Subjects) == 0 {
+			return []string{busURL}, nil
+		}
+		query := url.Values{"subject": rc.Subjects}
+		return []string{busURL + "?" + query.Encode()}, nil
+	}
+
+	result := make([]string, 0, len(rc.Subscribe))
+	for _, s := range rc.Subscribe {
+		if name, ok := strings.CutSuffix(s, config.RunDeadLettersSuffix); ok {
+			result = append(result, deadLetterURLs[name])
+			continue
+		}
+		u, ok := publishURLs[s]
+		if !ok {
+			return nil, fmt.Errorf("component %s subscribes to %s, which does not publish", rc.Name, s)
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+// the components that run in this process are started one by one because the commands read their flags from package variables
+var componentStart sync.Mutex
+
+// Runs the command of the component in this process, the flags get the values of the args like the flags of a child process.
+// The next component is started when the command has read its flags, see commandContext.
+func runInProcess(name string, found *cobra.Command, args []string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		componentStart.Lock()
+		defaultRegisterer := prometheus.DefaultRegisterer
+		started := sync.OnceFunc(func() {
+			prometheus.DefaultRegisterer = defaultRegisterer
+			componentStart.Unlock()
+		})
+		defer started()
+
+		if err := setComponentFlags(found, args); err != nil {
+			return err
+		}
+		for _, initialize := range []func(){initSchema, initPublishFormat, initTopics, initDropPolicy, initSnapshot} {
+			initialize()
+		}
+		prometheus.DefaultRegisterer = componentRegisterer{prometheus.WrapRegistererWith(prometheus.Labels{"component": name}, defaultRegisterer)}
+		found.SetContext(context.WithValue(ctx, startedKey{}, started))
+		found.Run(found, found.Flags().Args())
+		return nil
+	}
+}
+
+// sets all flags of the command to their default and parses the args
+func setComponentFlags(found *cobra.Command, args []string) error {
+	// merges the persistent flags of the root command into the flags of the command
+	found.InheritedFlags()
+	found.Flags().VisitAll(func(f *pflag.Flag) {
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			defaults := []string{}
+			if d := strings.Trim(f.DefValue, "[]"); d != "" {
+				defaults = strings.Split(d, ",")
+			}
+			v.Replace(defaults)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	if err := found.ParseFlags(args); err != nil {
+		return err
+	}
+	return found.ValidateRequiredFlags()
+}
+
+// Registers the metrics of a component that runs in this process with a component label, the metrics of a previous run of
+// the component are replaced
+type componentRegisterer struct {
+	prometheus.Registerer
+}
+
+func (r componentRegisterer) Register(c prometheus.Collector) error {
+	err := r.Registerer.Register(c)
+	var existing prometheus.AlreadyRegisteredError
+	if errors.As(err, &existing) {
+		r.Registerer.Unregister(existing.ExistingCollector)
+		return r.Registerer.Register(c)
+	}
+	return err
+}
+
+func (r componentRegisterer) MustRegister(collectors ...prometheus.Collector) {
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"go.uber.org/zap"
+)
+
+var schemaFile string
+
+// adds the paths of the schema file to the built in SignalK schema
+func initSchema() {
+	if schemaFile == "" {
+		return
+	}
+	c := config.NewSchemaConfig(schemaFile)
+	s := message.DefaultSchema()
+	for _, p := range c.Paths {
+		kind := message.Kind(p.Type)
+		if existing, ok := s.Lookup(p.Path); ok && kind == "" {
+			kind = existing.Kind
+		}
+		if kind != "" && !kind.Valid() {
+			logger.GetLogger().Fatal(
+				"Unknown type in the schema",
+				zap.String("Path", p.Path),
+				zap.String("Type", p.Type),
+			)
+		}
+		zones := make([]message.Zone, 0, len(p.Zones))
+		for _, z := range p.Zones {
+			zones = append(zones, message.Zone{Lower: z.Lower, Upper: z.Upper, State: z.State, Message: z.Message})
+		}
+		s.Add(&message.PathSchema{
+			Path: p.Path,
+			Kind: kind,
+			Meta: message.Meta{Units: p.Units, Description: p.Description, DisplayName: p.DisplayName, Zones: zones},
+		})
+	}
+	message.SetSchema(s)
+	logger.GetLogger().Info(
+		"Schema file used",
+		zap.String("File", schemaFile),
+	)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
-	"sync"
 	"time"
 
 	"github.com/expr-lang/expr"
@@ -51,17 +50,27 @@ func init() {
 
 func doTest(cmd *cobra.Command, args []string) {
 	sendBuffer := make(chan *message.Mapped, bufferCapacity)
-	defer close(sendBuffer)
-	publisher := nanomsg.NewPublisher[message.Mapped](publishURL)
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
 	go publisher.Send(sendBuffer)
+	defer func() {
+		close(sendBuffer)
+		<-publisher.Done()
+	}()
 
 	c := config.NewTestDataConfig(cfgFile)
 	ticker := time.NewTicker(c.Delay)
-	var wg sync.WaitGroup
-	wg.Add(1)
+	defer ticker.Stop()
+	ctx := commandContext(cmd)
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		i := 0
-		for range ticker.C {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 			result := message.NewMapped().WithContext(c.Context).WithOrigin(c.Context)
 			s := message.NewSource().WithLabel("sampleData").WithType("sampleData").WithUuid(uuid.New())
 			u := message.NewUpdate().WithSource(*s).WithTimestamp(time.Now())
@@ -87,22 +96,32 @@ func doTest(cmd *cobra.Command, args []string) {
 			sendBuffer <- result
 		}
 	}()
-	wg.Wait()
+	<-stopped
 }
 
 func doRawTest(cmd *cobra.Command, args []string) {
 	sendBuffer := make(chan *message.Raw, bufferCapacity)
-	defer close(sendBuffer)
-	publisher := nanomsg.NewPublisher[message.Raw](publishURL)
+	publisher := nanomsg.NewPublisher[message.Raw](publishURL, publisherFormat[message.Raw]())
 	go publisher.Send(sendBuffer)
+	defer func() {
+		close(sendBuffer)
+		<-publisher.Done()
+	}()
 
 	c := config.NewTestDataConfig(cfgFile)
 	ticker := time.NewTicker(c.Delay)
-	var wg sync.WaitGroup
-	wg.Add(1)
+	defer ticker.Stop()
+	ctx := commandContext(cmd)
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		i := 0
-		for range ticker.C {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 			for _, path := range c.Paths {
 				result := message.NewRaw().WithConnector("sampleData").WithType("sample")
 
@@ -143,7 +162,7 @@ func doRawTest(cmd *cobra.Command, args []string) {
 			i++
 		}
 	}()
-	wg.Wait()
+	<-stopped
 }
 func runExpr(vm vm.VM, env map[string]interface{}, mappingConfig config.MappingConfig) (interface{}, error) {
 	if mappingConfig.CompiledExpression == nil {
@@ -172,7 +191,7 @@ func runExpr(vm vm.VM, env map[string]interface{}, mappingConfig config.MappingC
 
 	// the value is a map so we could try to decode it
 	if m, ok := output.(map[string]interface{}); ok {
-		if decoded, err := message.Decode(m); err == nil {
+		if decoded, err := message.GetSchema().Decode(mappingConfig.Path, m); err == nil {
 			output = decoded
 		}
 	}
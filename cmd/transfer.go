@@ -40,11 +40,12 @@ func init() {
 func doTransferRequest(cmd *cobra.Command, args []string) {
 	c := config.NewTransferConfig(cfgFile)
 	w := transfer.NewTransferRequester(c)
-	w.Run()
+	w.Run(commandContext(cmd))
 }
 
 func doTransferRespond(cmd *cobra.Command, args []string) {
 	c := config.NewTransferConfig(cfgFile)
 	w := transfer.NewTransferResponder(c)
-	w.Run(nanomsg.NewPublisher[message.Mapped](publishURL))
+	publisher := nanomsg.NewPublisher[message.Mapped](publishURL, publisherFormat[message.Mapped]())
+	w.Run(commandContext(cmd), publisher)
 }
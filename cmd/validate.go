@@ -0,0 +1,55 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/mapper"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate a config file",
+	Long: `Detect which component the config file is for and check it without running the component, unknown keys,
+expressions that don't compile, paths that are not in the SignalK schema and invalid Modbus requests are reported. Paths
+that are not in the SignalK specification or in SIGNALK_PATHS.md have to be added to the schema file.`,
+	Run: doValidate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+func doValidate(cmd *cobra.Command, args []string) {
+	if cfgFile == "" {
+		fmt.Fprintln(os.Stderr, "the config file is not set")
+		os.Exit(2)
+	}
+	component, errors := config.Validate(cfgFile, mapper.CheckExpression)
+	for _, e := range errors {
+		fmt.Println(e.Error())
+	}
+	if len(errors) > 0 {
+		fmt.Printf("%s: %d errors found in the %s config\n", cfgFile, len(errors), component)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: valid %s config\n", cfgFile, component)
+}
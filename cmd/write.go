@@ -53,6 +53,12 @@ var (
 		Long:  `Store mapped messages in the timeseries database`,
 		Run:   doWriteDatabaseMapped,
 	}
+	writeDatabaseDeadLetterCmd = &cobra.Command{
+		Use:   "deadletter",
+		Short: "Store dead letters in the timeseries database",
+		Long:  `Store the messages that could not be mapped or are rejected by a filter in the timeseries database`,
+		Run:   doWriteDatabaseDeadLetter,
+	}
 	writeMQTTCmd = &cobra.Command{
 		Use:   "mqtt",
 		Short: "Write messages to a broker",
@@ -112,6 +118,9 @@ func init() {
 	writeDatabaseCmd.AddCommand(writeDatabaseMappedCmd)
 	writeDatabaseMappedCmd.Flags().StringVarP(&subscribeURL, "subscribeURL", "s", "", "Nanomsg URL, the URL is used to listen for subscribed data.")
 	writeDatabaseMappedCmd.MarkFlagRequired("subscribeURL")
+	writeDatabaseCmd.AddCommand(writeDatabaseDeadLetterCmd)
+	writeDatabaseDeadLetterCmd.Flags().StringVarP(&subscribeURL, "subscribeURL", "s", "", "Nanomsg URL, the URL is used to listen for subscribed data.")
+	writeDatabaseDeadLetterCmd.MarkFlagRequired("subscribeURL")
 
 	writeCmd.AddCommand(writeMQTTCmd)
 	writeMQTTCmd.Flags().StringVarP(&subscribeURL, "subscribeURL", "s", "", "Nanomsg URL, the URL is used to listen for subscribed data.")
@@ -148,6 +157,8 @@ func doWriteDatabaseRaw(cmd *cobra.Command, args []string) {
 		nanomsg.WithSubscriberReceivedCounter[message.Raw](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_received_total", Help: "total number of received nano messages"})),
 		nanomsg.WithSubscriberUnmarshalledCounter[message.Raw](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_unmarshalled_total", Help: "total number of unmarshalled nano messages"})),
 		nanomsg.WithSubscriberBufferSizeGauge[message.Raw](promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_psql_messages_buffer_size", Help: "fill percentage of the subscriber buffer"})),
+		// the database writer never drops messages, blocking would let the socket drop them while the database is slow
+		subscriberDropPolicy[message.Raw](nanomsg.DropPolicySpill, nanomsg.DropPolicySpill, nanomsg.DropPolicyBlock),
 	)
 	if err != nil {
 		logger.GetLogger().Fatal(
@@ -158,7 +169,7 @@ func doWriteDatabaseRaw(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewPostgresqlConfig(cfgFile)
 	w := writer.NewPostgresqlWriter[message.Raw](c)
-	w.Write(subscriber)
+	w.Write(commandContext(cmd), subscriber)
 }
 
 func doWriteDatabaseMapped(cmd *cobra.Command, args []string) {
@@ -168,6 +179,8 @@ func doWriteDatabaseMapped(cmd *cobra.Command, args []string) {
 		nanomsg.WithSubscriberReceivedCounter[message.Mapped](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_received_total", Help: "total number of received nano messages"})),
 		nanomsg.WithSubscriberUnmarshalledCounter[message.Mapped](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_unmarshalled_total", Help: "total number of unmarshalled nano messages"})),
 		nanomsg.WithSubscriberBufferSizeGauge[message.Mapped](promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_psql_messages_buffer_size", Help: "fill percentage of the subscriber buffer"})),
+		// the database writer never drops messages, blocking would let the socket drop them while the database is slow
+		subscriberDropPolicy[message.Mapped](nanomsg.DropPolicySpill, nanomsg.DropPolicySpill, nanomsg.DropPolicyBlock),
 	)
 	if err != nil {
 		logger.GetLogger().Fatal(
@@ -178,7 +191,29 @@ func doWriteDatabaseMapped(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewPostgresqlConfig(cfgFile)
 	w := writer.NewPostgresqlWriter[message.Mapped](c)
-	w.Write(subscriber)
+	w.Write(commandContext(cmd), subscriber)
+}
+
+func doWriteDatabaseDeadLetter(cmd *cobra.Command, args []string) {
+	subscriber, err := nanomsg.NewSubscriber[message.DeadLetter](
+		subscribeURL,
+		[]byte{},
+		nanomsg.WithSubscriberReceivedCounter[message.DeadLetter](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_received_total", Help: "total number of received nano messages"})),
+		nanomsg.WithSubscriberUnmarshalledCounter[message.DeadLetter](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_messages_unmarshalled_total", Help: "total number of unmarshalled nano messages"})),
+		nanomsg.WithSubscriberBufferSizeGauge[message.DeadLetter](promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_psql_messages_buffer_size", Help: "fill percentage of the subscriber buffer"})),
+		// the database writer never drops messages, blocking would let the socket drop them while the database is slow
+		subscriberDropPolicy[message.DeadLetter](nanomsg.DropPolicySpill, nanomsg.DropPolicySpill, nanomsg.DropPolicyBlock),
+	)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not subscribe to the URL",
+			zap.String("URL", subscribeURL),
+			zap.String("Error", err.Error()),
+		)
+	}
+	c := config.NewPostgresqlConfig(cfgFile)
+	w := writer.NewPostgresqlWriter[message.DeadLetter](c)
+	w.Write(commandContext(cmd), subscriber)
 }
 
 func doWriteMQTT(cmd *cobra.Command, args []string) {
@@ -198,7 +233,7 @@ func doWriteMQTT(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewMQTTConfig(cfgFile)
 	w := writer.NewMqttWriter(c)
-	w.WriteMapped(subscriber)
+	w.WriteMapped(commandContext(cmd), subscriber)
 }
 
 func doWriteSignalK(cmd *cobra.Command, args []string) {
@@ -208,6 +243,8 @@ func doWriteSignalK(cmd *cobra.Command, args []string) {
 		nanomsg.WithSubscriberReceivedCounter[message.Mapped](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_signalk_messages_received_total", Help: "total number of received nano messages"})),
 		nanomsg.WithSubscriberUnmarshalledCounter[message.Mapped](promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_signalk_messages_unmarshalled_total", Help: "total number of unmarshalled nano messages"})),
 		nanomsg.WithSubscriberBufferSizeGauge[message.Mapped](promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_signalk_messages_buffer_size", Help: "fill percentage of the subscriber buffer"})),
+		// websocket clients are only interested in the latest values
+		subscriberDropPolicy[message.Mapped](nanomsg.DropPolicyDropOldest),
 	)
 	if err != nil {
 		logger.GetLogger().Fatal(
@@ -218,7 +255,7 @@ func doWriteSignalK(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewSignalKConfig(cfgFile).WithVersion(version.Version)
 	s := writer.NewSignalKWriter(c)
-	s.WriteMapped(subscriber)
+	s.WriteMapped(commandContext(cmd), subscriber)
 }
 
 func doWriteLWE(cmd *cobra.Command, args []string) {
@@ -238,7 +275,7 @@ func doWriteLWE(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewLWEConfig(cfgFile)
 	w := writer.NewLWEWriter(c)
-	w.WriteRaw(subscriber)
+	w.WriteRaw(commandContext(cmd), subscriber)
 }
 
 func doWriteStdOutMapped(cmd *cobra.Command, args []string) {
@@ -251,7 +288,7 @@ func doWriteStdOutMapped(cmd *cobra.Command, args []string) {
 		)
 	}
 	s := writer.NewStdOutWriter()
-	s.WriteMapped(subscriber)
+	s.WriteMapped(commandContext(cmd), subscriber)
 }
 
 func doWriteStdOutRaw(cmd *cobra.Command, args []string) {
@@ -264,7 +301,7 @@ func doWriteStdOutRaw(cmd *cobra.Command, args []string) {
 		)
 	}
 	s := writer.NewStdOutWriter()
-	s.WriteRaw(subscriber)
+	s.WriteRaw(commandContext(cmd), subscriber)
 }
 
 func doWriteStdOutRawString(cmd *cobra.Command, args []string) {
@@ -277,7 +314,7 @@ func doWriteStdOutRawString(cmd *cobra.Command, args []string) {
 		)
 	}
 	s := writer.NewStdOutWriter()
-	s.WriteRawString(subscriber)
+	s.WriteRawString(commandContext(cmd), subscriber)
 }
 
 func doWriteGrafana(cmd *cobra.Command, args []string) {
@@ -297,5 +334,5 @@ func doWriteGrafana(cmd *cobra.Command, args []string) {
 	}
 	c := config.NewMQTTConfig(cfgFile)
 	w := writer.NewGrafanaWriter(c)
-	w.WriteMapped(subscriber)
+	w.WriteMapped(commandContext(cmd), subscriber)
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -10,28 +11,31 @@ import (
 )
 
 func readConfigFile(result interface{}, configFilePath string, subKeys ...string) interface{} {
-	viper.SetConfigFile(configFilePath)
-	if err := viper.ReadInConfig(); err != nil {
+	if err := loadConfigFile(result, configFilePath, subKeys...); err != nil {
 		logger.GetLogger().Fatal(
-			"Fatal error while reading the configuration",
+			"Unable to read the configuration",
 			zap.String("Config file", configFilePath),
+			zap.Strings("Keys", subKeys),
 			zap.String("Error", err.Error()),
 		)
-		return result
+	}
+	return result
+}
+
+// Same as readConfigFile but returns an error instead of exiting, a new viper instance is used so it is safe to call while running
+func loadConfigFile(result interface{}, configFilePath string, subKeys ...string) error {
+	v := viper.New()
+	v.SetConfigFile(configFilePath)
+	if err := v.ReadInConfig(); err != nil {
+		return err
 	}
 
 	if len(subKeys) > 1 {
-		logger.GetLogger().Fatal(
-			"Unable to read the configuration, only one key is allowed",
-			zap.String("Config file", configFilePath),
-			zap.Strings("Keys", subKeys),
-		)
-		return result
+		return fmt.Errorf("only one key is allowed but got %v", subKeys)
 	}
 
-	var err error
 	if len(subKeys) == 0 {
-		err = viper.Unmarshal(
+		return v.Unmarshal(
 			result,
 			viper.DecodeHook(
 				mapstructure.ComposeDecodeHookFunc(
@@ -40,15 +44,6 @@ func readConfigFile(result interface{}, configFilePath string, subKeys ...string
 				),
 			),
 		)
-	} else {
-		err = viper.UnmarshalKey(subKeys[0], result)
-	}
-	if err != nil {
-		logger.GetLogger().Fatal(
-			"Unable to read the configuration",
-			zap.String("Config file", configFilePath),
-			zap.String("Error", err.Error()),
-		)
 	}
-	return result
+	return v.UnmarshalKey(subKeys[0], result)
 }
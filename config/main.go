@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/protocol"
@@ -35,30 +37,36 @@ const (
 
 	FftType = "fft"
 
+	DerivedType = "derived"
+
+	AlarmType = "alarm"
+
 	ParityMap string = "NOE" // None, Odd, Even
 )
 
 type ConnectorConfig struct {
-	Name      string        `mapstructure:"name"`
-	URL       *url.URL      `mapstructure:"_"`
-	URLString string        `mapstructure:"url"`
-	Listen    bool          `mapstructure:"listen"`
-	BaudRate  int           `mapstructure:"baudRate"`
-	DataBits  int           `mapstructure:"dataBits"`
-	StopBits  string        `mapstructure:"stopBits"`
-	Parity    string        `mapstructure:"parity"`
-	Protocol  string        `mapstructure:"protocol"`
-	Timeout   time.Duration `mapstructure:"timeout"`
+	Name         string        `mapstructure:"name"`
+	URL          *url.URL      `mapstructure:"_"`
+	URLString    string        `mapstructure:"url"`
+	Listen       bool          `mapstructure:"listen"`
+	BaudRate     int           `mapstructure:"baudRate"`
+	DataBits     int           `mapstructure:"dataBits"`
+	StopBits     string        `mapstructure:"stopBits"`
+	Parity       string        `mapstructure:"parity"`
+	Protocol     string        `mapstructure:"protocol"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	ReadyTimeout time.Duration `mapstructure:"readyTimeout"` // the connector is not ready when it didn't receive data for this long
 }
 
 func NewConnectorConfig(configFilePath string) *ConnectorConfig {
 	result := &ConnectorConfig{
-		Listen:   false,
-		BaudRate: 4800,
-		DataBits: 8,
-		StopBits: "1",
-		Parity:   "N",
-		Timeout:  5 * time.Minute,
+		Listen:       false,
+		BaudRate:     4800,
+		DataBits:     8,
+		StopBits:     "1",
+		Parity:       "N",
+		Timeout:      5 * time.Minute,
+		ReadyTimeout: 30 * time.Second,
 	}
 	readConfigFile(result, configFilePath)
 
@@ -132,15 +140,57 @@ type MapperConfig struct {
 	Context         string            `mapstructure:"context"`
 	Protocol        string            `mapstructure:"protocol"`
 	ProtocolOptions map[string]string `mapstructure:"protocolOptions"`
+	NumberOfWorkers int               `mapstructure:"numberOfWorkers"` // number of workers mapping raw data, ordering is kept per connector or Modbus slave
+	StateConfig     StateConfig       `mapstructure:"state"`
+	ReloadConfig    `mapstructure:",squash"`
 }
 
 func NewMapperConfig(configFilePath string) MapperConfig {
-	result := MapperConfig{}
+	result := MapperConfig{
+		StateConfig: defaultStateConfig(),
+	}
+	readConfigFile(&result, configFilePath)
+	result.ConfigFile = configFilePath
+
+	return result
+}
+
+type ReloadConfig struct {
+	ConfigFile    string        `mapstructure:"-"`             // the configuration is reloaded from this file on a SIGHUP, reloading is disabled when empty
+	WatchInterval time.Duration `mapstructure:"watchInterval"` // the config file is checked for changes at this interval, disabled when zero
+}
+
+func NewReloadConfig(configFilePath string) ReloadConfig {
+	result := ReloadConfig{}
 	readConfigFile(&result, configFilePath)
+	result.ConfigFile = configFilePath
 
 	return result
 }
 
+const (
+	StateStoreFile       = "file"
+	StateStorePostgresql = "postgresql"
+)
+
+type StateConfig struct {
+	Store            string           `mapstructure:"store"`     // file or postgresql, the state is not persisted when empty
+	Key              string           `mapstructure:"key"`       // identifies the state in the store, has to be unique per mapper, the kind of mapper and the path of the config file are used when empty
+	Directory        string           `mapstructure:"directory"` // directory of the file store
+	Interval         time.Duration    `mapstructure:"interval"`  // time between snapshots
+	MaxAge           time.Duration    `mapstructure:"maxAge"`    // snapshots older than this are not restored
+	PostgresqlConfig PostgresqlConfig `mapstructure:"database"`
+}
+
+func defaultStateConfig() StateConfig {
+	return StateConfig{
+		Directory:        ".",
+		Interval:         time.Minute,
+		MaxAge:           time.Hour,
+		PostgresqlConfig: defaultPostgresqlConfig(),
+	}
+}
+
 type CanBusMapperConfig struct {
 	MapperConfig `mapstructure:",squash"`
 	DbcFile      string `mapstructure:"dbcFile"`
@@ -176,6 +226,21 @@ type MappingConfig struct {
 	Path                        string `mapstructure:"path"`
 }
 
+// Compiles the expressions so a mapping with an invalid expression can be rejected up front
+func (m *MappingConfig) Compile() error {
+	var err error
+	if m.CompiledExpression, err = expr.Compile(m.Expression); err != nil {
+		return fmt.Errorf("could not compile the expression %q for path %s: %w", m.Expression, m.Path, err)
+	}
+	if m.TimestampExpression == "" {
+		return nil
+	}
+	if m.CompiledTimestampExpression, err = expr.Compile(m.TimestampExpression); err != nil {
+		return fmt.Errorf("could not compile the timestamp expression %q for path %s: %w", m.TimestampExpression, m.Path, err)
+	}
+	return nil
+}
+
 func (m *MappingConfig) verify() {
 	if m.Path == "" {
 		logger.GetLogger().Warn(
@@ -205,6 +270,21 @@ func NewModbusMappingsConfig(configFilePath string) []ModbusMappingsConfig {
 	return result
 }
 
+// Reads and compiles the mappings, used to reload the configuration
+func LoadModbusMappingsConfig(configFilePath string) ([]ModbusMappingsConfig, error) {
+	var result []ModbusMappingsConfig
+	if err := loadConfigFile(&result, configFilePath, "mappings"); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].verify()
+		if err := result[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 type CSVMappingConfig struct {
 	MappingConfig `mapstructure:",squash"`
 	BeginsWith    string `mapstructure:"beginsWith"`
@@ -236,6 +316,21 @@ func NewJSONMappingConfig(configFilePath string) []JSONMappingConfig {
 	return result
 }
 
+// Reads and compiles the mappings, used to reload the configuration
+func LoadJSONMappingConfig(configFilePath string) ([]JSONMappingConfig, error) {
+	var result []JSONMappingConfig
+	if err := loadConfigFile(&result, configFilePath, "mappings"); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].verify()
+		if err := result[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 type ExpressionMappingConfig struct {
 	MappingConfig `mapstructure:",squash"`
 	SourcePaths   []string      `mapstructure:"sourcePaths"`
@@ -253,12 +348,70 @@ func NewExpressionMappingConfig(configFilePath string) []*ExpressionMappingConfi
 	return result
 }
 
+// Reads and compiles the mappings, used to reload the configuration
+func LoadExpressionMappingConfig(configFilePath string) ([]*ExpressionMappingConfig, error) {
+	var result []*ExpressionMappingConfig
+	if err := loadConfigFile(&result, configFilePath, "mappings"); err != nil {
+		return nil, err
+	}
+	for _, rmc := range result {
+		rmc.verify()
+		if err := rmc.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+const (
+	FftWindowHann     = "hann"
+	FftWindowHamming  = "hamming"
+	FftWindowBlackman = "blackman"
+)
+
+type FftBandConfig struct {
+	Path string  `mapstructure:"path"` // the energy of the band, the mean square of the samples within the band, is published on this path
+	From float64 `mapstructure:"from"` // lowest frequency of the band in Hz, inclusive
+	To   float64 `mapstructure:"to"`   // highest frequency of the band in Hz, exclusive
+}
+
 type FftConfig struct {
 	MappingConfig         `mapstructure:",squash"`
-	Path                  string  `mapstructure:"path"`
-	SpectrumPath          string  `mapstructure:"spectrumPath"`
-	SamplesChannelBitSize int64   `mapstructure:"samplesChannelBitSize"`
-	FrequencyStepSize     float64 `mapstructure:"frequencyStepSize"`
+	Path                  string          `mapstructure:"path"`
+	SpectrumPath          string          `mapstructure:"spectrumPath"`
+	SamplesChannelBitSize int64           `mapstructure:"samplesChannelBitSize"`
+	FrequencyStepSize     float64         `mapstructure:"frequencyStepSize"`
+	Window                string          `mapstructure:"window"`        // hann, hamming or blackman, the samples are not windowed when empty
+	Overlap               float64         `mapstructure:"overlap"`       // fraction of the samples that is used again in the next spectrum, from 0 up to 1
+	SampleRate            float64         `mapstructure:"sampleRate"`    // samples per second, when set the samples are resampled to handle irregular timestamps
+	RmsPath               string          `mapstructure:"rmsPath"`       // the RMS of the samples is published on this path when set
+	Bands                 []FftBandConfig `mapstructure:"bands"`         // the energy of each band is published on the path of the band
+	NumberOfPeaks         int             `mapstructure:"numberOfPeaks"` // the highest peaks are published on <peaksPath>.<n>.frequency and <peaksPath>.<n>.amplitude
+	PeaksPath             string          `mapstructure:"peaksPath"`
+}
+
+func (f *FftConfig) verify() {
+	f.MappingConfig.verify()
+	switch f.Window {
+	case "", FftWindowHann, FftWindowHamming, FftWindowBlackman:
+	default:
+		logger.GetLogger().Fatal(
+			"Not a supported window",
+			zap.String("Window", f.Window),
+		)
+	}
+	if f.Overlap < 0 || f.Overlap >= 1 {
+		logger.GetLogger().Fatal(
+			"Overlap should be at least 0 and less than 1",
+			zap.Float64("Overlap", f.Overlap),
+		)
+	}
+	if f.NumberOfPeaks > 0 && f.PeaksPath == "" {
+		logger.GetLogger().Fatal(
+			"Peaks path was not set",
+			zap.String("Path", f.Path),
+		)
+	}
 }
 
 func NewFftConfig(configFilePath string) []*FftConfig {
@@ -270,6 +423,100 @@ func NewFftConfig(configFilePath string) []*FftConfig {
 	return result
 }
 
+const (
+	DerivationTrueWindWater     = "trueWindWater"
+	DerivationTrueWindGround    = "trueWindGround"
+	DerivationSetAndDrift       = "setAndDrift"
+	DerivationVelocityMadeGood  = "velocityMadeGood"
+	DerivationMagneticVariation = "magneticVariation"
+	DerivationNextPoint         = "nextPoint"
+	DerivationClosestApproach   = "closestApproach"
+)
+
+type DerivedConfig struct {
+	Derivations []string      `mapstructure:"derivations"` // derivations to calculate, all derivations are calculated when empty
+	MaxAge      time.Duration `mapstructure:"maxAge"`      // input values older than this are not used
+}
+
+func NewDerivedConfig(configFilePath string) *DerivedConfig {
+	result := &DerivedConfig{
+		MaxAge: 10 * time.Second,
+	}
+	readConfigFile(result, configFilePath)
+
+	return result
+}
+
+const (
+	AlarmStateNormal    = "normal"
+	AlarmStateAlert     = "alert"
+	AlarmStateWarn      = "warn"
+	AlarmStateAlarm     = "alarm"
+	AlarmStateEmergency = "emergency"
+
+	AlarmMethodVisual = "visual"
+	AlarmMethodSound  = "sound"
+)
+
+type AlarmConfig struct {
+	Name          string        `mapstructure:"name"`          // the notification is published on notifications.<name>
+	Path          string        `mapstructure:"path"`          // path of the monitored value
+	Message       string        `mapstructure:"message"`       // message of the notification, the name is used when empty
+	LowLow        *float64      `mapstructure:"lowLow"`        // below this limit the state is alarm
+	Low           *float64      `mapstructure:"low"`           // below this limit the state is warn
+	High          *float64      `mapstructure:"high"`          // above this limit the state is warn
+	HighHigh      *float64      `mapstructure:"highHigh"`      // above this limit the state is alarm
+	Deadband      float64       `mapstructure:"deadband"`      // hysteresis, the value has to be this far within the limit before the state is lowered
+	OnDelay       time.Duration `mapstructure:"onDelay"`       // a limit has to be exceeded this long before the state is raised
+	OffDelay      time.Duration `mapstructure:"offDelay"`      // a limit has to be respected this long before the state is lowered
+	EscalateAfter time.Duration `mapstructure:"escalateAfter"` // unacknowledged alarms become an emergency after this period, disabled when zero
+	Inhibit       string        `mapstructure:"inhibit"`       // expression, the alarm is inhibited when it evaluates to true
+	Method        []string      `mapstructure:"method"`        // methods to notify the user with
+}
+
+func (a *AlarmConfig) verify() {
+	if a.Name == "" {
+		logger.GetLogger().Fatal(
+			"Name was not set",
+			zap.String("Alarm", fmt.Sprintf("%+v", a)),
+		)
+	}
+	if a.Path == "" {
+		logger.GetLogger().Fatal(
+			"Path was not set",
+			zap.String("Alarm", fmt.Sprintf("%+v", a)),
+		)
+	}
+	if a.LowLow == nil && a.Low == nil && a.High == nil && a.HighHigh == nil {
+		logger.GetLogger().Warn(
+			"No limits were set, the alarm will never be raised",
+			zap.String("Alarm", fmt.Sprintf("%+v", a)),
+		)
+	}
+	if len(a.Method) == 0 {
+		a.Method = []string{AlarmMethodVisual, AlarmMethodSound}
+	}
+}
+
+type AlarmsConfig struct {
+	Alarms           []*AlarmConfig    `mapstructure:"alarms"`
+	Listen           string            `mapstructure:"listen"`   // host and port for the alarm API, the API is disabled when empty
+	PostgresqlConfig *PostgresqlConfig `mapstructure:"database"` // the alarm history is stored when the url is set
+}
+
+func NewAlarmsConfig(configFilePath string) *AlarmsConfig {
+	postgres := defaultPostgresqlConfig()
+	result := &AlarmsConfig{
+		PostgresqlConfig: &postgres,
+	}
+	readConfigFile(result, configFilePath)
+	for _, a := range result.Alarms {
+		a.verify()
+	}
+
+	return result
+}
+
 type CanBusMappingConfig struct {
 	MappingConfig `mapstructure:",squash"`
 	Name          string    `mapstructure:"name"`
@@ -295,6 +542,21 @@ func NewMappingConfig(configFilePath string) []MappingConfig {
 	return result
 }
 
+// Reads and compiles the mappings, used to reload the configuration
+func LoadMappingConfig(configFilePath string) ([]MappingConfig, error) {
+	var result []MappingConfig
+	if err := loadConfigFile(&result, configFilePath, "mappings"); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].verify()
+		if err := result[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 type MQTTConfig struct {
 	URLString  string        `mapstructure:"url"`
 	Username   string        `mapstructure:"username"`
@@ -432,19 +694,434 @@ func NewEventConfig(configFilePath string) *EventConfig {
 	return result
 }
 
+const (
+	RateLimitAggregateMean = "mean"
+	RateLimitAggregateMin  = "min"
+	RateLimitAggregateMax  = "max"
+	RateLimitAggregateLast = "last"
+)
+
 type RateLimitsConfig struct {
-	Path     string        `mapstructure:"path"`
-	Interval time.Duration `mapstructure:"interval"`
+	Path             string        `mapstructure:"path"`
+	Interval         time.Duration `mapstructure:"interval"`
+	Deadband         float64       `mapstructure:"deadband"`         // a value is only sent when it differs this much from the last sent value
+	RelativeDeadband float64       `mapstructure:"relativeDeadband"` // fraction of the last sent value, the change has to exceed both deadbands
+	Angle            bool          `mapstructure:"angle"`            // the values are angles in radians, the change is the smallest angle between two values
+	Heartbeat        time.Duration `mapstructure:"heartbeat"`        // a value is sent at least at this interval, even when it did not change
+	SwingingDoor     bool          `mapstructure:"swingingDoor"`     // compress the values with the deadband as deviation, turning points are kept and the interval is not used
+	Aggregate        string        `mapstructure:"aggregate"`        // mean, min, max or last, the values of each interval are aggregated instead of dropped
+	CountPath        string        `mapstructure:"countPath"`        // the number of aggregated values is sent on this path when set
+	Grace            time.Duration `mapstructure:"grace"`            // values that arrive this long after their interval ended are still aggregated
+}
+
+// Values of paths with a deadband or compression are filtered on change instead of only on time
+func (r RateLimitsConfig) OnChange() bool {
+	return r.Deadband > 0 || r.RelativeDeadband > 0 || r.Heartbeat > 0 || r.SwingingDoor
+}
+
+func (r RateLimitsConfig) verify() error {
+	if r.Deadband < 0 || r.RelativeDeadband < 0 {
+		return fmt.Errorf("the deadbands of path %s should not be negative", r.Path)
+	}
+	if r.SwingingDoor && r.Deadband == 0 {
+		return fmt.Errorf("swinging door compression of path %s needs a deadband", r.Path)
+	}
+	switch r.Aggregate {
+	case "":
+		if r.CountPath != "" {
+			return fmt.Errorf("the count path of path %s needs an aggregate", r.Path)
+		}
+	case RateLimitAggregateMean, RateLimitAggregateMin, RateLimitAggregateMax, RateLimitAggregateLast:
+		if r.OnChange() {
+			return fmt.Errorf("path %s can't be aggregated and filtered on change", r.Path)
+		}
+		if r.Interval <= 0 {
+			return fmt.Errorf("aggregating path %s needs an interval", r.Path)
+		}
+		if r.Grace < 0 {
+			return fmt.Errorf("the grace period of path %s should not be negative", r.Path)
+		}
+	default:
+		return fmt.Errorf("%s is not a supported aggregate for path %s", r.Aggregate, r.Path)
+	}
+	return nil
 }
 
 type RateLimitFilterConfig struct {
 	Ratelimits      []RateLimitsConfig `mapstructure:"rateLimits"`
 	DefaultInterval time.Duration      `mapstructure:"defaultInterval"`
+	StateConfig     StateConfig        `mapstructure:"state"`
+	ReloadConfig    `mapstructure:",squash"`
 }
 
 func NewRateLimitConfig(configFilePath string) *RateLimitFilterConfig {
-	result := &RateLimitFilterConfig{}
+	result := &RateLimitFilterConfig{
+		StateConfig: defaultStateConfig(),
+	}
 	readConfigFile(result, configFilePath)
+	result.ConfigFile = configFilePath
+	for _, r := range result.Ratelimits {
+		if err := r.verify(); err != nil {
+			logger.GetLogger().Fatal(
+				"Invalid rate limit",
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+
+	return result
+}
+
+// Reads the rate limits, used to reload the configuration
+func LoadRateLimitConfig(configFilePath string) (*RateLimitFilterConfig, error) {
+	result := &RateLimitFilterConfig{
+		StateConfig: defaultStateConfig(),
+	}
+	if err := loadConfigFile(result, configFilePath); err != nil {
+		return nil, err
+	}
+	result.ConfigFile = configFilePath
+	for _, r := range result.Ratelimits {
+		if err := r.verify(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+type SourceConfig struct {
+	Label   string        `mapstructure:"label"`   // label of the source
+	Timeout time.Duration `mapstructure:"timeout"` // the source is stale when it didn't send a value for this long, the default timeout is used when zero
+}
+
+type SourcePriorityConfig struct {
+	Path       string          `mapstructure:"path"`
+	Sources    []*SourceConfig `mapstructure:"sources"`    // highest priority first, values of other sources are dropped
+	HoldTime   time.Duration   `mapstructure:"holdTime"`   // a higher priority source has to be fresh this long before failing back to it
+	ActivePath string          `mapstructure:"activePath"` // the label of the active source is sent on this path when it changes
+}
+
+type SourcePrioritiesConfig struct {
+	Priorities     []*SourcePriorityConfig `mapstructure:"priorities"`
+	DefaultTimeout time.Duration           `mapstructure:"defaultTimeout"`
+	ReloadConfig   `mapstructure:",squash"`
+}
+
+func (c *SourcePrioritiesConfig) verify() error {
+	for _, p := range c.Priorities {
+		if p.Path == "" || len(p.Sources) == 0 {
+			return fmt.Errorf("path and sources have to be set for each priority: %+v", p)
+		}
+		for _, s := range p.Sources {
+			if s.Timeout == 0 {
+				s.Timeout = c.DefaultTimeout
+			}
+			if s.Timeout <= 0 {
+				return fmt.Errorf("the timeout of source %s of path %s should be positive", s.Label, p.Path)
+			}
+		}
+	}
+	return nil
+}
+
+func NewSourcePrioritiesConfig(configFilePath string) *SourcePrioritiesConfig {
+	result := &SourcePrioritiesConfig{
+		DefaultTimeout: 10 * time.Second,
+	}
+	readConfigFile(result, configFilePath)
+	result.ConfigFile = configFilePath
+	if err := result.verify(); err != nil {
+		logger.GetLogger().Fatal(
+			"Invalid source priority",
+			zap.String("Error", err.Error()),
+		)
+	}
+
+	return result
+}
+
+// Reads the source priorities, used to reload the configuration
+func LoadSourcePrioritiesConfig(configFilePath string) (*SourcePrioritiesConfig, error) {
+	result := &SourcePrioritiesConfig{
+		DefaultTimeout: 10 * time.Second,
+	}
+	if err := loadConfigFile(result, configFilePath); err != nil {
+		return nil, err
+	}
+	result.ConfigFile = configFilePath
+	if err := result.verify(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+const (
+	PipelineStageFilter    = "filter"
+	PipelineStageRateLimit = "rateLimit"
+	PipelineStagePriority  = "priority"
+)
+
+type PipelineStageConfig struct {
+	Name       string `mapstructure:"name"`   // used to label the metrics of the stage, the type is used when empty
+	Type       string `mapstructure:"type"`   // filter, rateLimit, priority or a signalk, fft, derived or alarm mapper
+	ConfigFile string `mapstructure:"config"` // config file of the stage, the same file as used when the stage runs as a separate process
+}
+
+type PipelineConfig struct {
+	Stages []*PipelineStageConfig `mapstructure:"stages"`
+}
+
+func NewPipelineConfig(configFilePath string) *PipelineConfig {
+	result := &PipelineConfig{}
+	readConfigFile(result, configFilePath)
+	names := make(map[string]struct{}, len(result.Stages))
+	for _, s := range result.Stages {
+		if s.Type == "" || s.ConfigFile == "" {
+			logger.GetLogger().Fatal(
+				"Type and config have to be set for each stage",
+				zap.String("Stage", fmt.Sprintf("%+v", s)),
+			)
+		}
+		if s.Name == "" {
+			s.Name = s.Type
+		}
+		if _, ok := names[s.Name]; ok {
+			logger.GetLogger().Fatal(
+				"Stage names have to be unique",
+				zap.String("Stage", s.Name),
+			)
+		}
+		names[s.Name] = struct{}{}
+	}
+	if len(result.Stages) == 0 {
+		logger.GetLogger().Fatal(
+			"No stages were configured",
+			zap.String("Config file", configFilePath),
+		)
+	}
+
+	return result
+}
+
+const (
+	ProxyRuleInclude = "include"
+	ProxyRuleExclude = "exclude"
+)
+
+// A value or raw message matches the rule when all fields that are set match, the path is a prefix
+type ProxyRuleConfig struct {
+	Action    string `mapstructure:"action"` // include or exclude, when there are include rules only the matching values are forwarded
+	Context   string `mapstructure:"context"`
+	Path      string `mapstructure:"path"`
+	Connector string `mapstructure:"connector"` // the connector of raw messages or the source label of mapped values
+	Type      string `mapstructure:"type"`      // the protocol of raw messages or the source type of mapped values
+}
+
+type ContextRewriteConfig struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+type ProxyConfig struct {
+	Upstreams       []string               `mapstructure:"upstreams"`       // added to the upstreams of the command line
+	Rules           []ProxyRuleConfig      `mapstructure:"rules"`           // applied after the contexts are rewritten
+	ContextRewrites []ContextRewriteConfig `mapstructure:"contextRewrites"` // e.g. from vessels.self to the urn of the vessel
+	LivenessTimeout time.Duration          `mapstructure:"livenessTimeout"` // an upstream is not alive when it didn't send a message for this long
+	ReloadConfig    `mapstructure:",squash"`
+}
+
+func (c *ProxyConfig) verify() error {
+	for _, r := range c.Rules {
+		if r.Action != ProxyRuleInclude && r.Action != ProxyRuleExclude {
+			return fmt.Errorf("the action of a rule should be %s or %s: %+v", ProxyRuleInclude, ProxyRuleExclude, r)
+		}
+		if r.Context == "" && r.Path == "" && r.Connector == "" && r.Type == "" {
+			return fmt.Errorf("at least one of context, path, connector or type has to be set for each rule: %+v", r)
+		}
+	}
+	for _, r := range c.ContextRewrites {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("from and to have to be set for each context rewrite: %+v", r)
+		}
+	}
+	if c.LivenessTimeout <= 0 {
+		return fmt.Errorf("the liveness timeout should be positive")
+	}
+	return nil
+}
+
+// The proxy can run without a config file, only the upstreams of the command line are used then
+func NewProxyConfig(configFilePath string) *ProxyConfig {
+	result := &ProxyConfig{
+		LivenessTimeout: time.Minute,
+	}
+	if configFilePath != "" {
+		readConfigFile(result, configFilePath)
+	}
+	result.ConfigFile = configFilePath
+	if err := result.verify(); err != nil {
+		logger.GetLogger().Fatal(
+			"Invalid proxy configuration",
+			zap.String("Error", err.Error()),
+		)
+	}
+
+	return result
+}
+
+// Reads the proxy configuration, used to reload the configuration
+func LoadProxyConfig(configFilePath string) (*ProxyConfig, error) {
+	result := &ProxyConfig{
+		LivenessTimeout: time.Minute,
+	}
+	if err := loadConfigFile(result, configFilePath); err != nil {
+		return nil, err
+	}
+	result.ConfigFile = configFilePath
+	if err := result.verify(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// A gosk command that is started by the run command, the bus urls are set by the run command
+type RunComponentConfig struct {
+	Name             string   `mapstructure:"name"`             // unique, identifies the component in the status, the metrics and the subscriptions
+	Command          string   `mapstructure:"command"`          // the gosk command, e.g. connect, map or write database raw
+	ConfigFile       string   `mapstructure:"config"`           // config file of the command
+	Subscribe        []string `mapstructure:"subscribe"`        // names of the components this component receives from, name.deadLetters for the dead letters of a component
+	DeadLetters      bool     `mapstructure:"deadLetters"`      // publish the dead letters of a mapper or filter
+	Format           string   `mapstructure:"format"`           // format of the published messages, json or binary, json when empty
+	DeadLetterFormat string   `mapstructure:"deadLetterFormat"` // format of the published dead letters, the format is used when empty
+	Subjects         []string `mapstructure:"subjects"`         // with a NATS bus, the subjects to receive instead of the messages of the subscribed components
+	Args             []string `mapstructure:"args"`             // extra arguments of the command
+}
+
+type RunBusConfig struct {
+	URL            string        `mapstructure:"url"`            // a nats:// URL starts a NATS server that is used by all components, mangos sockets are used when empty
+	Host           string        `mapstructure:"host"`           // mangos sockets listen on this host
+	BasePort       int           `mapstructure:"basePort"`       // mangos sockets listen on ports starting at this port
+	StoreDirectory string        `mapstructure:"storeDirectory"` // where the NATS server stores the messages, in memory when empty
+	MaxAge         time.Duration `mapstructure:"maxAge"`         // the NATS server removes older messages, never when zero
+}
+
+type RunConfig struct {
+	Mode            string                `mapstructure:"mode"` // process starts a child process for each component, goroutine runs the components in the run process where they share the process wide settings
+	Bus             RunBusConfig          `mapstructure:"bus"`
+	StatusAddress   string                `mapstructure:"statusAddress"`   // host and port of the status and combined metrics endpoint, disabled when empty
+	MetricsBasePort int                   `mapstructure:"metricsBasePort"` // components serve their metrics on localhost starting at this port, disabled when zero
+	MinBackoff      time.Duration         `mapstructure:"minBackoff"`      // wait time before a failed component is restarted the first time
+	MaxBackoff      time.Duration         `mapstructure:"maxBackoff"`      // the wait time doubles after each failure up to this time
+	Components      []*RunComponentConfig `mapstructure:"components"`
+}
+
+const RunDeadLettersSuffix = ".deadLetters"
+
+const (
+	RunModeGoroutine = "goroutine"
+	RunModeProcess   = "process"
+)
+
+func (c *RunConfig) verify() error {
+	names := make(map[string]*RunComponentConfig, len(c.Components))
+	for _, component := range c.Components {
+		if component.Name == "" || component.Command == "" {
+			return fmt.Errorf("name and command have to be set for each component: %+v", component)
+		}
+		if _, ok := names[component.Name]; ok {
+			return fmt.Errorf("component names have to be unique, %s is used more than once", component.Name)
+		}
+		names[component.Name] = component
+	}
+	for _, component := range c.Components {
+		for _, s := range component.Subscribe {
+			name, deadLetters := strings.CutSuffix(s, RunDeadLettersSuffix)
+			other, ok := names[name]
+			if !ok || other == component {
+				return fmt.Errorf("component %s subscribes to %s, which is not another component", component.Name, s)
+			}
+			if deadLetters && !other.DeadLetters {
+				return fmt.Errorf("component %s subscribes to the dead letters of %s, which doesn't publish dead letters", component.Name, name)
+			}
+		}
+	}
+	if len(c.Components) == 0 {
+		return fmt.Errorf("no components were configured")
+	}
+	if c.Mode != RunModeGoroutine && c.Mode != RunModeProcess {
+		return fmt.Errorf("the mode should be %s or %s, not %s", RunModeGoroutine, RunModeProcess, c.Mode)
+	}
+	if c.MinBackoff <= 0 || c.MaxBackoff < c.MinBackoff {
+		return fmt.Errorf("the minimum backoff should be positive and not more than the maximum backoff")
+	}
+	if c.Bus.URL != "" && !strings.HasPrefix(c.Bus.URL, "nats://") {
+		return fmt.Errorf("the bus url %s should be a nats:// URL", c.Bus.URL)
+	}
+	return nil
+}
+
+func defaultRunConfig() RunConfig {
+	return RunConfig{
+		Mode: RunModeProcess,
+		Bus: RunBusConfig{
+			Host:     "127.0.0.1",
+			BasePort: 6000,
+			MaxAge:   24 * time.Hour,
+		},
+		MinBackoff: time.Second,
+		MaxBackoff: 5 * time.Minute,
+	}
+}
+
+func NewRunConfig(configFilePath string) *RunConfig {
+	result := defaultRunConfig()
+	readConfigFile(&result, configFilePath)
+	if err := result.verify(); err != nil {
+		logger.GetLogger().Fatal(
+			"Invalid run configuration",
+			zap.String("Config file", configFilePath),
+			zap.String("Error", err.Error()),
+		)
+	}
+
+	return &result
+}
+
+type ZoneConfig struct {
+	Lower   *float64 `mapstructure:"lower"`
+	Upper   *float64 `mapstructure:"upper"`
+	State   string   `mapstructure:"state"` // nominal, normal, alert, warn, alarm or emergency
+	Message string   `mapstructure:"message"`
+}
+
+type PathSchemaConfig struct {
+	Path        string        `mapstructure:"path"` // a * matches exactly one segment of the path
+	Type        string        `mapstructure:"type"` // the type of the built in schema is kept when empty
+	Units       string        `mapstructure:"units"`
+	Description string        `mapstructure:"description"`
+	DisplayName string        `mapstructure:"displayName"`
+	Zones       []*ZoneConfig `mapstructure:"zones"`
+}
+
+// Adds paths to the built in SignalK schema or replaces them
+type SchemaConfig struct {
+	Paths []*PathSchemaConfig `mapstructure:"schema"`
+}
+
+func NewSchemaConfig(configFilePath string) *SchemaConfig {
+	result := &SchemaConfig{}
+	readConfigFile(result, configFilePath)
+	for _, p := range result.Paths {
+		if p.Path == "" {
+			logger.GetLogger().Fatal(
+				"Path has to be set for each schema",
+				zap.String("Schema", fmt.Sprintf("%+v", p)),
+			)
+		}
+	}
 
 	return result
 }
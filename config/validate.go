@@ -0,0 +1,722 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ComponentConnector  = "connector"
+	ComponentMapper     = "mapper"
+	ComponentFilter     = "filter"
+	ComponentPipeline   = "pipeline"
+	ComponentPriority   = "priority"
+	ComponentRateLimit  = "rateLimit"
+	ComponentCache      = "cache"
+	ComponentTransfer   = "transfer"
+	ComponentTestData   = "testData"
+	ComponentSignalK    = "signalk"
+	ComponentLWE        = "lwe"
+	ComponentMQTT       = "mqtt"
+	ComponentPostgresql = "postgresql"
+	ComponentSchema     = "schema"
+	ComponentProxy      = "proxy"
+	ComponentRun        = "run"
+)
+
+// top level groups of the SignalK vessel schema and the groups GOSK adds, see SIGNALK_PATHS.md
+var signalKGroups = map[string]struct{}{
+	"name":          {},
+	"mmsi":          {},
+	"uuid":          {},
+	"url":           {},
+	"port":          {},
+	"flag":          {},
+	"registrations": {},
+	"communication": {},
+	"design":        {},
+	"navigation":    {},
+	"propulsion":    {},
+	"electrical":    {},
+	"environment":   {},
+	"tanks":         {},
+	"steering":      {},
+	"notifications": {},
+	"sails":         {},
+	"sensors":       {},
+	"performance":   {},
+	"auxiliaries":   {}, // generators and other auxiliary engines
+	"cargo":         {},
+	"event":         {},
+}
+
+var signalKPathSegment = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// A problem in a config file, the line refers to the key or item that causes the problem
+type ValidationError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Compiles the expression with the environment the mapper of the protocol uses, the source paths are added to the environment of signalk mappings
+type ExpressionChecker func(protocol string, expression string, environment map[string]interface{}, sourcePaths []string) error
+
+type validation struct {
+	file   string
+	root   *yaml.Node
+	check  ExpressionChecker
+	errors []ValidationError
+}
+
+func (v *validation) add(line int, format string, args ...any) {
+	v.errors = append(v.errors, ValidationError{File: v.file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Detects the component the config file is for and reports unknown keys, expressions that don't compile, unknown SignalK paths and invalid Modbus requests
+func Validate(configFilePath string, check ExpressionChecker) (string, []ValidationError) {
+	v := &validation{file: configFilePath, check: check}
+	bytes, err := os.ReadFile(configFilePath)
+	if err != nil {
+		v.add(0, "could not read the file: %s", err.Error())
+		return "", v.errors
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(bytes, &document); err != nil {
+		v.add(0, "could not parse the file: %s", err.Error())
+		return "", v.errors
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		v.add(document.Line, "the file should contain a map of keys")
+		return "", v.errors
+	}
+	v.root = document.Content[0]
+
+	component, protocolName := v.detect()
+	if component == "" {
+		v.add(v.root.Line, "could not detect the component the file is for")
+		return "", v.errors
+	}
+	schema, ok := v.schema(component, protocolName)
+	if !ok {
+		v.add(v.line(v.root, "protocol"), "%s is not a supported protocol for a %s", protocolName, component)
+		return component, v.errors
+	}
+	v.checkKeys(v.root, schema, "")
+	v.checkComponent(component, protocolName)
+
+	sort.SliceStable(v.errors, func(i, j int) bool { return v.errors[i].Line < v.errors[j].Line })
+	return component, v.errors
+}
+
+func (v *validation) detect() (string, string) {
+	keys := make(map[string]string)
+	for i := 0; i+1 < len(v.root.Content); i += 2 {
+		keys[strings.ToLower(v.root.Content[i].Value)] = v.root.Content[i+1].Value
+	}
+	has := func(names ...string) bool {
+		for _, n := range names {
+			if _, ok := keys[strings.ToLower(n)]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("schema"):
+		return ComponentSchema, ""
+	case has("components"):
+		return ComponentRun, ""
+	case has("upstreams", "contextRewrites"):
+		return ComponentProxy, ""
+	case has("stages"):
+		return ComponentPipeline, ""
+	case has("priorities"):
+		return ComponentPriority, ""
+	case has("rateLimits"):
+		return ComponentRateLimit, ""
+	case has("protocol") && has("name", "url", "registerGroups", "urlGroups"):
+		return ComponentConnector, keys["protocol"]
+	case has("protocol"):
+		return ComponentMapper, keys["protocol"]
+	case has("mappings"):
+		return ComponentFilter, ""
+	case has("lifeWindow", "hardMaxCacheSize"):
+		return ComponentCache, ""
+	case has("origin"):
+		return ComponentTransfer, ""
+	case has("delay", "paths"):
+		return ComponentTestData, ""
+	case has("self_context", "cache"):
+		return ComponentSignalK, ""
+	case has("destination_identification", "source_identification"):
+		return ComponentLWE, ""
+	case has("username", "topic"):
+		return ComponentMQTT, ""
+	case has("url"):
+		return ComponentPostgresql, ""
+	}
+	return "", ""
+}
+
+// the keys that are allowed at the top level of the file, the config types that are read from the file are combined
+func (v *validation) schema(component string, protocolName string) (map[string]reflect.Type, bool) {
+	types := []any{}
+	lists := map[string]any{}
+	switch component {
+	case ComponentConnector:
+		types = append(types, ConnectorConfig{})
+		switch protocolName {
+		case ModbusType:
+			lists["registerGroups"] = []RegisterGroupConfig{}
+		case HttpType:
+			lists["urlGroups"] = []UrlGroupConfig{}
+		case MQTTType:
+			types = append(types, MQTTConfig{})
+		case CSVType, NMEA0183Type, JSONType, CanBusType, MannerEthernetType:
+		default:
+			return nil, false
+		}
+	case ComponentMapper:
+		types = append(types, MapperConfig{})
+		switch protocolName {
+		case CSVType:
+			types = append(types, CSVMapperConfig{})
+			lists["mappings"] = []CSVMappingConfig{}
+		case JSONType:
+			lists["mappings"] = []JSONMappingConfig{}
+		case ModbusType:
+			lists["mappings"] = []ModbusMappingsConfig{}
+		case CanBusType:
+			types = append(types, CanBusMapperConfig{})
+			lists["mappings"] = []CanBusMappingConfig{}
+		case BinaryType:
+			lists["mappings"] = []MappingConfig{}
+		case SignalKType:
+			lists["mappings"] = []ExpressionMappingConfig{}
+		case FftType:
+			lists["mappings"] = []FftConfig{}
+		case DerivedType:
+			types = append(types, DerivedConfig{})
+		case AlarmType:
+			types = append(types, AlarmsConfig{})
+		case NMEA0183Type:
+		default:
+			return nil, false
+		}
+	case ComponentFilter:
+		types = append(types, ReloadConfig{})
+		lists["mappings"] = []ExpressionMappingConfig{}
+	case ComponentPipeline:
+		types = append(types, PipelineConfig{})
+	case ComponentPriority:
+		types = append(types, SourcePrioritiesConfig{})
+	case ComponentRateLimit:
+		types = append(types, RateLimitFilterConfig{})
+	case ComponentCache:
+		types = append(types, BigCacheConfig{})
+	case ComponentTransfer:
+		types = append(types, TransferConfig{})
+	case ComponentTestData:
+		types = append(types, TestDataConfig{})
+	case ComponentSignalK:
+		types = append(types, SignalKConfig{})
+	case ComponentLWE:
+		types = append(types, LWEConfig{})
+	case ComponentMQTT:
+		types = append(types, MQTTConfig{})
+	case ComponentPostgresql:
+		types = append(types, PostgresqlConfig{})
+	case ComponentSchema:
+		types = append(types, SchemaConfig{})
+	case ComponentProxy:
+		types = append(types, ProxyConfig{})
+	case ComponentRun:
+		types = append(types, RunConfig{})
+	}
+
+	result := make(map[string]reflect.Type)
+	for _, t := range types {
+		structKeys(reflect.TypeOf(t), result)
+	}
+	for key, t := range lists {
+		result[strings.ToLower(key)] = reflect.TypeOf(t)
+	}
+	return result, true
+}
+
+// the keys of the struct in lower case, viper ignores the case of keys
+func structKeys(t reflect.Type, keys map[string]reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("mapstructure")
+		if !ok {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if options == "squash" {
+			structKeys(f.Type, keys)
+			continue
+		}
+		if name == "" || name == "-" || name == "_" || !f.IsExported() {
+			continue
+		}
+		keys[strings.ToLower(name)] = f.Type
+	}
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// reports the keys of the map node that are not in the schema, nested maps and lists are checked with the type of their key
+func (v *validation) checkKeys(node *yaml.Node, keys map[string]reflect.Type, at string) {
+	if node.Kind != yaml.MappingNode {
+		v.add(node.Line, "%s should be a map", at)
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		t, ok := keys[strings.ToLower(key.Value)]
+		if !ok {
+			v.add(key.Line, "unknown key %s", joinKey(at, key.Value))
+			continue
+		}
+		v.checkValue(value, t, joinKey(at, key.Value))
+	}
+}
+
+func (v *validation) checkValue(node *yaml.Node, t reflect.Type, at string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType || t == timeType || t == urlType || node.Kind == yaml.ScalarNode || node.Kind == yaml.AliasNode {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		keys := make(map[string]reflect.Type)
+		structKeys(t, keys)
+		v.checkKeys(node, keys, at)
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			v.add(node.Line, "%s should be a list", at)
+			return
+		}
+		for i, item := range node.Content {
+			v.checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", at, i))
+		}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface || node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.checkValue(node.Content[i+1], t.Elem(), joinKey(at, node.Content[i].Value))
+		}
+	}
+}
+
+func joinKey(at string, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+// the value of the key in the map node, nil when the key is missing
+func child(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// the line of the key in the map node, the line of the node when the key is missing
+func (v *validation) line(node *yaml.Node, key string) int {
+	if node == nil {
+		return 0
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i].Line
+		}
+	}
+	return node.Line
+}
+
+// the item of the list under the key of the top level map, used to find the line of an item
+func (v *validation) item(key string, index int) *yaml.Node {
+	return itemOf(v.root, key, index)
+}
+
+// the item of the list under the key, the map node itself when the list has no such item
+func itemOf(node *yaml.Node, key string, index int) *yaml.Node {
+	list := child(node, key)
+	if list == nil || list.Kind != yaml.SequenceNode || index >= len(list.Content) {
+		return node
+	}
+	return list.Content[index]
+}
+
+// decodes the file the same way the component does, errors are reported instead of exiting
+func (v *validation) load(result any, subKeys ...string) bool {
+	if err := loadConfigFile(result, v.file, subKeys...); err != nil {
+		line := v.root.Line
+		if len(subKeys) > 0 {
+			line = v.line(v.root, subKeys[0])
+		}
+		v.add(line, "could not decode the file: %s", err.Error())
+		return false
+	}
+	return true
+}
+
+func (v *validation) checkComponent(component string, protocolName string) {
+	switch component {
+	case ComponentConnector:
+		if protocolName == ModbusType {
+			var groups []RegisterGroupConfig
+			if v.load(&groups, "registerGroups") {
+				for i, g := range groups {
+					item := v.item("registerGroups", i)
+					v.checkModbusRead(item, g.ModbusHeader)
+					if !g.WriteBeforeRead.IsEmpty() {
+						v.checkModbusWrite(child(item, "writeBeforeRead"), g.WriteBeforeRead)
+					}
+				}
+			}
+		}
+	case ComponentMapper:
+		v.checkMapper(protocolName)
+	case ComponentFilter:
+		var mappings []*ExpressionMappingConfig
+		if v.load(&mappings, "mappings") {
+			v.checkExpressionMappings(SignalKType, mappings, false)
+		}
+	case ComponentPriority:
+		c := &SourcePrioritiesConfig{}
+		if v.load(c) {
+			for i, p := range c.Priorities {
+				item := v.item("priorities", i)
+				v.checkPath(item, "path", p.Path, true)
+				v.checkPath(item, "activePath", p.ActivePath, false)
+				if len(p.Sources) == 0 {
+					v.add(item.Line, "sources are not set")
+				}
+			}
+		}
+	case ComponentRateLimit:
+		c := &RateLimitFilterConfig{}
+		if v.load(c) {
+			for i, r := range c.Ratelimits {
+				item := v.item("rateLimits", i)
+				v.checkPath(item, "path", r.Path, true)
+				v.checkPath(item, "countPath", r.CountPath, false)
+				if err := r.verify(); err != nil {
+					v.add(item.Line, "%s", err.Error())
+				}
+			}
+		}
+	case ComponentSchema:
+		c := &SchemaConfig{}
+		if v.load(c) {
+			for i, p := range c.Paths {
+				item := v.item("schema", i)
+				// the schema adds paths so only the segments are checked, a * matches any segment
+				if p.Path == "" {
+					v.add(item.Line, "path is not set")
+				} else if err := verifySignalKPathSegments(strings.ReplaceAll(p.Path, "*", "any")); err != nil {
+					v.add(v.line(item, "path"), "path %s", err.Error())
+				}
+				for j, z := range p.Zones {
+					switch z.State {
+					case "nominal", "normal", "alert", "warn", "alarm", "emergency":
+					default:
+						v.add(v.line(itemOf(item, "zones", j), "state"), "%s is not a valid zone state", z.State)
+					}
+				}
+			}
+		}
+	case ComponentProxy:
+		c := &ProxyConfig{LivenessTimeout: time.Minute}
+		if v.load(c) {
+			for i, r := range c.Rules {
+				item := v.item("rules", i)
+				// the path is a prefix, e.g. navigation., so only the segments are checked
+				if r.Path != "" {
+					if err := verifySignalKPathSegments(strings.TrimSuffix(r.Path, ".")); err != nil {
+						v.add(v.line(item, "path"), "path %s", err.Error())
+					}
+				}
+			}
+			if err := c.verify(); err != nil {
+				v.add(v.root.Line, "%s", err.Error())
+			}
+		}
+	case ComponentRun:
+		c := defaultRunConfig()
+		if v.load(&c) {
+			for i, component := range c.Components {
+				if component.ConfigFile == "" {
+					continue
+				}
+				if _, err := os.Stat(component.ConfigFile); err != nil {
+					v.add(v.line(v.item("components", i), "config"), "%s", err.Error())
+				}
+			}
+			if err := c.verify(); err != nil {
+				v.add(v.root.Line, "%s", err.Error())
+			}
+		}
+	case ComponentPipeline:
+		c := &PipelineConfig{}
+		if v.load(c) {
+			for i, s := range c.Stages {
+				item := v.item("stages", i)
+				switch s.Type {
+				case PipelineStageFilter, PipelineStageRateLimit, PipelineStagePriority, SignalKType, FftType, DerivedType, AlarmType:
+				default:
+					v.add(v.line(item, "type"), "%s is not a supported stage type", s.Type)
+				}
+				if s.ConfigFile == "" {
+					v.add(item.Line, "config is not set")
+				}
+			}
+		}
+	}
+}
+
+func (v *validation) checkMapper(protocolName string) {
+	switch protocolName {
+	case CSVType:
+		var mappings []CSVMappingConfig
+		if v.load(&mappings, "mappings") {
+			for i := range mappings {
+				v.checkMapping(protocolName, v.item("mappings", i), &mappings[i].MappingConfig, nil)
+			}
+		}
+	case JSONType:
+		var mappings []JSONMappingConfig
+		if v.load(&mappings, "mappings") {
+			for i := range mappings {
+				v.checkMapping(protocolName, v.item("mappings", i), &mappings[i].MappingConfig, nil)
+			}
+		}
+	case ModbusType:
+		var mappings []ModbusMappingsConfig
+		if v.load(&mappings, "mappings") {
+			for i := range mappings {
+				item := v.item("mappings", i)
+				v.checkMapping(protocolName, item, &mappings[i].MappingConfig, nil)
+				v.checkModbusRead(item, mappings[i].ModbusHeader)
+			}
+		}
+	case CanBusType:
+		var mappings []CanBusMappingConfig
+		if v.load(&mappings, "mappings") {
+			for i := range mappings {
+				v.checkMapping(protocolName, v.item("mappings", i), &mappings[i].MappingConfig, nil)
+			}
+		}
+	case BinaryType:
+		var mappings []MappingConfig
+		if v.load(&mappings, "mappings") {
+			for i := range mappings {
+				v.checkMapping(protocolName, v.item("mappings", i), &mappings[i], nil)
+			}
+		}
+	case SignalKType:
+		var mappings []*ExpressionMappingConfig
+		if v.load(&mappings, "mappings") {
+			v.checkExpressionMappings(protocolName, mappings, true)
+		}
+	case FftType:
+		var mappings []*FftConfig
+		if v.load(&mappings, "mappings") {
+			for i, f := range mappings {
+				item := v.item("mappings", i)
+				v.checkPath(item, "path", f.Path, true)
+				v.checkPath(item, "spectrumPath", f.SpectrumPath, false)
+				v.checkPath(item, "rmsPath", f.RmsPath, false)
+				v.checkPath(item, "peaksPath", f.PeaksPath, f.NumberOfPeaks > 0)
+				for j, b := range f.Bands {
+					v.checkPath(itemOf(item, "bands", j), "path", b.Path, true)
+				}
+				switch f.Window {
+				case "", FftWindowHann, FftWindowHamming, FftWindowBlackman:
+				default:
+					v.add(v.line(item, "window"), "%s is not a supported window", f.Window)
+				}
+				if f.Overlap < 0 || f.Overlap >= 1 {
+					v.add(v.line(item, "overlap"), "overlap should be at least 0 and less than 1")
+				}
+			}
+		}
+	case AlarmType:
+		c := &AlarmsConfig{}
+		if v.load(c) {
+			for i, a := range c.Alarms {
+				item := v.item("alarms", i)
+				if a.Name == "" {
+					v.add(item.Line, "name is not set")
+				}
+				v.checkPath(item, "path", a.Path, true)
+				if a.Inhibit != "" && v.check != nil {
+					if err := v.check(AlarmType, a.Inhibit, nil, nil); err != nil {
+						v.add(v.line(item, "inhibit"), "inhibit does not compile: %s", firstLine(err.Error()))
+					}
+				}
+			}
+		}
+	}
+}
+
+// the source paths of all mappings are available to each expression of an aggregate, the mapper keeps the last value of each path
+func (v *validation) checkExpressionMappings(protocolName string, mappings []*ExpressionMappingConfig, outputPath bool) {
+	sourcePaths := make([]string, 0)
+	for _, m := range mappings {
+		sourcePaths = append(sourcePaths, m.SourcePaths...)
+	}
+	for i, m := range mappings {
+		item := v.item("mappings", i)
+		if outputPath {
+			v.checkMapping(protocolName, item, &m.MappingConfig, sourcePaths)
+		} else {
+			v.checkExpression(protocolName, item, &m.MappingConfig, sourcePaths)
+		}
+		if len(m.SourcePaths) == 0 {
+			v.add(item.Line, "sourcePaths are not set")
+		}
+		for j, s := range m.SourcePaths {
+			if err := verifySignalKPath(s); err != nil {
+				v.add(itemOf(item, "sourcePaths", j).Line, "source path %s", err.Error())
+			}
+		}
+	}
+}
+
+func (v *validation) checkMapping(protocolName string, item *yaml.Node, m *MappingConfig, sourcePaths []string) {
+	v.checkPath(item, "path", m.Path, true)
+	v.checkExpression(protocolName, item, m, sourcePaths)
+}
+
+func (v *validation) checkExpression(protocolName string, item *yaml.Node, m *MappingConfig, sourcePaths []string) {
+	if m.Expression == "" {
+		v.add(item.Line, "expression is not set")
+	} else if v.check != nil {
+		if err := v.check(protocolName, m.Expression, m.ExpressionEnvironment, sourcePaths); err != nil {
+			v.add(v.line(item, "expression"), "expression does not compile: %s", firstLine(err.Error()))
+		}
+	}
+	if m.TimestampExpression != "" && v.check != nil {
+		if err := v.check(protocolName, m.TimestampExpression, m.ExpressionEnvironment, sourcePaths); err != nil {
+			v.add(v.line(item, "timestampExpression"), "timestampExpression does not compile: %s", firstLine(err.Error()))
+		}
+	}
+}
+
+func (v *validation) checkPath(item *yaml.Node, key string, path string, required bool) {
+	if path == "" {
+		if required {
+			v.add(item.Line, "%s is not set", key)
+		}
+		return
+	}
+	if err := verifySignalKPath(path); err != nil {
+		v.add(v.line(item, key), "%s %s", key, err.Error())
+	}
+}
+
+func (v *validation) checkModbusRead(item *yaml.Node, h protocol.ModbusHeader) {
+	var maximum uint16
+	switch h.FunctionCode {
+	case protocol.ReadCoils, protocol.ReadDiscreteInputs:
+		maximum = protocol.MODBUS_MAXIMUM_NUMBER_OF_COILS
+	case protocol.ReadHoldingRegisters, protocol.ReadInputRegisters:
+		maximum = protocol.MODBUS_MAXIMUM_NUMBER_OF_REGISTERS
+	default:
+		v.add(v.line(item, "functionCode"), "%d is not a supported function code for reading", h.FunctionCode)
+		return
+	}
+	v.checkModbusRange(item, h, maximum)
+}
+
+func (v *validation) checkModbusWrite(item *yaml.Node, w ModbusWriteRequest) {
+	switch w.FunctionCode {
+	case protocol.WriteSingleCoil, protocol.WriteSingleRegister:
+		v.checkModbusRange(item, w.ModbusHeader, 1)
+	case protocol.WriteMultipleCoils:
+		v.checkModbusRange(item, w.ModbusHeader, protocol.MODBUS_MAXIMUM_NUMBER_OF_COILS)
+	case protocol.WriteMultipleRegisters:
+		v.checkModbusRange(item, w.ModbusHeader, protocol.MODBUS_MAXIMUM_NUMBER_OF_REGISTERS)
+	default:
+		v.add(v.line(item, "functionCode"), "%d is not a supported function code for writing", w.FunctionCode)
+	}
+}
+
+func (v *validation) checkModbusRange(item *yaml.Node, h protocol.ModbusHeader, maximum uint16) {
+	if h.Slave > 247 {
+		v.add(v.line(item, "slave"), "slave %d is not a valid address, the maximum is 247", h.Slave)
+	}
+	if h.NumberOfCoilsOrRegisters == 0 || h.NumberOfCoilsOrRegisters > maximum {
+		v.add(v.line(item, "numberOfCoilsOrRegisters"), "%d coils or registers can't be requested with function code %d, the maximum is %d", h.NumberOfCoilsOrRegisters, h.FunctionCode, maximum)
+	}
+	if int(h.Address)+int(h.NumberOfCoilsOrRegisters) > 1<<16 {
+		v.add(v.line(item, "address"), "address %d with %d coils or registers exceeds the address range", h.Address, h.NumberOfCoilsOrRegisters)
+	}
+}
+
+// the path has to be in the SignalK specification, in SIGNALK_PATHS.md or in the schema, see message.KnownPath
+func verifySignalKPath(path string) error {
+	if err := verifySignalKPathSegments(path); err != nil {
+		return err
+	}
+	if !message.KnownPath(path) {
+		return fmt.Errorf("%s is not in the SignalK schema, check the spelling or add the path to the schema", path)
+	}
+	return nil
+}
+
+// the first segment has to be a group of the SignalK schema, the other segments are identifiers or numbers
+func verifySignalKPathSegments(path string) error {
+	segments := strings.Split(path, ".")
+	if _, ok := signalKGroups[segments[0]]; !ok {
+		return fmt.Errorf("%s is not in the SignalK schema, %s is not a known group", path, segments[0])
+	}
+	for _, s := range segments {
+		if !signalKPathSegment.MatchString(s) {
+			return fmt.Errorf("%s is not a valid SignalK path, %q is not a valid segment", path, s)
+		}
+	}
+	return nil
+}
+
+// compile errors of expressions span multiple lines, the first line contains the message
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
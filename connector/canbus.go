@@ -2,7 +2,6 @@ package connector
 
 import (
 	"context"
-	"time"
 
 	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/logger"
@@ -14,23 +13,20 @@ import (
 )
 
 type CanBusConnector struct {
-	config  *config.ConnectorConfig
-	timeout *time.Timer
+	config *config.ConnectorConfig
 }
 
 func NewCanBusConnector(c *config.ConnectorConfig) (*CanBusConnector, error) {
 	return &CanBusConnector{
-		config:  c,
-		timeout: time.AfterFunc(c.Timeout, exit),
+		config: c,
 	}, nil
 }
 
-func (r *CanBusConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (r *CanBusConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
 	go func() {
-		for {
-			if err := r.receive(stream); err != nil {
+		for ctx.Err() == nil {
+			if err := r.receive(ctx, stream); err != nil {
 				logger.GetLogger().Warn(
 					"Error while receiving data for the stream",
 					zap.String("URL", r.config.URL.String()),
@@ -39,18 +35,21 @@ func (r *CanBusConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
 			}
 		}
 	}()
-	process(stream, r.config.Name, r.config.Protocol, publisher, r.timeout, r.config.Timeout)
+	process(ctx, stream, r.config.Name, r.config.Protocol, publisher, r.config.Timeout, r.config.ReadyTimeout)
 }
 
-func (*CanBusConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (*CanBusConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	// do nothing
 }
 
-func (r *CanBusConnector) receive(stream chan<- []byte) error {
-	conn, err := socketcan.DialContext(context.Background(), "can", r.config.URL.Host)
+func (r *CanBusConnector) receive(ctx context.Context, stream chan<- []byte) error {
+	conn, err := socketcan.DialContext(ctx, "can", r.config.URL.Host)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	recv := socketcan.NewReceiver(conn)
 	for recv.Receive() {
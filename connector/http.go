@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"sync"
@@ -16,19 +17,17 @@ import (
 type HttpConnector struct {
 	config    *config.ConnectorConfig
 	urlGroups []config.UrlGroupConfig
-	timeout   *time.Timer
 }
 
 func NewHttpConnector(c *config.ConnectorConfig, ugc []config.UrlGroupConfig) (*HttpConnector, error) {
-	return &HttpConnector{config: c, urlGroups: ugc, timeout: time.AfterFunc(c.Timeout, exit)}, nil
+	return &HttpConnector{config: c, urlGroups: ugc}, nil
 }
 
-func (r *HttpConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (r *HttpConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
 	go func() {
-		for {
-			if err := r.receive(stream); err != nil {
+		for ctx.Err() == nil {
+			if err := r.receive(ctx, stream); err != nil {
 				logger.GetLogger().Warn(
 					"Error while receiving data for the stream",
 					zap.String("URL", r.config.URL.String()),
@@ -37,21 +36,22 @@ func (r *HttpConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
 			}
 		}
 	}()
-	process(stream, r.config.Name, r.config.Protocol, publisher, r.timeout, r.config.Timeout)
+	process(ctx, stream, r.config.Name, r.config.Protocol, publisher, r.config.Timeout, r.config.ReadyTimeout)
 }
 
-func (*HttpConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (*HttpConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	// do nothing
 }
 
-func (h *HttpConnector) receive(stream chan<- []byte) error {
+func (h *HttpConnector) receive(ctx context.Context, stream chan<- []byte) error {
 	errors := make(chan error)
 	done := make(chan bool)
 	var wg sync.WaitGroup
 	wg.Add(len(h.urlGroups))
 	for _, url := range h.urlGroups {
 		go func(url config.UrlGroupConfig) {
-			h.poll(url, stream)
+			defer wg.Done()
+			h.poll(ctx, url, stream)
 		}(url)
 	}
 	go func() {
@@ -70,9 +70,8 @@ func (h *HttpConnector) receive(stream chan<- []byte) error {
 	return nil
 }
 
-func (h *HttpConnector) poll(ugc config.UrlGroupConfig, stream chan<- []byte) {
+func (h *HttpConnector) poll(ctx context.Context, ugc config.UrlGroupConfig, stream chan<- []byte) {
 	ticker := time.NewTicker(ugc.PollingInterval)
-	done := make(chan struct{})
 Loop:
 	for {
 		select {
@@ -90,7 +89,7 @@ Loop:
 			}
 			stream <- bytes
 			resp.Body.Close()
-		case <-done:
+		case <-ctx.Done():
 			ticker.Stop()
 			break Loop
 		}
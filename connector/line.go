@@ -2,6 +2,7 @@ package connector
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -20,12 +21,11 @@ import (
 type LineConnector struct {
 	config     *config.ConnectorConfig
 	connection io.ReadWriter
-	timeout    *time.Timer
 }
 
 func NewLineConnector(c *config.ConnectorConfig) (*LineConnector, error) {
 	var err error
-	l := &LineConnector{config: c, timeout: time.AfterFunc(c.Timeout, exit)}
+	l := &LineConnector{config: c}
 	l.connection, err = l.createConnection()
 	if err != nil {
 		return nil, err
@@ -33,12 +33,11 @@ func NewLineConnector(c *config.ConnectorConfig) (*LineConnector, error) {
 	return l, nil
 }
 
-func (r *LineConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (r *LineConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
 	go func() {
-		for {
-			if err := r.receive(stream); err != nil {
+		for ctx.Err() == nil {
+			if err := r.receive(ctx, stream); err != nil {
 				logger.GetLogger().Warn(
 					"Error while receiving data for the stream",
 					zap.String("URL", r.config.URL.String()),
@@ -47,14 +46,13 @@ func (r *LineConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
 			}
 		}
 	}()
-	process(stream, r.config.Name, r.config.Protocol, publisher, r.timeout, r.config.Timeout)
+	process(ctx, stream, r.config.Name, r.config.Protocol, publisher, r.config.Timeout, r.config.ReadyTimeout)
 }
 
-func (r *LineConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (r *LineConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	go func() {
 		receiveBuffer := make(chan *message.Raw, bufferCapacity)
-		defer close(receiveBuffer)
-		go subscriber.Receive(receiveBuffer)
+		go subscriber.Receive(ctx, receiveBuffer)
 
 		for raw := range receiveBuffer {
 			r.connection.Write(append(raw.Value, '\r', '\n'))
@@ -62,8 +60,8 @@ func (r *LineConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
 	}()
 }
 
-func (l *LineConnector) receive(stream chan<- []byte) error {
-	return l.scan(l.connection, stream)
+func (l *LineConnector) receive(ctx context.Context, stream chan<- []byte) error {
+	return l.scan(ctx, l.connection, stream)
 }
 
 func (l LineConnector) createConnection() (io.ReadWriter, error) {
@@ -177,9 +175,9 @@ func (l LineConnector) createFileConnection() (io.ReadWriter, error) {
 	return connection, nil
 }
 
-func (l LineConnector) scan(reader io.Reader, stream chan<- []byte) error {
+func (l LineConnector) scan(ctx context.Context, reader io.Reader, stream chan<- []byte) error {
 	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
+	for ctx.Err() == nil && scanner.Scan() {
 		stream <- scanner.Bytes()
 	}
 	if err := scanner.Err(); err != nil {
@@ -1,37 +1,72 @@
 package connector
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/message"
 	"github.com/munnik/gosk/nanomsg"
+	"go.uber.org/zap"
 )
 
 const bufferCapacity = 5000
 
-// Connector interface
+// Connector interface, Publish returns when the context is done and the received data is sent
 type Connector[T nanomsg.Message] interface {
-	Publish(publisher *nanomsg.Publisher[T])
-	Subscribe(subscriber *nanomsg.Subscriber[T])
+	Publish(ctx context.Context, publisher *nanomsg.Publisher[T])
+	Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[T])
 }
 
-func process(stream <-chan []byte, connector string, protocol string, publisher *nanomsg.Publisher[message.Raw], timeout *time.Timer, timeoutDuration time.Duration) {
+// sends the data of the stream until the context is done, the stream is closed or no data is received within the timeout,
+// the connector is ready when it received data within the ready timeout
+func process(ctx context.Context, stream <-chan []byte, connector string, protocol string, publisher *nanomsg.Publisher[message.Raw], timeoutDuration time.Duration, readyTimeout time.Duration) {
+	var lastReceived atomic.Int64
+	checkName := "connector " + connector
+	started := time.Now()
+	health.Register(checkName, func() error {
+		last := lastReceived.Load()
+		if last == 0 {
+			return health.FailingSince(started, errors.New("no data received yet"))
+		}
+		if since := time.Since(time.Unix(0, last)); since > readyTimeout {
+			return health.FailingSince(time.Unix(0, last).Add(readyTimeout), fmt.Errorf("no data received for %s", since.Round(time.Second)))
+		}
+		return nil
+	})
+	defer health.Unregister(checkName)
+
 	sendBuffer := make(chan *message.Raw, bufferCapacity)
-	defer close(sendBuffer)
 	go publisher.Send(sendBuffer)
+	defer func() {
+		close(sendBuffer)
+		<-publisher.Done()
+	}()
 
-	var m *message.Raw
-	for value := range stream {
-		timeout.Reset(timeoutDuration)
-		m = message.NewRaw().WithConnector(connector).WithValue(value).WithType(protocol)
-		sendBuffer <- m
+	timeout := time.NewTimer(timeoutDuration)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			logger.GetLogger().Warn(
+				"Timeout receiving data for the stream, no data received",
+				zap.String("Connector", connector),
+				zap.Duration("Timeout", timeoutDuration),
+			)
+			return
+		case value, ok := <-stream:
+			if !ok {
+				return
+			}
+			timeout.Reset(timeoutDuration)
+			lastReceived.Store(time.Now().UnixNano())
+			sendBuffer <- message.NewRaw().WithConnector(connector).WithValue(value).WithType(protocol)
+		}
 	}
 }
-
-func exit() {
-	logger.GetLogger().Warn("timeout receiving data for the stream, no data received")
-	os.Exit(0)
-
-}
@@ -1,11 +1,11 @@
 package connector
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
-	"os"
 	"time"
 
 	"github.com/munnik/gosk/config"
@@ -19,12 +19,11 @@ import (
 type MannerEthernetConnector struct {
 	config     *config.ConnectorConfig
 	connection io.ReadWriter
-	timeout    *time.Timer
 }
 
 func NewMannerEthernetConnector(c *config.ConnectorConfig) (*MannerEthernetConnector, error) {
 	var err error
-	l := &MannerEthernetConnector{config: c, timeout: time.AfterFunc(c.Timeout, exit)}
+	l := &MannerEthernetConnector{config: c}
 	l.connection, err = l.createConnection()
 	if err != nil {
 		return nil, err
@@ -32,13 +31,13 @@ func NewMannerEthernetConnector(c *config.ConnectorConfig) (*MannerEthernetConne
 	return l, nil
 }
 
-func (r *MannerEthernetConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (r *MannerEthernetConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
 	streamBuffer := make(chan byte, 4096)
-	defer close(streamBuffer)
-	r.readToChannel(streamBuffer)
+	r.readToChannel(ctx, streamBuffer)
 	go func() {
+		// the stream is closed when the connection is closed so the processing stops
+		defer close(stream)
 		for b := range streamBuffer {
 			if b&0b11000000 == 0b11000000 {
 				values := make([]byte, 0, 12)
@@ -50,7 +49,7 @@ func (r *MannerEthernetConnector) Publish(publisher *nanomsg.Publisher[message.R
 			}
 		}
 	}()
-	process(stream, r.config.Name, r.config.Protocol, publisher, r.timeout, r.config.Timeout)
+	process(ctx, stream, r.config.Name, r.config.Protocol, publisher, r.config.Timeout, r.config.ReadyTimeout)
 }
 
 func extractValue(streamBuffer chan byte) int {
@@ -66,27 +65,27 @@ func extractFirstValue(byte1 byte, streamBuffer chan byte) int {
 	res := int(byte1&0b00111111)<<10 + int(byte2&0b00111111)<<4 + int(byte3&0b00111100)>>2
 	return res
 }
-func (r *MannerEthernetConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (r *MannerEthernetConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	go func() {
 		receiveBuffer := make(chan *message.Raw, bufferCapacity)
-		defer close(receiveBuffer)
-		go subscriber.Receive(receiveBuffer)
+		go subscriber.Receive(ctx, receiveBuffer)
 
 		for raw := range receiveBuffer {
 			r.connection.Write(append(raw.Value, '\r', '\n'))
 		}
 	}()
 }
-func (r MannerEthernetConnector) readToChannel(streamBuffer chan byte) {
+func (r MannerEthernetConnector) readToChannel(ctx context.Context, streamBuffer chan byte) {
 	go func() {
+		defer close(streamBuffer)
 		buffer := make([]byte, 1024)
-		for {
+		for ctx.Err() == nil {
 			n, err := r.connection.Read(buffer)
 			if err != nil {
 				logger.GetLogger().Error("Error reading from the network stream", zap.Error(err))
 			}
 			if err == io.ErrUnexpectedEOF {
-				os.Exit(0)
+				return
 			}
 			for i := 0; i < n; i++ {
 				streamBuffer <- buffer[i]
@@ -1,9 +1,9 @@
 package connector
 
 import (
+	"context"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/logger"
@@ -19,7 +19,6 @@ type ModbusConnector struct {
 	config               *config.ConnectorConfig
 	registerGroupsConfig []config.RegisterGroupConfig
 	realClient           *modbus.Client
-	timeout              *time.Timer
 	lock                 *sync.Mutex
 }
 
@@ -84,17 +83,15 @@ func NewModbusConnector(c *config.ConnectorConfig, rgcs []config.RegisterGroupCo
 		config:               c,
 		registerGroupsConfig: rgcs,
 		realClient:           realClient,
-		timeout:              time.AfterFunc(c.Timeout, exit),
 		lock:                 &sync.Mutex{},
 	}, nil
 }
 
-func (m *ModbusConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (m *ModbusConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
 	go func() {
-		for {
-			if err := m.receive(stream); err != nil {
+		for ctx.Err() == nil {
+			if err := m.receive(ctx, stream); err != nil {
 				logger.GetLogger().Warn(
 					"Error while receiving data for the stream",
 					zap.String("URL", m.config.URL.String()),
@@ -103,10 +100,10 @@ func (m *ModbusConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
 			}
 		}
 	}()
-	process(stream, m.config.Name, m.config.Protocol, publisher, m.timeout, m.config.Timeout)
+	process(ctx, stream, m.config.Name, m.config.Protocol, publisher, m.config.Timeout, m.config.ReadyTimeout)
 }
 
-func (m *ModbusConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (m *ModbusConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	go func() {
 		client := protocol.NewModbusClient(
 			m.realClient,
@@ -116,8 +113,7 @@ func (m *ModbusConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw])
 			m.lock,
 		)
 		receiveBuffer := make(chan *message.Raw, bufferCapacity)
-		defer close(receiveBuffer)
-		go subscriber.Receive(receiveBuffer)
+		go subscriber.Receive(ctx, receiveBuffer)
 
 		for raw := range receiveBuffer {
 			if _, err := client.Write(raw.Value); err != nil {
@@ -131,7 +127,7 @@ func (m *ModbusConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw])
 	}()
 }
 
-func (m *ModbusConnector) receive(stream chan<- []byte) error {
+func (m *ModbusConnector) receive(ctx context.Context, stream chan<- []byte) error {
 	errors := make(chan error)
 	defer close(errors)
 	done := make(chan bool)
@@ -1,9 +1,9 @@
 package connector
 
 import (
+	"context"
 	"fmt"
 	"sync"
-	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/munnik/gosk/config"
@@ -16,7 +16,6 @@ type MQTTConnector struct {
 	config     *config.ConnectorConfig
 	mqttConfig *config.MQTTConfig
 	mqttClient *mqtt.Client
-	timeout    *time.Timer
 	lock       *sync.Mutex
 }
 
@@ -24,7 +23,6 @@ func NewMQTTConnector(c *config.ConnectorConfig, mqttC *config.MQTTConfig) (*MQT
 	m := MQTTConnector{
 		config:     c,
 		mqttConfig: mqttC,
-		timeout:    time.AfterFunc(c.Timeout, exit),
 		lock:       &sync.Mutex{},
 	}
 	if mqttC.Topic == "" {
@@ -33,20 +31,24 @@ func NewMQTTConnector(c *config.ConnectorConfig, mqttC *config.MQTTConfig) (*MQT
 	return &m, nil
 }
 
-func (m *MQTTConnector) Publish(publisher *nanomsg.Publisher[message.Raw]) {
+func (m *MQTTConnector) Publish(ctx context.Context, publisher *nanomsg.Publisher[message.Raw]) {
 	stream := make(chan []byte, 1)
-	defer close(stream)
-	m.mqttClient = mqtt.New(m.mqttConfig, m.handleMessageReceived(stream), m.mqttConfig.Topic)
-	process(stream, m.config.Name, m.config.Protocol, publisher, m.timeout, m.config.Timeout)
+	// stops the handlers that wait for the stream when the processing stops before the context is done
+	handlerCtx, cancel := context.WithCancel(ctx)
+	m.mqttClient = mqtt.New(m.mqttConfig, m.handleMessageReceived(handlerCtx, stream), m.mqttConfig.Topic)
+	defer m.mqttClient.Disconnect()
+	defer cancel()
+	process(ctx, stream, m.config.Name, m.config.Protocol, publisher, m.config.Timeout, m.config.ReadyTimeout)
 }
 
-func (m *MQTTConnector) Subscribe(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (m *MQTTConnector) Subscribe(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	// don't support writing to mqtt via the connector yet, use the writer
 }
-func (m *MQTTConnector) handleMessageReceived(stream chan<- []byte) paho.MessageHandler {
+func (m *MQTTConnector) handleMessageReceived(ctx context.Context, stream chan<- []byte) paho.MessageHandler {
 	return func(c paho.Client, message paho.Message) {
-		stream <- message.Payload()
-		// fmt.Println(message.Topic(), string(message.Payload()))
-
+		select {
+		case stream <- message.Payload():
+		case <-ctx.Done():
+		}
 	}
 }
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileState struct {
+	Time  time.Time       `json:"time"`
+	State json.RawMessage `json:"state"`
+}
+
+// Stores each snapshot as a json file in a directory
+type FileStateStore struct {
+	directory string
+}
+
+func NewFileStateStore(directory string) *FileStateStore {
+	return &FileStateStore{directory: directory}
+}
+
+// The key is escaped so keys that contain a path are stored in the directory as well
+func (s *FileStateStore) fileName(key string) string {
+	return filepath.Join(s.directory, url.QueryEscape(key)+".state.json")
+}
+
+func (s *FileStateStore) SaveState(key string, state []byte) error {
+	b, err := json.Marshal(fileState{Time: time.Now(), State: state})
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a partial snapshot
+	tmp := s.fileName(key) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.fileName(key))
+}
+
+func (s *FileStateStore) LoadState(key string) ([]byte, time.Time, error) {
+	b, err := os.ReadFile(s.fileName(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var snapshot fileState
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, time.Time{}, err
+	}
+	return snapshot.State, snapshot.Time, nil
+}
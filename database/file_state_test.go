@@ -0,0 +1,38 @@
+package database_test
+
+import (
+	"time"
+
+	. "github.com/munnik/gosk/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File state store", func() {
+	var store *FileStateStore
+	BeforeEach(func() {
+		store = NewFileStateStore(GinkgoT().TempDir())
+	})
+
+	It("returns no state when nothing was saved", func() {
+		state, timestamp, err := store.LoadState("testingKey")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(BeNil())
+		Expect(timestamp.IsZero()).To(BeTrue())
+	})
+	It("loads the saved state", func() {
+		Expect(store.SaveState("testingKey", []byte(`{"testingPath":1}`))).To(Succeed())
+		Expect(store.SaveState("testingKey", []byte(`{"testingPath":2}`))).To(Succeed())
+		state, timestamp, err := store.LoadState("testingKey")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(MatchJSON(`{"testingPath":2}`))
+		Expect(timestamp).To(BeTemporally("~", time.Now(), time.Second))
+	})
+	It("stores keys that contain a path", func() {
+		Expect(store.SaveState("modbus:/etc/gosk/a.yaml", []byte(`{"testingPath":1}`))).To(Succeed())
+		Expect(store.SaveState("modbus:/etc/gosk/b.yaml", []byte(`{"testingPath":2}`))).To(Succeed())
+		state, _, err := store.LoadState("modbus:/etc/gosk/a.yaml")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(MatchJSON(`{"testingPath":1}`))
+	})
+})
@@ -1,6 +1,10 @@
 package database
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/message"
 )
 
@@ -18,3 +22,20 @@ type DatabaseCountReader interface {
 	ReadRawCount(where string, arguments ...interface{}) (int, error)
 	ReadMappedCount(where string, arguments ...interface{}) (int, error)
 }
+
+// Stores snapshots of the state of a mapper, a snapshot is identified by a key
+type StateStore interface {
+	SaveState(key string, state []byte) error
+	LoadState(key string) ([]byte, time.Time, error) // returns no state and no error when there is no snapshot for the key
+}
+
+func NewStateStore(c *config.StateConfig) (StateStore, error) {
+	switch c.Store {
+	case config.StateStoreFile:
+		return NewFileStateStore(c.Directory), nil
+	case config.StateStorePostgresql:
+		return NewPostgresqlDatabase(&c.PostgresqlConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown state store %s", c.Store)
+	}
+}
@@ -0,0 +1 @@
+DROP TABLE "alarm_history";
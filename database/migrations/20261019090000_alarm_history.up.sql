@@ -0,0 +1,10 @@
+CREATE TABLE "alarm_history" (
+    "time" TIMESTAMP WITH TIME ZONE NOT NULL, 
+    "context" TEXT NOT NULL, 
+    "path" TEXT NOT NULL, 
+    "event" TEXT NOT NULL, 
+    "state" TEXT NOT NULL, 
+    "message" TEXT NOT NULL
+);
+
+SELECT "public".create_hypertable('alarm_history', 'time');
@@ -0,0 +1 @@
+DROP TABLE "mapper_state";
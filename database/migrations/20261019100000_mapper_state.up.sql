@@ -0,0 +1,5 @@
+CREATE TABLE "mapper_state" (
+    "key" TEXT NOT NULL PRIMARY KEY, 
+    "time" TIMESTAMP WITH TIME ZONE NOT NULL, 
+    "state" JSONB NOT NULL
+);
@@ -0,0 +1,9 @@
+CREATE TABLE "dead_letters" (
+    "time" TIMESTAMP WITH TIME ZONE NOT NULL, 
+    "mapper" TEXT NOT NULL, 
+    "mapping" TEXT NOT NULL, 
+    "error" TEXT NOT NULL, 
+    "message" JSONB NOT NULL
+);
+
+SELECT "public".create_hypertable('dead_letters', 'time');
@@ -3,10 +3,12 @@ package database
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -19,6 +21,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/tracelog"
 	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/message"
 	"github.com/prometheus/client_golang/prometheus"
@@ -38,6 +41,10 @@ const (
 	logTransferInsertQuery         = `INSERT INTO "transfer_log" ("time", "origin", "message") VALUES (NOW(), $1, $2)`
 	selectMappedCountPerUuid       = `SELECT "uuid", COUNT("uuid") FROM "mapped_data" WHERE "origin" = $1 AND "time" BETWEEN $2 AND $2 + '5m'::interval GROUP BY 1`
 	selectFirstMappedDataPerOrigin = `SELECT "origin", MIN("start") FROM "transfer_local_data" GROUP BY 1`
+	stateUpsertQuery               = `INSERT INTO "mapper_state" ("key", "time", "state") VALUES ($1, NOW(), $2) ON CONFLICT ("key") DO UPDATE SET "time" = EXCLUDED.time, "state" = EXCLUDED.state`
+	selectStateQuery               = `SELECT "state", "time" FROM "mapper_state" WHERE "key" = $1`
+	alarmEventInsertQuery          = `INSERT INTO "alarm_history" ("time", "context", "path", "event", "state", "message") VALUES ($1, $2, $3, $4, $5, $6)`
+	deadLetterInsertQuery          = `INSERT INTO "dead_letters" ("time", "mapper", "mapping", "error", "message") VALUES ($1, $2, $3, $4, $5)`
 )
 
 //go:embed migrations/*.sql
@@ -66,6 +73,16 @@ type PostgresqlDatabase struct {
 	writesCounter   prometheus.Counter
 	timeoutsCounter prometheus.Counter
 	batchSizeGauge  prometheus.Gauge
+	stop            chan struct{}
+	flushes         sync.WaitGroup // the running flushes, Close waits for them
+	flushError      atomic.Pointer[flushFailure]
+	checkName       string // the name of the readiness check, it fails when the last flush failed
+}
+
+// the error of the last flush and the time the first of the failing flushes failed
+type flushFailure struct {
+	err   error
+	since time.Time
 }
 
 func NewPostgresqlDatabase(c *config.PostgresqlConfig) *PostgresqlDatabase {
@@ -81,11 +98,21 @@ func NewPostgresqlDatabase(c *config.PostgresqlConfig) *PostgresqlDatabase {
 		writesCounter:   promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_writes_total", Help: "total number of deltas added to queue"}),
 		timeoutsCounter: promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_psql_timeouts_total", Help: "total number timeouts"}),
 		batchSizeGauge:  promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_psql_batch_length", Help: "number of deltas in current batch"}),
+		stop:            make(chan struct{}),
+		checkName:       health.InstanceName("database"),
 	}
+	health.Register(result.checkName, result.FlushError)
+	result.flushes.Add(1)
 	go func() {
+		defer result.flushes.Done()
 		ticker := time.NewTicker(c.BatchFlushInterval)
+		defer ticker.Stop()
 		for {
-			<-ticker.C
+			select {
+			case <-result.stop:
+				return
+			case <-ticker.C:
+			}
 			if time.Now().After(result.lastFlush.Add(c.BatchFlushInterval)) {
 				result.flushBatch()
 			}
@@ -165,7 +192,7 @@ func (db *PostgresqlDatabase) WriteRaw(raw *message.Raw) {
 
 	db.batchSizeGauge.Inc()
 	if db.batch.Len() > db.batchSize {
-		go db.flushBatch()
+		db.flushInBackground()
 	}
 }
 
@@ -229,7 +256,7 @@ func (db *PostgresqlDatabase) WriteSingleValueMapped(svm message.SingleValueMapp
 
 	db.batchSizeGauge.Inc()
 	if db.batch.Len() > db.batchSize {
-		go db.flushBatch()
+		db.flushInBackground()
 	}
 }
 
@@ -295,7 +322,7 @@ func (db *PostgresqlDatabase) updateStaticData(context, path string, value any)
 
 	db.batchSizeGauge.Inc()
 	if db.batch.Len() > db.batchSize {
-		go db.flushBatch()
+		db.flushInBackground()
 	}
 }
 
@@ -330,7 +357,7 @@ func (db *PostgresqlDatabase) ReadMostRecentMapped(fromTime time.Time) ([]*messa
 		if err != nil {
 			return nil, err
 		}
-		if m.Value, err = message.Decode(m.Value); err != nil {
+		if m.Value, err = message.GetSchema().Decode(m.Path, m.Value); err != nil {
 			logger.GetLogger().Warn(
 				"Could not decode value",
 				zap.String("Error", err.Error()),
@@ -380,7 +407,7 @@ func (db *PostgresqlDatabase) ReadMapped(appendToQuery string, arguments ...inte
 		if err != nil {
 			return nil, err
 		}
-		if m.Value, err = message.Decode(m.Value); err != nil {
+		if m.Value, err = message.GetSchema().Decode(m.Path, m.Value); err != nil {
 			logger.GetLogger().Warn(
 				"Could not decode value",
 				zap.String("Error", err.Error()),
@@ -586,6 +613,68 @@ func (db *PostgresqlDatabase) LogTransferRequest(origin string, message interfac
 	return err
 }
 
+func (db *PostgresqlDatabase) WriteAlarmEvent(timestamp time.Time, mappedContext string, path string, event string, state string, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), db.databaseTimeout)
+	defer cancel()
+	_, err := db.GetConnection().Exec(ctx, alarmEventInsertQuery, timestamp, mappedContext, path, event, state, message)
+	if ctx.Err() != nil {
+		logger.GetLogger().Error("Timeout during database insertion")
+		db.timeoutsCounter.Inc()
+		return ctx.Err()
+	}
+	return err
+}
+
+// The original message is stored as json so it can be queried
+func (db *PostgresqlDatabase) WriteDeadLetter(deadLetter *message.DeadLetter) error {
+	var original any = deadLetter.Mapped
+	if deadLetter.Raw != nil {
+		original = deadLetter.Raw
+	}
+	bytes, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), db.databaseTimeout)
+	defer cancel()
+	_, err = db.GetConnection().Exec(ctx, deadLetterInsertQuery, deadLetter.Timestamp, deadLetter.Mapper, deadLetter.Mapping, deadLetter.Error, bytes)
+	if ctx.Err() != nil {
+		logger.GetLogger().Error("Timeout during database insertion")
+		db.timeoutsCounter.Inc()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (db *PostgresqlDatabase) SaveState(key string, state []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), db.databaseTimeout)
+	defer cancel()
+	_, err := db.GetConnection().Exec(ctx, stateUpsertQuery, key, state)
+	if ctx.Err() != nil {
+		logger.GetLogger().Error("Timeout during database insertion")
+		db.timeoutsCounter.Inc()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (db *PostgresqlDatabase) LoadState(key string) ([]byte, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), db.databaseTimeout)
+	defer cancel()
+	var state []byte
+	var timestamp time.Time
+	err := db.GetConnection().QueryRow(ctx, selectStateQuery, key).Scan(&state, &timestamp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, time.Time{}, nil
+	}
+	if ctx.Err() != nil {
+		logger.GetLogger().Error("Timeout during database query")
+		db.timeoutsCounter.Inc()
+		return nil, time.Time{}, ctx.Err()
+	}
+	return state, timestamp, err
+}
+
 func (db *PostgresqlDatabase) UpgradeDatabase() error {
 	if db.upgradeDone {
 		return nil
@@ -623,6 +712,46 @@ func (db *PostgresqlDatabase) DowngradeDatabase() error {
 	return nil
 }
 
+// the batch is flushed without blocking the writer
+func (db *PostgresqlDatabase) flushInBackground() {
+	db.flushes.Add(1)
+	go func() {
+		defer db.flushes.Done()
+		db.flushBatch()
+	}()
+}
+
+// Close stops the periodic flushes, flushes the queued queries and closes the connection. The queries are flushed once
+// and are lost when the flush fails.
+func (db *PostgresqlDatabase) Close() {
+	health.Unregister(db.checkName)
+	close(db.stop)
+	db.flushes.Wait()
+	if batchToFlush := db.copyBatch(); batchToFlush != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), db.databaseTimeout)
+		defer cancel()
+		if err := db.GetConnection().SendBatch(ctx, batchToFlush).Close(); err != nil {
+			logger.GetLogger().Error(
+				"Could not flush the queued queries before closing, the queries are lost",
+				zap.Int("Queries", batchToFlush.Len()),
+				zap.String("Error", err.Error()),
+			)
+		} else {
+			logger.GetLogger().Info(
+				"Flushed the queued queries before closing",
+				zap.Int("Queries", batchToFlush.Len()),
+			)
+			db.lastFlush = time.Now()
+			db.lastFlushGauge.SetToCurrentTime()
+		}
+	}
+	db.connectionMutex.Lock()
+	defer db.connectionMutex.Unlock()
+	if db.connection != nil {
+		db.connection.Close()
+	}
+}
+
 func (db *PostgresqlDatabase) flushBatch() {
 	// db.flushMutex.Lock() // make sure only one flush runs at the same time, to prevent deadlocks
 	// defer db.flushMutex.Unlock()
@@ -643,6 +772,11 @@ func (db *PostgresqlDatabase) flushBatch() {
 	result := db.GetConnection().SendBatch(ctx, batchToFlush)
 
 	if err := result.Close(); err != nil {
+		failure := &flushFailure{err: err, since: time.Now()}
+		if previous := db.flushError.Load(); previous != nil {
+			failure.since = previous.since
+		}
+		db.flushError.Store(failure)
 		if ctx.Err() != nil {
 			logger.GetLogger().Error("Timeout during database insertion", zap.Error(ctx.Err()), zap.Error(err))
 			db.timeoutsCounter.Inc()
@@ -665,10 +799,19 @@ func (db *PostgresqlDatabase) flushBatch() {
 		zap.String("uuid", uuid.String()),
 		zap.Duration("duration", time.Since(start)),
 	)
+	db.flushError.Store(nil)
 	db.lastFlush = time.Now()
 	db.lastFlushGauge.SetToCurrentTime()
 }
 
+// The error of the last flush, nil when the last flush succeeded or nothing is flushed yet
+func (db *PostgresqlDatabase) FlushError() error {
+	if f := db.flushError.Load(); f != nil {
+		return health.FailingSince(f.since, fmt.Errorf("the last flush failed: %w", f.err))
+	}
+	return nil
+}
+
 func (db *PostgresqlDatabase) copyBatch() *pgx.Batch {
 	db.batchMutex.Lock()
 	defer db.batchMutex.Unlock()
@@ -0,0 +1,202 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusReady     = "ready"
+	StatusNotReady  = "notReady"
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+)
+
+// A check returns an error when a part of the component doesn't work, e.g. a subscriber that is not connected. The check
+// returns a Failure when the component knows since when it doesn't work, otherwise the failure is timed when the checks
+// run.
+type Check func() error
+
+// The error of a part of the component that doesn't work since the time the component recorded
+type Failure struct {
+	Since time.Time
+	Err   error
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Reports that the check fails since the time, a zero time is the same as not knowing since when the check fails
+func FailingSince(since time.Time, err error) error {
+	return &Failure{Since: since, Err: err}
+}
+
+type CheckStatus struct {
+	Name         string     `json:"name"`
+	OK           bool       `json:"ok"`
+	Error        string     `json:"error,omitempty"`
+	FailingSince *time.Time `json:"failingSince,omitempty"` // when the check failed for the first time since it last passed
+	Unhealthy    bool       `json:"unhealthy,omitempty"`    // the check failed for longer than the unhealthy timeout
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckStatus `json:"checks"`
+}
+
+type registered struct {
+	check        Check
+	failingSince time.Time
+}
+
+// Registry keeps the checks of a component. The component is ready when all checks pass and unhealthy when a check fails
+// for longer than the unhealthy timeout, a component that is not ready might recover by itself but an unhealthy component
+// should be restarted. The checks run when the status is requested.
+type Registry struct {
+	mutex          sync.Mutex
+	checks         map[string]*registered
+	unhealthyAfter time.Duration
+}
+
+func NewRegistry(unhealthyAfter time.Duration) *Registry {
+	return &Registry{checks: make(map[string]*registered), unhealthyAfter: unhealthyAfter}
+}
+
+// Adds the check, a check with the same name is replaced
+func (r *Registry) Register(name string, check Check) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checks[name] = &registered{check: check}
+}
+
+func (r *Registry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.checks, name)
+}
+
+func (r *Registry) SetUnhealthyAfter(d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unhealthyAfter = d
+}
+
+// Runs the checks, the statuses are sorted by name
+func (r *Registry) Evaluate() []CheckStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	result := make([]CheckStatus, 0, len(r.checks))
+	for name, c := range r.checks {
+		status := CheckStatus{Name: name, OK: true}
+		if err := c.check(); err != nil {
+			var f *Failure
+			if errors.As(err, &f) && !f.Since.IsZero() {
+				c.failingSince = f.Since
+			} else if c.failingSince.IsZero() {
+				c.failingSince = now
+			}
+			since := c.failingSince
+			status.OK = false
+			status.Error = err.Error()
+			status.FailingSince = &since
+			status.Unhealthy = now.Sub(since) >= r.unhealthyAfter
+		} else {
+			c.failingSince = time.Time{}
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Ready when all checks pass
+func (r *Registry) Readiness() Report {
+	result := Report{Status: StatusReady, Checks: r.Evaluate()}
+	for _, c := range result.Checks {
+		if !c.OK {
+			result.Status = StatusNotReady
+		}
+	}
+	return result
+}
+
+// Healthy unless a check fails for longer than the unhealthy timeout
+func (r *Registry) Health() Report {
+	result := Report{Status: StatusHealthy, Checks: r.Evaluate()}
+	for _, c := range result.Checks {
+		if c.Unhealthy {
+			result.Status = StatusUnhealthy
+		}
+	}
+	return result
+}
+
+// Serves the readiness, the status code is 503 when the component is not ready
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := r.Readiness()
+		serve(w, report, report.Status == StatusReady)
+	})
+}
+
+// Serves the health, the status code is 503 when the component is unhealthy
+func (r *Registry) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := r.Health()
+		serve(w, report, report.Status == StatusHealthy)
+	})
+}
+
+func serve(w http.ResponseWriter, report Report, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// the checks of this process, the components register their checks here
+var defaultRegistry = NewRegistry(5 * time.Minute)
+
+var instances atomic.Int64
+
+// The name of the check of one instance of a part, the empty parts of the description are left out. Parts with the same
+// description get their own check so unregistering the check of one part doesn't remove the check of the others.
+func InstanceName(description ...string) string {
+	return fmt.Sprintf("%s #%d", strings.Join(slices.DeleteFunc(description, func(d string) bool { return d == "" }), " "), instances.Add(1))
+}
+
+func Register(name string, check Check) {
+	defaultRegistry.Register(name, check)
+}
+
+func Unregister(name string) {
+	defaultRegistry.Unregister(name)
+}
+
+func SetUnhealthyAfter(d time.Duration) {
+	defaultRegistry.SetUnhealthyAfter(d)
+}
+
+func ReadinessHandler() http.Handler {
+	return defaultRegistry.ReadinessHandler()
+}
+
+func HealthHandler() http.Handler {
+	return defaultRegistry.HealthHandler()
+}
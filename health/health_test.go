@@ -0,0 +1,105 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/munnik/gosk/health"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("health.Registry", func() {
+	var (
+		registry *health.Registry
+		failing  error
+	)
+	get := func(h http.Handler) (int, health.Report) {
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report health.Report
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &report)).To(Succeed())
+		return recorder.Code, report
+	}
+
+	BeforeEach(func() {
+		registry = health.NewRegistry(50 * time.Millisecond)
+		failing = nil
+		registry.Register("subscriber", func() error { return nil })
+		registry.Register("database", func() error { return failing })
+	})
+
+	It("is ready when all checks pass", func() {
+		code, report := get(registry.ReadinessHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Status).To(Equal(health.StatusReady))
+		Expect(report.Checks).To(HaveLen(2))
+		Expect(report.Checks[0]).To(And(HaveField("Name", "database"), HaveField("OK", true)))
+	})
+	It("is not ready but healthy when a check just started failing", func() {
+		failing = errors.New("the last flush failed")
+		code, report := get(registry.ReadinessHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Status).To(Equal(health.StatusNotReady))
+		Expect(report.Checks[0]).To(And(HaveField("OK", false), HaveField("Error", "the last flush failed"), HaveField("FailingSince", Not(BeNil()))))
+		Expect(report.Checks[1]).To(HaveField("OK", true))
+
+		code, report = get(registry.HealthHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Status).To(Equal(health.StatusHealthy))
+	})
+	It("is unhealthy when a check fails for longer than the unhealthy timeout", func() {
+		failing = errors.New("the last flush failed")
+		registry.Evaluate()
+		time.Sleep(60 * time.Millisecond)
+		code, report := get(registry.HealthHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Status).To(Equal(health.StatusUnhealthy))
+		Expect(report.Checks[0]).To(HaveField("Unhealthy", true))
+
+		failing = nil
+		code, report = get(registry.HealthHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Checks[0]).To(And(HaveField("OK", true), HaveField("FailingSince", BeNil())))
+	})
+	It("removes the unregistered checks", func() {
+		failing = errors.New("the last flush failed")
+		registry.Unregister("database")
+		_, report := get(registry.ReadinessHandler())
+		Expect(report.Status).To(Equal(health.StatusReady))
+		Expect(report.Checks).To(HaveLen(1))
+	})
+	It("uses the time the component reports as the start of the failure", func() {
+		since := time.Now().Add(-time.Minute).UTC()
+		failing = health.FailingSince(since, errors.New("the last flush failed"))
+		code, report := get(registry.HealthHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Checks[0]).To(And(HaveField("Error", "the last flush failed"), HaveField("Unhealthy", true)))
+		Expect(*report.Checks[0].FailingSince).To(BeTemporally("==", since))
+
+		later := since.Add(30 * time.Second)
+		failing = health.FailingSince(later, errors.New("the last flush failed"))
+		_, report = get(registry.HealthHandler())
+		Expect(*report.Checks[0].FailingSince).To(BeTemporally("==", later))
+	})
+	It("times the failure when the component doesn't report the time", func() {
+		failing = health.FailingSince(time.Time{}, errors.New("the last flush failed"))
+		before := time.Now()
+		_, report := get(registry.ReadinessHandler())
+		Expect(*report.Checks[0].FailingSince).To(BeTemporally(">=", before))
+		Expect(report.Checks[0]).To(HaveField("Unhealthy", false))
+	})
+	It("names the checks of parts with the same description differently", func() {
+		first, second := health.InstanceName("subscriber", "tcp://localhost:6000", ""), health.InstanceName("subscriber", "tcp://localhost:6000", "")
+		Expect(first).To(HavePrefix("subscriber tcp://localhost:6000 #"))
+		Expect(first).ToNot(Equal(second))
+		registry.Register(first, func() error { return nil })
+		registry.Register(second, func() error { return errors.New("not connected to the publisher") })
+		registry.Unregister(first)
+		_, report := get(registry.ReadinessHandler())
+		Expect(report.Status).To(Equal(health.StatusNotReady))
+	})
+})
@@ -30,20 +30,17 @@ import (
 // var version = "undefined" // overwritten by Makefile
 
 func main() {
+	// SIGINT and SIGTERM are handled by the commands so they can shut down gracefully
 	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel)
+	signal.Notify(signalChannel, syscall.SIGQUIT)
 	go func() {
-		for {
-			s := <-signalChannel
-			// https://www.computerhope.com/unix/signals.htm
-			if s == syscall.SIGQUIT || s == syscall.SIGTERM || s == syscall.SIGINT {
-				logger.GetLogger().Error(
-					"Receive a signal from to OS to stop the application",
-					zap.String("Signal", s.String()),
-				)
-				os.Exit(0)
-			}
-		}
+		s := <-signalChannel
+		// https://www.computerhope.com/unix/signals.htm
+		logger.GetLogger().Error(
+			"Receive a signal from to OS to stop the application",
+			zap.String("Signal", s.String()),
+		)
+		os.Exit(0)
 	}()
 
 	cmd.Execute()
@@ -1,6 +1,8 @@
 package mapper
 
 import (
+	"context"
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -14,13 +16,21 @@ type AggregateMapper struct {
 	config            config.MapperConfig
 	protocol          string
 	retentionTime     time.Duration
+	mappingsConfig    []*config.ExpressionMappingConfig
 	aggregateMappings map[string][]*config.ExpressionMappingConfig
 	env               ExpressionEnvironment
+	deadLetterSink
 }
 
 func NewAggregateMapper(c config.MapperConfig, emc []*config.ExpressionMappingConfig) (*AggregateMapper, error) {
 	env := NewExpressionEnvironment()
 	env["history"] = make(map[string][]message.SingleValueMapped, 0)
+	m := &AggregateMapper{config: c, protocol: config.SignalKType, env: env}
+	m.setMappings(emc)
+	return m, nil
+}
+
+func (m *AggregateMapper) setMappings(emc []*config.ExpressionMappingConfig) {
 	retentionTime := 0 * time.Second
 	mappings := make(map[string][]*config.ExpressionMappingConfig)
 	for _, m := range emc {
@@ -31,11 +41,30 @@ func NewAggregateMapper(c config.MapperConfig, emc []*config.ExpressionMappingCo
 			retentionTime = m.RetentionTime
 		}
 	}
-	return &AggregateMapper{config: c, protocol: config.SignalKType, retentionTime: retentionTime, aggregateMappings: mappings, env: env}, nil
+	m.retentionTime = retentionTime
+	m.mappingsConfig = emc
+	m.aggregateMappings = mappings
+}
+
+func (m *AggregateMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, m.runnable(), m.deadLetters, false)
 }
 
-func (m *AggregateMapper) Map(subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+// persists the state and reloads the configuration of the mapper
+func (m *AggregateMapper) runnable() RealMapper[message.Mapped] {
+	mapper := withPersistentState[message.Mapped](m, m.config.StateConfig, m.config.Protocol, m.config.ConfigFile)
+	return withReload(mapper, m, m.config.ReloadConfig)
+}
+
+// Replaces the mappings, the history is kept
+func (m *AggregateMapper) Reload(configFilePath string) error {
+	emc, err := config.LoadExpressionMappingConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(m.mappingsConfig, emc, describeExpressionMapping)
+	m.setMappings(emc)
+	return nil
 }
 
 func (m *AggregateMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
@@ -69,12 +98,14 @@ func (m *AggregateMapper) DoMap(input *message.Mapped) (*message.Mapped, error)
 			m.env[path] = svm
 			for _, mapping := range mappings {
 				output, err := runExpr(m.env, &mapping.MappingConfig)
-				if err == nil {
-					if mapping.Overwrite {
-						overwrites[mapping.Path] = struct{}{}
-					}
-					u.AddValue(message.NewValue().WithPath(mapping.Path).WithValue(output))
+				if err != nil {
+					m.deadLetters.failed(input, err)
+					continue
 				}
+				if mapping.Overwrite {
+					overwrites[mapping.Path] = struct{}{}
+				}
+				u.AddValue(message.NewValue().WithPath(mapping.Path).WithValue(output))
 			}
 		}
 	}
@@ -101,3 +132,49 @@ func (*AggregateMapper) removeOverWrites(input *message.Mapped, overwrites map[s
 	}
 	return result
 }
+
+type aggregateState struct {
+	History map[string][]*message.Mapped `json:"history"`
+	Values  map[string]*message.Mapped   `json:"values"`
+}
+
+// Returns the history and the most recent value per path
+func (m *AggregateMapper) Snapshot() ([]byte, error) {
+	state := aggregateState{
+		History: make(map[string][]*message.Mapped),
+		Values:  make(map[string]*message.Mapped),
+	}
+	if historyMap, ok := m.env["history"].(map[string][]message.SingleValueMapped); ok {
+		for path, history := range historyMap {
+			for _, svm := range history {
+				state.History[path] = append(state.History[path], svm.ToMapped())
+			}
+		}
+	}
+	for path, value := range m.env {
+		if svm, ok := value.(message.SingleValueMapped); ok {
+			state.Values[path] = svm.ToMapped()
+		}
+	}
+	return json.Marshal(state)
+}
+
+func (m *AggregateMapper) Restore(b []byte) error {
+	var state aggregateState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	historyMap := make(map[string][]message.SingleValueMapped, len(state.History))
+	for path, history := range state.History {
+		for _, mapped := range history {
+			historyMap[path] = append(historyMap[path], mapped.ToSingleValueMapped()...)
+		}
+	}
+	m.env["history"] = historyMap
+	for path, mapped := range state.Values {
+		if svms := mapped.ToSingleValueMapped(); len(svms) == 1 {
+			m.env[path] = svms[0]
+		}
+	}
+	return nil
+}
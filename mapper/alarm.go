@@ -0,0 +1,432 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"go.uber.org/zap"
+)
+
+const (
+	AlarmEventRaise       = "raise"
+	AlarmEventChange      = "change"
+	AlarmEventNormal      = "normal"
+	AlarmEventAcknowledge = "acknowledge"
+	AlarmEventSilence     = "silence"
+	AlarmEventEscalate    = "escalate"
+)
+
+var errAlarmNotActive = errors.New("the alarm is not active")
+
+// order of the alarm states, a higher value is more severe
+var alarmSeverity = map[string]int{
+	config.AlarmStateNormal:    0,
+	config.AlarmStateAlert:     1,
+	config.AlarmStateWarn:      2,
+	config.AlarmStateAlarm:     3,
+	config.AlarmStateEmergency: 4,
+}
+
+// stores the alarm events, implemented by database.PostgresqlDatabase
+type AlarmHistory interface {
+	WriteAlarmEvent(timestamp time.Time, context string, path string, event string, state string, message string) error
+}
+
+type alarm struct {
+	config       *config.AlarmConfig
+	inhibit      *config.MappingConfig
+	level        string    // state based on the limits
+	pending      string    // state based on the most recent value, becomes the level after the on or off delay
+	pendingSince time.Time // time the pending state was first seen
+	activeSince  time.Time // time the alarm was raised
+	acknowledged bool
+	silenced     bool
+	escalated    bool
+	changed      bool // the notification has to be published
+}
+
+// the state of the notification, an escalated alarm is an emergency
+func (a *alarm) state() string {
+	if a.escalated {
+		return config.AlarmStateEmergency
+	}
+	return a.level
+}
+
+// acknowledged and silenced alarms don't make sound
+func (a *alarm) method() []string {
+	if a.level == config.AlarmStateNormal {
+		return []string{}
+	}
+	if !a.acknowledged && !a.silenced {
+		return a.config.Method
+	}
+	result := make([]string, 0, len(a.config.Method))
+	for _, m := range a.config.Method {
+		if m != config.AlarmMethodSound {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func (a *alarm) message() string {
+	if a.config.Message != "" {
+		return a.config.Message
+	}
+	return a.config.Name
+}
+
+// returns the state for the value, the deadband is applied to limits of the current level and lower
+func (a *alarm) condition(value float64) string {
+	deadband := func(state string) float64 {
+		if alarmSeverity[a.level] >= alarmSeverity[state] {
+			return a.config.Deadband
+		}
+		return 0
+	}
+	if a.config.HighHigh != nil && value > *a.config.HighHigh-deadband(config.AlarmStateAlarm) {
+		return config.AlarmStateAlarm
+	}
+	if a.config.LowLow != nil && value < *a.config.LowLow+deadband(config.AlarmStateAlarm) {
+		return config.AlarmStateAlarm
+	}
+	if a.config.High != nil && value > *a.config.High-deadband(config.AlarmStateWarn) {
+		return config.AlarmStateWarn
+	}
+	if a.config.Low != nil && value < *a.config.Low+deadband(config.AlarmStateWarn) {
+		return config.AlarmStateWarn
+	}
+	return config.AlarmStateNormal
+}
+
+type AlarmMapper struct {
+	config       config.MapperConfig
+	protocol     string
+	alarmsConfig *config.AlarmsConfig
+	alarms       map[string]*alarm   // alarms by name
+	paths        map[string][]*alarm // alarms by monitored path
+	history      AlarmHistory
+	env          ExpressionEnvironment
+	mutex        sync.Mutex
+	deadLetterSink
+}
+
+func NewAlarmMapper(c config.MapperConfig, ac *config.AlarmsConfig, history AlarmHistory) (*AlarmMapper, error) {
+	alarms := make(map[string]*alarm)
+	paths := make(map[string][]*alarm)
+	for _, a := range ac.Alarms {
+		al := &alarm{
+			config:  a,
+			level:   config.AlarmStateNormal,
+			pending: config.AlarmStateNormal,
+		}
+		if a.Inhibit != "" {
+			// the failures of the inhibit expression are reported with the path of the notification of the alarm
+			al.inhibit = &config.MappingConfig{Path: "notifications." + a.Name, Expression: a.Inhibit}
+		}
+		alarms[a.Name] = al
+		paths[a.Path] = append(paths[a.Path], al)
+	}
+	return &AlarmMapper{
+		config:       c,
+		protocol:     config.SignalKType,
+		alarmsConfig: ac,
+		alarms:       alarms,
+		paths:        paths,
+		history:      history,
+		env:          NewExpressionEnvironment(),
+	}, nil
+}
+
+func (m *AlarmMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, m.runnable(), m.deadLetters, false)
+}
+
+// starts the alarm API
+func (m *AlarmMapper) runnable() RealMapper[message.Mapped] {
+	if m.alarmsConfig.Listen != "" {
+		go func() {
+			if err := http.ListenAndServe(m.alarmsConfig.Listen, m.Handler()); err != nil {
+				logger.GetLogger().Fatal(
+					"Could not start the alarm API",
+					zap.String("Host and port", m.alarmsConfig.Listen),
+					zap.String("Error", err.Error()),
+				)
+			}
+		}()
+	}
+	return m
+}
+
+// The paths of the notifications of the alarms
+func (m *AlarmMapper) Paths() []string {
+	result := make([]string, 0, len(m.alarmsConfig.Alarms))
+	for _, a := range m.alarmsConfig.Alarms {
+		result = append(result, "notifications."+a.Name)
+	}
+	return result
+}
+
+func (m *AlarmMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := message.NewSource().WithLabel("signalk").WithType(m.protocol).WithUuid(uuid.Nil)
+	u := message.NewUpdate().WithSource(*s).WithTimestamp(time.Time{}) // initialize with empty timestamp instead of hidden now
+
+	if input.Context == m.config.Context {
+		svms := input.ToSingleValueMapped()
+		// make all values available to the inhibit expressions before evaluating the alarms
+		for _, svm := range svms {
+			m.env[strings.ReplaceAll(svm.Path, ".", "_")] = svm
+			if svm.Timestamp.After(u.Timestamp) {
+				u.WithTimestamp(svm.Timestamp)
+			}
+		}
+		for _, svm := range svms {
+			value, ok := svm.Value.(float64)
+			if !ok {
+				continue
+			}
+			for _, a := range m.paths[svm.Path] {
+				m.evaluate(a, value, svm.Timestamp)
+			}
+		}
+		for _, a := range m.alarms {
+			m.escalate(a, u.Timestamp)
+		}
+	}
+
+	m.addNotifications(u)
+	if len(u.Values) > 0 {
+		if u.Timestamp.IsZero() {
+			u.WithTimestamp(time.Now())
+		}
+		return input.AddUpdate(u), nil
+	}
+	return input, nil
+}
+
+func (m *AlarmMapper) evaluate(a *alarm, value float64, now time.Time) {
+	inhibited := m.inhibited(a)
+	condition := a.condition(value)
+	if inhibited {
+		condition = config.AlarmStateNormal
+	}
+	if condition != a.pending {
+		a.pending = condition
+		a.pendingSince = now
+	}
+	if a.pending == a.level {
+		return
+	}
+
+	delay := a.config.OnDelay
+	if alarmSeverity[a.pending] < alarmSeverity[a.level] {
+		delay = a.config.OffDelay
+	}
+	if inhibited {
+		delay = 0 // inhibited alarms return to normal immediately
+	}
+	if now.Sub(a.pendingSince) < delay {
+		return
+	}
+
+	event := AlarmEventChange
+	if a.pending == config.AlarmStateNormal {
+		event = AlarmEventNormal
+		a.acknowledged = false
+		a.silenced = false
+		a.escalated = false
+	} else if alarmSeverity[a.pending] > alarmSeverity[a.level] {
+		// a more severe state has to be acknowledged again
+		event = AlarmEventRaise
+		a.activeSince = now
+		a.acknowledged = false
+		a.silenced = false
+		a.escalated = false
+	}
+	a.level = a.pending
+	a.changed = true
+	m.writeHistory(a, event, now)
+}
+
+// the alarm is inhibited when the inhibit expression evaluates to true, it is not inhibited when the expression fails
+func (m *AlarmMapper) inhibited(a *alarm) bool {
+	if a.inhibit == nil {
+		return false
+	}
+	output, err := runExpr(m.env, a.inhibit)
+	if err != nil {
+		// the failure is logged and reported by runExpr
+		return false
+	}
+	inhibited, ok := output.(bool)
+	if !ok {
+		logger.GetLogger().Warn(
+			"The inhibit expression of the alarm should return a bool",
+			zap.String("Alarm", a.config.Name),
+			zap.String("Expression", a.inhibit.Expression),
+			zap.Any("Output", output),
+		)
+		mappingFailed(a.inhibit, fmt.Errorf("the inhibit expression returned %v instead of a bool", output))
+		return false
+	}
+	return inhibited
+}
+
+func (m *AlarmMapper) escalate(a *alarm, now time.Time) {
+	if a.config.EscalateAfter == 0 || a.level == config.AlarmStateNormal || a.acknowledged || a.escalated {
+		return
+	}
+	if now.Sub(a.activeSince) < a.config.EscalateAfter {
+		return
+	}
+	a.escalated = true
+	a.changed = true
+	m.writeHistory(a, AlarmEventEscalate, now)
+}
+
+func (m *AlarmMapper) addNotifications(u *message.Update) {
+	names := make([]string, 0, len(m.alarms))
+	for name, a := range m.alarms {
+		if a.changed {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names) // publish the notifications in a predictable order
+	for _, name := range names {
+		a := m.alarms[name]
+		state := a.state()
+		msg := a.message()
+		u.AddValue(message.NewValue().WithPath("notifications." + name).WithValue(message.AlarmNotification{
+			State:   &state,
+			Method:  a.method(),
+			Message: &msg,
+		}))
+		a.changed = false
+	}
+}
+
+func (m *AlarmMapper) writeHistory(a *alarm, event string, timestamp time.Time) {
+	if m.history == nil {
+		return
+	}
+	if err := m.history.WriteAlarmEvent(timestamp, m.config.Context, "notifications."+a.config.Name, event, a.state(), a.message()); err != nil {
+		logger.GetLogger().Warn(
+			"Could not store the alarm event",
+			zap.String("Alarm", a.config.Name),
+			zap.String("Event", event),
+			zap.String("Error", err.Error()),
+		)
+	}
+}
+
+// Acknowledges an active alarm, this stops the sound and the escalation. The notification is published with the next mapped message.
+func (m *AlarmMapper) Acknowledge(name string) (bool, error) {
+	return m.action(name, AlarmEventAcknowledge, func(a *alarm) { a.acknowledged = true })
+}
+
+// Silences an active alarm, this stops the sound but the alarm will still escalate. The notification is published with the next mapped message.
+func (m *AlarmMapper) Silence(name string) (bool, error) {
+	return m.action(name, AlarmEventSilence, func(a *alarm) { a.silenced = true })
+}
+
+// returns false when the alarm does not exist and an error when the alarm is not active
+func (m *AlarmMapper) action(name string, event string, f func(*alarm)) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	a, ok := m.alarms[name]
+	if !ok {
+		return false, nil
+	}
+	if a.level == config.AlarmStateNormal {
+		return true, errAlarmNotActive
+	}
+	f(a)
+	a.changed = true
+	m.writeHistory(a, event, time.Now())
+	return true, nil
+}
+
+type AlarmStatus struct {
+	Path         string     `json:"path"`
+	State        string     `json:"state"`
+	Method       []string   `json:"method"`
+	Message      string     `json:"message"`
+	Acknowledged bool       `json:"acknowledged"`
+	Silenced     bool       `json:"silenced"`
+	Since        *time.Time `json:"since,omitempty"`
+}
+
+// Returns the status of all alarms by name
+func (m *AlarmMapper) Status() map[string]AlarmStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := make(map[string]AlarmStatus, len(m.alarms))
+	for name, a := range m.alarms {
+		status := AlarmStatus{
+			Path:         a.config.Path,
+			State:        a.state(),
+			Method:       a.method(),
+			Message:      a.message(),
+			Acknowledged: a.acknowledged,
+			Silenced:     a.silenced,
+		}
+		if a.level != config.AlarmStateNormal {
+			since := a.activeSince
+			status.Since = &since
+		}
+		result[name] = status
+	}
+	return result
+}
+
+// Returns the handler for the alarm API
+//
+//	GET /alarms                    status of all alarms
+//	POST /alarms/{name}/acknowledge acknowledge an active alarm
+//	POST /alarms/{name}/silence     silence an active alarm
+func (m *AlarmMapper) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /alarms", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(m.Status())
+	})
+	mux.HandleFunc("POST /alarms/{name}/acknowledge", func(writer http.ResponseWriter, request *http.Request) {
+		found, err := m.Acknowledge(request.PathValue("name"))
+		serveAlarmAction(writer, found, err)
+	})
+	mux.HandleFunc("POST /alarms/{name}/silence", func(writer http.ResponseWriter, request *http.Request) {
+		found, err := m.Silence(request.PathValue("name"))
+		serveAlarmAction(writer, found, err)
+	})
+	return mux
+}
+
+func serveAlarmAction(writer http.ResponseWriter, found bool, err error) {
+	if !found {
+		http.Error(writer, "alarm not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package mapper_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type alarmEvent struct {
+	path  string
+	event string
+	state string
+}
+
+type testAlarmHistory struct {
+	events []alarmEvent
+}
+
+func (h *testAlarmHistory) WriteAlarmEvent(timestamp time.Time, context string, path string, event string, state string, message string) error {
+	h.events = append(h.events, alarmEvent{path: path, event: event, state: state})
+	return nil
+}
+
+var _ = Describe("DoMap alarm", func() {
+	now := time.Now()
+	high := 90.0
+	highHigh := 95.0
+	var history *testAlarmHistory
+	newMapper := func(ac *config.AlarmConfig) *AlarmMapper {
+		if len(ac.Method) == 0 {
+			ac.Method = []string{config.AlarmMethodVisual, config.AlarmMethodSound}
+		}
+		history = &testAlarmHistory{}
+		m, _ := NewAlarmMapper(
+			config.MapperConfig{Context: "testingContext"},
+			&config.AlarmsConfig{Alarms: []*config.AlarmConfig{ac}},
+			history,
+		)
+		return m
+	}
+	input := func(timestamp time.Time, values ...*message.Value) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(timestamp)
+		for _, v := range values {
+			u.AddValue(v)
+		}
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+	temperature := func(timestamp time.Time, value float64) *message.Mapped {
+		return input(timestamp, message.NewValue().WithPath("propulsion.mainEngine.coolantTemperature").WithValue(value))
+	}
+	notification := func(result *message.Mapped) *message.AlarmNotification {
+		for _, u := range result.Updates {
+			for _, v := range u.Values {
+				if v.Path == "notifications.coolant" {
+					n := v.Value.(message.AlarmNotification)
+					return &n
+				}
+			}
+		}
+		return nil
+	}
+	doMap := func(m *AlarmMapper, input *message.Mapped) *message.AlarmNotification {
+		result, err := m.DoMap(input)
+		Expect(err).ToNot(HaveOccurred())
+		return notification(result)
+	}
+
+	It("raises and clears an alarm", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, HighHigh: &highHigh})
+		Expect(doMap(m, temperature(now, 80))).To(BeNil())
+
+		n := doMap(m, temperature(now, 92))
+		Expect(n).ToNot(BeNil())
+		Expect(*n.State).To(Equal(config.AlarmStateWarn))
+		Expect(n.Method).To(Equal([]string{config.AlarmMethodVisual, config.AlarmMethodSound}))
+		Expect(*n.Message).To(Equal("coolant"))
+
+		Expect(*doMap(m, temperature(now, 96)).State).To(Equal(config.AlarmStateAlarm))
+		Expect(*doMap(m, temperature(now, 80)).State).To(Equal(config.AlarmStateNormal))
+		Expect(history.events).To(Equal([]alarmEvent{
+			{"notifications.coolant", AlarmEventRaise, config.AlarmStateWarn},
+			{"notifications.coolant", AlarmEventRaise, config.AlarmStateAlarm},
+			{"notifications.coolant", AlarmEventNormal, config.AlarmStateNormal},
+		}))
+	})
+	It("applies the deadband", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, Deadband: 2})
+		Expect(*doMap(m, temperature(now, 91)).State).To(Equal(config.AlarmStateWarn))
+		Expect(doMap(m, temperature(now, 89))).To(BeNil())
+		Expect(*doMap(m, temperature(now, 87)).State).To(Equal(config.AlarmStateNormal))
+	})
+	It("waits for the on and off delay", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, OnDelay: 5 * time.Second, OffDelay: 10 * time.Second})
+		Expect(doMap(m, temperature(now, 92))).To(BeNil())
+		Expect(doMap(m, temperature(now.Add(4*time.Second), 92))).To(BeNil())
+		Expect(*doMap(m, temperature(now.Add(5*time.Second), 92)).State).To(Equal(config.AlarmStateWarn))
+		Expect(doMap(m, temperature(now.Add(6*time.Second), 80))).To(BeNil())
+		Expect(doMap(m, temperature(now.Add(7*time.Second), 92))).To(BeNil())
+		Expect(doMap(m, temperature(now.Add(8*time.Second), 80))).To(BeNil())
+		Expect(*doMap(m, temperature(now.Add(18*time.Second), 80)).State).To(Equal(config.AlarmStateNormal))
+	})
+	It("is inhibited", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, Inhibit: "propulsion_mainEngine_revolutions.Value < 1"})
+		Expect(doMap(m, input(now,
+			message.NewValue().WithPath("propulsion.mainEngine.revolutions").WithValue(0.0),
+			message.NewValue().WithPath("propulsion.mainEngine.coolantTemperature").WithValue(92.0),
+		))).To(BeNil())
+		Expect(*doMap(m, input(now,
+			message.NewValue().WithPath("propulsion.mainEngine.revolutions").WithValue(12.5),
+			message.NewValue().WithPath("propulsion.mainEngine.coolantTemperature").WithValue(92.0),
+		)).State).To(Equal(config.AlarmStateWarn))
+	})
+	DescribeTable("is not inhibited when the inhibit expression fails",
+		func(inhibit string) {
+			failed := make(chan *MappingError, 10)
+			SetMappingErrorObserver(func(err *MappingError) { failed <- err })
+			defer SetMappingErrorObserver(nil)
+			m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, Inhibit: inhibit})
+			Expect(*doMap(m, input(now,
+				message.NewValue().WithPath("propulsion.mainEngine.revolutions").WithValue(0.0),
+				message.NewValue().WithPath("propulsion.mainEngine.coolantTemperature").WithValue(92.0),
+			)).State).To(Equal(config.AlarmStateWarn))
+			Expect(failed).To(Receive(HaveField("Mapping", "notifications.coolant")))
+		},
+		Entry("with an error", "propulsion_mainEngine_revolutions.Value < 'a'"),
+		Entry("with a value that is not a bool", "propulsion_mainEngine_revolutions.Value"),
+	)
+	It("is acknowledged and silenced", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high})
+		found, err := m.Acknowledge("coolant")
+		Expect(found).To(BeTrue())
+		Expect(err).To(HaveOccurred())
+		found, _ = m.Acknowledge("unknown")
+		Expect(found).To(BeFalse())
+
+		doMap(m, temperature(now, 92))
+		found, err = m.Silence("coolant")
+		Expect(found).To(BeTrue())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doMap(m, temperature(now, 92)).Method).To(Equal([]string{config.AlarmMethodVisual}))
+		Expect(m.Status()["coolant"].Silenced).To(BeTrue())
+
+		m.Acknowledge("coolant")
+		Expect(m.Status()["coolant"].Acknowledged).To(BeTrue())
+		Expect(*doMap(m, temperature(now, 80)).State).To(Equal(config.AlarmStateNormal))
+		Expect(m.Status()["coolant"].Acknowledged).To(BeFalse())
+	})
+	It("escalates when not acknowledged", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, EscalateAfter: time.Minute})
+		doMap(m, temperature(now, 92))
+		Expect(doMap(m, temperature(now.Add(30*time.Second), 92))).To(BeNil())
+		Expect(*doMap(m, temperature(now.Add(time.Minute), 92)).State).To(Equal(config.AlarmStateEmergency))
+
+		m = newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high, EscalateAfter: time.Minute})
+		doMap(m, temperature(now, 92))
+		m.Acknowledge("coolant")
+		Expect(*doMap(m, temperature(now.Add(time.Minute), 92)).State).To(Equal(config.AlarmStateWarn))
+		Expect(doMap(m, temperature(now.Add(2*time.Minute), 92))).To(BeNil())
+	})
+	It("serves the API", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high})
+		server := httptest.NewServer(m.Handler())
+		defer server.Close()
+
+		response, err := http.Post(server.URL+"/alarms/coolant/acknowledge", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusConflict))
+		response, err = http.Post(server.URL+"/alarms/unknown/acknowledge", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+
+		doMap(m, temperature(now, 92))
+		response, err = http.Post(server.URL+"/alarms/coolant/silence", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusNoContent))
+		response, err = http.Get(server.URL + "/alarms")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+	})
+	It("reports the paths of the notifications", func() {
+		m := newMapper(&config.AlarmConfig{Name: "coolant", Path: "propulsion.mainEngine.coolantTemperature", High: &high})
+		Expect(m.Paths()).To(Equal([]string{"notifications.coolant"}))
+	})
+})
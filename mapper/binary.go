@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/munnik/gosk/config"
@@ -12,33 +13,49 @@ type BinaryMapper struct {
 	config         config.MapperConfig
 	protocol       string
 	mappingsConfig []config.MappingConfig
-	env            ExpressionEnvironment
+	deadLetterSink
 }
 
 func NewBinaryMapper(c config.MapperConfig, mc []config.MappingConfig) (*BinaryMapper, error) {
+	// compile the expressions up front, the workers only read the mappings
+	for i := range mc {
+		mc[i].Compile()
+	}
 	return &BinaryMapper{
 		config:         c,
 		protocol:       config.BinaryType,
 		mappingsConfig: mc,
-		env:            NewExpressionEnvironment(),
 	}, nil
 }
 
-func (m *BinaryMapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *BinaryMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	processInParallel(ctx, subscriber, publisher, withReload[message.Raw](m, m, m.config.ReloadConfig), m.deadLetters, false, m.config.NumberOfWorkers)
+}
+
+// Replaces the mappings
+func (m *BinaryMapper) Reload(configFilePath string) error {
+	mc, err := config.LoadMappingConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(m.mappingsConfig, mc, describeMapping)
+	m.mappingsConfig = mc
+	return nil
 }
 
 func (m *BinaryMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 	result := message.NewMapped().WithContext(m.config.Context).WithOrigin(m.config.Context)
 	s := message.NewSource().WithLabel(r.Connector).WithType(m.protocol).WithUuid(r.Uuid)
 	u := message.NewUpdate().WithSource(*s).WithTimestamp(r.Timestamp)
-	m.env["value"] = r.Value
-	for i, mc := range m.mappingsConfig {
-		output, err := runExpr(m.env, &mc)
-		if err == nil {
-			u.AddValue(message.NewValue().WithPath(mc.Path).WithValue(output))
-			m.mappingsConfig[i] = mc
+	env := NewExpressionEnvironment()
+	env["value"] = r.Value
+	for _, mc := range m.mappingsConfig {
+		output, err := runExpr(env, &mc)
+		if err != nil {
+			m.deadLetters.failed(r, err)
+			continue
 		}
+		u.AddValue(message.NewValue().WithPath(mc.Path).WithValue(output))
 	}
 
 	if len(u.Values) == 0 {
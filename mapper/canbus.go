@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"io"
 	"os"
 	"slices"
@@ -21,6 +22,7 @@ type CanBusMapper struct {
 	protocol       string
 	dbc            DBC
 	canbusMappings map[string]map[string]config.CanBusMappingConfig
+	deadLetterSink
 }
 
 type signal struct {
@@ -46,8 +48,8 @@ func NewCanBusMapper(c config.CanBusMapperConfig, cmc []config.CanBusMappingConf
 	return &CanBusMapper{config: c, protocol: config.CanBusType, dbc: dbc, canbusMappings: mappings}, nil
 }
 
-func (m *CanBusMapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *CanBusMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	processInParallel(ctx, subscriber, publisher, m, m.deadLetters, false, m.config.NumberOfWorkers)
 }
 
 func (m *CanBusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
@@ -86,6 +88,7 @@ func (m *CanBusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 						zap.String("path", mapping.Path),
 						zap.String("error", err.Error()),
 					)
+					m.deadLetters.failed(r, err)
 				}
 			}
 		}
@@ -2,6 +2,7 @@ package mapper
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -18,14 +19,15 @@ type CSVMapper struct {
 	config           config.CSVMapperConfig
 	protocol         string
 	csvMappingConfig []config.CSVMappingConfig
+	deadLetterSink
 }
 
 func NewCSVMapper(c config.CSVMapperConfig, cmc []config.CSVMappingConfig) (*CSVMapper, error) {
 	return &CSVMapper{config: c, protocol: config.CSVType, csvMappingConfig: cmc}, nil
 }
 
-func (m *CSVMapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *CSVMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	processInParallel(ctx, subscriber, publisher, m, m.deadLetters, false, m.config.NumberOfWorkers)
 }
 
 func (m *CSVMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
@@ -87,9 +89,11 @@ func (m *CSVMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 			env["intValues"] = intValues
 
 			output, err := runExpr(env, &cmc.MappingConfig)
-			if err == nil {
-				u.AddValue(message.NewValue().WithPath(cmc.Path).WithValue(output))
+			if err != nil {
+				m.deadLetters.failed(r, err)
+				continue
 			}
+			u.AddValue(message.NewValue().WithPath(cmc.Path).WithValue(output))
 		}
 	}
 
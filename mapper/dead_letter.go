@@ -0,0 +1,138 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	deadLetterCounter        = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_mapper_dead_letters_total", Help: "total number of messages sent to the dead letter stream"}, []string{"reason"})
+	deadLetterDroppedCounter = promauto.NewCounter(prometheus.CounterOpts{Name: "gosk_mapper_dead_letters_dropped_total", Help: "total number of dead letters dropped because the buffer was full"})
+)
+
+// The error of a mapping, used to tell in the dead letter which mapping failed
+type MappingError struct {
+	Mapping string
+	Err     error
+}
+
+func (e *MappingError) Error() string {
+	return fmt.Sprintf("mapping %s: %s", e.Mapping, e.Err.Error())
+}
+
+func (e *MappingError) Unwrap() error {
+	return e.Err
+}
+
+// observes the errors of all mappings, also the errors that are not returned by the mapper, the mappers of the
+// components that run as goroutines share the observer
+var (
+	mappingErrorObserver      func(*MappingError)
+	mappingErrorObserverMutex sync.RWMutex
+)
+
+func setMappingErrorObserver(f func(*MappingError)) {
+	mappingErrorObserverMutex.Lock()
+	defer mappingErrorObserverMutex.Unlock()
+	mappingErrorObserver = f
+}
+
+func observeMappingError(err *MappingError) {
+	mappingErrorObserverMutex.RLock()
+	defer mappingErrorObserverMutex.RUnlock()
+	if mappingErrorObserver != nil {
+		mappingErrorObserver(err)
+	}
+}
+
+func mappingFailed(m *config.MappingConfig, err error) *MappingError {
+	result := &MappingError{Mapping: mappingName(m), Err: err}
+	observeMappingError(result)
+	return result
+}
+
+// the path identifies the mapping, the expression is used for mappings without a path
+func mappingName(m *config.MappingConfig) string {
+	if m.Path != "" {
+		return m.Path
+	}
+	return m.Expression
+}
+
+// Sends messages that could not be mapped or are rejected by a filter to the buffer, the buffer is published by the caller
+type DeadLetters struct {
+	mapper string
+	buffer chan<- *message.DeadLetter
+}
+
+func NewDeadLetters(mapper string, buffer chan<- *message.DeadLetter) *DeadLetters {
+	return &DeadLetters{mapper: mapper, buffer: buffer}
+}
+
+// Embedded in the mappers so each mapper sends its dead letters to its own stream, also when several mappers run in one
+// process
+type deadLetterSink struct {
+	deadLetters *DeadLetters
+}
+
+// Enables the dead letter stream of the mapper, the dead letters are not sent when nil. Set it before the mapper runs.
+func (s *deadLetterSink) SetDeadLetters(d *DeadLetters) {
+	s.deadLetters = d
+}
+
+// the input could not be mapped
+func (d *DeadLetters) failed(in any, err error) {
+	if d == nil {
+		return
+	}
+	result := message.NewDeadLetter().WithMapper(d.mapper).WithError(err.Error())
+	var me *MappingError
+	if errors.As(err, &me) {
+		result.WithMapping(me.Mapping)
+	}
+	d.send(withInput(result, in), "failed")
+}
+
+// the input is rejected by the mapping of a filter
+func (d *DeadLetters) rejected(in *message.Mapped, mapping string) {
+	if d == nil {
+		return
+	}
+	result := message.NewDeadLetter().WithMapper(d.mapper).WithMapping(mapping).WithError("rejected by the filter")
+	d.send(result.WithMapped(in), "rejected")
+}
+
+// the value doesn't match the schema of the path
+func (d *DeadLetters) invalid(in *message.Mapped, path string, err error) {
+	if d == nil {
+		return
+	}
+	result := message.NewDeadLetter().WithMapper(d.mapper).WithMapping(path).WithError(err.Error())
+	d.send(result.WithMapped(in), "invalid")
+}
+
+// the dead letter is dropped when the buffer is full, mapping is never blocked by the dead letter stream
+func (d *DeadLetters) send(dl *message.DeadLetter, reason string) {
+	select {
+	case d.buffer <- dl:
+		deadLetterCounter.WithLabelValues(reason).Inc()
+	default:
+		deadLetterDroppedCounter.Inc()
+	}
+}
+
+func withInput(d *message.DeadLetter, in any) *message.DeadLetter {
+	switch m := in.(type) {
+	case *message.Raw:
+		return d.WithRaw(m)
+	case *message.Mapped:
+		return d.WithMapped(m)
+	}
+	return d
+}
@@ -0,0 +1,94 @@
+package mapper_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dead letters", func() {
+	var buffer chan *message.DeadLetter
+	BeforeEach(func() {
+		buffer = make(chan *message.DeadLetter, 10)
+	})
+	newFilter := func() *ExpressionFilter {
+		f, _ := NewExpressionFilter(config.NewExpressionMappingConfig("expression_filter_test.yaml"))
+		f.SetDeadLetters(NewDeadLetters("filter", buffer))
+		return f
+	}
+	mapped := func(path string) *message.Mapped {
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(
+			message.NewUpdate().WithSource(
+				*message.NewSource().WithLabel("testingConnector").WithType(config.JSONType).WithUuid(uuid.Nil),
+			).WithTimestamp(time.Now()).AddValue(message.NewValue().WithPath(path).WithValue(1.0)),
+		)
+	}
+
+	It("contains the values rejected by a filter", func() {
+		f := newFilter()
+		result, err := f.DoMap(mapped("propulsion.mainEngine.drive.torque"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+		Expect(buffer).To(HaveLen(1))
+		deadLetter := <-buffer
+		Expect(deadLetter.Mapper).To(Equal("filter"))
+		Expect(deadLetter.Mapping).To(Equal("propulsion.mainEngine.drive.torque"))
+		Expect(deadLetter.Mapped.Updates[0].Values[0].Path).To(Equal("propulsion.mainEngine.drive.torque"))
+	})
+	It("does not contain the values passed by a filter", func() {
+		f := newFilter()
+		_, err := f.DoMap(mapped("propulsion.mainEngine.drive.power"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buffer).To(BeEmpty())
+	})
+	It("is sent to the dead letters of the mapper that rejected the value", func() {
+		other := make(chan *message.DeadLetter, 10)
+		f := newFilter()
+		g, _ := NewExpressionFilter(config.NewExpressionMappingConfig("expression_filter_test.yaml"))
+		g.SetDeadLetters(NewDeadLetters("other", other))
+		h, _ := NewExpressionFilter(config.NewExpressionMappingConfig("expression_filter_test.yaml"))
+
+		for _, m := range []*ExpressionFilter{f, g, h} {
+			_, err := m.DoMap(mapped("propulsion.mainEngine.drive.torque"))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(buffer).To(HaveLen(1))
+		Expect((<-buffer).Mapper).To(Equal("filter"))
+		Expect(other).To(HaveLen(1))
+		Expect((<-other).Mapper).To(Equal("other"))
+	})
+	It("tells which mapping failed", func() {
+		f, _ := NewExpressionFilter([]*config.ExpressionMappingConfig{{
+			MappingConfig: config.MappingConfig{Path: "testingPath", Expression: "testingPath.Value > 'a'"},
+			SourcePaths:   []string{"testingPath"},
+		}})
+		_, err := f.DoMap(mapped("testingPath"))
+		Expect(err).To(HaveOccurred())
+		var me *MappingError
+		Expect(errors.As(err, &me)).To(BeTrue())
+		Expect(me.Mapping).To(Equal("testingPath"))
+	})
+	It("contains the input of each mapping that failed", func() {
+		m, _ := NewBinaryMapper(config.MapperConfig{Context: "testingContext"}, []config.MappingConfig{
+			{Path: "testingPath", Expression: "value[0]"},
+			{Path: "failingPath", Expression: "value[5]"},
+		})
+		m.SetDeadLetters(NewDeadLetters("binary", buffer))
+		r := message.NewRaw().WithConnector("testingConnector").WithType(config.BinaryType).WithValue([]byte{1})
+		result, err := m.DoMap(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[0].Values).To(HaveLen(1))
+		Expect(result.Updates[0].Values[0].Path).To(Equal("testingPath"))
+		Expect(buffer).To(HaveLen(1))
+		deadLetter := <-buffer
+		Expect(deadLetter.Mapper).To(Equal("binary"))
+		Expect(deadLetter.Mapping).To(Equal("failingPath"))
+		Expect(deadLetter.Raw.Value).To(Equal([]byte{1}))
+	})
+})
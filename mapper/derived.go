@@ -0,0 +1,381 @@
+package mapper
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+)
+
+const (
+	pathApparentWindSpeed        = "environment.wind.speedApparent"
+	pathApparentWindAngle        = "environment.wind.angleApparent"
+	pathTrueWindSpeed            = "environment.wind.speedTrue"
+	pathTrueWindAngleWater       = "environment.wind.angleTrueWater"
+	pathTrueWindAngleGround      = "environment.wind.angleTrueGround"
+	pathGroundWindSpeed          = "environment.wind.speedOverGround"
+	pathWindDirectionTrue        = "environment.wind.directionTrue"
+	pathWindDirectionMagnetic    = "environment.wind.directionMagnetic"
+	pathCurrentSetTrue           = "environment.current.setTrue"
+	pathCurrentDrift             = "environment.current.drift"
+	pathSpeedThroughWater        = "navigation.speedThroughWater"
+	pathSpeedOverGround          = "navigation.speedOverGround"
+	pathCourseOverGroundTrue     = "navigation.courseOverGroundTrue"
+	pathCourseOverGroundMagnetic = "navigation.courseOverGroundMagnetic"
+	pathHeadingTrue              = "navigation.headingTrue"
+	pathHeadingMagnetic          = "navigation.headingMagnetic"
+	pathMagneticVariation        = "navigation.magneticVariation"
+	pathPosition                 = "navigation.position"
+	pathVelocityMadeGood         = "performance.velocityMadeGood"
+	pathNextPointPosition        = "navigation.courseRhumbline.nextPoint.position"
+	pathNextPointDistance        = "navigation.courseRhumbline.nextPoint.distance"
+	pathNextPointBearingTrue     = "navigation.courseRhumbline.nextPoint.bearingTrue"
+	pathNextPointVelocity        = "navigation.courseRhumbline.nextPoint.velocityMadeGood"
+	pathClosestApproachDistance  = "navigation.closestApproach.distance"
+	pathClosestApproachTimeTo    = "navigation.closestApproach.timeTo"
+)
+
+// paths that are used as input for one of the derivations
+var derivedInputPaths = map[string]struct{}{
+	pathApparentWindSpeed:        {},
+	pathApparentWindAngle:        {},
+	pathSpeedThroughWater:        {},
+	pathSpeedOverGround:          {},
+	pathCourseOverGroundTrue:     {},
+	pathCourseOverGroundMagnetic: {},
+	pathHeadingTrue:              {},
+	pathHeadingMagnetic:          {},
+	pathMagneticVariation:        {},
+	pathPosition:                 {},
+	pathNextPointPosition:        {},
+}
+
+// input paths that are set by the user, they are used until the user changes them
+var userSetPaths = map[string]struct{}{
+	pathNextPointPosition: {},
+}
+
+// paths that are derived by each derivation
+var derivationPaths = map[string][]string{
+	config.DerivationTrueWindWater:     {pathTrueWindSpeed, pathTrueWindAngleWater},
+	config.DerivationTrueWindGround:    {pathGroundWindSpeed, pathTrueWindAngleGround, pathWindDirectionTrue, pathWindDirectionMagnetic},
+	config.DerivationSetAndDrift:       {pathCurrentSetTrue, pathCurrentDrift},
+	config.DerivationVelocityMadeGood:  {pathVelocityMadeGood},
+	config.DerivationMagneticVariation: {pathHeadingTrue, pathCourseOverGroundTrue},
+	config.DerivationNextPoint:         {pathNextPointDistance, pathNextPointBearingTrue, pathNextPointVelocity},
+	config.DerivationClosestApproach:   {pathClosestApproachDistance, pathClosestApproachTimeTo},
+}
+
+type DerivedMapper struct {
+	config        config.MapperConfig
+	protocol      string
+	derivedConfig *config.DerivedConfig
+	derivations   map[string]struct{}
+	state         map[string]map[string]message.SingleValueMapped // most recent input value per context and path
+	newest        time.Time                                       // most recent timestamp of the input values
+	evicted       time.Time
+	deadLetterSink
+}
+
+func NewDerivedMapper(c config.MapperConfig, dc *config.DerivedConfig) (*DerivedMapper, error) {
+	derivations := make(map[string]struct{})
+	for _, d := range dc.Derivations {
+		derivations[d] = struct{}{}
+	}
+	if len(derivations) == 0 {
+		for _, d := range []string{
+			config.DerivationTrueWindWater,
+			config.DerivationTrueWindGround,
+			config.DerivationSetAndDrift,
+			config.DerivationVelocityMadeGood,
+			config.DerivationMagneticVariation,
+			config.DerivationNextPoint,
+			config.DerivationClosestApproach,
+		} {
+			derivations[d] = struct{}{}
+		}
+	}
+	return &DerivedMapper{
+		config:        c,
+		protocol:      config.SignalKType,
+		derivedConfig: dc,
+		derivations:   derivations,
+		state:         make(map[string]map[string]message.SingleValueMapped),
+	}, nil
+}
+
+func (m *DerivedMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, m, m.deadLetters, false)
+}
+
+func (m *DerivedMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
+	s := message.NewSource().WithLabel("signalk").WithType(m.protocol).WithUuid(uuid.Nil)
+	u := message.NewUpdate().WithSource(*s).WithTimestamp(time.Time{}) // initialize with empty timestamp instead of hidden now
+
+	// the values are checked once per max age, before the input is stored so the values of the input are always used
+	if m.newest.Sub(m.evicted) >= m.derivedConfig.MaxAge {
+		m.evict()
+	}
+
+	for _, svm := range input.ToSingleValueMapped() {
+		if _, ok := derivedInputPaths[svm.Path]; !ok {
+			continue
+		}
+		if svm.Timestamp.After(u.Timestamp) { // take most recent timestamp from relevant data
+			u.WithTimestamp(svm.Timestamp)
+		}
+		u.Source.Uuid = svm.Source.Uuid // take the uuid from the message that updated this value
+		if _, ok := m.state[svm.Context]; !ok {
+			m.state[svm.Context] = make(map[string]message.SingleValueMapped)
+		}
+		m.state[svm.Context][svm.Path] = svm
+		if svm.Timestamp.After(m.newest) {
+			m.newest = svm.Timestamp
+		}
+	}
+
+	if u.Timestamp.IsZero() {
+		return input, nil
+	}
+
+	if input.Context == m.config.Context {
+		m.deriveTrueWindWater(u)
+		m.deriveTrueWindGround(u)
+		m.deriveSetAndDrift(u)
+		m.deriveVelocityMadeGood(u)
+		m.deriveMagneticVariation(u)
+		m.deriveNextPoint(u)
+	} else {
+		m.deriveClosestApproach(u, input.Context)
+	}
+
+	if len(u.Values) > 0 {
+		return input.AddUpdate(u), nil
+	}
+	return input, nil
+}
+
+// The paths of the enabled derivations
+func (m *DerivedMapper) Paths() []string {
+	result := make([]string, 0)
+	for d := range m.derivations {
+		result = append(result, derivationPaths[d]...)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// removes the values that are too old to be used, the timestamps of the input are used instead of the clock
+func (m *DerivedMapper) evict() {
+	for context, paths := range m.state {
+		for path, svm := range paths {
+			if _, ok := userSetPaths[path]; ok {
+				continue
+			}
+			if m.newest.Sub(svm.Timestamp) > m.derivedConfig.MaxAge {
+				delete(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			delete(m.state, context)
+		}
+	}
+	m.evicted = m.newest
+}
+
+func (m *DerivedMapper) enabled(derivation string) bool {
+	_, ok := m.derivations[derivation]
+	return ok
+}
+
+// returns the most recent float value for the path, values older than the max age relative to now are ignored
+func (m *DerivedMapper) float(context string, path string, now time.Time) (float64, bool) {
+	svm, ok := m.state[context][path]
+	if !ok || now.Sub(svm.Timestamp) > m.derivedConfig.MaxAge {
+		return 0, false
+	}
+	f, ok := svm.Value.(float64)
+	return f, ok
+}
+
+// returns the most recent position for the path, values older than the max age relative to now are ignored
+func (m *DerivedMapper) position(context string, path string, now time.Time) (message.Position, bool) {
+	svm, ok := m.state[context][path]
+	if !ok || now.Sub(svm.Timestamp) > m.derivedConfig.MaxAge {
+		return message.Position{}, false
+	}
+	p, ok := svm.Value.(message.Position)
+	return p, ok
+}
+
+// returns the true heading, when it is not available it is derived from the magnetic heading and variation
+func (m *DerivedMapper) headingTrue(context string, now time.Time) (float64, bool) {
+	if heading, ok := m.float(context, pathHeadingTrue, now); ok {
+		return heading, true
+	}
+	heading, okHeading := m.float(context, pathHeadingMagnetic, now)
+	variation, okVariation := m.float(context, pathMagneticVariation, now)
+	if okHeading && okVariation {
+		return MagneticToTrue(heading, variation), true
+	}
+	return 0, false
+}
+
+// returns the true course over ground, when it is not available it is derived from the magnetic course and variation
+func (m *DerivedMapper) courseOverGroundTrue(context string, now time.Time) (float64, bool) {
+	if course, ok := m.float(context, pathCourseOverGroundTrue, now); ok {
+		return course, true
+	}
+	course, okCourse := m.float(context, pathCourseOverGroundMagnetic, now)
+	variation, okVariation := m.float(context, pathMagneticVariation, now)
+	if okCourse && okVariation {
+		return MagneticToTrue(course, variation), true
+	}
+	return 0, false
+}
+
+func (m *DerivedMapper) deriveTrueWindWater(u *message.Update) {
+	if !m.enabled(config.DerivationTrueWindWater) {
+		return
+	}
+	apparentSpeed, okSpeed := m.float(m.config.Context, pathApparentWindSpeed, u.Timestamp)
+	apparentAngle, okAngle := m.float(m.config.Context, pathApparentWindAngle, u.Timestamp)
+	speedThroughWater, okWater := m.float(m.config.Context, pathSpeedThroughWater, u.Timestamp)
+	if !okSpeed || !okAngle || !okWater {
+		return
+	}
+
+	speed, angle := TrueWindWater(apparentSpeed, apparentAngle, speedThroughWater)
+	u.AddValue(message.NewValue().WithPath(pathTrueWindSpeed).WithValue(speed))
+	u.AddValue(message.NewValue().WithPath(pathTrueWindAngleWater).WithValue(angle))
+}
+
+func (m *DerivedMapper) deriveTrueWindGround(u *message.Update) {
+	if !m.enabled(config.DerivationTrueWindGround) {
+		return
+	}
+	apparentSpeed, okSpeed := m.float(m.config.Context, pathApparentWindSpeed, u.Timestamp)
+	apparentAngle, okAngle := m.float(m.config.Context, pathApparentWindAngle, u.Timestamp)
+	speedOverGround, okGround := m.float(m.config.Context, pathSpeedOverGround, u.Timestamp)
+	courseOverGround, okCourse := m.courseOverGroundTrue(m.config.Context, u.Timestamp)
+	heading, okHeading := m.headingTrue(m.config.Context, u.Timestamp)
+	if !okSpeed || !okAngle || !okGround || !okCourse || !okHeading {
+		return
+	}
+
+	speed, angle := TrueWindGround(apparentSpeed, apparentAngle, speedOverGround, courseOverGround, heading)
+	u.AddValue(message.NewValue().WithPath(pathGroundWindSpeed).WithValue(speed))
+	u.AddValue(message.NewValue().WithPath(pathTrueWindAngleGround).WithValue(angle))
+	u.AddValue(message.NewValue().WithPath(pathWindDirectionTrue).WithValue(NormalizeAngle(heading + angle)))
+	if variation, ok := m.float(m.config.Context, pathMagneticVariation, u.Timestamp); ok {
+		u.AddValue(message.NewValue().WithPath(pathWindDirectionMagnetic).WithValue(TrueToMagnetic(heading+angle, variation)))
+	}
+}
+
+func (m *DerivedMapper) deriveSetAndDrift(u *message.Update) {
+	if !m.enabled(config.DerivationSetAndDrift) {
+		return
+	}
+	speedOverGround, okGround := m.float(m.config.Context, pathSpeedOverGround, u.Timestamp)
+	courseOverGround, okCourse := m.courseOverGroundTrue(m.config.Context, u.Timestamp)
+	speedThroughWater, okWater := m.float(m.config.Context, pathSpeedThroughWater, u.Timestamp)
+	heading, okHeading := m.headingTrue(m.config.Context, u.Timestamp)
+	if !okGround || !okCourse || !okWater || !okHeading {
+		return
+	}
+
+	set, drift := SetAndDrift(speedOverGround, courseOverGround, speedThroughWater, heading)
+	u.AddValue(message.NewValue().WithPath(pathCurrentSetTrue).WithValue(set))
+	u.AddValue(message.NewValue().WithPath(pathCurrentDrift).WithValue(drift))
+}
+
+func (m *DerivedMapper) deriveVelocityMadeGood(u *message.Update) {
+	if !m.enabled(config.DerivationVelocityMadeGood) {
+		return
+	}
+	apparentSpeed, okSpeed := m.float(m.config.Context, pathApparentWindSpeed, u.Timestamp)
+	apparentAngle, okAngle := m.float(m.config.Context, pathApparentWindAngle, u.Timestamp)
+	speedThroughWater, okWater := m.float(m.config.Context, pathSpeedThroughWater, u.Timestamp)
+	if !okSpeed || !okAngle || !okWater {
+		return
+	}
+
+	_, angle := TrueWindWater(apparentSpeed, apparentAngle, speedThroughWater)
+	u.AddValue(message.NewValue().WithPath(pathVelocityMadeGood).WithValue(VelocityMadeGood(speedThroughWater, angle)))
+}
+
+func (m *DerivedMapper) deriveMagneticVariation(u *message.Update) {
+	if !m.enabled(config.DerivationMagneticVariation) {
+		return
+	}
+	variation, ok := m.float(m.config.Context, pathMagneticVariation, u.Timestamp)
+	if !ok {
+		return
+	}
+
+	if _, ok := m.float(m.config.Context, pathHeadingTrue, u.Timestamp); !ok {
+		if heading, ok := m.float(m.config.Context, pathHeadingMagnetic, u.Timestamp); ok {
+			u.AddValue(message.NewValue().WithPath(pathHeadingTrue).WithValue(MagneticToTrue(heading, variation)))
+		}
+	}
+	if _, ok := m.float(m.config.Context, pathCourseOverGroundTrue, u.Timestamp); !ok {
+		if course, ok := m.float(m.config.Context, pathCourseOverGroundMagnetic, u.Timestamp); ok {
+			u.AddValue(message.NewValue().WithPath(pathCourseOverGroundTrue).WithValue(MagneticToTrue(course, variation)))
+		}
+	}
+}
+
+func (m *DerivedMapper) deriveNextPoint(u *message.Update) {
+	if !m.enabled(config.DerivationNextPoint) {
+		return
+	}
+	position, okPosition := m.position(m.config.Context, pathPosition, u.Timestamp)
+	// the next point is set by the user so it doesn't expire
+	nextPoint, okNextPoint := m.state[m.config.Context][pathNextPointPosition].Value.(message.Position)
+	if !okPosition || !okNextPoint {
+		return
+	}
+
+	distance, err := HaversineDistance(position, nextPoint)
+	if err != nil {
+		return
+	}
+	bearing, err := InitialBearing(position, nextPoint)
+	if err != nil {
+		return
+	}
+	u.AddValue(message.NewValue().WithPath(pathNextPointDistance).WithValue(distance))
+	u.AddValue(message.NewValue().WithPath(pathNextPointBearingTrue).WithValue(bearing))
+
+	speedOverGround, okGround := m.float(m.config.Context, pathSpeedOverGround, u.Timestamp)
+	courseOverGround, okCourse := m.courseOverGroundTrue(m.config.Context, u.Timestamp)
+	if okGround && okCourse {
+		u.AddValue(message.NewValue().WithPath(pathNextPointVelocity).WithValue(VelocityMadeGood(speedOverGround, courseOverGround-bearing)))
+	}
+}
+
+func (m *DerivedMapper) deriveClosestApproach(u *message.Update, context string) {
+	if !m.enabled(config.DerivationClosestApproach) {
+		return
+	}
+	ownPosition, okOwnPosition := m.position(m.config.Context, pathPosition, u.Timestamp)
+	ownCourse, okOwnCourse := m.courseOverGroundTrue(m.config.Context, u.Timestamp)
+	ownSpeed, okOwnSpeed := m.float(m.config.Context, pathSpeedOverGround, u.Timestamp)
+	targetPosition, okTargetPosition := m.position(context, pathPosition, u.Timestamp)
+	targetCourse, okTargetCourse := m.courseOverGroundTrue(context, u.Timestamp)
+	targetSpeed, okTargetSpeed := m.float(context, pathSpeedOverGround, u.Timestamp)
+	if !okOwnPosition || !okOwnCourse || !okOwnSpeed || !okTargetPosition || !okTargetCourse || !okTargetSpeed {
+		return
+	}
+
+	distance, timeTo, err := ClosestApproach(ownPosition, ownCourse, ownSpeed, targetPosition, targetCourse, targetSpeed)
+	if err != nil {
+		return
+	}
+	u.AddValue(message.NewValue().WithPath(pathClosestApproachDistance).WithValue(distance))
+	u.AddValue(message.NewValue().WithPath(pathClosestApproachTimeTo).WithValue(timeTo))
+}
@@ -0,0 +1,171 @@
+package mapper_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoMap derived", func() {
+	now := time.Now()
+	newMapper := func() *DerivedMapper {
+		m, _ := NewDerivedMapper(
+			config.MapperConfig{Context: "testingContext"},
+			&config.DerivedConfig{MaxAge: 10 * time.Second},
+		)
+		return m
+	}
+	input := func(context string, timestamp time.Time, values ...*message.Value) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(timestamp)
+		for _, v := range values {
+			u.AddValue(v)
+		}
+		return message.NewMapped().WithContext(context).WithOrigin("testingContext").AddUpdate(u)
+	}
+	derived := func(timestamp time.Time, values ...*message.Value) *message.Update {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("signalk").WithType(config.SignalKType).WithUuid(uuid.Nil),
+		).WithTimestamp(timestamp)
+		for _, v := range values {
+			u.AddValue(v)
+		}
+		return u
+	}
+	latitude := 0.0
+	longitude := 0.0
+	targetLatitude := 1.0 / 60
+	targetLongitude := 0.0
+
+	DescribeTable("Messages",
+		func(m *DerivedMapper, inputs []*message.Mapped, expected *message.Mapped) {
+			var result *message.Mapped
+			var err error
+			for _, i := range inputs {
+				result, err = m.DoMap(i)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(result).To(Equal(expected))
+		},
+		Entry("no matching path",
+			newMapper(),
+			[]*message.Mapped{
+				input("testingContext", now, message.NewValue().WithPath("propulsion.mainEngine.revolutions").WithValue(12.5)),
+			},
+			input("testingContext", now, message.NewValue().WithPath("propulsion.mainEngine.revolutions").WithValue(12.5)),
+		),
+		Entry("true wind relative to the water",
+			newMapper(),
+			[]*message.Mapped{
+				input("testingContext", now,
+					message.NewValue().WithPath("environment.wind.speedApparent").WithValue(10.0),
+					message.NewValue().WithPath("environment.wind.angleApparent").WithValue(0.0),
+					message.NewValue().WithPath("navigation.speedThroughWater").WithValue(4.0),
+				),
+			},
+			input("testingContext", now,
+				message.NewValue().WithPath("environment.wind.speedApparent").WithValue(10.0),
+				message.NewValue().WithPath("environment.wind.angleApparent").WithValue(0.0),
+				message.NewValue().WithPath("navigation.speedThroughWater").WithValue(4.0),
+			).AddUpdate(derived(now,
+				message.NewValue().WithPath("environment.wind.speedTrue").WithValue(6.0),
+				message.NewValue().WithPath("environment.wind.angleTrueWater").WithValue(0.0),
+				message.NewValue().WithPath("performance.velocityMadeGood").WithValue(4.0),
+			)),
+		),
+		Entry("input too old",
+			newMapper(),
+			[]*message.Mapped{
+				input("testingContext", now.Add(-time.Minute),
+					message.NewValue().WithPath("navigation.speedThroughWater").WithValue(4.0),
+				),
+				input("testingContext", now,
+					message.NewValue().WithPath("environment.wind.speedApparent").WithValue(10.0),
+					message.NewValue().WithPath("environment.wind.angleApparent").WithValue(0.0),
+				),
+			},
+			input("testingContext", now,
+				message.NewValue().WithPath("environment.wind.speedApparent").WithValue(10.0),
+				message.NewValue().WithPath("environment.wind.angleApparent").WithValue(0.0),
+			),
+		),
+		Entry("closest approach of another vessel",
+			newMapper(),
+			[]*message.Mapped{
+				input("testingContext", now,
+					message.NewValue().WithPath("navigation.position").WithValue(message.Position{Latitude: &latitude, Longitude: &longitude}),
+					message.NewValue().WithPath("navigation.courseOverGroundTrue").WithValue(0.0),
+					message.NewValue().WithPath("navigation.speedOverGround").WithValue(0.0),
+				),
+				input("otherContext", now,
+					message.NewValue().WithPath("navigation.position").WithValue(message.Position{Latitude: &targetLatitude, Longitude: &targetLongitude}),
+					message.NewValue().WithPath("navigation.courseOverGroundTrue").WithValue(0.0),
+					message.NewValue().WithPath("navigation.speedOverGround").WithValue(0.0),
+				),
+			},
+			input("otherContext", now,
+				message.NewValue().WithPath("navigation.position").WithValue(message.Position{Latitude: &targetLatitude, Longitude: &targetLongitude}),
+				message.NewValue().WithPath("navigation.courseOverGroundTrue").WithValue(0.0),
+				message.NewValue().WithPath("navigation.speedOverGround").WithValue(0.0),
+			).AddUpdate(derived(now,
+				message.NewValue().WithPath("navigation.closestApproach.distance").WithValue(func() float64 {
+					d, _, _ := ClosestApproach(message.Position{Latitude: &latitude, Longitude: &longitude}, 0, 0, message.Position{Latitude: &targetLatitude, Longitude: &targetLongitude}, 0, 0)
+					return d
+				}()),
+				message.NewValue().WithPath("navigation.closestApproach.timeTo").WithValue(0.0),
+			)),
+		),
+	)
+	It("reports the paths of the enabled derivations", func() {
+		m, _ := NewDerivedMapper(
+			config.MapperConfig{Context: "testingContext"},
+			&config.DerivedConfig{Derivations: []string{config.DerivationSetAndDrift, config.DerivationVelocityMadeGood}},
+		)
+		Expect(m.Paths()).To(Equal([]string{"environment.current.drift", "environment.current.setTrue", "performance.velocityMadeGood"}))
+		Expect(newMapper().Paths()).To(ContainElements("environment.wind.speedTrue", "navigation.closestApproach.timeTo"))
+	})
+	It("removes the values that are older than the max age", func() {
+		m := newMapper()
+		speed := func(context string, timestamp time.Time) *message.Mapped {
+			return input(context, timestamp, message.NewValue().WithPath("navigation.speedOverGround").WithValue(3.5))
+		}
+		for i := range 10 {
+			_, err := m.DoMap(speed(fmt.Sprintf("vessels.urn:mrn:imo:mmsi:%d", i), now))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(m.StateLen()).To(Equal(10))
+		_, err := m.DoMap(speed("testingContext", now.Add(15*time.Second)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.StateLen()).To(Equal(11))
+		_, err = m.DoMap(speed("testingContext", now.Add(25*time.Second)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.StateLen()).To(Equal(1))
+	})
+	It("keeps the next point that is set by the user", func() {
+		m := newMapper()
+		latitude, longitude := 52.0, 4.0
+		nextLatitude, nextLongitude := 52.1, 4.1
+		position := func(timestamp time.Time) *message.Mapped {
+			return input("testingContext", timestamp, message.NewValue().WithPath("navigation.position").WithValue(message.Position{Latitude: &latitude, Longitude: &longitude}))
+		}
+		_, err := m.DoMap(input("testingContext", now, message.NewValue().WithPath("navigation.courseRhumbline.nextPoint.position").WithValue(message.Position{Latitude: &nextLatitude, Longitude: &nextLongitude})))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = m.DoMap(position(now.Add(15 * time.Second)))
+		Expect(err).ToNot(HaveOccurred())
+		result, err := m.DoMap(position(now.Add(30 * time.Second)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.StateLen()).To(Equal(2))
+		paths := make([]string, 0)
+		for _, svm := range result.ToSingleValueMapped() {
+			paths = append(paths, svm.Path)
+		}
+		Expect(paths).To(ContainElement("navigation.courseRhumbline.nextPoint.distance"))
+	})
+})
@@ -0,0 +1,21 @@
+package mapper
+
+import "github.com/munnik/gosk/nanomsg"
+
+func PartitionKey[T nanomsg.Message](in *T) string {
+	return partitionKey(in)
+}
+
+// the number of input values the derived mapper keeps
+func (m *DerivedMapper) StateLen() int {
+	result := 0
+	for _, paths := range m.state {
+		result += len(paths)
+	}
+	return result
+}
+
+var (
+	ValidateMapped          = validateMapped
+	SetMappingErrorObserver = setMappingErrorObserver
+)
@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -10,25 +11,56 @@ import (
 )
 
 type ExpressionFilter struct {
+	reloadConfig   config.ReloadConfig
+	mappingsConfig []*config.ExpressionMappingConfig
 	filterMappings map[string][]*config.ExpressionMappingConfig
 	env            ExpressionEnvironment
+	deadLetterSink
 }
 
 func NewExpressionFilter(emc []*config.ExpressionMappingConfig) (*ExpressionFilter, error) {
 	env := NewExpressionEnvironment()
 
+	f := &ExpressionFilter{env: env}
+	f.setMappings(emc)
+	return f, nil
+}
+
+// Enables reloading the filters from the config file
+func (f *ExpressionFilter) WithReloadConfig(c config.ReloadConfig) *ExpressionFilter {
+	f.reloadConfig = c
+	return f
+}
+
+func (f *ExpressionFilter) setMappings(emc []*config.ExpressionMappingConfig) {
 	mappings := make(map[string][]*config.ExpressionMappingConfig)
 	for _, m := range emc {
 		for _, s := range m.SourcePaths {
 			mappings[s] = append(mappings[s], m)
 		}
 	}
+	f.mappingsConfig = emc
+	f.filterMappings = mappings
+}
+
+func (f *ExpressionFilter) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, f.runnable(), f.deadLetters, true)
+}
 
-	return &ExpressionFilter{env: env, filterMappings: mappings}, nil
+// reloads the configuration of the filter
+func (f *ExpressionFilter) runnable() RealMapper[message.Mapped] {
+	return withReload[message.Mapped](f, f, f.reloadConfig)
 }
 
-func (f *ExpressionFilter) Map(subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, f, true)
+// Replaces the filters
+func (f *ExpressionFilter) Reload(configFilePath string) error {
+	emc, err := config.LoadExpressionMappingConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(f.mappingsConfig, emc, describeExpressionMapping)
+	f.setMappings(emc)
+	return nil
 }
 
 func (f *ExpressionFilter) DoMap(delta *message.Mapped) (*message.Mapped, error) {
@@ -36,6 +68,7 @@ func (f *ExpressionFilter) DoMap(delta *message.Mapped) (*message.Mapped, error)
 
 	for _, svm := range delta.ToSingleValueMapped() {
 		shouldSkip := false
+		rejectedBy := ""
 		if mappings, ok := f.filterMappings[svm.Path]; ok {
 			path := strings.ReplaceAll(svm.Path, ".", "_")
 			f.env[path] = svm
@@ -45,6 +78,9 @@ func (f *ExpressionFilter) DoMap(delta *message.Mapped) (*message.Mapped, error)
 					return nil, err
 				}
 				if boolOutput, ok := output.(bool); ok {
+					if boolOutput && !shouldSkip {
+						rejectedBy = mappingName(&mapping.MappingConfig)
+					}
 					shouldSkip = shouldSkip || boolOutput
 				} else {
 					return nil, fmt.Errorf("could not cast result of the expression to bool")
@@ -53,6 +89,7 @@ func (f *ExpressionFilter) DoMap(delta *message.Mapped) (*message.Mapped, error)
 		}
 
 		if shouldSkip {
+			f.deadLetters.rejected(svm.ToMapped(), rejectedBy)
 			continue
 		}
 
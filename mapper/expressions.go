@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sync"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
@@ -15,7 +16,14 @@ import (
 
 type ExpressionEnvironment map[string]any
 
-var virtualMachine = vm.VM{}
+// a virtual machine can't run multiple programs at the same time
+var virtualMachines = sync.Pool{New: func() any { return &vm.VM{} }}
+
+func runProgram(program *vm.Program, env ExpressionEnvironment) (any, error) {
+	v := virtualMachines.Get().(*vm.VM)
+	defer virtualMachines.Put(v)
+	return v.Run(program, env)
+}
 
 func NewExpressionEnvironment() ExpressionEnvironment {
 	return ExpressionEnvironment{
@@ -37,6 +45,29 @@ func NewExpressionEnvironment() ExpressionEnvironment {
 		"bitwiseContains":  BitwiseContains,
 		"isBitSet":         IsBitSet,
 		"notify":           Notify,
+
+		"haversineDistance": HaversineDistance,
+		"rhumbLineDistance": RhumbLineDistance,
+		"initialBearing":    InitialBearing,
+		"rhumbLineBearing":  RhumbLineBearing,
+		"destinationPoint":  DestinationPoint,
+		"pointInPolygon":    PointInPolygon,
+
+		"normalizeAngle":         NormalizeAngle,
+		"normalizeRelativeAngle": NormalizeRelativeAngle,
+
+		"knotsToMetersPerSecond":             KnotsToMetersPerSecond,
+		"metersPerSecondToKnots":             MetersPerSecondToKnots,
+		"kilometersPerHourToMetersPerSecond": KilometersPerHourToMetersPerSecond,
+		"metersPerSecondToKilometersPerHour": MetersPerSecondToKilometersPerHour,
+		"celsiusToKelvin":                    CelsiusToKelvin,
+		"kelvinToCelsius":                    KelvinToCelsius,
+		"barToPascal":                        BarToPascal,
+		"pascalToBar":                        PascalToBar,
+		"litersToCubicMeters":                LitersToCubicMeters,
+		"cubicMetersToLiters":                CubicMetersToLiters,
+		"degreesToRadians":                   DegreesToRadians,
+		"radiansToDegrees":                   RadiansToDegrees,
 	}
 }
 
@@ -210,8 +241,8 @@ func IsBitSet(input uint16, position int) bool {
 	return BitwiseContains(input, 1<<position)
 }
 
-func Notify(s bool, m string) []message.Notification {
-	return []message.Notification{{State: &s, Message: &m}}
+func Notify(s bool, m string) message.Notifications {
+	return message.Notifications{{State: &s, Message: &m}}
 }
 
 func runExpr(env ExpressionEnvironment, mappingConfig *config.MappingConfig) (interface{}, error) {
@@ -228,11 +259,11 @@ func runExpr(env ExpressionEnvironment, mappingConfig *config.MappingConfig) (in
 				zap.String("Expression", mappingConfig.Expression),
 				zap.String("Error", err.Error()),
 			)
-			return nil, err
+			return nil, mappingFailed(mappingConfig, err)
 		}
 	}
 	// the compiled program exists, let's run it
-	output, err := virtualMachine.Run(mappingConfig.CompiledExpression, env)
+	output, err := runProgram(mappingConfig.CompiledExpression, env)
 	if err != nil {
 		logger.GetLogger().Warn(
 			"Could not run the mapping expression",
@@ -240,12 +271,12 @@ func runExpr(env ExpressionEnvironment, mappingConfig *config.MappingConfig) (in
 			zap.String("Environment", fmt.Sprintf("%+v", env)),
 			zap.String("Error", err.Error()),
 		)
-		return nil, err
+		return nil, mappingFailed(mappingConfig, err)
 	}
 
 	// the value is a map so we could try to decode it
 	if m, ok := output.(map[string]interface{}); ok {
-		if decoded, err := message.Decode(m); err == nil {
+		if decoded, err := message.GetSchema().Decode(mappingConfig.Path, m); err == nil {
 			output = decoded
 		}
 	}
@@ -270,7 +301,7 @@ func runTimestampExpr(env ExpressionEnvironment, mappingConfig *config.MappingCo
 		}
 	}
 	// the compiled program exists, let's run it
-	output, err := virtualMachine.Run(mappingConfig.CompiledTimestampExpression, env)
+	output, err := runProgram(mappingConfig.CompiledTimestampExpression, env)
 	if err != nil {
 		logger.GetLogger().Warn(
 			"Could not run the timestamp expression",
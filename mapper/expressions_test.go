@@ -1,9 +1,12 @@
 package mapper_test
 
 import (
+	"math"
 	"testing"
 
+	"github.com/expr-lang/expr"
 	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
 )
 
 var (
@@ -146,3 +149,27 @@ func TestMilliAmpereToVolume(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestExpressionEnvironmentNavigation(t *testing.T) {
+	env := NewExpressionEnvironment()
+	latitude, longitude := 52.0, 4.0
+	env["position"] = message.Position{Latitude: &latitude, Longitude: &longitude}
+	for expression, expected := range map[string]float64{
+		"knotsToMetersPerSecond(10.0)": 5.144444,
+		"degreesToRadians(180.0)":      math.Pi,
+		"haversineDistance(destinationPoint(position, 0.0, 1852.0), position)": 1852,
+	} {
+		program, err := expr.Compile(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := expr.Run(program, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, ok := result.(float64); !ok || math.Abs(f-expected) > 1e-6 {
+			t.Logf("Expected %f but got %v for %s", expected, result, expression)
+			t.Fail()
+		}
+	}
+}
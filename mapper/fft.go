@@ -1,6 +1,11 @@
 package mapper
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
 	"math/cmplx"
 	"slices"
 	"sync"
@@ -11,32 +16,51 @@ import (
 	"github.com/munnik/gosk/message"
 	"github.com/munnik/gosk/nanomsg"
 	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/dsp/window"
+	"gonum.org/v1/gonum/floats"
 )
 
 type FftMapper struct {
 	config   config.MapperConfig
 	protocol string
 	mappings map[string]*singleFftMapper
+	deadLetterSink
 }
 
 type singleFftMapper struct {
-	spectrumPath       string
+	config             *config.FftConfig
 	samplesBuffer      map[time.Time]float64
 	samplesBufferMutex *sync.Mutex
 	fft                *fourier.FFT
-	frequencyStepSize  float64
+	weights            []float64 // weights of the window, all ones when the samples are not windowed
+	overlap            int       // number of samples used again in the next spectrum
+	oldest, newest     time.Time // timestamps of the buffered samples, used to check if the buffer spans enough time to resample
 }
 
 func NewFftMapper(c config.MapperConfig, fftc []*config.FftConfig) (*FftMapper, error) {
 	mappings := make(map[string]*singleFftMapper)
 	for _, cfg := range fftc {
+		n := 1 << cfg.SamplesChannelBitSize
+		weights := make([]float64, n)
+		for i := range weights {
+			weights[i] = 1
+		}
+		switch cfg.Window {
+		case config.FftWindowHann:
+			window.Hann(weights)
+		case config.FftWindowHamming:
+			window.Hamming(weights)
+		case config.FftWindowBlackman:
+			window.Blackman(weights)
+		}
 		mappings[cfg.Path] = &singleFftMapper{
-			spectrumPath: cfg.SpectrumPath,
+			config: cfg,
 			// allow double space for values comming in not in order
 			samplesBuffer:      make(map[time.Time]float64, 2<<cfg.SamplesChannelBitSize),
 			samplesBufferMutex: &sync.Mutex{},
-			fft:                fourier.NewFFT(1 << cfg.SamplesChannelBitSize),
-			frequencyStepSize:  cfg.FrequencyStepSize,
+			fft:                fourier.NewFFT(n),
+			weights:            weights,
+			overlap:            min(int(math.Round(cfg.Overlap*float64(n))), n-1),
 		}
 	}
 	return &FftMapper{
@@ -46,8 +70,33 @@ func NewFftMapper(c config.MapperConfig, fftc []*config.FftConfig) (*FftMapper,
 	}, nil
 }
 
-func (m *FftMapper) Map(subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, true)
+func (m *FftMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, m.runnable(), m.deadLetters, true)
+}
+
+// persists the state of the mapper
+func (m *FftMapper) runnable() RealMapper[message.Mapped] {
+	return withPersistentState[message.Mapped](m, m.config.StateConfig, m.config.Protocol, m.config.ConfigFile)
+}
+
+// The paths of the spectra, the RMS values, the bands and the peaks
+func (m *FftMapper) Paths() []string {
+	result := make([]string, 0)
+	for _, mapping := range m.mappings {
+		c := mapping.config
+		result = append(result, c.SpectrumPath)
+		if c.RmsPath != "" {
+			result = append(result, c.RmsPath)
+		}
+		for _, band := range c.Bands {
+			result = append(result, band.Path)
+		}
+		for i := range c.NumberOfPeaks {
+			result = append(result, fmt.Sprintf("%s.%d.frequency", c.PeaksPath, i+1), fmt.Sprintf("%s.%d.amplitude", c.PeaksPath, i+1))
+		}
+	}
+	slices.Sort(result)
+	return result
 }
 
 func (m *FftMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
@@ -56,11 +105,13 @@ func (m *FftMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
 	u := message.NewUpdate().WithSource(*s).WithTimestamp(time.Time{}) // initialize with empty timestamp instead of hidden now
 
 	for _, svm := range input.ToSingleValueMapped() {
-		if _, ok := m.mappings[svm.Path]; ok {
+		if mapping, ok := m.mappings[svm.Path]; ok {
+			mapping.samplesBufferMutex.Lock()
 			if value, ok := svm.Value.(float64); ok {
-				m.mappings[svm.Path].samplesBuffer[svm.Timestamp] = value
+				mapping.add(svm.Timestamp, value)
 			}
-			m.doFft(u, svm.Path)
+			mapping.doFft(u)
+			mapping.samplesBufferMutex.Unlock()
 		}
 	}
 
@@ -70,69 +121,193 @@ func (m *FftMapper) DoMap(input *message.Mapped) (*message.Mapped, error) {
 	return result.AddUpdate(u), nil
 }
 
-func (m *FftMapper) doFft(update *message.Update, path string) {
-	m.mappings[path].samplesBufferMutex.Lock()
-	defer m.mappings[path].samplesBufferMutex.Unlock()
-	if len(m.mappings[path].samplesBuffer) < m.mappings[path].fft.Len()<<1 {
+func (m *singleFftMapper) add(timestamp time.Time, value float64) {
+	if len(m.samplesBuffer) == 0 || timestamp.Before(m.oldest) {
+		m.oldest = timestamp
+	}
+	if len(m.samplesBuffer) == 0 || timestamp.After(m.newest) {
+		m.newest = timestamp
+	}
+	m.samplesBuffer[timestamp] = value
+}
+
+// the buffer holds twice the samples needed, so samples that arrive out of order are used as well
+func (m *singleFftMapper) ready() bool {
+	if m.config.SampleRate > 0 {
+		return len(m.samplesBuffer) > 1 && m.newest.Sub(m.oldest).Seconds() >= 2*float64(m.fft.Len())/m.config.SampleRate
+	}
+	return len(m.samplesBuffer) >= m.fft.Len()<<1
+}
+
+func (m *singleFftMapper) doFft(update *message.Update) {
+	if !m.ready() {
 		return
 	}
+	timestamps := m.sortTimestamps()
+	var samples []float64
+	var duration float64
+	if m.config.SampleRate > 0 {
+		samples, duration = m.resampleFrame(timestamps)
+	} else {
+		samples, duration = m.frame(timestamps)
+	}
 
-	timestamps := m.sortTimestamps(path)
 	value := message.Spectrum{
-		NumberOfSamples:   m.mappings[path].fft.Len(),
-		Duration:          timestamps[m.mappings[path].fft.Len()].Sub(timestamps[0]).Seconds(),
-		Coefficients:      make([]message.Coefficient, 0, m.mappings[path].fft.Len()),
-		FrequencyStepSize: m.mappings[path].frequencyStepSize,
+		NumberOfSamples:   m.fft.Len(),
+		Duration:          duration,
+		Coefficients:      make([]message.Coefficient, 0, m.fft.Len()),
+		FrequencyStepSize: m.config.FrequencyStepSize,
 	}
 
-	samples := m.extractSamples(path, timestamps)
-	coeff := m.mappings[path].fft.Coefficients(nil, samples)
+	rms := rootMeanSquare(samples)
+	for i := range samples {
+		samples[i] *= m.weights[i]
+	}
+	coeff := m.fft.Coefficients(nil, samples)
 
-	m.buildSpectrum(&value, coeff, path)
+	m.buildSpectrum(&value, coeff)
 
 	update.AddValue(
-		message.NewValue().WithPath(m.mappings[path].spectrumPath).WithValue(value),
+		message.NewValue().WithPath(m.config.SpectrumPath).WithValue(value),
 	).WithTimestamp(timestamps[0])
+	if m.config.RmsPath != "" {
+		update.AddValue(message.NewValue().WithPath(m.config.RmsPath).WithValue(rms))
+	}
+	samplesPerSecond := float64(value.NumberOfSamples) / value.Duration
+	for _, band := range m.config.Bands {
+		update.AddValue(message.NewValue().WithPath(band.Path).WithValue(m.bandEnergy(coeff, samplesPerSecond, band)))
+	}
+	for i, peak := range m.peaks(coeff, samplesPerSecond) {
+		update.AddValue(message.NewValue().WithPath(fmt.Sprintf("%s.%d.frequency", m.config.PeaksPath, i+1)).WithValue(peak.frequency))
+		update.AddValue(message.NewValue().WithPath(fmt.Sprintf("%s.%d.amplitude", m.config.PeaksPath, i+1)).WithValue(peak.amplitude))
+	}
 }
 
-func (m *FftMapper) buildSpectrum(value *message.Spectrum, coeff []complex128, path string) {
+// takes the oldest samples, the samples are assumed to be equally spaced
+func (m *singleFftMapper) frame(timestamps []time.Time) ([]float64, float64) {
+	n := m.fft.Len()
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = m.samplesBuffer[timestamps[i]]
+	}
+	for _, t := range timestamps[:n-m.overlap] {
+		delete(m.samplesBuffer, t)
+	}
+	m.oldest = timestamps[n-m.overlap]
+	return samples, timestamps[n].Sub(timestamps[0]).Seconds()
+}
+
+// interpolates the oldest samples at the sample rate
+func (m *singleFftMapper) resampleFrame(timestamps []time.Time) ([]float64, float64) {
+	n := m.fft.Len()
+	duration := float64(n) / m.config.SampleRate
+	at := func(i int) time.Time {
+		return timestamps[0].Add(time.Duration(float64(i) / m.config.SampleRate * float64(time.Second)))
+	}
+	samples := make([]float64, n)
+	j := 0
+	for i := range samples {
+		t := at(i)
+		for !timestamps[j+1].After(t) {
+			j++
+		}
+		before, after := m.samplesBuffer[timestamps[j]], m.samplesBuffer[timestamps[j+1]]
+		fraction := t.Sub(timestamps[j]).Seconds() / timestamps[j+1].Sub(timestamps[j]).Seconds()
+		samples[i] = before + (after-before)*fraction
+	}
+	next := at(n - m.overlap)
+	for _, t := range timestamps {
+		if !t.Before(next) {
+			m.oldest = t
+			break
+		}
+		delete(m.samplesBuffer, t)
+	}
+	return samples, duration
+}
+
+func (m *singleFftMapper) buildSpectrum(value *message.Spectrum, coeff []complex128) {
 	samplesPerSecond := float64(value.NumberOfSamples) / value.Duration
+	// corrects the magnitudes for the coherent gain of the window
+	weightsSum := floats.Sum(m.weights)
 	var spectrumFrequency, coefficientFrequency float64
 	var coefficientSum complex128
 	var n int
 
 	for i, c := range coeff {
-		coefficientFrequency = m.mappings[path].fft.Freq(i) * samplesPerSecond
+		coefficientFrequency = m.fft.Freq(i) * samplesPerSecond
 		coefficientSum += c
 		n += 1
-		if coefficientFrequency > spectrumFrequency+m.mappings[path].frequencyStepSize/2 {
+		if coefficientFrequency > spectrumFrequency+m.config.FrequencyStepSize/2 {
 			value.Coefficients = append(
 				value.Coefficients,
 				message.Coefficient{
-					Magnitude: 2 * cmplx.Abs(coefficientSum) / float64(value.NumberOfSamples),
+					Magnitude: 2 * cmplx.Abs(coefficientSum) / weightsSum,
 					Phase:     cmplx.Phase(coefficientSum),
 				},
 			)
 			// reset values and increase spectrumFrequency
 			coefficientSum = 0
 			n = 0
-			spectrumFrequency += m.mappings[path].frequencyStepSize
+			spectrumFrequency += m.config.FrequencyStepSize
 		}
 	}
 }
 
-func (m *FftMapper) extractSamples(path string, timestamps []time.Time) []float64 {
-	samples := make([]float64, 0, m.mappings[path].fft.Len())
-	for i := 0; i < cap(samples); i++ {
-		samples = append(samples, m.mappings[path].samplesBuffer[timestamps[i]])
-		delete(m.mappings[path].samplesBuffer, timestamps[i])
+// the mean square of the frequencies within the band, corrected for the power of the window
+func (m *singleFftMapper) bandEnergy(coeff []complex128, samplesPerSecond float64, band config.FftBandConfig) float64 {
+	n := m.fft.Len()
+	normalization := float64(n) * floats.Dot(m.weights, m.weights)
+	var energy float64
+	for i, c := range coeff {
+		frequency := m.fft.Freq(i) * samplesPerSecond
+		if frequency < band.From || frequency >= band.To {
+			continue
+		}
+		power := real(c)*real(c) + imag(c)*imag(c)
+		// the energy of the negative frequencies is added to the positive ones, the zero and the Nyquist frequency have no counterpart
+		if i != 0 && !(n%2 == 0 && i == n/2) {
+			power *= 2
+		}
+		energy += power / normalization
 	}
-	return samples
+	return energy
 }
 
-func (m *FftMapper) sortTimestamps(path string) []time.Time {
-	timestamps := make([]time.Time, 0, m.mappings[path].fft.Len()<<1)
-	for k := range m.mappings[path].samplesBuffer {
+type fftPeak struct {
+	frequency float64
+	amplitude float64
+}
+
+// returns the local maxima of the amplitudes, highest first
+func (m *singleFftMapper) peaks(coeff []complex128, samplesPerSecond float64) []fftPeak {
+	if m.config.NumberOfPeaks == 0 {
+		return nil
+	}
+	weightsSum := floats.Sum(m.weights)
+	amplitudes := make([]float64, len(coeff))
+	for i, c := range coeff {
+		amplitudes[i] = 2 * cmplx.Abs(c) / weightsSum
+	}
+	peaks := make([]fftPeak, 0)
+	for i := 1; i < len(amplitudes)-1; i++ {
+		if amplitudes[i] > amplitudes[i-1] && amplitudes[i] >= amplitudes[i+1] {
+			peaks = append(peaks, fftPeak{frequency: m.fft.Freq(i) * samplesPerSecond, amplitude: amplitudes[i]})
+		}
+	}
+	slices.SortStableFunc(peaks, func(a, b fftPeak) int {
+		return cmp.Compare(b.amplitude, a.amplitude)
+	})
+	return peaks[:min(len(peaks), m.config.NumberOfPeaks)]
+}
+
+func rootMeanSquare(samples []float64) float64 {
+	return math.Sqrt(floats.Dot(samples, samples) / float64(len(samples)))
+}
+
+func (m *singleFftMapper) sortTimestamps() []time.Time {
+	timestamps := make([]time.Time, 0, m.fft.Len()<<1)
+	for k := range m.samplesBuffer {
 		timestamps = append(timestamps, k)
 	}
 	slices.SortFunc(timestamps, func(a, b time.Time) int {
@@ -146,3 +321,37 @@ func (m *FftMapper) sortTimestamps(path string) []time.Time {
 	})
 	return timestamps
 }
+
+// Returns the buffered samples per path
+func (m *FftMapper) Snapshot() ([]byte, error) {
+	state := make(map[string]map[time.Time]float64, len(m.mappings))
+	for path, mapping := range m.mappings {
+		mapping.samplesBufferMutex.Lock()
+		samples := make(map[time.Time]float64, len(mapping.samplesBuffer))
+		for t, v := range mapping.samplesBuffer {
+			samples[t] = v
+		}
+		mapping.samplesBufferMutex.Unlock()
+		state[path] = samples
+	}
+	return json.Marshal(state)
+}
+
+func (m *FftMapper) Restore(b []byte) error {
+	var state map[string]map[time.Time]float64
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	for path, samples := range state {
+		mapping, ok := m.mappings[path]
+		if !ok {
+			continue
+		}
+		mapping.samplesBufferMutex.Lock()
+		for t, v := range samples {
+			mapping.add(t, v)
+		}
+		mapping.samplesBufferMutex.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mapper_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoMap fft", func() {
+	now := time.Now()
+	// 62.5 Hz is exactly on a frequency of the spectrum with 256 samples at 1000 samples per second
+	sine := func(t float64) float64 { return math.Sin(2 * math.Pi * 62.5 * t) }
+	mapped := func(timestamp time.Time, value float64) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(timestamp).AddValue(message.NewValue().WithPath("testingPath").WithValue(value))
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+	// maps the samples and returns the values of the updates, one map per update
+	run := func(fftc *config.FftConfig, timestamps []float64) []map[string]any {
+		m, _ := NewFftMapper(config.MapperConfig{Context: "testingContext"}, []*config.FftConfig{fftc})
+		results := make([]map[string]any, 0)
+		for _, t := range timestamps {
+			result, err := m.DoMap(mapped(now.Add(time.Duration(t*float64(time.Second))), sine(t)))
+			Expect(err).ToNot(HaveOccurred())
+			for _, u := range result.Updates {
+				values := make(map[string]any)
+				for _, v := range u.Values {
+					values[v.Path] = v.Value
+				}
+				results = append(results, values)
+			}
+		}
+		return results
+	}
+	regular := func(n int) []float64 {
+		timestamps := make([]float64, n)
+		for i := range timestamps {
+			timestamps[i] = float64(i) / 1000
+		}
+		return timestamps
+	}
+	newConfig := func() *config.FftConfig {
+		return &config.FftConfig{
+			Path:                  "testingPath",
+			SpectrumPath:          "testingSpectrumPath",
+			SamplesChannelBitSize: 8,
+			FrequencyStepSize:     1000.0 / 256,
+			Window:                config.FftWindowHann,
+			RmsPath:               "testingRmsPath",
+			Bands: []config.FftBandConfig{
+				{Path: "testingBandPath", From: 50, To: 75},
+				{Path: "testingOtherBandPath", From: 200, To: 300},
+			},
+			NumberOfPeaks: 2,
+			PeaksPath:     "testingPeaksPath",
+		}
+	}
+
+	It("publishes the spectrum, rms, band energy and peaks", func() {
+		results := run(newConfig(), regular(512))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0]).To(HaveKey("testingSpectrumPath"))
+		Expect(results[0]["testingRmsPath"]).To(BeNumerically("~", math.Sqrt(0.5), 0.01))
+		Expect(results[0]["testingBandPath"]).To(BeNumerically("~", 0.5, 0.01))
+		Expect(results[0]["testingOtherBandPath"]).To(BeNumerically("<", 0.001))
+		Expect(results[0]["testingPeaksPath.1.frequency"]).To(BeNumerically("~", 62.5, 0.01))
+		Expect(results[0]["testingPeaksPath.1.amplitude"]).To(BeNumerically("~", 1, 0.01))
+	})
+	It("reuses samples when overlapping", func() {
+		Expect(run(newConfig(), regular(1024))).To(HaveLen(3))
+		c := newConfig()
+		c.Overlap = 0.5
+		Expect(run(c, regular(1024))).To(HaveLen(5))
+	})
+	It("resamples irregular samples", func() {
+		timestamps := regular(600)
+		for i := range timestamps {
+			// up to a quarter of the sample interval early or late
+			timestamps[i] += math.Sin(float64(i)) * 0.00025
+		}
+		c := newConfig()
+		c.SampleRate = 1000
+		results := run(c, timestamps)
+		Expect(results).To(HaveLen(1))
+		Expect(results[0]["testingPeaksPath.1.frequency"]).To(BeNumerically("~", 62.5, 0.01))
+		Expect(results[0]["testingPeaksPath.1.amplitude"]).To(BeNumerically("~", 1, 0.05))
+	})
+	It("reports the paths it publishes", func() {
+		m, _ := NewFftMapper(config.MapperConfig{Context: "testingContext"}, []*config.FftConfig{newConfig()})
+		Expect(m.Paths()).To(Equal([]string{
+			"testingBandPath",
+			"testingOtherBandPath",
+			"testingPeaksPath.1.amplitude",
+			"testingPeaksPath.1.frequency",
+			"testingPeaksPath.2.amplitude",
+			"testingPeaksPath.2.frequency",
+			"testingRmsPath",
+			"testingSpectrumPath",
+		}))
+		for path := range run(newConfig(), regular(512))[0] {
+			Expect(m.Paths()).To(ContainElement(path))
+		}
+	})
+})
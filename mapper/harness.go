@@ -0,0 +1,129 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+)
+
+// Runs a mapper over recorded messages, used to test a mapping file without deploying it
+type Harness[T nanomsg.Message] struct {
+	mapper   RealMapper[T]
+	mappings []string
+}
+
+// The mappings are the paths of the configured mappings, they are reported when they never fired
+func NewHarness[T nanomsg.Message](m RealMapper[T], mappings []string) *Harness[T] {
+	return &Harness[T]{mapper: m, mappings: mappings}
+}
+
+type HarnessReport struct {
+	Output     []*message.Mapped
+	Fired      map[string]int    // number of mapped values per path
+	Errors     map[string]int    // number of errors per mapping, errors that are not caused by a mapping use an empty string
+	LastErrors map[string]string // the last error per mapping
+	NeverFired []string          // the configured mappings without mapped values
+}
+
+// Messages without updates are not part of the output, the same as when the mapper runs as a process
+func (h *Harness[T]) Run(input []*T) *HarnessReport {
+	report := &HarnessReport{
+		Output:     make([]*message.Mapped, 0),
+		Fired:      make(map[string]int),
+		Errors:     make(map[string]int),
+		LastErrors: make(map[string]string),
+	}
+	setMappingErrorObserver(func(err *MappingError) {
+		report.Errors[err.Mapping]++
+		report.LastErrors[err.Mapping] = err.Err.Error()
+	})
+	defer setMappingErrorObserver(nil)
+
+	for _, in := range input {
+		out, err := h.mapper.DoMap(in)
+		if err != nil {
+			var me *MappingError
+			if !errors.As(err, &me) {
+				// errors of mappings are already reported by the observer
+				report.Errors[""]++
+				report.LastErrors[""] = err.Error()
+			}
+			continue
+		}
+		if out != nil {
+			out = validateMapped(out, nil)
+		}
+		if out == nil || len(out.Updates) == 0 {
+			continue
+		}
+		for _, u := range out.Updates {
+			for _, v := range u.Values {
+				report.Fired[v.Path]++
+			}
+		}
+		report.Output = append(report.Output, out)
+	}
+
+	for _, m := range h.mappings {
+		if report.Fired[m] == 0 {
+			report.NeverFired = append(report.NeverFired, m)
+		}
+	}
+	return report
+}
+
+// Compares the output with the expected output, uuids are ignored because they are generated for every message
+func DiffMapped(expected []*message.Mapped, actual []*message.Mapped, ignoreTimestamps bool) ([]string, error) {
+	result := make([]string, 0)
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		var e, a string
+		var err error
+		if i < len(expected) {
+			if e, err = NormalizeMapped(expected[i], ignoreTimestamps); err != nil {
+				return nil, err
+			}
+		}
+		if i < len(actual) {
+			if a, err = NormalizeMapped(actual[i], ignoreTimestamps); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case i >= len(actual):
+			result = append(result, fmt.Sprintf("line %d: missing %s", i+1, e))
+		case i >= len(expected):
+			result = append(result, fmt.Sprintf("line %d: unexpected %s", i+1, a))
+		case e != a:
+			result = append(result, fmt.Sprintf("line %d: expected %s, got %s", i+1, e, a))
+		}
+	}
+	return result, nil
+}
+
+// The json document of the message without uuids, the message is decoded first so values compare the same as after reading a file
+func NormalizeMapped(m *message.Mapped, ignoreTimestamps bool) (string, error) {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	var decoded message.Mapped
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		return "", err
+	}
+	for i := range decoded.Updates {
+		decoded.Updates[i].Source.Uuid = uuid.Nil
+		decoded.Updates[i].Source.TransferUuid = uuid.Nil
+		if ignoreTimestamps {
+			decoded.Updates[i].Timestamp = time.Time{}
+		}
+	}
+	if bytes, err = json.Marshal(decoded); err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
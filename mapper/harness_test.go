@@ -0,0 +1,59 @@
+package mapper_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// maps every value to the testingPath, values that are not numbers fail
+type harnessTestMapper struct{}
+
+func (harnessTestMapper) DoMap(in *message.Mapped) (*message.Mapped, error) {
+	if _, ok := in.Updates[0].Values[0].Value.(float64); !ok {
+		return nil, errors.New("not a number")
+	}
+	return mappedWithValue(in.Updates[0].Timestamp, uuid.New(), in.Updates[0].Values[0].Value), nil
+}
+
+func mappedWithValue(timestamp time.Time, id uuid.UUID, value any) *message.Mapped {
+	return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(
+		message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.SignalKType).WithUuid(id),
+		).WithTimestamp(timestamp).AddValue(message.NewValue().WithPath("testingPath").WithValue(value)),
+	)
+}
+
+var _ = Describe("Harness", func() {
+	now := time.Now().UTC()
+	input := []*message.Mapped{
+		mappedWithValue(now, uuid.Nil, 1.0),
+		mappedWithValue(now, uuid.Nil, "a"),
+		mappedWithValue(now.Add(time.Second), uuid.Nil, 2.0),
+	}
+
+	It("reports the coverage of the mappings", func() {
+		report := NewHarness[message.Mapped](harnessTestMapper{}, []string{"testingPath", "otherPath"}).Run(input)
+		Expect(report.Output).To(HaveLen(2))
+		Expect(report.Fired).To(Equal(map[string]int{"testingPath": 2}))
+		Expect(report.NeverFired).To(Equal([]string{"otherPath"}))
+		Expect(report.Errors).To(Equal(map[string]int{"": 1}))
+	})
+	It("ignores the uuids", func() {
+		report := NewHarness[message.Mapped](harnessTestMapper{}, nil).Run(input)
+		expected := []*message.Mapped{mappedWithValue(now, uuid.Nil, 1.0), mappedWithValue(now.Add(time.Second), uuid.Nil, 2.0)}
+		Expect(DiffMapped(expected, report.Output, false)).To(BeEmpty())
+	})
+	It("reports the differences", func() {
+		report := NewHarness[message.Mapped](harnessTestMapper{}, nil).Run(input)
+		expected := []*message.Mapped{mappedWithValue(now, uuid.Nil, 1.0), mappedWithValue(now, uuid.Nil, 2.0), mappedWithValue(now, uuid.Nil, 3.0)}
+		Expect(DiffMapped(expected, report.Output, false)).To(HaveLen(2))
+		Expect(DiffMapped(expected, report.Output, true)).To(HaveLen(1))
+	})
+})
@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -16,14 +17,26 @@ type JSONMapper struct {
 	config            config.MapperConfig
 	protocol          string
 	jsonMappingConfig []config.JSONMappingConfig
+	deadLetterSink
 }
 
 func NewJSONMapper(c config.MapperConfig, jmc []config.JSONMappingConfig) (*JSONMapper, error) {
 	return &JSONMapper{config: c, protocol: config.JSONType, jsonMappingConfig: jmc}, nil
 }
 
-func (m *JSONMapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *JSONMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	processInParallel(ctx, subscriber, publisher, withReload[message.Raw](m, m, m.config.ReloadConfig), m.deadLetters, false, m.config.NumberOfWorkers)
+}
+
+// Replaces the mappings
+func (m *JSONMapper) Reload(configFilePath string) error {
+	jmc, err := config.LoadJSONMappingConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(m.jsonMappingConfig, jmc, func(c config.JSONMappingConfig) string { return describeMapping(c.MappingConfig) })
+	m.jsonMappingConfig = jmc
+	return nil
 }
 
 func (m *JSONMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
@@ -62,9 +75,11 @@ func (m *JSONMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 			}
 		}
 		output, err := runExpr(env, &jmc.MappingConfig)
-		if err == nil {
-			u.AddValue(message.NewValue().WithPath(jmc.Path).WithValue(output))
+		if err != nil {
+			m.deadLetters.failed(r, err)
+			continue
 		}
+		u.AddValue(message.NewValue().WithPath(jmc.Path).WithValue(output))
 	}
 
 	if len(u.Values) == 0 {
@@ -1,17 +1,33 @@
 package mapper
 
 import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/message"
 	"github.com/munnik/gosk/nanomsg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.einride.tech/can"
 	"go.uber.org/zap"
 )
 
 const bufferSize = 1 << 16
 
-// Mapper interface
+var (
+	receiveQueueGauge = promauto.NewGauge(prometheus.GaugeOpts{Name: "gosk_mapper_receive_queue_length", Help: "number of received messages waiting to be divided over the workers"})
+	workerQueueGauge  = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "gosk_mapper_worker_queue_length", Help: "number of messages waiting to be mapped by the worker"}, []string{"worker"})
+	mappingDuration   = promauto.NewHistogram(prometheus.HistogramOpts{Name: "gosk_mapper_duration_seconds", Help: "time spent mapping a message"})
+)
+
+// Mapper interface, Map returns when the context is done and the received messages are mapped and published
 type Mapper[TS nanomsg.Message, TP nanomsg.Message] interface {
-	Map(subscriber *nanomsg.Subscriber[TS], publisher *nanomsg.Publisher[TP])
+	Map(ctx context.Context, subscriber *nanomsg.Subscriber[TS], publisher *nanomsg.Publisher[TP])
 }
 
 type RealMapper[T nanomsg.Message] interface {
@@ -22,27 +38,45 @@ type RealRawMapper[T nanomsg.Message] interface {
 	DoMap(*T) (*message.Raw, error)
 }
 
-func process[T nanomsg.Message](subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Mapped], mapper RealMapper[T], ignoreEmptyUpdates bool) {
+// Maps the messages, the messages that could not be mapped or don't match the schema are sent to the dead letters
+func process[T nanomsg.Message](ctx context.Context, subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Mapped], mapper RealMapper[T], deadLetters *DeadLetters, ignoreEmptyUpdates bool) {
+	processInParallel(ctx, subscriber, publisher, mapper, deadLetters, ignoreEmptyUpdates, 1)
+}
+
+// Maps the messages with a number of workers, the mapper has to be safe for concurrent use when there is more than one worker
+func processInParallel[T nanomsg.Message](ctx context.Context, subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Mapped], mapper RealMapper[T], deadLetters *DeadLetters, ignoreEmptyUpdates bool, workers int) {
+	processFlushing(ctx, subscriber, publisher, mapper, nil, deadLetters, ignoreEmptyUpdates, workers)
+}
+
+// Maps the messages like processInParallel and sends the messages the flusher held back at every flush interval and on
+// shutdown, there is nothing to flush when the flusher is nil
+func processFlushing[T nanomsg.Message](ctx context.Context, subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Mapped], mapper RealMapper[T], flusher FlushingMapper, deadLetters *DeadLetters, ignoreEmptyUpdates bool, workers int) {
 	receiveBuffer := make(chan *T, bufferSize)
-	defer close(receiveBuffer)
 	sendBuffer := make(chan *message.Mapped, bufferSize)
-	defer close(sendBuffer)
+	if flusher != nil {
+		g := guard(mapper)
+		mapper = g
+		onShutdown(g, startFlushing(g, flusher, sendBuffer, deadLetters))
+	}
+	defer stopPublishing(sendBuffer, publisher, mapper)
 
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 	go publisher.Send(sendBuffer)
 
-	var err error
-
-	for in := range receiveBuffer {
-		var out *message.Mapped
-		if out, err = mapper.DoMap(in); err != nil {
+	dispatch(receiveBuffer, workers, func(in *T) {
+		start := time.Now()
+		out, err := mapper.DoMap(in)
+		mappingDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
 			logger.GetLogger().Warn(
 				"Could not map the received data",
 				zap.Any("Input", in),
 				zap.String("Error", err.Error()),
 			)
-			continue
+			deadLetters.failed(in, err)
+			return
 		}
+		out = validateMapped(out, deadLetters)
 		if len(out.Updates) == 0 {
 			if !ignoreEmptyUpdates {
 				logger.GetLogger().Warn(
@@ -51,35 +85,147 @@ func process[T nanomsg.Message](subscriber *nanomsg.Subscriber[T], publisher *na
 					zap.Any("Output", out),
 				)
 			}
-			continue
+			return
 		}
 		sendBuffer <- out
-	}
+	})
 }
 
-func processRaw[T nanomsg.Message](subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Raw], mapper RealRawMapper[T]) {
+func processRaw[T nanomsg.Message](ctx context.Context, subscriber *nanomsg.Subscriber[T], publisher *nanomsg.Publisher[message.Raw], mapper RealRawMapper[T], deadLetters *DeadLetters, workers int) {
 	receiveBuffer := make(chan *T, bufferSize)
-	defer close(receiveBuffer)
 	sendBuffer := make(chan *message.Raw, bufferSize)
-	defer close(sendBuffer)
+	defer stopPublishing(sendBuffer, publisher, mapper)
 
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 	go publisher.Send(sendBuffer)
 
-	var err error
-
-	for in := range receiveBuffer {
-		var out *message.Raw
-		if out, err = mapper.DoMap(in); err != nil {
+	dispatch(receiveBuffer, workers, func(in *T) {
+		start := time.Now()
+		out, err := mapper.DoMap(in)
+		mappingDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
 			logger.GetLogger().Warn(
 				"Could not map the received data",
 				zap.Any("Input", in),
 				zap.String("Error", err.Error()),
 			)
-			continue
+			deadLetters.failed(in, err)
+			return
 		}
 		if out != nil {
 			sendBuffer <- out
 		}
+	})
+}
+
+// called when the receive buffer is closed and all messages are mapped, runs the shutdown hooks of the mappers and waits until
+// the mapped messages are published
+func stopPublishing[T nanomsg.Message](sendBuffer chan *T, publisher *nanomsg.Publisher[T], mappers ...any) {
+	shutdown(mappers...)
+	close(sendBuffer)
+	<-publisher.Done()
+}
+
+// Mappers that hold messages back, e.g. the aggregate of an interval, return the messages of the intervals that ended before
+// now. On shutdown the messages that can't be continued after a restart are returned as well.
+type FlushingMapper interface {
+	Flush(now time.Time, shutdown bool) []*message.Mapped
+}
+
+const flushInterval = time.Second
+
+// flushes at every flush interval until the returned function is called, that function flushes for the last time
+func startFlushing[T nanomsg.Message](g *guardedMapper[T], flusher FlushingMapper, sendBuffer chan<- *message.Mapped, deadLetters *DeadLetters) func() {
+	flush := func(shutdown bool) {
+		var flushed []*message.Mapped
+		g.between(func() { flushed = flusher.Flush(time.Now(), shutdown) })
+		for _, m := range flushed {
+			if m = validateMapped(m, deadLetters); len(m.Updates) > 0 {
+				sendBuffer <- m
+			}
+		}
 	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				flush(false)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		flush(true)
+	}
+}
+
+// Divides the messages over the workers, messages with the same partition key are handled by the same worker so they are mapped in the order they are received
+func dispatch[T nanomsg.Message](receiveBuffer <-chan *T, workers int, handle func(*T)) {
+	if workers <= 1 {
+		for in := range receiveBuffer {
+			receiveQueueGauge.Set(float64(len(receiveBuffer)))
+			handle(in)
+		}
+		return
+	}
+
+	queues := make([]chan *T, workers)
+	wg := sync.WaitGroup{}
+	for i := range queues {
+		queues[i] = make(chan *T, bufferSize/workers)
+		wg.Add(1)
+		go func(queue <-chan *T, gauge prometheus.Gauge) {
+			defer wg.Done()
+			for in := range queue {
+				gauge.Set(float64(len(queue)))
+				handle(in)
+			}
+		}(queues[i], workerQueueGauge.WithLabelValues(strconv.Itoa(i)))
+	}
+	for in := range receiveBuffer {
+		receiveQueueGauge.Set(float64(len(receiveBuffer)))
+		queues[partition(in, workers)] <- in
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+}
+
+// Raw messages are partitioned by connector, Modbus messages by slave because the previous registers are kept per slave and
+// CAN bus messages by connector and frame id so the frames of one id are mapped in order, mapped messages by context and source
+func partitionKey[T nanomsg.Message](in *T) string {
+	switch m := any(in).(type) {
+	case *message.Raw:
+		if m.Type == config.ModbusType && len(m.Value) > 0 {
+			return "slave/" + strconv.Itoa(int(m.Value[0]))
+		}
+		if m.Type == config.CanBusType {
+			frame := can.Frame{}
+			if err := frame.UnmarshalJSON(m.Value); err == nil {
+				return m.Connector + "/frame/" + strconv.FormatUint(uint64(frame.ID), 10)
+			}
+		}
+		return m.Connector
+	case *message.Mapped:
+		if len(m.Updates) > 0 {
+			return m.Context + "/" + m.Updates[0].Source.Label
+		}
+		return m.Context
+	}
+	return ""
+}
+
+func partition[T nanomsg.Message](in *T, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(partitionKey(in)))
+	return int(h.Sum32() % uint32(workers))
 }
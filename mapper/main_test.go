@@ -0,0 +1,84 @@
+package mapper_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/protocol"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parallel mapping", func() {
+	now := time.Now()
+	raw := func(connector string, protocolType string, value []byte) *message.Raw {
+		r := message.NewRaw().WithConnector(connector).WithType(protocolType).WithValue(value)
+		r.Uuid = uuid.Nil
+		r.Timestamp = now
+		return r
+	}
+	modbusRaw := func(slave byte, register byte) *message.Raw {
+		return raw("testingConnector", config.ModbusType, []byte{slave, 0x00, 0x04, 0x00, 0x16, 0x00, 0x01, 0x00, register})
+	}
+
+	It("partitions the messages", func() {
+		Expect(PartitionKey(modbusRaw(1, 1))).To(Equal(PartitionKey(raw("otherConnector", config.ModbusType, []byte{1, 0}))))
+		Expect(PartitionKey(modbusRaw(1, 1))).ToNot(Equal(PartitionKey(modbusRaw(2, 1))))
+		Expect(PartitionKey(raw("testingConnector", config.BinaryType, []byte{1}))).To(Equal("testingConnector"))
+		frame := func(id string, data string) []byte {
+			return []byte(`{"id":` + id + `,"data":"` + data + `"}`)
+		}
+		Expect(PartitionKey(raw("testingConnector", config.CanBusType, frame("256", "0102")))).To(Equal(PartitionKey(raw("testingConnector", config.CanBusType, frame("256", "0304")))))
+		Expect(PartitionKey(raw("testingConnector", config.CanBusType, frame("256", "0102")))).ToNot(Equal(PartitionKey(raw("testingConnector", config.CanBusType, frame("257", "0102")))))
+		Expect(PartitionKey(raw("testingConnector", config.CanBusType, []byte("invalid")))).To(Equal("testingConnector"))
+		m := message.NewMapped().WithContext("testingContext").AddUpdate(
+			message.NewUpdate().WithSource(*message.NewSource().WithLabel("testingConnector")),
+		)
+		Expect(PartitionKey(m)).To(Equal("testingContext/testingConnector"))
+	})
+	It("maps the slaves of the modbus mapper concurrently", func() {
+		mmc := make([]config.ModbusMappingsConfig, 0)
+		for slave := uint8(1); slave <= 8; slave++ {
+			mmc = append(mmc, config.ModbusMappingsConfig{
+				MappingConfig: config.MappingConfig{Expression: "registers[22]", Path: "testingPath"},
+				ModbusHeader:  protocol.ModbusHeader{Slave: slave, FunctionCode: protocol.ReadInputRegisters, Address: 22, NumberOfCoilsOrRegisters: 1},
+			})
+		}
+		m, _ := NewModbusMapper(config.MapperConfig{Context: "testingContext"}, mmc)
+		wg := sync.WaitGroup{}
+		for slave := byte(1); slave <= 8; slave++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for register := byte(1); register <= 100; register++ {
+					result, err := m.DoMap(modbusRaw(slave, register))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.Updates[0].Values[0].Value).To(Equal(uint16(register)))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	It("maps concurrently with the binary mapper", func() {
+		m, _ := NewBinaryMapper(config.MapperConfig{Context: "testingContext"}, []config.MappingConfig{{Path: "testingPath", Expression: "value[0]"}})
+		wg := sync.WaitGroup{}
+		for i := byte(1); i <= 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for range 100 {
+					result, err := m.DoMap(raw("testingConnector", config.BinaryType, []byte{i}))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.Updates[0].Values[0].Value).To(Equal(i))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+})
@@ -2,7 +2,11 @@ package mapper_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -11,3 +15,11 @@ func TestMapper(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Mapper Suite")
 }
+
+// a mapped message with a single value of the testing connector
+func mappedWithPath(path string, timestamp time.Time, value any) *message.Mapped {
+	u := message.NewUpdate().WithSource(
+		*message.NewSource().WithLabel("testingConnector").WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+	).WithTimestamp(timestamp).AddValue(message.NewValue().WithPath(path).WithValue(value))
+	return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+}
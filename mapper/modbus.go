@@ -1,11 +1,14 @@
 package mapper
 
 import (
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"maps"
 	"math"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/munnik/gosk/config"
@@ -19,6 +22,8 @@ type ModbusMapper struct {
 	protocol             string
 	modbusMappingsConfig []config.ModbusMappingsConfig
 	env                  map[uint8]ExpressionEnvironment
+	envMutex             sync.Mutex
+	deadLetterSink
 }
 
 func NewModbusMapper(c config.MapperConfig, mmc []config.ModbusMappingsConfig) (*ModbusMapper, error) {
@@ -30,8 +35,22 @@ func NewModbusMapper(c config.MapperConfig, mmc []config.ModbusMappingsConfig) (
 	}, nil
 }
 
-func (m *ModbusMapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *ModbusMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	mapper := withPersistentState[message.Raw](m, m.config.StateConfig, m.config.Protocol, m.config.ConfigFile)
+	processInParallel(ctx, subscriber, publisher, withReload(mapper, m, m.config.ReloadConfig), m.deadLetters, false, m.config.NumberOfWorkers)
+}
+
+// Replaces the mappings, the previous registers are kept
+func (m *ModbusMapper) Reload(configFilePath string) error {
+	mmc, err := config.LoadModbusMappingsConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(m.modbusMappingsConfig, mmc, func(c config.ModbusMappingsConfig) string {
+		return fmt.Sprintf("%+v %s", c.ModbusHeader, describeMapping(c.MappingConfig))
+	})
+	m.modbusMappingsConfig = mmc
+	return nil
 }
 
 func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
@@ -44,7 +63,8 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 	}
 	slave := uint8(r.Value[0])
 
-	m.loadEnvironmentForSlave(slave)
+	// the messages of a slave are mapped by one worker at a time
+	env := m.loadEnvironmentForSlave(slave)
 
 	functionCode := binary.BigEndian.Uint16(r.Value[1:3])
 	address := binary.BigEndian.Uint16(r.Value[3:5])
@@ -58,10 +78,10 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 		for i, coil := range protocol.RegistersToCoils(registerData) {
 			coilsMap[int(address)+i] = coil
 		}
-		if m.env[slave]["coils"] == nil {
-			m.env[slave]["coils"] = make(map[int]bool, 0)
+		if env["coils"] == nil {
+			env["coils"] = make(map[int]bool, 0)
 		}
-		maps.Copy(m.env[slave]["coils"].(map[int]bool), coilsMap)
+		maps.Copy(env["coils"].(map[int]bool), coilsMap)
 	} else if functionCode == protocol.ReadHoldingRegisters || functionCode == protocol.ReadInputRegisters {
 		skipFaultDetection := false
 		if _, ok := m.config.ProtocolOptions[config.ProtocolOptionModbusSkipFaultDetection]; ok {
@@ -89,8 +109,8 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 		timestampMap := make(map[int]time.Time, len(registerData))
 		timeDeltaMap := make(map[int]int64, len(registerData))
 
-		if previousRegisterMap, ok := m.env[slave]["registers"].(map[int]uint16); ok {
-			previousTimestampMap := m.env[slave]["timestamps"].(map[int]time.Time)
+		if previousRegisterMap, ok := env["registers"].(map[int]uint16); ok {
+			previousTimestampMap := env["timestamps"].(map[int]time.Time)
 			for i, register := range registerData {
 				delta := int32(register) - int32(previousRegisterMap[int(address)+i])
 				if delta < -50000 { // overflow
@@ -110,25 +130,25 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 			registersMap[int(address)+i] = register
 			timestampMap[int(address)+i] = r.Timestamp
 		}
-		if _, ok := m.env[slave]["deltas"].(map[int]int32); ok {
-			maps.Copy(m.env[slave]["deltas"].(map[int]int32), deltaMap)
+		if _, ok := env["deltas"].(map[int]int32); ok {
+			maps.Copy(env["deltas"].(map[int]int32), deltaMap)
 		} else {
-			m.env[slave]["deltas"] = deltaMap
+			env["deltas"] = deltaMap
 		}
-		if _, ok := m.env[slave]["registers"].(map[int]uint16); ok {
-			maps.Copy(m.env[slave]["registers"].(map[int]uint16), registersMap)
+		if _, ok := env["registers"].(map[int]uint16); ok {
+			maps.Copy(env["registers"].(map[int]uint16), registersMap)
 		} else {
-			m.env[slave]["registers"] = registersMap
+			env["registers"] = registersMap
 		}
-		if _, ok := m.env[slave]["timestamps"].(map[int]time.Time); ok {
-			maps.Copy(m.env[slave]["timestamps"].(map[int]time.Time), timestampMap)
+		if _, ok := env["timestamps"].(map[int]time.Time); ok {
+			maps.Copy(env["timestamps"].(map[int]time.Time), timestampMap)
 		} else {
-			m.env[slave]["timestamps"] = timestampMap
+			env["timestamps"] = timestampMap
 		}
-		if _, ok := m.env[slave]["timedeltas"].(map[int]int64); ok {
-			maps.Copy(m.env[slave]["timedeltas"].(map[int]int64), timeDeltaMap)
+		if _, ok := env["timedeltas"].(map[int]int64); ok {
+			maps.Copy(env["timedeltas"].(map[int]int64), timeDeltaMap)
 		} else {
-			m.env[slave]["timedeltas"] = timeDeltaMap
+			env["timedeltas"] = timeDeltaMap
 		}
 	}
 
@@ -139,8 +159,13 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 		if mmc.Address < address || mmc.Address+mmc.NumberOfCoilsOrRegisters > address+numberOfCoilsOrRegisters {
 			continue
 		}
-		output, err := runExpr(m.env[slave], &mmc.MappingConfig)
-		if err == nil && output != nil {
+		output, err := runExpr(env, &mmc.MappingConfig)
+		if err != nil {
+			// the other mappings of the message are still mapped
+			m.deadLetters.failed(r, err)
+			continue
+		}
+		if output != nil {
 			u.AddValue(message.NewValue().WithPath(mmc.Path).WithValue(output))
 		}
 	}
@@ -152,8 +177,59 @@ func (m *ModbusMapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 	return result.AddUpdate(u), nil
 }
 
-func (m *ModbusMapper) loadEnvironmentForSlave(slave uint8) {
+func (m *ModbusMapper) loadEnvironmentForSlave(slave uint8) ExpressionEnvironment {
+	m.envMutex.Lock()
+	defer m.envMutex.Unlock()
 	if _, ok := m.env[slave]; !ok {
 		m.env[slave] = NewExpressionEnvironment()
 	}
+	return m.env[slave]
+}
+
+type modbusState struct {
+	Coils      map[int]bool      `json:"coils,omitempty"`
+	Registers  map[int]uint16    `json:"registers,omitempty"`
+	Deltas     map[int]int32     `json:"deltas,omitempty"`
+	Timestamps map[int]time.Time `json:"timestamps,omitempty"`
+	TimeDeltas map[int]int64     `json:"timedeltas,omitempty"`
+}
+
+// Returns the previous coils and registers per slave
+func (m *ModbusMapper) Snapshot() ([]byte, error) {
+	state := make(map[uint8]modbusState, len(m.env))
+	for slave, env := range m.env {
+		s := modbusState{}
+		s.Coils, _ = env["coils"].(map[int]bool)
+		s.Registers, _ = env["registers"].(map[int]uint16)
+		s.Deltas, _ = env["deltas"].(map[int]int32)
+		s.Timestamps, _ = env["timestamps"].(map[int]time.Time)
+		s.TimeDeltas, _ = env["timedeltas"].(map[int]int64)
+		state[slave] = s
+	}
+	return json.Marshal(state)
+}
+
+func (m *ModbusMapper) Restore(b []byte) error {
+	var state map[uint8]modbusState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	for slave, s := range state {
+		m.loadEnvironmentForSlave(slave)
+		if s.Coils != nil {
+			m.env[slave]["coils"] = s.Coils
+		}
+		// the deltas are calculated from the registers and the timestamps, restore them together
+		if s.Registers != nil && s.Timestamps != nil {
+			m.env[slave]["registers"] = s.Registers
+			m.env[slave]["timestamps"] = s.Timestamps
+		}
+		if s.Deltas != nil {
+			m.env[slave]["deltas"] = s.Deltas
+		}
+		if s.TimeDeltas != nil {
+			m.env[slave]["timedeltas"] = s.TimeDeltas
+		}
+	}
+	return nil
 }
@@ -0,0 +1,255 @@
+package mapper
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/munnik/gosk/message"
+)
+
+// mean radius of the earth in m
+const earthRadius = 6371008.8
+
+// Wraps an angle to the range 0 .. 2π
+// angle is in rad
+// return value is in rad
+func NormalizeAngle(angle float64) float64 {
+	result := math.Mod(angle, 2*math.Pi)
+	if result < 0 {
+		result += 2 * math.Pi
+	}
+	return result
+}
+
+// Wraps an angle to the range -π .. π
+// angle is in rad
+// return value is in rad
+func NormalizeRelativeAngle(angle float64) float64 {
+	result := NormalizeAngle(angle)
+	if result > math.Pi {
+		result -= 2 * math.Pi
+	}
+	return result
+}
+
+// Calculates the true wind relative to the water from the apparent wind and the speed through water
+// apparentSpeed and speedThroughWater are in m/s
+// apparentAngle is in rad relative to the bow, positive to starboard
+// return values are the speed in m/s and the angle in rad relative to the bow (-π .. π)
+func TrueWindWater(apparentSpeed float64, apparentAngle float64, speedThroughWater float64) (speed float64, angle float64) {
+	x := apparentSpeed*math.Cos(apparentAngle) - speedThroughWater
+	y := apparentSpeed * math.Sin(apparentAngle)
+	return math.Hypot(x, y), math.Atan2(y, x)
+}
+
+// Calculates the true wind relative to the ground from the apparent wind and the motion over ground
+// apparentSpeed and speedOverGround are in m/s
+// apparentAngle is in rad relative to the bow, positive to starboard
+// courseOverGround and heading are in rad relative to true north
+// return values are the speed in m/s and the angle in rad relative to the bow (-π .. π)
+func TrueWindGround(apparentSpeed float64, apparentAngle float64, speedOverGround float64, courseOverGround float64, heading float64) (speed float64, angle float64) {
+	drift := courseOverGround - heading
+	x := apparentSpeed*math.Cos(apparentAngle) - speedOverGround*math.Cos(drift)
+	y := apparentSpeed*math.Sin(apparentAngle) - speedOverGround*math.Sin(drift)
+	return math.Hypot(x, y), math.Atan2(y, x)
+}
+
+// Calculates the set and drift of the current, leeway is ignored
+// speedOverGround and speedThroughWater are in m/s
+// courseOverGround and heading are in rad relative to true north
+// return values are the set in rad relative to true north (0 .. 2π) and the drift in m/s
+func SetAndDrift(speedOverGround float64, courseOverGround float64, speedThroughWater float64, heading float64) (set float64, drift float64) {
+	north := speedOverGround*math.Cos(courseOverGround) - speedThroughWater*math.Cos(heading)
+	east := speedOverGround*math.Sin(courseOverGround) - speedThroughWater*math.Sin(heading)
+	return NormalizeAngle(math.Atan2(east, north)), math.Hypot(north, east)
+}
+
+// Calculates the component of the speed in the given direction
+// speed is in m/s
+// angle is in rad, the angle between the direction of the speed and the direction of interest
+// return value is in m/s
+func VelocityMadeGood(speed float64, angle float64) float64 {
+	return speed * math.Cos(angle)
+}
+
+// Applies the magnetic variation to a magnetic angle
+// magnetic and variation are in rad, variation is positive to the east
+// return value is in rad relative to true north (0 .. 2π)
+func MagneticToTrue(magnetic float64, variation float64) float64 {
+	return NormalizeAngle(magnetic + variation)
+}
+
+// Removes the magnetic variation from a true angle
+// trueAngle and variation are in rad, variation is positive to the east
+// return value is in rad relative to magnetic north (0 .. 2π)
+func TrueToMagnetic(trueAngle float64, variation float64) float64 {
+	return NormalizeAngle(trueAngle - variation)
+}
+
+// Calculates the great circle distance between two positions using the haversine formula
+// return value is in m
+func HaversineDistance(from message.Position, to message.Position) (float64, error) {
+	fromLatitude, fromLongitude, err := latitudeLongitude(from)
+	if err != nil {
+		return 0, err
+	}
+	toLatitude, toLongitude, err := latitudeLongitude(to)
+	if err != nil {
+		return 0, err
+	}
+	deltaLatitude := toLatitude - fromLatitude
+	deltaLongitude := toLongitude - fromLongitude
+
+	a := math.Sin(deltaLatitude/2)*math.Sin(deltaLatitude/2) + math.Cos(fromLatitude)*math.Cos(toLatitude)*math.Sin(deltaLongitude/2)*math.Sin(deltaLongitude/2)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)), nil
+}
+
+// Calculates the initial bearing of the great circle from one position to another
+// return value is in rad relative to true north (0 .. 2π)
+func InitialBearing(from message.Position, to message.Position) (float64, error) {
+	fromLatitude, fromLongitude, err := latitudeLongitude(from)
+	if err != nil {
+		return 0, err
+	}
+	toLatitude, toLongitude, err := latitudeLongitude(to)
+	if err != nil {
+		return 0, err
+	}
+	deltaLongitude := toLongitude - fromLongitude
+
+	y := math.Sin(deltaLongitude) * math.Cos(toLatitude)
+	x := math.Cos(fromLatitude)*math.Sin(toLatitude) - math.Sin(fromLatitude)*math.Cos(toLatitude)*math.Cos(deltaLongitude)
+	return NormalizeAngle(math.Atan2(y, x)), nil
+}
+
+// Calculates the distance along the rhumb line (line of constant bearing) between two positions
+// return value is in m
+func RhumbLineDistance(from message.Position, to message.Position) (float64, error) {
+	fromLatitude, fromLongitude, err := latitudeLongitude(from)
+	if err != nil {
+		return 0, err
+	}
+	toLatitude, toLongitude, err := latitudeLongitude(to)
+	if err != nil {
+		return 0, err
+	}
+	deltaLatitude := toLatitude - fromLatitude
+	deltaLongitude := NormalizeRelativeAngle(toLongitude - fromLongitude)
+	deltaProjectedLatitude := math.Log(math.Tan(math.Pi/4+toLatitude/2) / math.Tan(math.Pi/4+fromLatitude/2))
+
+	// on an east-west line the projected latitude difference is zero
+	q := math.Cos(fromLatitude)
+	if math.Abs(deltaProjectedLatitude) > 1e-12 {
+		q = deltaLatitude / deltaProjectedLatitude
+	}
+	return math.Sqrt(deltaLatitude*deltaLatitude+q*q*deltaLongitude*deltaLongitude) * earthRadius, nil
+}
+
+// Calculates the constant bearing of the rhumb line from one position to another
+// return value is in rad relative to true north (0 .. 2π)
+func RhumbLineBearing(from message.Position, to message.Position) (float64, error) {
+	fromLatitude, fromLongitude, err := latitudeLongitude(from)
+	if err != nil {
+		return 0, err
+	}
+	toLatitude, toLongitude, err := latitudeLongitude(to)
+	if err != nil {
+		return 0, err
+	}
+	deltaLongitude := NormalizeRelativeAngle(toLongitude - fromLongitude)
+	deltaProjectedLatitude := math.Log(math.Tan(math.Pi/4+toLatitude/2) / math.Tan(math.Pi/4+fromLatitude/2))
+	return NormalizeAngle(math.Atan2(deltaLongitude, deltaProjectedLatitude)), nil
+}
+
+// Calculates the position reached when following the great circle from a position with the initial bearing for the distance
+// bearing is in rad relative to true north
+// distance is in m
+func DestinationPoint(from message.Position, bearing float64, distance float64) (message.Position, error) {
+	fromLatitude, fromLongitude, err := latitudeLongitude(from)
+	if err != nil {
+		return message.Position{}, err
+	}
+	angularDistance := distance / earthRadius
+
+	toLatitude := math.Asin(math.Sin(fromLatitude)*math.Cos(angularDistance) + math.Cos(fromLatitude)*math.Sin(angularDistance)*math.Cos(bearing))
+	toLongitude := fromLongitude + math.Atan2(math.Sin(bearing)*math.Sin(angularDistance)*math.Cos(fromLatitude), math.Cos(angularDistance)-math.Sin(fromLatitude)*math.Sin(toLatitude))
+
+	latitude := RadiansToDegrees(toLatitude)
+	longitude := RadiansToDegrees(NormalizeRelativeAngle(toLongitude))
+	return message.Position{Latitude: &latitude, Longitude: &longitude}, nil
+}
+
+// Checks if the position is inside the polygon, the edges of the polygon are straight lines in latitude and longitude
+// polygon is a list of corners, each corner is a list with a latitude and a longitude in degrees
+func PointInPolygon(position message.Position, polygon []interface{}) (bool, error) {
+	if position.Latitude == nil || position.Longitude == nil {
+		return false, fmt.Errorf("the position %v should have a latitude and a longitude", position)
+	}
+	if len(polygon) < 3 {
+		return false, fmt.Errorf("the polygon should have at least 3 corners, it has %d", len(polygon))
+	}
+
+	latitudes := make([]float64, len(polygon))
+	longitudes := make([]float64, len(polygon))
+	for i, corner := range polygon {
+		c, ok := corner.([]interface{})
+		if !ok || len(c) != 2 {
+			return false, fmt.Errorf("corner %d of the polygon should be a list with a latitude and a longitude", i)
+		}
+		floats, err := ListToFloats(c)
+		if err != nil {
+			return false, err
+		}
+		latitudes[i], longitudes[i] = floats[0], floats[1]
+	}
+
+	// count the number of edges crossed by a ray going east from the position
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		if (latitudes[i] > *position.Latitude) != (latitudes[j] > *position.Latitude) &&
+			*position.Longitude < (longitudes[j]-longitudes[i])*(*position.Latitude-latitudes[i])/(latitudes[j]-latitudes[i])+longitudes[i] {
+			inside = !inside
+		}
+	}
+	return inside, nil
+}
+
+// Calculates the closest point of approach between the own vessel and a target, both are assumed to keep their course and speed
+// courses are in rad relative to true north
+// speeds are in m/s
+// return values are the distance at the closest point of approach in m and the time until that moment in s, the time is 0 when the vessels are moving apart
+func ClosestApproach(own message.Position, ownCourse float64, ownSpeed float64, target message.Position, targetCourse float64, targetSpeed float64) (distance float64, timeTo float64, err error) {
+	ownLatitude, ownLongitude, err := latitudeLongitude(own)
+	if err != nil {
+		return 0, 0, err
+	}
+	targetLatitude, targetLongitude, err := latitudeLongitude(target)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// use a local flat projection around the own position, this is accurate enough for the ranges used in collision avoidance
+	north := (targetLatitude - ownLatitude) * earthRadius
+	east := NormalizeRelativeAngle(targetLongitude-ownLongitude) * earthRadius * math.Cos(ownLatitude)
+
+	velocityNorth := targetSpeed*math.Cos(targetCourse) - ownSpeed*math.Cos(ownCourse)
+	velocityEast := targetSpeed*math.Sin(targetCourse) - ownSpeed*math.Sin(ownCourse)
+
+	relativeSpeedSquared := velocityNorth*velocityNorth + velocityEast*velocityEast
+	if relativeSpeedSquared > 0 {
+		timeTo = -(north*velocityNorth + east*velocityEast) / relativeSpeedSquared
+	}
+	if timeTo < 0 {
+		timeTo = 0
+	}
+
+	return math.Hypot(north+velocityNorth*timeTo, east+velocityEast*timeTo), timeTo, nil
+}
+
+// returns the latitude and longitude of the position in rad
+func latitudeLongitude(p message.Position) (float64, float64, error) {
+	if p.Latitude == nil || p.Longitude == nil {
+		return 0, 0, fmt.Errorf("the position %v should have a latitude and a longitude", p)
+	}
+	return DegreesToRadians(*p.Latitude), DegreesToRadians(*p.Longitude), nil
+}
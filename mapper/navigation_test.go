@@ -0,0 +1,244 @@
+package mapper_test
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+)
+
+const tolerance = 1e-6
+
+func knots(speed float64) float64 {
+	return speed * 1852 / 3600
+}
+
+func TestNormalizeAngle(t *testing.T) {
+	for input, expected := range map[float64]float64{
+		0:               0,
+		-math.Pi / 2:    3 * math.Pi / 2,
+		5 * math.Pi / 2: math.Pi / 2,
+	} {
+		if result := NormalizeAngle(input); math.Abs(result-expected) > tolerance {
+			t.Logf("Expected %f but got %f for input %f", expected, result, input)
+			t.Fail()
+		}
+	}
+}
+
+func TestNormalizeRelativeAngle(t *testing.T) {
+	for input, expected := range map[float64]float64{
+		0:                0,
+		3 * math.Pi / 2:  -math.Pi / 2,
+		-5 * math.Pi / 2: -math.Pi / 2,
+	} {
+		if result := NormalizeRelativeAngle(input); math.Abs(result-expected) > tolerance {
+			t.Logf("Expected %f but got %f for input %f", expected, result, input)
+			t.Fail()
+		}
+	}
+}
+
+func TestTrueWindWaterHeadWind(t *testing.T) {
+	// 15 knots of apparent wind on the nose while doing 5 knots means 10 knots of true wind on the nose
+	speed, angle := TrueWindWater(knots(15), 0, knots(5))
+	if math.Abs(speed-knots(10)) > tolerance {
+		t.Logf("Expected %f but got %f", knots(10), speed)
+		t.Fail()
+	}
+	if math.Abs(angle) > tolerance {
+		t.Logf("Expected %f but got %f", 0.0, angle)
+		t.Fail()
+	}
+}
+
+func TestTrueWindWaterBeamReach(t *testing.T) {
+	// true wind of 6 knots from starboard beam at a speed of 8 knots gives 10 knots of apparent wind
+	apparentAngle := math.Atan2(6, 8)
+	speed, angle := TrueWindWater(knots(10), apparentAngle, knots(8))
+	if math.Abs(speed-knots(6)) > tolerance {
+		t.Logf("Expected %f but got %f", knots(6), speed)
+		t.Fail()
+	}
+	if math.Abs(angle-math.Pi/2) > tolerance {
+		t.Logf("Expected %f but got %f", math.Pi/2, angle)
+		t.Fail()
+	}
+}
+
+func TestTrueWindGroundWithoutDrift(t *testing.T) {
+	// without current and leeway the ground wind equals the water wind
+	waterSpeed, waterAngle := TrueWindWater(knots(12), DegreesToRadians(40), knots(6))
+	groundSpeed, groundAngle := TrueWindGround(knots(12), DegreesToRadians(40), knots(6), DegreesToRadians(90), DegreesToRadians(90))
+	if math.Abs(waterSpeed-groundSpeed) > tolerance || math.Abs(waterAngle-groundAngle) > tolerance {
+		t.Logf("Expected %f, %f but got %f, %f", waterSpeed, waterAngle, groundSpeed, groundAngle)
+		t.Fail()
+	}
+}
+
+func TestSetAndDrift(t *testing.T) {
+	// heading north at 5 knots through the water while moving north east over ground
+	set, drift := SetAndDrift(knots(5)*math.Sqrt2, DegreesToRadians(45), knots(5), 0)
+	if math.Abs(set-math.Pi/2) > tolerance {
+		t.Logf("Expected %f but got %f", math.Pi/2, set)
+		t.Fail()
+	}
+	if math.Abs(drift-knots(5)) > tolerance {
+		t.Logf("Expected %f but got %f", knots(5), drift)
+		t.Fail()
+	}
+}
+
+func TestVelocityMadeGood(t *testing.T) {
+	if result := VelocityMadeGood(knots(6), DegreesToRadians(60)); math.Abs(result-knots(3)) > tolerance {
+		t.Logf("Expected %f but got %f", knots(3), result)
+		t.Fail()
+	}
+}
+
+func TestMagneticToTrue(t *testing.T) {
+	if result := MagneticToTrue(DegreesToRadians(355), DegreesToRadians(10)); math.Abs(result-DegreesToRadians(5)) > tolerance {
+		t.Logf("Expected %f but got %f", DegreesToRadians(5), result)
+		t.Fail()
+	}
+	if result := TrueToMagnetic(DegreesToRadians(5), DegreesToRadians(10)); math.Abs(result-DegreesToRadians(355)) > tolerance {
+		t.Logf("Expected %f but got %f", DegreesToRadians(355), result)
+		t.Fail()
+	}
+}
+
+func position(latitude float64, longitude float64) message.Position {
+	return message.Position{Latitude: &latitude, Longitude: &longitude}
+}
+
+func TestHaversineDistance(t *testing.T) {
+	// one minute of latitude is about one nautical mile
+	result, err := HaversineDistance(position(52, 4), position(52+1.0/60, 4))
+	if err != nil || math.Abs(result-1853.2) > 1 {
+		t.Logf("Expected %f but got %f, %v", 1853.2, result, err)
+		t.Fail()
+	}
+}
+
+func TestHaversineDistanceMissingLatitude(t *testing.T) {
+	longitude := 4.0
+	if _, err := HaversineDistance(message.Position{Longitude: &longitude}, position(52, 4)); err == nil {
+		t.Log("Expected an error for a position without latitude")
+		t.Fail()
+	}
+}
+
+func TestInitialBearing(t *testing.T) {
+	for _, test := range []struct {
+		toLatitude, toLongitude, expected float64
+	}{
+		{1, 0, 0},
+		{0, 1, math.Pi / 2},
+		{-1, 0, math.Pi},
+		{0, -1, 3 * math.Pi / 2},
+	} {
+		result, err := InitialBearing(position(0, 0), position(test.toLatitude, test.toLongitude))
+		if err != nil || math.Abs(result-test.expected) > tolerance {
+			t.Logf("Expected %f but got %f, %v", test.expected, result, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestRhumbLine(t *testing.T) {
+	// along a meridian the rhumb line and the great circle are the same
+	rhumbLine, err := RhumbLineDistance(position(52, 4), position(53, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	greatCircle, _ := HaversineDistance(position(52, 4), position(53, 4))
+	if math.Abs(rhumbLine-greatCircle) > 1 {
+		t.Logf("Expected %f but got %f", greatCircle, rhumbLine)
+		t.Fail()
+	}
+	bearing, err := RhumbLineBearing(position(52, 4), position(52, 5))
+	if err != nil || math.Abs(bearing-math.Pi/2) > tolerance {
+		t.Logf("Expected %f but got %f, %v", math.Pi/2, bearing, err)
+		t.Fail()
+	}
+}
+
+func TestDestinationPoint(t *testing.T) {
+	// one nautical mile to the east and back again
+	from := position(52, 4)
+	to, err := DestinationPoint(from, math.Pi/2, 1852)
+	if err != nil {
+		t.Fatal(err)
+	}
+	distance, _ := HaversineDistance(from, to)
+	if math.Abs(distance-1852) > 1 {
+		t.Logf("Expected %f but got %f", 1852.0, distance)
+		t.Fail()
+	}
+	back, _ := InitialBearing(to, from)
+	if math.Abs(NormalizeRelativeAngle(back-3*math.Pi/2)) > 1e-3 {
+		t.Logf("Expected %f but got %f", 3*math.Pi/2, back)
+		t.Fail()
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	polygon := []interface{}{
+		[]interface{}{52.0, 4.0},
+		[]interface{}{52.0, 5.0},
+		[]interface{}{53.0, 5.0},
+		[]interface{}{53.0, 4.0},
+	}
+	for _, test := range []struct {
+		latitude, longitude float64
+		expected            bool
+	}{
+		{52.5, 4.5, true},
+		{51.5, 4.5, false},
+		{52.5, 5.5, false},
+	} {
+		result, err := PointInPolygon(position(test.latitude, test.longitude), polygon)
+		if err != nil || result != test.expected {
+			t.Logf("Expected %t but got %t, %v for %f, %f", test.expected, result, err, test.latitude, test.longitude)
+			t.Fail()
+		}
+	}
+	if _, err := PointInPolygon(position(52.5, 4.5), []interface{}{"not a corner"}); err == nil {
+		t.Log("Expected an error for an invalid polygon")
+		t.Fail()
+	}
+}
+
+func TestClosestApproachCollisionCourse(t *testing.T) {
+	// target one nautical mile north heading south, own vessel heading north, both 5 knots
+	distance, timeTo, err := ClosestApproach(position(0, 0), 0, knots(5), position(1.0/60, 0), math.Pi, knots(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if distance > 1 {
+		t.Logf("Expected %f but got %f", 0.0, distance)
+		t.Fail()
+	}
+	if math.Abs(timeTo-360) > 1 {
+		t.Logf("Expected %f but got %f", 360.0, timeTo)
+		t.Fail()
+	}
+}
+
+func TestClosestApproachMovingApart(t *testing.T) {
+	// target north of the own vessel and moving away faster
+	distance, timeTo, err := ClosestApproach(position(0, 0), 0, knots(5), position(1.0/60, 0), 0, knots(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeTo != 0 {
+		t.Logf("Expected %f but got %f", 0.0, timeTo)
+		t.Fail()
+	}
+	expected, _ := HaversineDistance(position(0, 0), position(1.0/60, 0))
+	if math.Abs(distance-expected) > 1 {
+		t.Logf("Expected %f but got %f", expected, distance)
+		t.Fail()
+	}
+}
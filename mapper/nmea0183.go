@@ -1,7 +1,9 @@
 package mapper
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 
@@ -12,10 +14,47 @@ import (
 	"github.com/munnik/gosk/nanomsg"
 )
 
+// paths the mapper maps the sentences to, the vessel information without a path is not included
+var nmea0183Paths = []string{
+	"design.aisShipType",
+	"environment.depth.belowSurface",
+	"environment.depth.belowTransducer",
+	"navigation.gnss.methodQuality",
+	"navigation.gnss.type",
+	"navigation.rateOfTurn",
+	"navigation.courseOverGroundTrue",
+	"navigation.headingTrue",
+	"navigation.headingMagnetic",
+	"navigation.state",
+	"navigation.gnss.satellites",
+	"navigation.position",
+	"navigation.speedOverGround",
+	"navigation.speedThroughWater",
+	"communication.callsignVhf",
+	"registrations.imo",
+	"registrations.other.eni.registration",
+	"design.length",
+	"design.beam",
+	"environment.wind.angleApparent",
+	"environment.wind.directionTrue",
+	"environment.wind.directionMagnetic",
+	"environment.outside.temperature",
+	"environment.outside.dewPointTemperature",
+	"environment.outside.humidity",
+	"environment.water.temperature",
+	"environment.heave",
+	"navigation.datetime",
+	"steering.rudderAngle",
+	"environment.wind.speedOverGround",
+	"environment.wind.speedApparent",
+	"notifications.ais",
+}
+
 type Nmea0183Mapper struct {
 	config   config.MapperConfig
 	protocol string
 	parser   nmea.SentenceParser
+	deadLetterSink
 }
 
 type customCheckCRC struct {
@@ -57,8 +96,13 @@ func NewNmea0183Mapper(c config.MapperConfig) (*Nmea0183Mapper, error) {
 	return &Nmea0183Mapper{config: c, protocol: config.NMEA0183Type, parser: nmea.SentenceParser{CheckCRC: ccc.CheckCRC}}, nil
 }
 
-func (m *Nmea0183Mapper) Map(subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, m, false)
+func (m *Nmea0183Mapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw], publisher *nanomsg.Publisher[message.Mapped]) {
+	processInParallel(ctx, subscriber, publisher, m, m.deadLetters, false, m.config.NumberOfWorkers)
+}
+
+// The paths the mapper maps the sentences to
+func (m *Nmea0183Mapper) Paths() []string {
+	return slices.Clone(nmea0183Paths)
 }
 
 func (m *Nmea0183Mapper) DoMap(r *message.Raw) (*message.Mapped, error) {
@@ -210,7 +254,14 @@ func (m *Nmea0183Mapper) DoMap(r *message.Raw) (*message.Mapped, error) {
 	}
 	if v, ok := sentence.(signalk.WindSpeed); ok {
 		if windSpeed, err := v.GetWindSpeed(); err == nil {
-			u.AddValue(message.NewValue().WithPath("environment.wind.speedOverGround").WithValue(windSpeed))
+			path := "environment.wind.speedOverGround"
+			// the speed belongs to the relative wind direction when the sentence contains one
+			if r, ok := sentence.(signalk.RelativeWindDirection); ok {
+				if _, err := r.GetRelativeWindDirection(); err == nil {
+					path = "environment.wind.speedApparent"
+				}
+			}
+			u.AddValue(message.NewValue().WithPath(path).WithValue(windSpeed))
 		}
 	}
 	if v, ok := sentence.(signalk.OutsideTemperature); ok {
@@ -98,4 +98,22 @@ var _ = Describe("DoMap nmea0183", func() {
 			false,
 		),
 	)
+	It("reports the paths it maps to", func() {
+		Expect(mapper.Paths()).To(ContainElements("navigation.position", "environment.wind.speedApparent", "notifications.ais"))
+		Expect(mapper.Paths()).NotTo(ContainElement(""))
+	})
+	It("maps the wind speed of a relative wind direction to the apparent wind speed", func() {
+		paths := func(sentence string) map[string]any {
+			m := message.NewRaw().WithConnector("testingConnector").WithType(config.NMEA0183Type).WithValue([]byte(sentence))
+			result, err := mapper.DoMap(m)
+			Expect(err).ToNot(HaveOccurred())
+			values := make(map[string]any)
+			for _, svm := range result.ToSingleValueMapped() {
+				values[svm.Path] = svm.Value
+			}
+			return values
+		}
+		Expect(paths("$IIMWV,045.0,R,10.5,M,A*0B")).To(HaveKey("environment.wind.speedApparent"))
+		Expect(paths("$IIMWV,045.0,T,10.5,M,A*0D")).To(HaveKey("environment.wind.speedOverGround"))
+	})
 })
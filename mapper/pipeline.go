@@ -0,0 +1,190 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/database"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	pipelineReceivedCounter  = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_pipeline_stage_received_total", Help: "total number of messages received by the stage"}, []string{"stage"})
+	pipelineForwardedCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_pipeline_stage_forwarded_total", Help: "total number of messages forwarded by the stage"}, []string{"stage"})
+	pipelineDroppedCounter   = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_pipeline_stage_dropped_total", Help: "total number of messages without updates after the stage"}, []string{"stage"})
+	pipelineErrorsCounter    = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_pipeline_stage_errors_total", Help: "total number of messages the stage could not map"}, []string{"stage"})
+	pipelineDuration         = promauto.NewHistogramVec(prometheus.HistogramOpts{Name: "gosk_pipeline_stage_duration_seconds", Help: "time spent mapping a message in the stage"}, []string{"stage"})
+)
+
+type PipelineStage struct {
+	Name    string
+	Mapper  RealMapper[message.Mapped]
+	flusher FlushingMapper // sends the messages the mapper held back, the mapper is guarded when it is set
+}
+
+// Creates the mapper of the stage the same way as when the stage runs as a separate process
+func NewPipelineStage(c *config.PipelineStageConfig) (PipelineStage, error) {
+	var m RealMapper[message.Mapped]
+	var flusher FlushingMapper
+	switch c.Type {
+	case config.PipelineStageFilter:
+		f, err := NewExpressionFilter(config.NewExpressionMappingConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = f.WithReloadConfig(config.NewReloadConfig(c.ConfigFile)).runnable()
+	case config.PipelineStageRateLimit:
+		r, err := NewRateLimitFilter(config.NewRateLimitConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = guard(r.runnable())
+		flusher = r
+	case config.PipelineStagePriority:
+		p, err := NewSourcePriorityFilter(config.NewSourcePrioritiesConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = p.runnable()
+	case config.SignalKType:
+		a, err := NewAggregateMapper(config.NewMapperConfig(c.ConfigFile), config.NewExpressionMappingConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = a.runnable()
+	case config.FftType:
+		f, err := NewFftMapper(config.NewMapperConfig(c.ConfigFile), config.NewFftConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = f.runnable()
+	case config.DerivedType:
+		d, err := NewDerivedMapper(config.NewMapperConfig(c.ConfigFile), config.NewDerivedConfig(c.ConfigFile))
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = d
+	case config.AlarmType:
+		ac := config.NewAlarmsConfig(c.ConfigFile)
+		var history AlarmHistory
+		if ac.PostgresqlConfig.URLString != "" {
+			history = database.NewPostgresqlDatabase(ac.PostgresqlConfig)
+		}
+		a, err := NewAlarmMapper(config.NewMapperConfig(c.ConfigFile), ac, history)
+		if err != nil {
+			return PipelineStage{}, err
+		}
+		m = a.runnable()
+	default:
+		return PipelineStage{}, fmt.Errorf("stage %s has an unsupported type %s", c.Name, c.Type)
+	}
+	return PipelineStage{Name: c.Name, Mapper: m, flusher: flusher}, nil
+}
+
+// Chains mappers of signalk data in one process, only the result of the last stage is published
+type Pipeline struct {
+	stages []PipelineStage
+	deadLetterSink
+}
+
+func NewPipeline(stages ...PipelineStage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+func NewPipelineFromConfig(c *config.PipelineConfig) (*Pipeline, error) {
+	stages := make([]PipelineStage, 0, len(c.Stages))
+	for _, sc := range c.Stages {
+		s, err := NewPipelineStage(sc)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, s)
+	}
+	return NewPipeline(stages...), nil
+}
+
+// Each stage runs in its own go routine, the stages are connected with channels
+func (p *Pipeline) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	receiveBuffer := make(chan *message.Mapped, bufferSize)
+	sendBuffer := make(chan *message.Mapped, bufferSize)
+	mappers := make([]any, 0, len(p.stages))
+	for _, s := range p.stages {
+		mappers = append(mappers, s.Mapper)
+	}
+	defer stopPublishing(sendBuffer, publisher, mappers...)
+
+	go subscriber.Receive(ctx, receiveBuffer)
+	go publisher.Send(sendBuffer)
+
+	var in <-chan *message.Mapped = receiveBuffer
+	for _, s := range p.stages {
+		out := make(chan *message.Mapped, bufferSize)
+		go s.run(in, out)
+		in = out
+	}
+	for m := range in {
+		sendBuffer <- m
+	}
+}
+
+// Runs the stages one after another, a message without updates is not passed to the next stage
+func (p *Pipeline) DoMap(input *message.Mapped) (*message.Mapped, error) {
+	result := input
+	for _, s := range p.stages {
+		var ok bool
+		var err error
+		if result, ok, err = s.doMap(result); err != nil || !ok {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (s PipelineStage) run(in <-chan *message.Mapped, out chan<- *message.Mapped) {
+	defer close(out)
+	if s.flusher != nil {
+		// the held back messages are flushed before the next stage stops
+		// the pipeline has no dead letter stream
+		defer startFlushing(guard(s.Mapper), s.flusher, out, nil)()
+	}
+	for m := range in {
+		result, ok, err := s.doMap(m)
+		if err != nil {
+			logger.GetLogger().Warn(
+				"Could not map the received data",
+				zap.String("Stage", s.Name),
+				zap.Any("Input", m),
+				zap.String("Error", err.Error()),
+			)
+			continue
+		}
+		if ok {
+			out <- result
+		}
+	}
+}
+
+// maps the message and updates the metrics of the stage, ok is false when the result has no updates
+func (s PipelineStage) doMap(in *message.Mapped) (*message.Mapped, bool, error) {
+	pipelineReceivedCounter.WithLabelValues(s.Name).Inc()
+	start := time.Now()
+	result, err := s.Mapper.DoMap(in)
+	pipelineDuration.WithLabelValues(s.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		pipelineErrorsCounter.WithLabelValues(s.Name).Inc()
+		return nil, false, err
+	}
+	if len(result.Updates) == 0 {
+		pipelineDroppedCounter.WithLabelValues(s.Name).Inc()
+		return result, false, nil
+	}
+	pipelineForwardedCounter.WithLabelValues(s.Name).Inc()
+	return result, true, nil
+}
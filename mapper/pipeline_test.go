@@ -0,0 +1,56 @@
+package mapper_test
+
+import (
+	"time"
+
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoMap pipeline", func() {
+	now := time.Now()
+	newPipeline := func() *Pipeline {
+		f, _ := NewExpressionFilter([]*config.ExpressionMappingConfig{{
+			MappingConfig: config.MappingConfig{Expression: "testingPath.Value > 5.0"},
+			SourcePaths:   []string{"testingPath"},
+		}})
+		r, _ := NewRateLimitFilter(&config.RateLimitFilterConfig{DefaultInterval: time.Minute})
+		a, _ := NewAggregateMapper(config.MapperConfig{Context: "testingContext"}, []*config.ExpressionMappingConfig{{
+			MappingConfig: config.MappingConfig{Expression: "testingPath.Value * 2", Path: "testingDoublePath"},
+			SourcePaths:   []string{"testingPath"},
+		}})
+		return NewPipeline(
+			PipelineStage{Name: "filter", Mapper: f},
+			PipelineStage{Name: "rateLimit", Mapper: r},
+			PipelineStage{Name: "aggregate", Mapper: a},
+		)
+	}
+
+	It("passes the message through all stages", func() {
+		result, err := newPipeline().DoMap(mappedWithPath("testingPath", now, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(HaveLen(2))
+		Expect(result.Updates[1].Values[0].Path).To(Equal("testingDoublePath"))
+		Expect(result.Updates[1].Values[0].Value).To(Equal(4.0))
+	})
+	It("stops when a stage removes all updates", func() {
+		p := newPipeline()
+		result, err := p.DoMap(mappedWithPath("testingPath", now, 6.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+
+		p.DoMap(mappedWithPath("testingPath", now, 2.0))
+		p.DoMap(mappedWithPath("testingPath", now, 2.0))
+		result, err = p.DoMap(mappedWithPath("testingPath", now.Add(time.Second), 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+	})
+	It("creates the stages from the config", func() {
+		_, err := NewPipelineStage(&config.PipelineStageConfig{Name: "filter", Type: config.PipelineStageFilter, ConfigFile: "expression_filter_test.yaml"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewPipelineStage(&config.PipelineStageConfig{Name: "unknown", Type: config.ModbusType, ConfigFile: "expression_filter_test.yaml"})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,122 @@
+package mapper
+
+import (
+	"math"
+	"time"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var lateAggregateCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_mapper_ratelimit_late_values_total", Help: "total number of values dropped because the aggregate of their interval was already sent"}, []string{"path"})
+
+// the values of a path per context and connector within one interval
+type aggregateBucket struct {
+	Start    time.Time                 `json:"start"`
+	Count    int                       `json:"count"`
+	Numeric  int                       `json:"numeric"` // number of values that are numbers, only those are used for the mean, min and max
+	Sum      float64                   `json:"sum"`
+	Min      float64                   `json:"min"`
+	Max      float64                   `json:"max"`
+	Last     message.SingleValueMapped `json:"last"`
+	Received time.Time                 `json:"-"`       // when the last value arrived
+	Flushed  bool                      `json:"flushed"` // the aggregate is sent before the next interval started, later values of the interval are dropped
+}
+
+type buckets map[string]*aggregateBucket
+
+// Adds the value that arrived at received to the bucket of its interval, the aggregate of the previous interval is returned
+// when the value starts a new interval
+func (b buckets) Update(key string, svm *message.SingleValueMapped, limit config.RateLimitsConfig, received time.Time) []*message.SingleValueMapped {
+	start := svm.Timestamp.Truncate(limit.Interval)
+	var result []*message.SingleValueMapped
+	bucket, ok := b[key]
+	if ok && (start.Before(bucket.Start) || bucket.Flushed && start.Equal(bucket.Start)) {
+		// the aggregate of this interval is already sent
+		lateAggregateCounter.WithLabelValues(svm.Path).Inc()
+		return nil
+	}
+	if ok && start.After(bucket.Start) {
+		if !bucket.Flushed {
+			result = bucket.aggregate(limit)
+		}
+		ok = false
+	}
+	if !ok {
+		bucket = &aggregateBucket{Start: start}
+		b[key] = bucket
+	}
+	bucket.add(svm)
+	bucket.Received = received
+	return result
+}
+
+// Returns the aggregates of the buckets of which the grace period after the interval ended, or of all buckets when all is
+// true. The intervals end on the time of the newest value so lagging or replayed values are aggregated as well, the interval
+// of a sensor that stopped sending ends when no value arrived before now for an interval and the grace period. The last value
+// is returned for a path that is no longer aggregated.
+func (b buckets) Flush(now time.Time, all bool, limits map[string]config.RateLimitsConfig) []*message.SingleValueMapped {
+	var newest time.Time
+	for _, bucket := range b {
+		if bucket.Last.Timestamp.After(newest) {
+			newest = bucket.Last.Timestamp
+		}
+	}
+	result := make([]*message.SingleValueMapped, 0)
+	for _, bucket := range b {
+		if bucket.Flushed {
+			continue
+		}
+		limit, ok := limits[bucket.Last.Path]
+		aggregated := ok && limit.Aggregate != ""
+		ended := !newest.Before(bucket.Start.Add(limit.Interval+limit.Grace)) || !now.Before(bucket.Received.Add(limit.Interval+limit.Grace))
+		if aggregated && !all && !ended {
+			continue
+		}
+		bucket.Flushed = true
+		result = append(result, bucket.aggregate(limit)...)
+	}
+	return result
+}
+
+func (b *aggregateBucket) add(svm *message.SingleValueMapped) {
+	b.Count++
+	b.Last = *svm
+	value, ok := toFloat(svm.Value)
+	if !ok {
+		return
+	}
+	if b.Numeric == 0 {
+		b.Min, b.Max = value, value
+	}
+	b.Numeric++
+	b.Sum += value
+	b.Min = math.Min(b.Min, value)
+	b.Max = math.Max(b.Max, value)
+}
+
+// the aggregate is timestamped at the start of the interval, the last value is used when none of the values are numbers
+func (b *aggregateBucket) aggregate(limit config.RateLimitsConfig) []*message.SingleValueMapped {
+	value := b.Last
+	value.Timestamp = b.Start
+	if b.Numeric > 0 {
+		switch limit.Aggregate {
+		case config.RateLimitAggregateMean:
+			value.Value = b.Sum / float64(b.Numeric)
+		case config.RateLimitAggregateMin:
+			value.Value = b.Min
+		case config.RateLimitAggregateMax:
+			value.Value = b.Max
+		}
+	}
+	result := []*message.SingleValueMapped{&value}
+	if limit.CountPath != "" {
+		count := value
+		count.Path = limit.CountPath
+		count.Value = b.Count
+		result = append(result, &count)
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package mapper
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
+)
+
+// the last sent value of a path per context and connector
+type changeState struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Numeric   bool      `json:"numeric"`
+	// the swinging door is not persisted, it opens again at the last sent value after a restart
+	upper, lower float64
+	held         *message.SingleValueMapped // the last received value is held until the door closes
+	heldValue    float64
+}
+
+type changes map[string]*changeState
+
+func changeKey(context, path, connector string) string {
+	return strings.Join([]string{context, path, connector}, "|")
+}
+
+// Returns the values to send, the held value is returned instead of the received value when swinging door compression finds a turning point
+func (c changes) Update(key string, svm *message.SingleValueMapped, limit config.RateLimitsConfig) []*message.SingleValueMapped {
+	value, numeric := toFloat(svm.Value)
+	state, ok := c[key]
+	if !ok {
+		c[key] = newChangeState(svm.Timestamp, value, numeric)
+		return []*message.SingleValueMapped{svm}
+	}
+	elapsed := svm.Timestamp.Sub(state.Timestamp)
+	if limit.Heartbeat > 0 && elapsed >= limit.Heartbeat || numeric != state.Numeric {
+		c[key] = newChangeState(svm.Timestamp, value, numeric)
+		return []*message.SingleValueMapped{svm}
+	}
+	if !numeric {
+		if elapsed < limit.Interval {
+			return nil
+		}
+		c[key] = newChangeState(svm.Timestamp, value, numeric)
+		return []*message.SingleValueMapped{svm}
+	}
+	if limit.Angle {
+		// unwrap the angle so it is close to the last sent value
+		value = state.Value + angleDifference(state.Value, value)
+	}
+	if limit.SwingingDoor {
+		return state.swingingDoor(c, key, svm, value, limit.Deadband)
+	}
+	if elapsed < limit.Interval {
+		return nil
+	}
+	change := math.Abs(value - state.Value)
+	if change <= limit.Deadband || change <= limit.RelativeDeadband*math.Abs(state.Value) {
+		return nil
+	}
+	c[key] = newChangeState(svm.Timestamp, value, numeric)
+	return []*message.SingleValueMapped{svm}
+}
+
+func newChangeState(timestamp time.Time, value float64, numeric bool) *changeState {
+	return &changeState{Timestamp: timestamp, Value: value, Numeric: numeric}
+}
+
+// narrows the door with each value, when the door closes the held value is a turning point and is sent
+func (s *changeState) swingingDoor(c changes, key string, svm *message.SingleValueMapped, value float64, deviation float64) []*message.SingleValueMapped {
+	elapsed := svm.Timestamp.Sub(s.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+	if s.held == nil {
+		s.upper, s.lower = math.Inf(1), math.Inf(-1)
+	}
+	upper := math.Min(s.upper, (value+deviation-s.Value)/elapsed)
+	lower := math.Max(s.lower, (value-deviation-s.Value)/elapsed)
+	if lower <= upper {
+		s.upper, s.lower, s.held, s.heldValue = upper, lower, svm, value
+		return nil
+	}
+
+	sent := s.held
+	next := newChangeState(sent.Timestamp, s.heldValue, true)
+	c[key] = next
+	next.swingingDoor(c, key, svm, value, deviation)
+	return []*message.SingleValueMapped{sent}
+}
+
+// the smallest angle from a to b in radians, between -π and π
+func angleDifference(a float64, b float64) float64 {
+	d := math.Mod(b-a+math.Pi, 2*math.Pi)
+	if d < 0 {
+		d += 2 * math.Pi
+	}
+	return d - math.Pi
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -1,6 +1,9 @@
 package mapper
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/munnik/gosk/config"
@@ -52,18 +55,65 @@ type RateLimitFilter struct {
 	config    *config.RateLimitFilterConfig
 	lastSeen  lastSeen
 	rateLimit rateLimit
+	changes   changes
+	buckets   buckets
+	limits    map[string]config.RateLimitsConfig
+	deadLetterSink
 }
 
 func NewRateLimitFilter(c *config.RateLimitFilterConfig) (*RateLimitFilter, error) {
+	return &RateLimitFilter{config: c, lastSeen: make(lastSeen, 0), rateLimit: newRateLimit(c), changes: make(changes), buckets: make(buckets), limits: newLimits(c)}, nil
+}
+
+func newRateLimit(c *config.RateLimitFilterConfig) rateLimit {
 	rateLimit := make(rateLimit)
 	for _, mapping := range c.Ratelimits {
 		rateLimit[mapping.Path] = mapping.Interval
 	}
-	return &RateLimitFilter{config: c, lastSeen: make(lastSeen, 0), rateLimit: rateLimit}, nil
+	return rateLimit
+}
+
+// the paths that are filtered on change or aggregated instead of only on time
+func newLimits(c *config.RateLimitFilterConfig) map[string]config.RateLimitsConfig {
+	limits := make(map[string]config.RateLimitsConfig)
+	for _, mapping := range c.Ratelimits {
+		if mapping.OnChange() || mapping.Aggregate != "" {
+			limits[mapping.Path] = mapping
+		}
+	}
+	return limits
+}
+
+func (r *RateLimitFilter) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	processFlushing(ctx, subscriber, publisher, r.runnable(), r, r.deadLetters, true, 1)
 }
 
-func (r *RateLimitFilter) Map(subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
-	process(subscriber, publisher, r, true)
+// persists the state and reloads the configuration of the filter
+func (r *RateLimitFilter) runnable() RealMapper[message.Mapped] {
+	mapper := withPersistentState[message.Mapped](r, r.config.StateConfig, "ratelimit", r.config.ConfigFile)
+	return withReload(mapper, r, r.config.ReloadConfig)
+}
+
+// Replaces the rate limits, the last seen times are kept
+func (r *RateLimitFilter) Reload(configFilePath string) error {
+	c, err := config.LoadRateLimitConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(r.config.Ratelimits, c.Ratelimits, func(c config.RateLimitsConfig) string {
+		return fmt.Sprintf("%+v", c)
+	})
+	if c.DefaultInterval != r.config.DefaultInterval {
+		logger.GetLogger().Info(
+			"Default interval changed",
+			zap.Duration("From", r.config.DefaultInterval),
+			zap.Duration("To", c.DefaultInterval),
+		)
+	}
+	r.config = c
+	r.rateLimit = newRateLimit(c)
+	r.limits = newLimits(c)
+	return nil
 }
 
 func (r *RateLimitFilter) DoMap(m *message.Mapped) (*message.Mapped, error) {
@@ -88,6 +138,22 @@ func (r *RateLimitFilter) DoMap(m *message.Mapped) (*message.Mapped, error) {
 			}
 		}
 
+		if limit, ok := r.limits[path]; ok {
+			key := changeKey(m.Context, path, svm.Source.Label)
+			var sent []*message.SingleValueMapped
+			if limit.Aggregate != "" {
+				sent = r.buckets.Update(key, &svm, limit, time.Now())
+			} else {
+				sent = r.changes.Update(key, &svm, limit)
+			}
+			for _, send := range sent {
+				for _, u := range send.ToMapped().Updates {
+					result.AddUpdate(&u)
+				}
+			}
+			continue
+		}
+
 		interval := r.rateLimit.GetRateLimit(path, r.config.DefaultInterval)
 		if r.lastSeen.Update(m.Context, path, svm.Source.Label, svm.Timestamp, interval) {
 			for _, u := range svm.ToMapped().Updates {
@@ -99,3 +165,47 @@ func (r *RateLimitFilter) DoMap(m *message.Mapped) (*message.Mapped, error) {
 
 	return result, nil
 }
+
+// Returns the aggregates of the intervals that ended, a sensor that stopped sending doesn't keep its last interval. On shutdown
+// the aggregates of the current intervals are returned as well unless the state is stored, then the intervals continue after
+// a restart.
+func (r *RateLimitFilter) Flush(now time.Time, shutdown bool) []*message.Mapped {
+	all := shutdown && r.config.StateConfig.Store == ""
+	result := make([]*message.Mapped, 0)
+	for _, svm := range r.buckets.Flush(now, all, r.limits) {
+		result = append(result, svm.ToMapped())
+	}
+	return result
+}
+
+type rateLimitState struct {
+	LastSeen lastSeen `json:"lastSeen"`
+	Changes  changes  `json:"changes"`
+	Buckets  buckets  `json:"buckets"`
+}
+
+// Returns the time each path was last seen, the last sent values and the values of the current interval per context and connector
+func (r *RateLimitFilter) Snapshot() ([]byte, error) {
+	return json.Marshal(rateLimitState{LastSeen: r.lastSeen, Changes: r.changes, Buckets: r.buckets})
+}
+
+func (r *RateLimitFilter) Restore(b []byte) error {
+	var state rateLimitState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.LastSeen != nil {
+		r.lastSeen = state.LastSeen
+	}
+	if state.Changes != nil {
+		r.changes = state.Changes
+	}
+	if state.Buckets != nil {
+		// the sensors get an interval to continue sending after the restart
+		for _, bucket := range state.Buckets {
+			bucket.Received = time.Now()
+		}
+		r.buckets = state.Buckets
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package mapper_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoMap rate limit on change", func() {
+	now := time.Now()
+	mapped := func(seconds int, value any) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(now.Add(time.Duration(seconds) * time.Second)).AddValue(message.NewValue().WithPath("testingPath").WithValue(value))
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+	// maps the values, one per second, and returns the values that are sent
+	run := func(limit config.RateLimitsConfig, values ...any) []any {
+		limit.Path = "testingPath"
+		r, _ := NewRateLimitFilter(&config.RateLimitFilterConfig{DefaultInterval: time.Minute, Ratelimits: []config.RateLimitsConfig{limit}})
+		sent := make([]any, 0)
+		for i, v := range values {
+			result, err := r.DoMap(mapped(i, v))
+			Expect(err).ToNot(HaveOccurred())
+			for _, u := range result.Updates {
+				sent = append(sent, u.Values[0].Value)
+			}
+		}
+		return sent
+	}
+
+	It("applies the absolute deadband", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.1}, 10.0, 10.05, 10.2, 10.25, 10.0)).To(Equal([]any{10.0, 10.2, 10.0}))
+	})
+	It("applies the relative deadband", func() {
+		Expect(run(config.RateLimitsConfig{RelativeDeadband: 0.1}, 100.0, 105.0, 111.0, 1.0)).To(Equal([]any{100.0, 111.0, 1.0}))
+	})
+	It("applies the interval", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.1, Interval: 2 * time.Second}, 10.0, 11.0, 12.0)).To(Equal([]any{10.0, 12.0}))
+	})
+	It("compares angles", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.2, Angle: true}, 6.2, 0.05, 0.2)).To(Equal([]any{6.2, 0.2}))
+	})
+	It("sends a heartbeat", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.1, Heartbeat: 2 * time.Second}, 10.0, 10.0, 10.0, 10.0)).To(Equal([]any{10.0, 10.0}))
+	})
+	It("sends values that are not numbers on the interval", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.1, Interval: 2 * time.Second}, "a", "b", "c")).To(Equal([]any{"a", "c"}))
+	})
+	It("keeps the turning points with swinging door compression", func() {
+		Expect(run(config.RateLimitsConfig{Deadband: 0.1, SwingingDoor: true}, 0.0, 1.0, 2.0, 3.0, 4.0, 3.0, 2.0, 1.0, 1.0, 1.0, 1.0)).To(Equal([]any{0.0, 4.0, 1.0}))
+	})
+})
+
+var _ = Describe("DoMap rate limit aggregate", func() {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	mappedFrom := func(label string, milliseconds int, value any) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel(label).WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(start.Add(time.Duration(milliseconds) * time.Millisecond)).AddValue(message.NewValue().WithPath("testingPath").WithValue(value))
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+	mapped := func(milliseconds int, value any) *message.Mapped {
+		return mappedFrom("testingConnector", milliseconds, value)
+	}
+	newFilter := func(aggregate string) *RateLimitFilter {
+		r, _ := NewRateLimitFilter(&config.RateLimitFilterConfig{DefaultInterval: time.Minute, Ratelimits: []config.RateLimitsConfig{
+			{Path: "testingPath", Interval: time.Second, Aggregate: aggregate, CountPath: "testingCountPath", Grace: 500 * time.Millisecond},
+		}})
+		return r
+	}
+	// maps the values of the first interval and returns the values sent when the next interval starts
+	run := func(r *RateLimitFilter, values ...any) map[string]*message.Value {
+		for i, v := range values {
+			result, err := r.DoMap(mapped(i*100, v))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Updates).To(BeEmpty())
+		}
+		result, err := r.DoMap(mapped(1500, 0.0))
+		Expect(err).ToNot(HaveOccurred())
+		sent := make(map[string]*message.Value)
+		for _, u := range result.Updates {
+			Expect(u.Timestamp).To(Equal(start))
+			sent[u.Values[0].Path] = &u.Values[0]
+		}
+		return sent
+	}
+
+	DescribeTable("Aggregates",
+		func(aggregate string, expected any) {
+			sent := run(newFilter(aggregate), 2.0, 6.0, 4.0, 1.0)
+			Expect(sent["testingPath"].Value).To(Equal(expected))
+			Expect(sent["testingCountPath"].Value).To(Equal(4))
+		},
+		Entry("mean", config.RateLimitAggregateMean, 3.25),
+		Entry("min", config.RateLimitAggregateMin, 1.0),
+		Entry("max", config.RateLimitAggregateMax, 6.0),
+		Entry("last", config.RateLimitAggregateLast, 1.0),
+	)
+	It("sends the last value when the values are not numbers", func() {
+		sent := run(newFilter(config.RateLimitAggregateMean), "a", "b")
+		Expect(sent["testingPath"].Value).To(Equal("b"))
+	})
+	It("ignores values of an interval that is already sent", func() {
+		r := newFilter(config.RateLimitAggregateMean)
+		run(r, 2.0)
+		result, err := r.DoMap(mapped(500, 4.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+	})
+	// the values sent by a flush per path
+	flushed := func(result []*message.Mapped) map[string]*message.Value {
+		sent := make(map[string]*message.Value)
+		for _, m := range result {
+			for _, u := range m.Updates {
+				Expect(u.Timestamp).To(Equal(start))
+				sent[u.Values[0].Path] = &u.Values[0]
+			}
+		}
+		return sent
+	}
+	It("flushes the interval when the newest value is past the grace period", func() {
+		r := newFilter(config.RateLimitAggregateMean)
+		for i, v := range []float64{2.0, 4.0} {
+			_, err := r.DoMap(mapped(i*100, v))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		// the values of another sensor tell the time of the stream, the flush time is only used for sensors that stopped
+		_, err := r.DoMap(mappedFrom("otherConnector", 1200, 1.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Flush(time.Now(), false)).To(BeEmpty())
+		_, err = r.DoMap(mappedFrom("otherConnector", 1500, 1.0))
+		Expect(err).ToNot(HaveOccurred())
+		sent := flushed(r.Flush(time.Now(), false))
+		Expect(sent["testingPath"].Value).To(Equal(3.0))
+		Expect(sent["testingCountPath"].Value).To(Equal(2))
+		Expect(r.Flush(time.Now(), false)).To(BeEmpty())
+
+		// a late value of the flushed interval and the start of the next interval don't send the interval again
+		result, err := r.DoMap(mapped(900, 8.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+		result, err = r.DoMap(mapped(1500, 8.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+	})
+	It("aggregates the values of a lagging stream", func() {
+		r := newFilter(config.RateLimitAggregateMean)
+		for i, v := range []float64{2.0, 4.0, 6.0} {
+			_, err := r.DoMap(mapped(i*100, v))
+			Expect(err).ToNot(HaveOccurred())
+			// the interval ended long ago on the wall clock but not on the time of the stream
+			Expect(r.Flush(time.Now(), false)).To(BeEmpty())
+		}
+		sent := run(r)
+		Expect(sent["testingPath"].Value).To(Equal(4.0))
+		Expect(sent["testingCountPath"].Value).To(Equal(3))
+	})
+	It("flushes the interval of a sensor that stopped sending", func() {
+		r := newFilter(config.RateLimitAggregateMean)
+		_, err := r.DoMap(mapped(0, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Flush(time.Now(), false)).To(BeEmpty())
+		sent := flushed(r.Flush(time.Now().Add(1500*time.Millisecond), false))
+		Expect(sent["testingPath"].Value).To(Equal(2.0))
+	})
+	It("flushes the current interval on shutdown", func() {
+		r := newFilter(config.RateLimitAggregateMax)
+		_, err := r.DoMap(mapped(100, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(flushed(r.Flush(time.Now(), true))["testingPath"].Value).To(Equal(2.0))
+	})
+	It("keeps the current interval on shutdown when the state is stored", func() {
+		r, _ := NewRateLimitFilter(&config.RateLimitFilterConfig{DefaultInterval: time.Minute, Ratelimits: []config.RateLimitsConfig{
+			{Path: "testingPath", Interval: time.Second, Aggregate: config.RateLimitAggregateMax},
+		}, StateConfig: config.StateConfig{Store: config.StateStoreFile}})
+		_, err := r.DoMap(mapped(100, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Flush(time.Now(), true)).To(BeEmpty())
+	})
+	It("sends the interval of a sensor that stopped sending without a new message", func() {
+		r := newFilter(config.RateLimitAggregateMean)
+		in := make(chan *message.Mapped, 1)
+		publisher := nanomsg.NewPublisher[message.Mapped]("inproc://ratelimit-quiet-in")
+		go publisher.Send(in)
+		subscriber, err := nanomsg.NewSubscriber[message.Mapped]("inproc://ratelimit-quiet-in", []byte{})
+		Expect(err).ToNot(HaveOccurred())
+		outPublisher := nanomsg.NewPublisher[message.Mapped]("inproc://ratelimit-quiet-out")
+		out := make(chan *message.Mapped, 10)
+		outSubscriber, err := nanomsg.NewSubscriber[message.Mapped]("inproc://ratelimit-quiet-out", []byte{})
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go outSubscriber.Receive(ctx, out)
+		go r.Map(ctx, subscriber, outPublisher)
+
+		// the interval of the value ended a day ago, it is sent by the next flush
+		in <- mapped(-24*60*60*1000, 2.0)
+		var received *message.Mapped
+		Eventually(out).WithTimeout(5 * time.Second).Should(Receive(&received))
+		Expect(received.Updates[0].Timestamp).To(Equal(start.Add(-24 * time.Hour)))
+		Expect(received.Updates[0].Values[0].Value).To(Equal(2.0))
+	})
+})
@@ -1,10 +1,12 @@
 package mapper
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 
 	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/message"
@@ -16,7 +18,9 @@ type RawModbusMapper struct {
 	config         config.MapperConfig
 	protocol       string
 	env            ExpressionEnvironment
+	envMutex       sync.Mutex
 	modbusMappings map[string][]config.ModbusMappingsConfig
+	deadLetterSink
 }
 
 func NewModbusRawMapper(c config.MapperConfig, mmc []config.ModbusMappingsConfig) (*RawModbusMapper, error) {
@@ -34,10 +38,14 @@ func NewModbusRawMapper(c config.MapperConfig, mmc []config.ModbusMappingsConfig
 	}, nil
 }
 
-func (m *RawModbusMapper) Map(subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Raw]) {
-	processRaw(subscriber, publisher, m)
+func (m *RawModbusMapper) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Raw]) {
+	processRaw(ctx, subscriber, publisher, m, m.deadLetters, m.config.NumberOfWorkers)
 }
 func (m *RawModbusMapper) DoMap(r *message.Mapped) (*message.Raw, error) {
+	// the environment holds the last value of every path
+	m.envMutex.Lock()
+	defer m.envMutex.Unlock()
+
 	result := message.NewRaw().WithType(config.ModbusType).WithConnector("ModbusReverseMapper")
 
 	for _, svm := range r.ToSingleValueMapped() {
@@ -72,6 +80,8 @@ func (m *RawModbusMapper) DoMap(r *message.Mapped) (*message.Raw, error) {
 
 					result.WithValue(protocol.InjectModbusHeader(&mapping.ModbusHeader, bytes))
 
+				} else {
+					m.deadLetters.failed(r, err)
 				}
 			}
 			return result, nil
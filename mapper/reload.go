@@ -0,0 +1,112 @@
+package mapper
+
+import (
+	"fmt"
+	"os"
+	ossignal "os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/nanomsg"
+	"go.uber.org/zap"
+)
+
+// Mappers that can replace their configuration while running, a configuration that can't be read or compiled is rejected and the running configuration is kept
+type ReloadableMapper interface {
+	Reload(configFilePath string) error
+}
+
+type reloader[T nanomsg.Message] struct {
+	guarded    *guardedMapper[T]
+	reloadable ReloadableMapper
+	config     config.ReloadConfig
+	modTime    time.Time
+}
+
+// Reloads the configuration of the mapper on a SIGHUP and when the config file changes, the mapper is returned as is when there is no config file
+func withReload[T nanomsg.Message](m RealMapper[T], r ReloadableMapper, c config.ReloadConfig) RealMapper[T] {
+	if c.ConfigFile == "" {
+		return m
+	}
+	l := &reloader[T]{guarded: guard(m), reloadable: r, config: c}
+	if info, err := os.Stat(c.ConfigFile); err == nil {
+		l.modTime = info.ModTime()
+	}
+	go l.run()
+	return l.guarded
+}
+
+func (l *reloader[T]) run() {
+	signals := make(chan os.Signal, 1)
+	ossignal.Notify(signals, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if l.config.WatchInterval > 0 {
+		ticker := time.NewTicker(l.config.WatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-signals:
+			l.reload()
+		case <-tick:
+			info, err := os.Stat(l.config.ConfigFile)
+			if err != nil || !info.ModTime().After(l.modTime) {
+				continue
+			}
+			l.modTime = info.ModTime()
+			l.reload()
+		}
+	}
+}
+
+func (l *reloader[T]) reload() {
+	var err error
+	l.guarded.between(func() { err = l.reloadable.Reload(l.config.ConfigFile) })
+	if err != nil {
+		logger.GetLogger().Warn(
+			"Rejected the new configuration, keeping the running configuration",
+			zap.String("Config file", l.config.ConfigFile),
+			zap.String("Error", err.Error()),
+		)
+		return
+	}
+	logger.GetLogger().Info(
+		"Reloaded the configuration",
+		zap.String("Config file", l.config.ConfigFile),
+	)
+}
+
+// logs which mappings were removed and added, a changed mapping is logged as removed and added
+func logMappingsDiff[C any](running []C, reloaded []C, describe func(C) string) {
+	before := make([]string, 0, len(running))
+	for _, c := range running {
+		before = append(before, describe(c))
+	}
+	after := make([]string, 0, len(reloaded))
+	for _, c := range reloaded {
+		after = append(after, describe(c))
+	}
+	for _, d := range before {
+		if !slices.Contains(after, d) {
+			logger.GetLogger().Info("Mapping removed", zap.String("Mapping", d))
+		}
+	}
+	for _, d := range after {
+		if !slices.Contains(before, d) {
+			logger.GetLogger().Info("Mapping added", zap.String("Mapping", d))
+		}
+	}
+}
+
+// describes the mapping without the compiled expressions
+func describeMapping(m config.MappingConfig) string {
+	return fmt.Sprintf("path=%s expression=%q timestampExpression=%q environment=%v", m.Path, m.Expression, m.TimestampExpression, m.ExpressionEnvironment)
+}
+
+func describeExpressionMapping(m *config.ExpressionMappingConfig) string {
+	return fmt.Sprintf("%s sourcePaths=%v retentionTime=%s overwrite=%t", describeMapping(m.MappingConfig), m.SourcePaths, m.RetentionTime, m.Overwrite)
+}
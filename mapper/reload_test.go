@@ -0,0 +1,141 @@
+package mapper_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reload", func() {
+	now := time.Now()
+	var configFile string
+	writeConfig := func(content string) {
+		Expect(os.WriteFile(configFile, []byte(content), 0o644)).To(Succeed())
+	}
+	raw := func(value []byte) *message.Raw {
+		r := message.NewRaw().WithConnector("testingConnector").WithType(config.BinaryType).WithValue(value)
+		r.Uuid = uuid.Nil
+		r.Timestamp = now
+		return r
+	}
+	BeforeEach(func() {
+		configFile = filepath.Join(GinkgoT().TempDir(), "mapper.yaml")
+	})
+
+	It("replaces the mappings of the binary mapper", func() {
+		writeConfig(`
+mappings:
+  - path: "testingPath"
+    expression: "value[0]"
+`)
+		m, _ := NewBinaryMapper(config.MapperConfig{Context: "testingContext"}, config.NewMappingConfig(configFile))
+		result, err := m.DoMap(raw([]byte{2, 3}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[0].Values[0].Value).To(Equal(byte(2)))
+
+		writeConfig(`
+mappings:
+  - path: "testingPath"
+    expression: "value[1]"
+`)
+		Expect(m.Reload(configFile)).To(Succeed())
+		result, err = m.DoMap(raw([]byte{2, 3}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[0].Values[0].Value).To(Equal(byte(3)))
+	})
+	It("keeps the running mappings when the new mappings don't compile", func() {
+		writeConfig(`
+mappings:
+  - path: "testingPath"
+    expression: "value[0]"
+`)
+		m, _ := NewBinaryMapper(config.MapperConfig{Context: "testingContext"}, config.NewMappingConfig(configFile))
+		writeConfig(`
+mappings:
+  - path: "testingPath"
+    expression: "value[1"
+`)
+		Expect(m.Reload(configFile)).ToNot(Succeed())
+		result, err := m.DoMap(raw([]byte{2, 3}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[0].Values[0].Value).To(Equal(byte(2)))
+	})
+	It("keeps the history of the aggregate mapper", func() {
+		writeConfig(`
+mappings:
+  - path: "testingCountPath"
+    expression: "len(history.testingPath)"
+    retentionTime: 1h
+    sourcePaths:
+      - "testingPath"
+`)
+		m, _ := NewAggregateMapper(config.MapperConfig{Context: "testingContext"}, config.NewExpressionMappingConfig(configFile))
+		_, err := m.DoMap(mappedWithPath("testingPath", now, 1.0))
+		Expect(err).ToNot(HaveOccurred())
+
+		writeConfig(`
+mappings:
+  - path: "testingCountPath"
+    expression: "len(history.testingPath) * 10"
+    retentionTime: 1h
+    sourcePaths:
+      - "testingPath"
+`)
+		Expect(m.Reload(configFile)).To(Succeed())
+		result, err := m.DoMap(mappedWithPath("testingPath", now.Add(time.Second), 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[1].Values[0].Value).To(Equal(20))
+	})
+	It("replaces the filters of the expression filter", func() {
+		writeConfig(`
+mappings:
+  - expression: "testingPath.Value > 1"
+    sourcePaths:
+      - "testingPath"
+`)
+		f, _ := NewExpressionFilter(config.NewExpressionMappingConfig(configFile))
+		result, err := f.DoMap(mappedWithPath("testingPath", now, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+
+		writeConfig(`
+mappings:
+  - expression: "testingPath.Value > 5"
+    sourcePaths:
+      - "testingPath"
+`)
+		Expect(f.Reload(configFile)).To(Succeed())
+		result, err = f.DoMap(mappedWithPath("testingPath", now, 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(HaveLen(1))
+	})
+	It("replaces the rate limits of the rate limit filter", func() {
+		writeConfig(`
+defaultInterval: 1m
+`)
+		r, _ := NewRateLimitFilter(config.NewRateLimitConfig(configFile))
+		r.DoMap(mappedWithPath("testingPath", now, 1.0))
+		r.DoMap(mappedWithPath("testingPath", now, 1.0))
+		result, err := r.DoMap(mappedWithPath("testingPath", now.Add(time.Second), 1.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+
+		writeConfig(`
+defaultInterval: 1m
+rateLimits:
+  - path: "testingPath"
+    interval: 100ms
+`)
+		Expect(r.Reload(configFile)).To(Succeed())
+		result, err = r.DoMap(mappedWithPath("testingPath", now.Add(2*time.Second), 1.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(HaveLen(1))
+	})
+})
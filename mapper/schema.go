@@ -0,0 +1,38 @@
+package mapper
+
+import (
+	"github.com/munnik/gosk/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var invalidValueCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_mapper_invalid_values_total", Help: "total number of mapped values that don't match the schema of the path"}, []string{"path"})
+
+// Removes the values that don't match the schema of their path, they are counted and sent to the dead letters of the
+// mapper. The other values get the type of their path.
+func validateMapped(m *message.Mapped, deadLetters *DeadLetters) *message.Mapped {
+	schema := message.GetSchema()
+	updates := make([]message.Update, 0, len(m.Updates))
+	for _, u := range m.Updates {
+		values := make([]message.Value, 0, len(u.Values))
+		for _, v := range u.Values {
+			coerced, err := schema.Coerce(v.Path, v.Value)
+			if err != nil {
+				invalidValueCounter.WithLabelValues(v.Path).Inc()
+				observeMappingError(&MappingError{Mapping: v.Path, Err: err})
+				invalid := message.NewUpdate().WithSource(u.Source).WithTimestamp(u.Timestamp).AddValue(&v)
+				deadLetters.invalid(message.NewMapped().WithContext(m.Context).WithOrigin(m.Origin).AddUpdate(invalid), v.Path, err)
+				continue
+			}
+			v.Value = coerced
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		u.Values = values
+		updates = append(updates, u)
+	}
+	m.Updates = updates
+	return m
+}
@@ -0,0 +1,75 @@
+package mapper_test
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// returns the input as output
+type identityMapper struct{}
+
+func (identityMapper) DoMap(in *message.Mapped) (*message.Mapped, error) {
+	return in, nil
+}
+
+var _ = Describe("Schema", func() {
+	var (
+		buffer      chan *message.DeadLetter
+		deadLetters *DeadLetters
+	)
+	BeforeEach(func() {
+		buffer = make(chan *message.DeadLetter, 10)
+		deadLetters = NewDeadLetters("signalk", buffer)
+	})
+	mapped := func(values ...*message.Value) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel("testingConnector").WithType(config.SignalKType).WithUuid(uuid.Nil),
+		).WithTimestamp(time.Now())
+		for _, v := range values {
+			u.AddValue(v)
+		}
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+
+	It("removes the values that don't match the schema", func() {
+		input := func() *message.Mapped {
+			return mapped(
+				message.NewValue().WithPath("navigation.position").WithValue(1.0),
+				message.NewValue().WithPath("navigation.speedOverGround").WithValue(2.0),
+			)
+		}
+		report := NewHarness[message.Mapped](identityMapper{}, nil).Run([]*message.Mapped{input()})
+		Expect(report.Output).To(HaveLen(1))
+		Expect(report.Fired).To(Equal(map[string]int{"navigation.speedOverGround": 1}))
+		Expect(report.Errors).To(Equal(map[string]int{"navigation.position": 1}))
+
+		Expect(ValidateMapped(input(), deadLetters).Updates[0].Values).To(HaveLen(1))
+		Expect(buffer).To(HaveLen(1))
+		deadLetter := <-buffer
+		Expect(deadLetter.Mapping).To(Equal("navigation.position"))
+		Expect(deadLetter.Mapped.Updates[0].Values).To(HaveLen(1))
+		Expect(deadLetter.Mapped.Updates[0].Values[0].Value).To(Equal(1.0))
+	})
+	It("drops the message when no value matches the schema", func() {
+		report := NewHarness[message.Mapped](identityMapper{}, nil).Run([]*message.Mapped{mapped(
+			message.NewValue().WithPath("navigation.speedOverGround").WithValue("fast"),
+		)})
+		Expect(report.Output).To(BeEmpty())
+		Expect(ValidateMapped(mapped(message.NewValue().WithPath("navigation.speedOverGround").WithValue("fast")), deadLetters).Updates).To(BeEmpty())
+		Expect(buffer).To(HaveLen(1))
+	})
+	It("passes the values of paths that are not in the schema", func() {
+		report := NewHarness[message.Mapped](identityMapper{}, nil).Run([]*message.Mapped{mapped(
+			message.NewValue().WithPath("testingPath").WithValue("a"),
+		)})
+		Expect(report.Output).To(HaveLen(1))
+		Expect(ValidateMapped(mapped(message.NewValue().WithPath("testingPath").WithValue("a")), deadLetters).Updates).To(HaveLen(1))
+		Expect(buffer).To(BeEmpty())
+	})
+})
@@ -0,0 +1,183 @@
+package mapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"go.uber.org/zap"
+)
+
+// freshness of a source of a path in a context
+type sourceState struct {
+	lastSeen   time.Time
+	freshSince time.Time // start of the period the source has been sending values without going stale
+}
+
+type priorityState struct {
+	active  string
+	sources map[string]*sourceState
+}
+
+// Passes only the values of the highest priority source that is fresh, other paths are passed as is
+type SourcePriorityFilter struct {
+	config     *config.SourcePrioritiesConfig
+	protocol   string
+	priorities map[string]*config.SourcePriorityConfig
+	states     map[string]*priorityState // per context and path
+	deadLetterSink
+}
+
+func NewSourcePriorityFilter(c *config.SourcePrioritiesConfig) (*SourcePriorityFilter, error) {
+	return &SourcePriorityFilter{
+		config:     c,
+		protocol:   config.SignalKType,
+		priorities: newPriorities(c),
+		states:     make(map[string]*priorityState),
+	}, nil
+}
+
+func newPriorities(c *config.SourcePrioritiesConfig) map[string]*config.SourcePriorityConfig {
+	priorities := make(map[string]*config.SourcePriorityConfig, len(c.Priorities))
+	for _, p := range c.Priorities {
+		priorities[p.Path] = p
+	}
+	return priorities
+}
+
+func (f *SourcePriorityFilter) Map(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped], publisher *nanomsg.Publisher[message.Mapped]) {
+	process(ctx, subscriber, publisher, f.runnable(), f.deadLetters, true)
+}
+
+// reloads the configuration of the filter
+func (f *SourcePriorityFilter) runnable() RealMapper[message.Mapped] {
+	return withReload[message.Mapped](f, f, f.config.ReloadConfig)
+}
+
+// Replaces the priorities, the active sources are kept
+func (f *SourcePriorityFilter) Reload(configFilePath string) error {
+	c, err := config.LoadSourcePrioritiesConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	logMappingsDiff(f.config.Priorities, c.Priorities, describeSourcePriority)
+	f.config = c
+	f.priorities = newPriorities(c)
+	return nil
+}
+
+func describeSourcePriority(p *config.SourcePriorityConfig) string {
+	sources := make([]string, 0, len(p.Sources))
+	for _, s := range p.Sources {
+		sources = append(sources, fmt.Sprintf("%s(%s)", s.Label, s.Timeout))
+	}
+	return fmt.Sprintf("path=%s sources=%v holdTime=%s activePath=%s", p.Path, sources, p.HoldTime, p.ActivePath)
+}
+
+func (f *SourcePriorityFilter) DoMap(input *message.Mapped) (*message.Mapped, error) {
+	result := message.NewMapped().WithContext(input.Context).WithOrigin(input.Origin)
+
+	for _, svm := range input.ToSingleValueMapped() {
+		p, ok := f.priorities[svm.Path]
+		if !ok {
+			for _, u := range svm.ToMapped().Updates {
+				result.AddUpdate(&u)
+			}
+			continue
+		}
+		key := svm.Context + "/" + svm.Path
+		state, ok := f.states[key]
+		if !ok {
+			state = &priorityState{sources: make(map[string]*sourceState)}
+			f.states[key] = state
+		}
+		if !state.seen(p, svm.Source.Label, svm.Timestamp) {
+			continue
+		}
+		if active := state.selectActive(p, svm.Timestamp); active != state.active {
+			logger.GetLogger().Info(
+				"Active source changed",
+				zap.String("Context", svm.Context),
+				zap.String("Path", svm.Path),
+				zap.String("From", state.active),
+				zap.String("To", active),
+			)
+			state.active = active
+			if p.ActivePath != "" {
+				s := message.NewSource().WithLabel("signalk").WithType(f.protocol).WithUuid(uuid.Nil)
+				result.AddUpdate(message.NewUpdate().WithSource(*s).WithTimestamp(svm.Timestamp).AddValue(
+					message.NewValue().WithPath(p.ActivePath).WithValue(active),
+				))
+			}
+		}
+		if svm.Source.Label != state.active {
+			continue
+		}
+		for _, u := range svm.ToMapped().Updates {
+			result.AddUpdate(&u)
+		}
+	}
+
+	return result, nil
+}
+
+// registers the value of the source, returns false for sources without a priority
+func (s *priorityState) seen(p *config.SourcePriorityConfig, label string, timestamp time.Time) bool {
+	sc := findSource(p, label)
+	if sc == nil {
+		return false
+	}
+	source, ok := s.sources[label]
+	if !ok {
+		source = &sourceState{freshSince: timestamp}
+		s.sources[label] = source
+	} else if timestamp.Sub(source.lastSeen) > sc.Timeout {
+		source.freshSince = timestamp
+	}
+	if timestamp.After(source.lastSeen) {
+		source.lastSeen = timestamp
+	}
+	return true
+}
+
+// fails over to the highest priority fresh source when the active source is stale, fails back to a higher priority source after the hold time
+func (s *priorityState) selectActive(p *config.SourcePriorityConfig, now time.Time) string {
+	activeFresh := false
+	for _, sc := range p.Sources {
+		if sc.Label == s.active {
+			activeFresh = s.fresh(sc, now)
+			break
+		}
+	}
+	for _, sc := range p.Sources {
+		if sc.Label == s.active && activeFresh {
+			return s.active
+		}
+		if sc.Label == s.active || !s.fresh(sc, now) {
+			continue
+		}
+		if !activeFresh || now.Sub(s.sources[sc.Label].freshSince) >= p.HoldTime {
+			return sc.Label
+		}
+	}
+	return ""
+}
+
+func (s *priorityState) fresh(sc *config.SourceConfig, now time.Time) bool {
+	source, ok := s.sources[sc.Label]
+	return ok && now.Sub(source.lastSeen) <= sc.Timeout
+}
+
+func findSource(p *config.SourcePriorityConfig, label string) *config.SourceConfig {
+	for _, sc := range p.Sources {
+		if sc.Label == label {
+			return sc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mapper_test
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DoMap source priority", func() {
+	now := time.Now()
+	mapped := func(seconds int, label string, path string) *message.Mapped {
+		u := message.NewUpdate().WithSource(
+			*message.NewSource().WithLabel(label).WithType(config.NMEA0183Type).WithUuid(uuid.Nil),
+		).WithTimestamp(now.Add(time.Duration(seconds) * time.Second)).AddValue(message.NewValue().WithPath(path).WithValue(float64(seconds)))
+		return message.NewMapped().WithContext("testingContext").WithOrigin("testingContext").AddUpdate(u)
+	}
+	newFilter := func() *SourcePriorityFilter {
+		f, _ := NewSourcePriorityFilter(&config.SourcePrioritiesConfig{Priorities: []*config.SourcePriorityConfig{
+			{
+				Path:       "testingPath",
+				Sources:    []*config.SourceConfig{{Label: "primary", Timeout: 2 * time.Second}, {Label: "secondary", Timeout: 2 * time.Second}},
+				HoldTime:   3 * time.Second,
+				ActivePath: "testingActivePath",
+			},
+		}})
+		return f
+	}
+	type received struct {
+		seconds int
+		label   string
+	}
+	// maps the values and returns the labels of the values that are passed, changes of the active source are prefixed with active:
+	run := func(f *SourcePriorityFilter, values ...received) []string {
+		passed := make([]string, 0)
+		for _, r := range values {
+			result, err := f.DoMap(mapped(r.seconds, r.label, "testingPath"))
+			Expect(err).ToNot(HaveOccurred())
+			for _, u := range result.Updates {
+				if u.Values[0].Path == "testingActivePath" {
+					passed = append(passed, "active:"+u.Values[0].Value.(string))
+					continue
+				}
+				passed = append(passed, u.Source.Label)
+			}
+		}
+		return passed
+	}
+
+	It("passes only the values of the highest priority source", func() {
+		Expect(run(newFilter(),
+			received{0, "primary"},
+			received{0, "secondary"},
+			received{1, "secondary"},
+			received{1, "primary"},
+		)).To(Equal([]string{"active:primary", "primary", "primary"}))
+	})
+	It("fails over when the active source goes stale", func() {
+		Expect(run(newFilter(),
+			received{0, "primary"},
+			received{1, "secondary"},
+			received{2, "secondary"},
+			received{3, "secondary"},
+		)).To(Equal([]string{"active:primary", "primary", "active:secondary", "secondary"}))
+	})
+	It("fails back after the hold time", func() {
+		Expect(run(newFilter(),
+			received{0, "primary"},
+			received{3, "secondary"},
+			received{4, "primary"},
+			received{4, "secondary"},
+			received{6, "primary"},
+			received{6, "secondary"},
+			received{7, "primary"},
+			received{7, "secondary"},
+		)).To(Equal([]string{"active:primary", "primary", "active:secondary", "secondary", "secondary", "secondary", "active:primary", "primary"}))
+	})
+	It("drops the values of sources without a priority", func() {
+		Expect(run(newFilter(), received{0, "unknown"})).To(BeEmpty())
+	})
+	It("passes paths without a priority", func() {
+		f := newFilter()
+		result, err := f.DoMap(mapped(0, "unknown", "otherPath"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,195 @@
+package mapper
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/database"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"go.uber.org/zap"
+)
+
+// Mappers that keep state in memory can implement this interface to persist the state across restarts
+type StatefulMapper interface {
+	Snapshot() ([]byte, error)
+	Restore(state []byte) error
+}
+
+type statefulRealMapper[T nanomsg.Message] interface {
+	RealMapper[T]
+	StatefulMapper
+}
+
+// messages can be mapped by multiple workers at the same time, the state is saved and the configuration reloaded while no message is mapped
+type guardedMapper[T nanomsg.Message] struct {
+	mapper RealMapper[T]
+	mutex  sync.RWMutex
+}
+
+// wraps the mapper, a mapper that is already wrapped is returned as is
+func guard[T nanomsg.Message](m RealMapper[T]) *guardedMapper[T] {
+	if g, ok := m.(*guardedMapper[T]); ok {
+		return g
+	}
+	return &guardedMapper[T]{mapper: m}
+}
+
+func (g *guardedMapper[T]) DoMap(in *T) (*message.Mapped, error) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.mapper.DoMap(in)
+}
+
+// runs f while no message is mapped
+func (g *guardedMapper[T]) between(f func()) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	f()
+}
+
+type persistentMapper[T nanomsg.Message] struct {
+	guarded  *guardedMapper[T]
+	stateful StatefulMapper
+	store    database.StateStore
+	config   config.StateConfig
+	stop     chan struct{}
+}
+
+// Restores the state of the mapper and saves it at intervals and on shutdown, the mapper is returned as is when no store is
+// configured. Without a key the state is stored under the kind of mapper and the path of its config file so mappers of the
+// same kind don't share their state.
+func withPersistentState[T nanomsg.Message](m statefulRealMapper[T], c config.StateConfig, kind string, configFile string) RealMapper[T] {
+	if c.Store == "" {
+		return m
+	}
+	if c.Key == "" {
+		if configFile == "" {
+			logger.GetLogger().Fatal(
+				"Set state.key, the state can't be stored without a key or a config file",
+				zap.String("Mapper", kind),
+			)
+		}
+		path, err := filepath.Abs(configFile)
+		if err != nil {
+			path = configFile
+		}
+		c.Key = kind + ":" + path
+	}
+	store, err := database.NewStateStore(&c)
+	if err != nil {
+		logger.GetLogger().Fatal(
+			"Could not create the state store",
+			zap.String("Store", c.Store),
+			zap.String("Error", err.Error()),
+		)
+	}
+	p := &persistentMapper[T]{guarded: guard[T](m), stateful: m, store: store, config: c, stop: make(chan struct{})}
+	p.restore()
+	go p.run()
+	onShutdown(p.guarded, func() {
+		close(p.stop)
+		p.save()
+	})
+	return p.guarded
+}
+
+func (p *persistentMapper[T]) restore() {
+	state, timestamp, err := p.store.LoadState(p.config.Key)
+	if err != nil {
+		logger.GetLogger().Warn(
+			"Could not load the state",
+			zap.String("Key", p.config.Key),
+			zap.String("Error", err.Error()),
+		)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if time.Since(timestamp) > p.config.MaxAge {
+		logger.GetLogger().Info(
+			"The state is too old to restore",
+			zap.String("Key", p.config.Key),
+			zap.Time("Saved", timestamp),
+		)
+		return
+	}
+	if err := p.stateful.Restore(state); err != nil {
+		logger.GetLogger().Warn(
+			"Could not restore the state",
+			zap.String("Key", p.config.Key),
+			zap.String("Error", err.Error()),
+		)
+		return
+	}
+	logger.GetLogger().Info(
+		"Restored the state",
+		zap.String("Key", p.config.Key),
+		zap.Time("Saved", timestamp),
+	)
+}
+
+func (p *persistentMapper[T]) save() {
+	var state []byte
+	var err error
+	p.guarded.between(func() { state, err = p.stateful.Snapshot() })
+	if err != nil {
+		logger.GetLogger().Warn(
+			"Could not take a snapshot of the state",
+			zap.String("Key", p.config.Key),
+			zap.String("Error", err.Error()),
+		)
+		return
+	}
+	if err := p.store.SaveState(p.config.Key, state); err != nil {
+		logger.GetLogger().Warn(
+			"Could not save the state",
+			zap.String("Key", p.config.Key),
+			zap.String("Error", err.Error()),
+		)
+	}
+}
+
+// saves the state at intervals until the mapper stops
+func (p *persistentMapper[T]) run() {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.save()
+		}
+	}
+}
+
+var (
+	shutdownHooks = make(map[any][]func())
+	shutdownMutex sync.Mutex
+)
+
+// runs f when the mapper stopped processing, the mapper is the one that is passed to process
+func onShutdown(mapper any, f func()) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	shutdownHooks[mapper] = append(shutdownHooks[mapper], f)
+}
+
+// runs the hooks of the mappers after the last received message is mapped, the hook that is added last runs first
+func shutdown(mappers ...any) {
+	shutdownMutex.Lock()
+	var hooks []func()
+	for _, m := range mappers {
+		hooks = append(hooks, shutdownHooks[m]...)
+		delete(shutdownHooks, m)
+	}
+	shutdownMutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
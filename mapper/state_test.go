@@ -0,0 +1,154 @@
+package mapper_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
+	"github.com/munnik/gosk/protocol"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot and restore", func() {
+	now := time.Now().Truncate(time.Millisecond)
+
+	It("restores the previous registers of the modbus mapper", func() {
+		mmc := []config.ModbusMappingsConfig{{
+			MappingConfig: config.MappingConfig{Expression: "deltas[22]", Path: "testingDeltaPath"},
+			ModbusHeader:  protocol.ModbusHeader{Slave: 3, FunctionCode: protocol.ReadInputRegisters, Address: 22, NumberOfCoilsOrRegisters: 1},
+		}}
+		raw := func(register byte, timestamp time.Time) *message.Raw {
+			r := message.NewRaw().WithConnector("testingConnector").WithType(config.ModbusType).WithValue([]byte{0x03, 0x00, 0x04, 0x00, 0x16, 0x00, 0x01, 0x00, register})
+			r.Uuid = uuid.Nil
+			r.Timestamp = timestamp
+			return r
+		}
+		m, _ := NewModbusMapper(config.MapperConfig{Context: "testingContext"}, mmc)
+		_, err := m.DoMap(raw(10, now))
+		Expect(err).ToNot(HaveOccurred())
+		state, err := m.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, _ := NewModbusMapper(config.MapperConfig{Context: "testingContext"}, mmc)
+		Expect(restored.Restore(state)).To(Succeed())
+		result, err := restored.DoMap(raw(15, now.Add(time.Second)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[0].Values[0].Value).To(Equal(int32(5)))
+	})
+	It("keeps the state of mappers of the same protocol apart in one store", func() {
+		mmc := []config.ModbusMappingsConfig{{
+			MappingConfig: config.MappingConfig{Expression: "deltas[22]", Path: "testingDeltaPath"},
+			ModbusHeader:  protocol.ModbusHeader{Slave: 3, FunctionCode: protocol.ReadInputRegisters, Address: 22, NumberOfCoilsOrRegisters: 1},
+		}}
+		raw := func(register byte, timestamp time.Time) *message.Raw {
+			r := message.NewRaw().WithConnector("testingConnector").WithType(config.ModbusType).WithValue([]byte{0x03, 0x00, 0x04, 0x00, 0x16, 0x00, 0x01, 0x00, register})
+			r.Timestamp = timestamp
+			return r
+		}
+		directory := GinkgoT().TempDir()
+		// runs the mapper until the register is mapped, the state is saved when the mapper stops
+		run := func(name string, register byte, timestamp time.Time) *message.Mapped {
+			c := config.MapperConfig{Context: "testingContext", Protocol: config.ModbusType}
+			c.ConfigFile = filepath.Join(directory, name+".yaml")
+			c.StateConfig = config.StateConfig{Store: config.StateStoreFile, Directory: directory, Interval: time.Hour, MaxAge: time.Hour}
+			m, _ := NewModbusMapper(c, mmc)
+
+			rawURL := "inproc://state-raw-" + name + timestamp.String()
+			mappedURL := "inproc://state-mapped-" + name + timestamp.String()
+			in := make(chan *message.Raw, 1)
+			rawPublisher := nanomsg.NewPublisher[message.Raw](rawURL)
+			go rawPublisher.Send(in)
+			subscriber, err := nanomsg.NewSubscriber[message.Raw](rawURL, []byte{})
+			Expect(err).ToNot(HaveOccurred())
+			mappedPublisher := nanomsg.NewPublisher[message.Mapped](mappedURL)
+			out := make(chan *message.Mapped, 10)
+			mappedSubscriber, err := nanomsg.NewSubscriber[message.Mapped](mappedURL, []byte{})
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			go mappedSubscriber.Receive(ctx, out)
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				m.Map(ctx, subscriber, mappedPublisher)
+			}()
+
+			var result *message.Mapped
+			Eventually(func() bool {
+				select {
+				case in <- raw(register, timestamp):
+				default:
+				}
+				select {
+				case result = <-out:
+					return true
+				case <-time.After(20 * time.Millisecond):
+					return false
+				}
+			}).WithTimeout(2 * time.Second).Should(BeTrue())
+			cancel()
+			Eventually(stopped).WithTimeout(2 * time.Second).Should(BeClosed())
+			close(in)
+			return result
+		}
+
+		run("first", 10, now)
+		run("second", 50, now)
+		Expect(run("first", 15, now.Add(time.Second)).Updates[0].Values[0].Value).To(Equal(5.0))
+		Expect(run("second", 52, now.Add(time.Second)).Updates[0].Values[0].Value).To(Equal(2.0))
+	})
+	It("restores the history of the aggregate mapper", func() {
+		emc := []*config.ExpressionMappingConfig{{
+			MappingConfig: config.MappingConfig{Expression: "len(history.testingPath)", Path: "testingCountPath"},
+			SourcePaths:   []string{"testingPath"},
+			RetentionTime: time.Hour,
+		}}
+		m, _ := NewAggregateMapper(config.MapperConfig{Context: "testingContext"}, emc)
+		_, err := m.DoMap(mappedWithPath("testingPath", now, 1.0))
+		Expect(err).ToNot(HaveOccurred())
+		state, err := m.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, _ := NewAggregateMapper(config.MapperConfig{Context: "testingContext"}, emc)
+		Expect(restored.Restore(state)).To(Succeed())
+		result, err := restored.DoMap(mappedWithPath("testingPath", now.Add(time.Second), 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates[1].Values[0].Value).To(Equal(2))
+	})
+	It("restores the samples of the fft mapper", func() {
+		fftc := []*config.FftConfig{{Path: "testingPath", SpectrumPath: "testingSpectrumPath", SamplesChannelBitSize: 1, FrequencyStepSize: 1}}
+		m, _ := NewFftMapper(config.MapperConfig{Context: "testingContext"}, fftc)
+		for i := range 3 {
+			_, err := m.DoMap(mappedWithPath("testingPath", now.Add(time.Duration(i)*time.Second), float64(i)))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		state, err := m.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, _ := NewFftMapper(config.MapperConfig{Context: "testingContext"}, fftc)
+		Expect(restored.Restore(state)).To(Succeed())
+		result, err := restored.DoMap(mappedWithPath("testingPath", now.Add(3*time.Second), 3.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(HaveLen(1))
+	})
+	It("restores the last seen times of the rate limit filter", func() {
+		c := &config.RateLimitFilterConfig{DefaultInterval: time.Minute}
+		m, _ := NewRateLimitFilter(c)
+		// the first value of a path is used to register the path, the second one to register the connector
+		m.DoMap(mappedWithPath("testingPath", now, 1.0))
+		m.DoMap(mappedWithPath("testingPath", now, 1.0))
+		state, err := m.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, _ := NewRateLimitFilter(c)
+		Expect(restored.Restore(state)).To(Succeed())
+		result, err := restored.DoMap(mappedWithPath("testingPath", now.Add(time.Second), 2.0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updates).To(BeEmpty())
+	})
+})
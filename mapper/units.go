@@ -0,0 +1,71 @@
+package mapper
+
+import "math"
+
+const (
+	metersPerNauticalMile = 1852
+	secondsPerHour        = 3600
+	zeroCelsiusInKelvin   = 273.15
+	pascalsPerBar         = 100000
+	litersPerCubicMeter   = 1000
+)
+
+// Converts a speed in knots to m/s
+func KnotsToMetersPerSecond(knots float64) float64 {
+	return knots * metersPerNauticalMile / secondsPerHour
+}
+
+// Converts a speed in m/s to knots
+func MetersPerSecondToKnots(metersPerSecond float64) float64 {
+	return metersPerSecond * secondsPerHour / metersPerNauticalMile
+}
+
+// Converts a speed in km/h to m/s
+func KilometersPerHourToMetersPerSecond(kilometersPerHour float64) float64 {
+	return kilometersPerHour * 1000 / secondsPerHour
+}
+
+// Converts a speed in m/s to km/h
+func MetersPerSecondToKilometersPerHour(metersPerSecond float64) float64 {
+	return metersPerSecond * secondsPerHour / 1000
+}
+
+// Converts a temperature in °C to K
+func CelsiusToKelvin(celsius float64) float64 {
+	return celsius + zeroCelsiusInKelvin
+}
+
+// Converts a temperature in K to °C
+func KelvinToCelsius(kelvin float64) float64 {
+	return kelvin - zeroCelsiusInKelvin
+}
+
+// Converts a pressure in bar to Pa
+func BarToPascal(bar float64) float64 {
+	return bar * pascalsPerBar
+}
+
+// Converts a pressure in Pa to bar
+func PascalToBar(pascal float64) float64 {
+	return pascal / pascalsPerBar
+}
+
+// Converts a volume in L to m3
+func LitersToCubicMeters(liters float64) float64 {
+	return liters / litersPerCubicMeter
+}
+
+// Converts a volume in m3 to L
+func CubicMetersToLiters(cubicMeters float64) float64 {
+	return cubicMeters * litersPerCubicMeter
+}
+
+// Converts an angle in degrees to rad
+func DegreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Converts an angle in rad to degrees
+func RadiansToDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
@@ -0,0 +1,33 @@
+package mapper_test
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/munnik/gosk/mapper"
+)
+
+func TestUnitConversionsRoundTrip(t *testing.T) {
+	for name, test := range map[string]struct {
+		to, from func(float64) float64
+		input    float64
+		expected float64
+	}{
+		"knots":               {KnotsToMetersPerSecond, MetersPerSecondToKnots, 10, 5.144444},
+		"kilometers per hour": {KilometersPerHourToMetersPerSecond, MetersPerSecondToKilometersPerHour, 36, 10},
+		"celsius":             {CelsiusToKelvin, KelvinToCelsius, 20, 293.15},
+		"bar":                 {BarToPascal, PascalToBar, 1.5, 150000},
+		"liters":              {LitersToCubicMeters, CubicMetersToLiters, 2500, 2.5},
+		"degrees":             {DegreesToRadians, RadiansToDegrees, 180, math.Pi},
+	} {
+		result := test.to(test.input)
+		if math.Abs(result-test.expected) > tolerance {
+			t.Logf("Expected %f but got %f for %s", test.expected, result, name)
+			t.Fail()
+		}
+		if back := test.from(result); math.Abs(back-test.input) > tolerance {
+			t.Logf("Expected %f but got %f for %s", test.input, back, name)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package mapper
+
+import (
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/message"
+)
+
+// Compiles the expression against the environment the mapper of the protocol provides, unknown variables and type errors are reported
+func CheckExpression(protocol string, expression string, environment map[string]interface{}, sourcePaths []string) error {
+	env := NewExpressionEnvironment()
+	switch protocol {
+	case config.ModbusType:
+		env["coils"] = map[int]bool{}
+		env["registers"] = map[int]uint16{}
+		env["deltas"] = map[int]int32{}
+		env["timestamps"] = map[int]time.Time{}
+		env["timedeltas"] = map[int]int64{}
+	case config.CSVType:
+		env["stringValues"] = []string{}
+		env["floatValues"] = []float64{}
+		env["intValues"] = []int64{}
+	case config.JSONType:
+		env["json"] = map[string]interface{}{}
+	case config.CanBusType:
+		env["value"] = float64(0)
+	case config.BinaryType:
+		env["value"] = []byte{}
+	case config.SignalKType:
+		env["history"] = map[string][]message.SingleValueMapped{}
+		for _, p := range sourcePaths {
+			env[strings.ReplaceAll(p, ".", "_")] = message.SingleValueMapped{}
+		}
+	default:
+		// the environment contains the values of all paths the mapper received, only the syntax can be checked
+		_, err := expr.Compile(expression)
+		return err
+	}
+	for key, value := range environment {
+		env[key] = value
+	}
+	_, err := expr.Compile(expression, expr.Env(env))
+	return err
+}
@@ -0,0 +1,39 @@
+package mapper_test
+
+import (
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/mapper"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	DescribeTable("CheckExpression",
+		func(protocol string, expression string, sourcePaths []string, valid bool) {
+			err := CheckExpression(protocol, expression, nil, sourcePaths)
+			if valid {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("modbus registers", config.ModbusType, "registers[1] * 2", nil, true),
+		Entry("unknown variable", config.ModbusType, "register[1] * 2", nil, false),
+		Entry("csv values", config.CSVType, "floatValues[1] + float(intValues[0])", nil, true),
+		Entry("source path", config.SignalKType, "navigation_speedOverGround.Value * 2", []string{"navigation.speedOverGround"}, true),
+		Entry("mismatched types", config.SignalKType, "navigation_speedOverGround - 2", []string{"navigation.speedOverGround"}, false),
+		Entry("syntax only", config.AlarmType, "anyPath.Value > 2", nil, true),
+		Entry("syntax error", config.AlarmType, "anyPath.Value >", nil, false),
+	)
+
+	It("reports the errors with their lines", func() {
+		component, errors := config.Validate("validate_test.yaml", CheckExpression)
+		Expect(component).To(Equal(config.ComponentMapper))
+		lines := make([]int, 0, len(errors))
+		for _, e := range errors {
+			lines = append(lines, e.Line)
+		}
+		// missing number of registers, unknown key, unknown variable and invalid path
+		Expect(lines).To(Equal([]int{11, 14, 15, 16}))
+	})
+})
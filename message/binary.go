@@ -0,0 +1,143 @@
+package message
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// The type tags of values in the binary format, the numbers are part of the format and should never change
+const (
+	tagAny uint8 = iota // the type is guessed when decoding, used for types without a tag
+	tagFloat
+	tagInt
+	tagString
+	tagBool
+	tagPosition
+	tagVesselInfo
+	tagVesselType
+	tagLength
+	tagNotification
+	tagNotifications
+	tagAlarmNotification
+	tagDraft
+	tagSpectrum
+	tagVector3D
+	tagAttitude
+	tagCurrent
+	tagSatellitesInView
+	tagCoursePoint
+	tagActiveRoute
+	tagEngineState
+)
+
+var (
+	binaryEncMode cbor.EncMode
+	binaryDecMode cbor.DecMode
+)
+
+func init() {
+	var err error
+	if binaryEncMode, err = (cbor.EncOptions{Time: cbor.TimeRFC3339NanoUTC}).EncMode(); err != nil {
+		panic(err)
+	}
+	if binaryDecMode, err = (cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}{})}).DecMode(); err != nil {
+		panic(err)
+	}
+}
+
+// Encodes the message in the binary format, see MarshalCBOR of Value for the encoding of values
+func MarshalBinary(v any) ([]byte, error) {
+	return binaryEncMode.Marshal(v)
+}
+
+func UnmarshalBinary(data []byte, v any) error {
+	return binaryDecMode.Unmarshal(data, v)
+}
+
+// a value is encoded as an array of the path, the type tag and the value
+type binaryValue struct {
+	_     struct{} `cbor:",toarray"`
+	Path  string
+	Tag   uint8
+	Value cbor.RawMessage
+}
+
+func (v Value) MarshalCBOR() ([]byte, error) {
+	tag, value := tagOf(v.Value)
+	encoded, err := binaryEncMode.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return binaryEncMode.Marshal(binaryValue{Path: v.Path, Tag: tag, Value: encoded})
+}
+
+func (v *Value) UnmarshalCBOR(data []byte) error {
+	var b binaryValue
+	if err := binaryDecMode.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	v.Path = b.Path
+
+	switch b.Tag {
+	case tagFloat:
+		var f float64
+		v.Value = &f
+	case tagInt:
+		var i int64
+		v.Value = &i
+	case tagString:
+		var s string
+		v.Value = &s
+	case tagBool:
+		var b bool
+		v.Value = &b
+	case tagAny:
+		var i interface{}
+		if err := binaryDecMode.Unmarshal(b.Value, &i); err != nil {
+			return err
+		}
+		decoded, err := GetSchema().Decode(v.Path, i)
+		if err != nil {
+			return fmt.Errorf("don't know how to unmarshal the value of %s: %w", v.Path, err)
+		}
+		v.Value = decoded
+		return nil
+	default:
+		t, ok := lookupValueTypeByTag(b.Tag)
+		if !ok {
+			return fmt.Errorf("unknown type tag %d for the value of %s", b.Tag, v.Path)
+		}
+		v.Value = reflect.New(t.Type).Interface()
+	}
+	if err := binaryDecMode.Unmarshal(b.Value, v.Value); err != nil {
+		return err
+	}
+	v.Value = reflect.ValueOf(v.Value).Elem().Interface()
+	return nil
+}
+
+// numbers are widened to float64 or int64 so they decode to the same type on every platform
+func tagOf(value interface{}) (uint8, interface{}) {
+	if t, ok := lookupValueTypeOf(value); ok {
+		return t.Tag, value
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return tagFloat, v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return tagInt, v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := v.Uint(); u <= math.MaxInt64 {
+			return tagInt, int64(u)
+		}
+		return tagFloat, float64(v.Uint())
+	case reflect.String:
+		return tagString, v.String()
+	case reflect.Bool:
+		return tagBool, v.Bool()
+	}
+	return tagAny, value
+}
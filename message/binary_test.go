@@ -0,0 +1,76 @@
+package message_test
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/munnik/gosk/config"
+	. "github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Binary", func() {
+	timestamp := time.Date(2022, time.Month(2), 9, 12, 3, 57, 431272983, time.UTC)
+	mapped := func(values ...*Value) *Mapped {
+		u := NewUpdate().WithSource(
+			*NewSource().WithLabel("GPS").WithType(config.NMEA0183Type).WithUuid(uuid.MustParse("496aa0fb-d838-4631-a12f-dbad3cb27389")),
+		).WithTimestamp(timestamp)
+		for _, v := range values {
+			u.AddValue(v)
+		}
+		return NewMapped().WithContext("vessels.urn:mrn:imo:mmsi:234567890").WithOrigin("vessels.urn:mrn:imo:mmsi:123456789").AddUpdate(u)
+	}
+	roundTrip := func(in any, out any) {
+		bytes, err := MarshalBinary(in)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(UnmarshalBinary(bytes, out)).To(Succeed())
+	}
+
+	DescribeTable(
+		"keeps the type of the value",
+		func(value interface{}, expected interface{}) {
+			var result Mapped
+			roundTrip(mapped(NewValue().WithPath("testingPath").WithValue(value)), &result)
+			Expect(result.Updates[0].Values[0].Value).To(Equal(expected))
+		},
+		Entry("a float", 1.5, 1.5),
+		Entry("an int", 42, int64(42)),
+		Entry("an uint16", uint16(42), int64(42)),
+		Entry("an uint64 that fits an int", uint64(math.MaxInt64), int64(math.MaxInt64)),
+		Entry("an uint64 that doesn't fit an int", uint64(math.MaxUint64), float64(math.MaxUint64)),
+		Entry("a string", "a", "a"),
+		Entry("a bool", true, true),
+		Entry("a vector", Vector3D{X: 1, Y: 2, Z: 3}, Vector3D{X: 1, Y: 2, Z: 3}),
+		Entry("notifications", Notifications{{Message: ptrString("a")}}, Notifications{{Message: ptrString("a")}}),
+		Entry("a map", map[string]interface{}{"x": 1.0, "y": 2.0, "z": 3.0}, Vector3D{X: 1, Y: 2, Z: 3}),
+	)
+	It("decodes a mapped message", func() {
+		lat, lon := 52.150099, 5.921749
+		in := mapped(NewValue().WithPath("navigation.position").WithValue(Position{Latitude: &lat, Longitude: &lon}))
+		var result Mapped
+		roundTrip(in, &result)
+		Expect(result).To(Equal(*in))
+	})
+	It("decodes a raw message", func() {
+		in := NewRaw().WithConnector("GPS").WithValue([]byte{0, 1, 255}).WithType(config.NMEA0183Type)
+		in.Timestamp = timestamp
+		var result Raw
+		roundTrip(in, &result)
+		Expect(result).To(Equal(*in))
+	})
+	It("is smaller than json", func() {
+		in := mapped(NewValue().WithPath("navigation.speedOverGround").WithValue(3.5))
+		bytes, err := MarshalBinary(in)
+		Expect(err).NotTo(HaveOccurred())
+		jsonBytes, err := json.Marshal(in)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(bytes)).To(BeNumerically("<", len(jsonBytes)*2/3))
+	})
+})
+
+func ptrString(s string) *string {
+	return &s
+}
@@ -0,0 +1,46 @@
+package message
+
+import (
+	"time"
+)
+
+// A message that could not be mapped or is rejected by a filter, either Raw or Mapped is set
+type DeadLetter struct {
+	Timestamp time.Time `json:"timestamp"`
+	Mapper    string    `json:"mapper"`
+	Mapping   string    `json:"mapping"`
+	Error     string    `json:"error"`
+	Raw       *Raw      `json:"raw,omitempty"`
+	Mapped    *Mapped   `json:"mapped,omitempty"`
+}
+
+func NewDeadLetter() *DeadLetter {
+	return &DeadLetter{
+		Timestamp: time.Now(),
+	}
+}
+
+func (d *DeadLetter) WithMapper(m string) *DeadLetter {
+	d.Mapper = m
+	return d
+}
+
+func (d *DeadLetter) WithMapping(m string) *DeadLetter {
+	d.Mapping = m
+	return d
+}
+
+func (d *DeadLetter) WithError(e string) *DeadLetter {
+	d.Error = e
+	return d
+}
+
+func (d *DeadLetter) WithRaw(r *Raw) *DeadLetter {
+	d.Raw = r
+	return d
+}
+
+func (d *DeadLetter) WithMapped(m *Mapped) *DeadLetter {
+	d.Mapped = m
+	return d
+}
@@ -183,7 +183,8 @@ var _ = Describe("Mapped", func() {
           							"value": {
 										  "latitude": 52.150099,
 										  "longitude": 5.921749
-									  }
+									  },
+									"kind": "position"
 								}
 							]
           				}
@@ -8,9 +8,9 @@ import (
 )
 
 type Mapped struct {
-	Context string   `json:"context"` // indicates what the data is about
-	Origin  string   `json:"origin"`  // indicates the creator of the data
-	Updates []Update `json:"updates"`
+	Context string   `json:"context" cbor:"1,keyasint"` // indicates what the data is about
+	Origin  string   `json:"origin" cbor:"2,keyasint"`  // indicates the creator of the data
+	Updates []Update `json:"updates" cbor:"3,keyasint"`
 }
 
 func NewMapped() *Mapped {
@@ -133,6 +133,15 @@ func (left SingleValueMapped) Merge(right SingleValueMapped) SingleValueMapped {
 	}
 }
 
+// The kind of a value of a registered type is added, see Value
+func (s SingleValueMapped) MarshalJSON() ([]byte, error) {
+	type singleValueMapped SingleValueMapped
+	return json.Marshal(struct {
+		singleValueMapped
+		Kind Kind `json:"kind,omitempty"`
+	}{singleValueMapped(s), kindOf(s.Value)})
+}
+
 func (s *SingleValueMapped) UnmarshalJSON(data []byte) error {
 	var err error
 	var j map[string]interface{}
@@ -181,7 +190,7 @@ func (s *SingleValueMapped) UnmarshalJSON(data []byte) error {
 	}
 	s.Path = str
 
-	if decoded, err := Decode(j["value"]); err == nil {
+	if decoded, err := decodeValue(s.Path, j); err == nil {
 		s.Value = decoded
 		return nil
 	}
@@ -6,9 +6,9 @@ import (
 )
 
 type Update struct {
-	Source    Source    `json:"source"`
-	Timestamp time.Time `json:"timestamp"`
-	Values    []Value   `json:"values"`
+	Source    Source    `json:"source" cbor:"1,keyasint"`
+	Timestamp time.Time `json:"timestamp" cbor:"2,keyasint"`
+	Values    []Value   `json:"values" cbor:"3,keyasint"`
 }
 
 func NewUpdate() *Update {
@@ -3,10 +3,10 @@ package message
 import "github.com/google/uuid"
 
 type Source struct {
-	Label        string    `json:"label"`
-	Type         string    `json:"type"`
-	Uuid         uuid.UUID `json:"uuid"`
-	TransferUuid uuid.UUID `json:"transferUuid"`
+	Label        string    `json:"label" cbor:"1,keyasint"`
+	Type         string    `json:"type" cbor:"2,keyasint"`
+	Uuid         uuid.UUID `json:"uuid" cbor:"3,keyasint"`
+	TransferUuid uuid.UUID `json:"transferUuid" cbor:"4,keyasint"`
 }
 
 func NewSource() *Source {
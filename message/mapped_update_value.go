@@ -24,6 +24,16 @@ func (v *Value) WithValue(val interface{}) *Value {
 	return v
 }
 
+// The kind of a value of a registered type is added like the tag in the binary format, so the value is decoded without
+// guessing its type
+func (v Value) MarshalJSON() ([]byte, error) {
+	type value Value
+	return json.Marshal(struct {
+		value
+		Kind Kind `json:"kind,omitempty"`
+	}{value(v), kindOf(v.Value)})
+}
+
 func (v *Value) UnmarshalJSON(data []byte) error {
 	var err error
 	var j map[string]interface{}
@@ -42,7 +52,7 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 	}
 	v.Path = s
 
-	if decoded, err := Decode(j["value"]); err == nil {
+	if decoded, err := decodeValue(v.Path, j); err == nil {
 		v.Value = decoded
 		return nil
 	}
@@ -50,6 +60,22 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("don't know how to unmarshal %v", string(data))
 }
 
+// the kind of the value when it has a registered type, empty otherwise
+func kindOf(value interface{}) Kind {
+	if t, ok := lookupValueTypeOf(value); ok {
+		return t.Kind
+	}
+	return ""
+}
+
+// decodes the value of the json object with its kind, values without a kind are decoded with the type of the path
+func decodeValue(path string, j map[string]interface{}) (interface{}, error) {
+	if kind, ok := j["kind"].(string); ok {
+		return decodeKind(Kind(kind), j["value"])
+	}
+	return GetSchema().Decode(path, j["value"])
+}
+
 func (v Value) Equals(other Value) bool {
 	return v.Path == other.Path && v.Value == other.Value
 }
@@ -2,6 +2,7 @@ package message
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -119,6 +120,30 @@ func (left Notification) Merge(right Merger) (Merger, error) {
 	return left, err
 }
 
+type AlarmNotification struct {
+	State   *string  `json:"state,omitempty"`
+	Method  []string `json:"method,omitempty"`
+	Message *string  `json:"message,omitempty"`
+}
+
+func (left AlarmNotification) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(AlarmNotification); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.State != nil {
+			left.State = right.State
+		}
+		if right.Method != nil {
+			left.Method = right.Method
+		}
+		if right.Message != nil {
+			left.Message = right.Message
+		}
+	}
+	return left, err
+}
+
 type Draft struct {
 	Current          *float64  `json:"current,omitempty"`
 	CurrentPort      []float64 `json:"currentPort,omitempty"`
@@ -164,70 +189,202 @@ type Vector3D struct {
 	Z float64 `json:"z"`
 }
 
-func Decode(input interface{}) (interface{}, error) {
-	if i, ok := input.(int64); ok {
-		return i, nil
+func (left Vector3D) Merge(right Merger) (Merger, error) {
+	if right, ok := right.(Vector3D); ok {
+		return right, nil
 	}
-	if f, ok := input.(float64); ok {
-		return f, nil
-	}
-	if s, ok := input.(string); ok {
-		return s, nil
+	return left, fmt.Errorf("right has type %T but should be type %T", right, left)
+}
+
+// A list of notifications, the list of right replaces the list of left
+type Notifications []Notification
+
+func (left Notifications) Merge(right Merger) (Merger, error) {
+	if right, ok := right.(Notifications); ok {
+		return right, nil
 	}
+	return left, fmt.Errorf("right has type %T but should be type %T", right, left)
+}
 
-	var metadata mapstructure.Metadata
-	p := Position{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &p, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return p, nil
+type Attitude struct {
+	Roll  *float64 `json:"roll,omitempty"`
+	Pitch *float64 `json:"pitch,omitempty"`
+	Yaw   *float64 `json:"yaw,omitempty"`
+}
+
+func (left Attitude) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(Attitude); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.Roll != nil {
+			left.Roll = right.Roll
+		}
+		if right.Pitch != nil {
+			left.Pitch = right.Pitch
+		}
+		if right.Yaw != nil {
+			left.Yaw = right.Yaw
+		}
 	}
+	return left, err
+}
+
+// The direction and strength of the current
+type Current struct {
+	Drift       *float64 `json:"drift,omitempty"`
+	SetTrue     *float64 `json:"setTrue,omitempty"`
+	SetMagnetic *float64 `json:"setMagnetic,omitempty"`
+}
 
-	vi := VesselInfo{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &vi, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return vi, nil
+func (left Current) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(Current); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.Drift != nil {
+			left.Drift = right.Drift
+		}
+		if right.SetTrue != nil {
+			left.SetTrue = right.SetTrue
+		}
+		if right.SetMagnetic != nil {
+			left.SetMagnetic = right.SetMagnetic
+		}
 	}
+	return left, err
+}
+
+type Satellite struct {
+	Id        int      `json:"id"`
+	Elevation *float64 `json:"elevation,omitempty"`
+	Azimuth   *float64 `json:"azimuth,omitempty"`
+	SNR       *float64 `json:"SNR,omitempty"`
+}
+
+type SatellitesInView struct {
+	Count      *int        `json:"count,omitempty"`
+	Satellites []Satellite `json:"satellites,omitempty"`
+}
 
-	vt := VesselType{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &vt, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return vt, nil
+func (left SatellitesInView) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(SatellitesInView); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.Count != nil {
+			left.Count = right.Count
+		}
+		if right.Satellites != nil {
+			left.Satellites = right.Satellites
+		}
 	}
+	return left, err
+}
 
-	l := Length{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &l, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return l, nil
+// The next or previous point of the course
+type CoursePoint struct {
+	Type     *string   `json:"type,omitempty"` // Location, RoutePoint or VesselPosition
+	Href     *string   `json:"href,omitempty"`
+	Position *Position `json:"position,omitempty"`
+}
+
+func (left CoursePoint) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(CoursePoint); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.Type != nil {
+			left.Type = right.Type
+		}
+		if right.Href != nil {
+			left.Href = right.Href
+		}
+		if right.Position != nil {
+			left.Position = right.Position
+		}
 	}
+	return left, err
+}
+
+type ActiveRoute struct {
+	Href       *string `json:"href,omitempty"`
+	Name       *string `json:"name,omitempty"`
+	PointIndex *int    `json:"pointIndex,omitempty"`
+	PointTotal *int    `json:"pointTotal,omitempty"`
+	Reverse    *bool   `json:"reverse,omitempty"`
+}
 
-	n := Notification{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &n, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return n, nil
+func (left ActiveRoute) Merge(right Merger) (Merger, error) {
+	var err error
+	if right, ok := right.(ActiveRoute); !ok {
+		err = fmt.Errorf("right has type %T but should be type %T", right, left)
+	} else {
+		if right.Href != nil {
+			left.Href = right.Href
+		}
+		if right.Name != nil {
+			left.Name = right.Name
+		}
+		if right.PointIndex != nil {
+			left.PointIndex = right.PointIndex
+		}
+		if right.PointTotal != nil {
+			left.PointTotal = right.PointTotal
+		}
+		if right.Reverse != nil {
+			left.Reverse = right.Reverse
+		}
 	}
+	return left, err
+}
+
+type EngineState string
+
+const (
+	EngineStateStopped  EngineState = "stopped"
+	EngineStateStarted  EngineState = "started"
+	EngineStateUnusable EngineState = "unusable"
+)
 
-	ns := []Notification{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &ns, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return ns, nil
+func (left EngineState) Merge(right Merger) (Merger, error) {
+	if right, ok := right.(EngineState); ok {
+		return right, nil
 	}
+	return left, fmt.Errorf("right has type %T but should be type %T", right, left)
+}
 
-	d := Draft{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &d, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return d, nil
+func (s EngineState) Validate() error {
+	switch s {
+	case EngineStateStopped, EngineStateStarted, EngineStateUnusable:
+		return nil
 	}
+	return fmt.Errorf("%s is not a valid engine state", s)
+}
 
-	s := Spectrum{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &s, &metadata); err == nil && len(metadata.Unused) == 0 {
+// Decodes the input by trying the registered value types in the order they are registered, a type is only used when
+// all keys of the input are used and at least one key matches
+func Decode(input interface{}) (interface{}, error) {
+	if i, ok := input.(int64); ok {
+		return i, nil
+	}
+	if f, ok := input.(float64); ok {
+		return f, nil
+	}
+	if s, ok := input.(string); ok {
 		return s, nil
 	}
 
-	v := Vector3D{}
-	metadata = mapstructure.Metadata{}
-	if err := mapstructure.DecodeMetadata(input, &v, &metadata); err == nil && len(metadata.Unused) == 0 {
-		return v, nil
+	for _, t := range ValueTypes() {
+		if t.Type.Kind() == reflect.String {
+			// enums are only decoded by path
+			continue
+		}
+		result := reflect.New(t.Type)
+		metadata := mapstructure.Metadata{}
+		if err := mapstructure.DecodeMetadata(input, result.Interface(), &metadata); err == nil && len(metadata.Unused) == 0 && len(metadata.Keys) > 0 {
+			return result.Elem().Interface(), nil
+		}
 	}
 
 	return input, fmt.Errorf("don't know how to decode %v", input)
@@ -0,0 +1,372 @@
+package message
+
+import (
+	"strings"
+	"sync"
+)
+
+// The paths of the SignalK specification and the paths GOSK adds, see SIGNALK_PATHS.md. A * matches exactly one segment,
+// e.g. the identifier of an engine or a tank. Properties of object values are listed as paths.
+var knownPaths = []string{
+	"name",
+	"mmsi",
+	"uuid",
+	"url",
+	"port",
+	"flag",
+	"registrations.imo",
+	"registrations.national.*.registration",
+	"registrations.local.*.registration",
+	"registrations.other.*.registration",
+	"communication.callsignVhf",
+	"communication.callsignHf",
+	"communication.phoneNumber",
+	"communication.emailHf",
+	"communication.email",
+	"communication.satPhoneNumber",
+	"communication.skipperName",
+	"communication.crewNames",
+
+	"design.displacement",
+	"design.isTrawler",
+	"design.isBuoy",
+	"design.aisShipType",
+	"design.draft",
+	"design.draft.minimum",
+	"design.draft.maximum",
+	"design.draft.current",
+	"design.draft.canoe",
+	"design.draft.currentPort",
+	"design.draft.currentStarboard",
+	"design.draft.*.*", // the draft at a side and a position, e.g. design.draft.port.forward
+	"design.length",
+	"design.length.overall",
+	"design.length.hull",
+	"design.length.waterline",
+	"design.keel.type",
+	"design.keel.angle",
+	"design.keel.lift",
+	"design.beam",
+	"design.airHeight",
+	"design.rigging.type",
+	"design.rigging.masts",
+
+	"navigation.lights",
+	"navigation.courseOverGroundMagnetic",
+	"navigation.courseOverGroundTrue",
+	"navigation.course.startTime",
+	"navigation.course.targetArrivalTime",
+	"navigation.course.arrivalCircle",
+	"navigation.course.activeRoute",
+	"navigation.course.nextPoint",
+	"navigation.course.previousPoint",
+	"navigation.course.calcValues.calcMethod",
+	"navigation.course.calcValues.crossTrackError",
+	"navigation.course.calcValues.bearingTrackTrue",
+	"navigation.course.calcValues.bearingTrackMagnetic",
+	"navigation.course.calcValues.estimatedTimeOfArrival",
+	"navigation.course.calcValues.distance",
+	"navigation.course.calcValues.bearingTrue",
+	"navigation.course.calcValues.bearingMagnetic",
+	"navigation.course.calcValues.velocityMadeGood",
+	"navigation.course.calcValues.timeToGo",
+	"navigation.magneticVariation",
+	"navigation.magneticVariationAgeOfService",
+	"navigation.destination.commonName",
+	"navigation.destination.eta",
+	"navigation.destination.waypoint",
+	"navigation.gnss.type",
+	"navigation.gnss.methodQuality",
+	"navigation.gnss.integrity",
+	"navigation.gnss.satellites",
+	"navigation.gnss.antennaAltitude",
+	"navigation.gnss.horizontalDilution",
+	"navigation.gnss.positionDilution",
+	"navigation.gnss.geoidalSeparation",
+	"navigation.gnss.differentialAge",
+	"navigation.gnss.differentialReference",
+	"navigation.gnss.satellitesInView",
+	"navigation.headingMagnetic",
+	"navigation.magneticDeviation",
+	"navigation.headingCompass",
+	"navigation.headingTrue",
+	"navigation.position",
+	"navigation.attitude",
+	"navigation.attitude.roll",
+	"navigation.attitude.pitch",
+	"navigation.attitude.yaw",
+	"navigation.maneuver",
+	"navigation.rateOfTurn",
+	"navigation.speedOverGround",
+	"navigation.speedThroughWater",
+	"navigation.speedThroughWaterTransverse",
+	"navigation.speedThroughWaterLongitudinal",
+	"navigation.leewayAngle",
+	"navigation.log",
+	"navigation.trip.log",
+	"navigation.trip.lastReset",
+	"navigation.state",
+	"navigation.anchor.maxRadius",
+	"navigation.anchor.currentRadius",
+	"navigation.anchor.position",
+	"navigation.datetime",
+
+	"environment.outside.temperature",
+	"environment.outside.dewPointTemperature",
+	"environment.outside.apparentWindChillTemperature",
+	"environment.outside.theoreticalWindChillTemperature",
+	"environment.outside.heatIndexTemperature",
+	"environment.outside.pressure",
+	"environment.outside.humidity",
+	"environment.outside.relativeHumidity",
+	"environment.outside.airDensity",
+	"environment.outside.illuminance",
+	"environment.inside.temperature",
+	"environment.inside.heatIndexTemperature",
+	"environment.inside.pressure",
+	"environment.inside.relativeHumidity",
+	"environment.inside.dewPoint",
+	"environment.inside.airDensity",
+	"environment.inside.illuminance",
+	"environment.inside.*.temperature",
+	"environment.inside.*.heatIndexTemperature",
+	"environment.inside.*.pressure",
+	"environment.inside.*.relativeHumidity",
+	"environment.inside.*.dewPoint",
+	"environment.inside.*.airDensity",
+	"environment.inside.*.illuminance",
+	"environment.inside.auxiliaries.*.temperature", // the compartment of an auxiliary engine
+	"environment.inside.auxiliaries.*.pressure",
+	"environment.water.temperature",
+	"environment.water.salinity",
+	"environment.depth.belowKeel",
+	"environment.depth.belowTransducer",
+	"environment.depth.belowSurface",
+	"environment.depth.transducerToKeel",
+	"environment.depth.surfaceToTransducer",
+	"environment.current",
+	"environment.current.drift",
+	"environment.current.setTrue",
+	"environment.current.setMagnetic",
+	"environment.tide.heightHigh",
+	"environment.tide.heightNow",
+	"environment.tide.heightLow",
+	"environment.tide.timeLow",
+	"environment.tide.timeHigh",
+	"environment.heave",
+	"environment.wind.angleApparent",
+	"environment.wind.angleTrueGround",
+	"environment.wind.angleTrueWater",
+	"environment.wind.directionChangeAlarm",
+	"environment.wind.directionTrue",
+	"environment.wind.directionMagnetic",
+	"environment.wind.speedTrue",
+	"environment.wind.speedOverGround",
+	"environment.wind.speedApparent",
+	"environment.time.millis",
+	"environment.time.timezoneOffset",
+	"environment.time.timezoneRegion",
+	"environment.mode",
+
+	"propulsion.*.label",
+	"propulsion.*.state",
+	"propulsion.*.revolutions",
+	"propulsion.*.temperature",
+	"propulsion.*.oilTemperature",
+	"propulsion.*.oilPressure",
+	"propulsion.*.oilLevel",
+	"propulsion.*.alternatorVoltage",
+	"propulsion.*.runTime",
+	"propulsion.*.coolantTemperature",
+	"propulsion.*.coolantPressure",
+	"propulsion.*.coolantLevel",
+	"propulsion.*.boostPressure",
+	"propulsion.*.intakeManifoldTemperature",
+	"propulsion.*.intakeManifoldPressure",
+	"propulsion.*.engineLoad",
+	"propulsion.*.engineTorque",
+	"propulsion.*.exhaustTemperature",
+	"propulsion.*.transmission.gear",
+	"propulsion.*.transmission.gearRatio",
+	"propulsion.*.transmission.oilTemperature",
+	"propulsion.*.transmission.oilPressure",
+	"propulsion.*.drive.type",
+	"propulsion.*.drive.trimState",
+	"propulsion.*.drive.thrustAngle",
+	"propulsion.*.drive.propeller",
+	"propulsion.*.drive.power",
+	"propulsion.*.drive.torque",
+	"propulsion.*.fuel.type",
+	"propulsion.*.fuel.used",
+	"propulsion.*.fuel.pressure",
+	"propulsion.*.fuel.rate",
+	"propulsion.*.fuel.economyRate",
+	"propulsion.*.fuel.averageRate",
+
+	// generators and other auxiliary engines
+	"auxiliaries.*.label",
+	"auxiliaries.*.state",
+	"auxiliaries.*.revolutions",
+	"auxiliaries.*.temperature",
+	"auxiliaries.*.oilTemperature",
+	"auxiliaries.*.oilPressure",
+	"auxiliaries.*.oilLevel",
+	"auxiliaries.*.runTime",
+	"auxiliaries.*.coolantTemperature",
+	"auxiliaries.*.coolantPressure",
+	"auxiliaries.*.coolantLevel",
+	"auxiliaries.*.boostPressure",
+	"auxiliaries.*.intakeManifoldTemperature",
+	"auxiliaries.*.intakeManifoldPressure",
+	"auxiliaries.*.engineLoad",
+	"auxiliaries.*.engineTorque",
+	"auxiliaries.*.exhaustTemperature",
+	"auxiliaries.*.fuel.used",
+	"auxiliaries.*.fuel.rate",
+
+	"electrical.*.*.name",
+	"electrical.*.*.location",
+	"electrical.*.*.dateInstalled",
+	"electrical.*.*.voltage",
+	"electrical.*.*.current",
+	"electrical.*.*.temperature",
+	"electrical.*.*.chargingMode",
+	"electrical.*.*.inverterMode",
+	"electrical.*.*.revolutions",
+	"electrical.*.*.pulleyRatio",
+	"electrical.*.*.fieldDrive",
+	"electrical.*.*.regulatorTemperature",
+	"electrical.*.*.panelVoltage",
+	"electrical.*.*.panelCurrent",
+	"electrical.*.*.panelPower",
+	"electrical.*.*.controllerMode",
+	"electrical.*.*.chemistry",
+	"electrical.*.*.lifetimeDischarge",
+	"electrical.*.*.lifetimeRecharge",
+	"electrical.*.*.capacity.nominal",
+	"electrical.*.*.capacity.actual",
+	"electrical.*.*.capacity.remaining",
+	"electrical.*.*.capacity.dischargeLimit",
+	"electrical.*.*.capacity.stateOfCharge",
+	"electrical.*.*.capacity.stateOfHealth",
+	"electrical.*.*.capacity.dischargeSinceFull",
+	"electrical.*.*.capacity.timeRemaining",
+	"electrical.*.*.phase.*.current",
+	"electrical.*.*.phase.*.lineNeutralVoltage",
+	"electrical.*.*.phase.*.lineLineVoltage",
+	"electrical.*.*.phase.*.frequency",
+	"electrical.*.*.phase.*.realPower",
+	"electrical.*.*.phase.*.reactivePower",
+	"electrical.*.*.phase.*.powerFactor",
+	"electrical.*.*.phase.*.apparentPower",
+
+	"tanks.*.*.name",
+	"tanks.*.*.type",
+	"tanks.*.*.capacity",
+	"tanks.*.*.currentLevel",
+	"tanks.*.*.currentVolume",
+	"tanks.*.*.pressure",
+	"tanks.*.*.temperature",
+	"tanks.*.*.viscosity",
+	"tanks.*.*.extinguishThreshold",
+
+	"steering.rudderAngle",
+	"steering.rudderAngleTarget",
+	"steering.autopilot.state",
+	"steering.autopilot.mode",
+	"steering.autopilot.target.windAngleApparent",
+	"steering.autopilot.target.headingTrue",
+	"steering.autopilot.target.headingMagnetic",
+	"steering.autopilot.deadZone",
+	"steering.autopilot.backlash",
+	"steering.autopilot.gain",
+	"steering.autopilot.maxDriveCurrent",
+	"steering.autopilot.maxDriveRate",
+	"steering.autopilot.portLock",
+	"steering.autopilot.starboardLock",
+
+	"performance.activePolar",
+	"performance.polarSpeed",
+	"performance.polarSpeedRatio",
+	"performance.velocityMadeGood",
+	"performance.velocityMadeGoodToWaypoint",
+	"performance.beatAngle",
+	"performance.beatAngleVelocityMadeGood",
+	"performance.beatAngleTargetSpeed",
+	"performance.gybeAngle",
+	"performance.gybeAngleVelocityMadeGood",
+	"performance.gybeAngleTargetSpeed",
+	"performance.targetAngle",
+	"performance.targetSpeed",
+	"performance.leeway",
+	"performance.tackMagnetic",
+	"performance.tackTrue",
+
+	"sails.inventory.*.name",
+	"sails.inventory.*.type",
+	"sails.inventory.*.material",
+	"sails.inventory.*.brand",
+	"sails.inventory.*.active",
+	"sails.inventory.*.area",
+	"sails.inventory.*.minimumWind",
+	"sails.inventory.*.maximumWind",
+	"sails.area.total",
+	"sails.area.active",
+
+	"sensors.*.name",
+	"sensors.*.sensorType",
+	"sensors.*.sensorData",
+	"sensors.*.fromBow",
+	"sensors.*.fromCenter",
+
+	"cargo.total.capacity",
+	"cargo.total.currentLevel",
+	"cargo.tank.*.capacity",
+	"cargo.tank.*.currentLevel",
+	"cargo.tank.*.density",
+	"cargo.tank.*.temperature",
+	"cargo.hold.*.capacity",
+	"cargo.hold.*.currentLevel",
+
+	"event.voyage",
+	"event.voyage.duration",
+	"event.leg",
+	"event.leg.type",
+	"event.leg.duration",
+	"event.leg.distance",
+	"event.leg.position",
+	"event.leg.fuelConsumption",
+	"event.leg.cargo",
+	"event.loading",
+	"event.loading.duration",
+	"event.loading.position",
+	"event.loading.fuelConsumption",
+	"event.loading.cargo",
+	"event.loading.delta",
+	"event.bunkering",
+	"event.bunkering.duration",
+	"event.bunkering.position",
+	"event.bunkering.currentVolume",
+	"event.bunkering.delta",
+}
+
+var knownPathsSchema = sync.OnceValue(func() *Schema {
+	s := NewSchema()
+	for _, p := range knownPaths {
+		s.Add(&PathSchema{Path: p})
+	}
+	return s
+})
+
+// KnownPath is true when the path is in the SignalK specification, is one of the paths GOSK adds or is in the schema of this
+// process. Notifications can have any path.
+func KnownPath(path string) bool {
+	if strings.HasPrefix(path, "notifications.") {
+		return true
+	}
+	if _, ok := knownPathsSchema().Lookup(path); ok {
+		return true
+	}
+	_, ok := GetSchema().Lookup(path)
+	return ok
+}
@@ -0,0 +1,40 @@
+package message_test
+
+import (
+	. "github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KnownPath", func() {
+	DescribeTable("knows the paths of the SignalK specification and the paths GOSK adds",
+		func(path string, known bool) {
+			Expect(KnownPath(path)).To(Equal(known))
+		},
+		Entry("a path", "navigation.speedOverGround", true),
+		Entry("a path with an identifier", "propulsion.mainEngine.revolutions", true),
+		Entry("a path with two identifiers", "tanks.fuel.portAft.currentVolume", true),
+		Entry("a property of an object value", "design.draft.current", true),
+		Entry("an object value", "navigation.attitude", true),
+		Entry("a path GOSK adds", "cargo.tank.forward1.density", true),
+		Entry("an event", "event.leg.fuelConsumption", true),
+		Entry("an auxiliary engine", "auxiliaries.generatorPortAft.engineTorque", true),
+		Entry("any notification", "notifications.tanks.fuel.level", true),
+		Entry("a misspelled leaf", "navigation.speedOverGrund", false),
+		Entry("a misspelled leaf with an identifier", "propulsion.mainEngine.revolution", false),
+		Entry("a misspelled leaf with two identifiers", "tanks.fuel.portAft.curentLevel", false),
+		Entry("a misspelled leaf of a path GOSK adds", "event.leg.fuelConsumptoin", false),
+		Entry("a leaf with the wrong case", "environment.outside.Temperature", false),
+		Entry("a missing identifier", "propulsion.revolutions", false),
+		Entry("an extra segment", "navigation.speedOverGround.value", false),
+		Entry("a group", "navigation", false),
+		Entry("an unknown group", "test.aggregate", false),
+		Entry("only the notifications group", "notifications", false),
+	)
+	It("knows the paths of the schema", func() {
+		defer SetSchema(GetSchema())
+		Expect(KnownPath("propulsion.mainEngine.fuel.totalUsed")).To(BeFalse())
+		SetSchema(DefaultSchema().Add(&PathSchema{Path: "propulsion.*.fuel.totalUsed", Kind: KindNumber}))
+		Expect(KnownPath("propulsion.mainEngine.fuel.totalUsed")).To(BeTrue())
+	})
+})
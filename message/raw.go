@@ -11,11 +11,11 @@ import (
 )
 
 type Raw struct {
-	Connector string    `json:"connector"`
-	Timestamp time.Time `json:"timestamp"`
-	Type      string    `json:"type"`
-	Uuid      uuid.UUID `json:"uuid"`
-	Value     []byte    `json:"value"`
+	Connector string    `json:"connector" cbor:"1,keyasint"`
+	Timestamp time.Time `json:"timestamp" cbor:"2,keyasint"`
+	Type      string    `json:"type" cbor:"3,keyasint"`
+	Uuid      uuid.UUID `json:"uuid" cbor:"4,keyasint"`
+	Value     []byte    `json:"value" cbor:"5,keyasint"`
 }
 
 func NewRaw() *Raw {
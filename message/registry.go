@@ -0,0 +1,103 @@
+package message
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// A struct or enum type of values, the kind and the tag tell which type a value has
+type ValueType struct {
+	Kind  Kind  // the name of the type in the schema
+	Tag   uint8 // the type tag in the binary format, it is part of the format and should never change
+	Type  reflect.Type
+	Paths []string // the paths that have values of this type, a * matches exactly one segment of the path
+}
+
+// the first tag that can be used by a registered type, the lower tags are used for numbers, strings and booleans
+const firstRegisteredTag = tagPosition
+
+var (
+	valueTypesMutex sync.RWMutex
+	valueTypes      []*ValueType
+	valueTypeByKind = make(map[Kind]*ValueType)
+	valueTypeByTag  = make(map[uint8]*ValueType)
+	valueTypeByType = make(map[reflect.Type]*ValueType)
+)
+
+// Registers a type of values, types are guessed in the order they are registered when a value has a path without a type
+func RegisterValueType[T Merger](kind Kind, tag uint8, paths ...string) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	valueTypesMutex.Lock()
+	defer valueTypesMutex.Unlock()
+	if kind == KindNumber || kind == KindString || kind == "" {
+		panic(fmt.Sprintf("the kind of %s is reserved", t))
+	}
+	if tag < firstRegisteredTag {
+		panic(fmt.Sprintf("the tag %d of %s is reserved", tag, t))
+	}
+	if _, ok := valueTypeByKind[kind]; ok {
+		panic(fmt.Sprintf("the kind %s of %s is already registered", kind, t))
+	}
+	if _, ok := valueTypeByTag[tag]; ok {
+		panic(fmt.Sprintf("the tag %d of %s is already registered", tag, t))
+	}
+	if _, ok := valueTypeByType[t]; ok {
+		panic(fmt.Sprintf("%s is already registered", t))
+	}
+	result := &ValueType{Kind: kind, Tag: tag, Type: t, Paths: paths}
+	valueTypes = append(valueTypes, result)
+	valueTypeByKind[kind] = result
+	valueTypeByTag[tag] = result
+	valueTypeByType[t] = result
+}
+
+// The registered types in the order they are registered
+func ValueTypes() []*ValueType {
+	valueTypesMutex.RLock()
+	defer valueTypesMutex.RUnlock()
+	return append([]*ValueType(nil), valueTypes...)
+}
+
+func LookupValueType(kind Kind) (*ValueType, bool) {
+	valueTypesMutex.RLock()
+	defer valueTypesMutex.RUnlock()
+	t, ok := valueTypeByKind[kind]
+	return t, ok
+}
+
+func lookupValueTypeByTag(tag uint8) (*ValueType, bool) {
+	valueTypesMutex.RLock()
+	defer valueTypesMutex.RUnlock()
+	t, ok := valueTypeByTag[tag]
+	return t, ok
+}
+
+func lookupValueTypeOf(value interface{}) (*ValueType, bool) {
+	valueTypesMutex.RLock()
+	defer valueTypesMutex.RUnlock()
+	t, ok := valueTypeByType[reflect.TypeOf(value)]
+	return t, ok
+}
+
+func init() {
+	RegisterValueType[Position](KindPosition, tagPosition, "navigation.position")
+	RegisterValueType[VesselInfo](KindVesselInfo, tagVesselInfo, "")
+	RegisterValueType[VesselType](KindVesselType, tagVesselType, "design.aisShipType")
+	RegisterValueType[Length](KindLength, tagLength, "design.length")
+	RegisterValueType[Notification](KindNotification, tagNotification)
+	RegisterValueType[Notifications](KindNotifications, tagNotifications)
+	RegisterValueType[AlarmNotification](KindAlarmNotification, tagAlarmNotification)
+	RegisterValueType[Draft](KindDraft, tagDraft, "design.draft")
+	RegisterValueType[Spectrum](KindSpectrum, tagSpectrum)
+	RegisterValueType[Vector3D](KindVector3D, tagVector3D)
+	RegisterValueType[Attitude](KindAttitude, tagAttitude, "navigation.attitude")
+	RegisterValueType[Current](KindCurrent, tagCurrent, "environment.current")
+	RegisterValueType[SatellitesInView](KindSatellitesInView, tagSatellitesInView, "navigation.gnss.satellitesInView")
+	RegisterValueType[CoursePoint](KindCoursePoint, tagCoursePoint, "navigation.course.nextPoint", "navigation.course.previousPoint")
+	RegisterValueType[ActiveRoute](KindActiveRoute, tagActiveRoute, "navigation.course.activeRoute")
+	RegisterValueType[EngineState](KindEngineState, tagEngineState, "propulsion.*.state")
+
+	// the default schema contains the paths of the value types
+	currentSchema = DefaultSchema()
+}
@@ -0,0 +1,74 @@
+package message_test
+
+import (
+	. "github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	DescribeTable(
+		"Decode guesses the type",
+		func(input interface{}, expected interface{}) {
+			result, err := Decode(input)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("a vector", map[string]interface{}{"x": 1.0, "y": 2.0, "z": 3.0}, Vector3D{X: 1, Y: 2, Z: 3}),
+		Entry("an attitude", map[string]interface{}{"roll": 0.1, "pitch": 0.2}, Attitude{Roll: ptr(0.1), Pitch: ptr(0.2)}),
+		Entry("a current", map[string]interface{}{"drift": 0.5, "setTrue": 1.0}, Current{Drift: ptr(0.5), SetTrue: ptr(1.0)}),
+		Entry("notifications", []interface{}{map[string]interface{}{"message": "a"}}, Notifications{{Message: ptrString("a")}}),
+	)
+	It("does not guess the type of an empty object", func() {
+		_, err := Decode(map[string]interface{}{})
+		Expect(err).To(HaveOccurred())
+	})
+	It("does not guess enums", func() {
+		result, err := Decode("started")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal("started"))
+	})
+
+	DescribeTable(
+		"Coerce uses the type of the path",
+		func(path string, input interface{}, expected interface{}) {
+			result, err := GetSchema().Coerce(path, input)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("an engine state", "propulsion.mainEngine.state", "started", EngineStateStarted),
+		Entry("an empty position", "navigation.position", map[string]interface{}{}, Position{}),
+		Entry("a course point", "navigation.course.nextPoint", map[string]interface{}{"type": "Location", "position": map[string]interface{}{"latitude": 52.0}},
+			CoursePoint{Type: ptrString("Location"), Position: &Position{Latitude: ptr(52.0)}}),
+		Entry("satellites", "navigation.gnss.satellitesInView", map[string]interface{}{"count": 1, "satellites": []interface{}{map[string]interface{}{"id": 5, "SNR": 40.0}}},
+			SatellitesInView{Count: ptrInt(1), Satellites: []Satellite{{Id: 5, SNR: ptr(40.0)}}}),
+	)
+	It("rejects an unknown engine state", func() {
+		_, err := GetSchema().Coerce("propulsion.mainEngine.state", "running")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("merges registered types", func() {
+		result, err := Attitude{Roll: ptr(0.1), Yaw: ptr(0.3)}.Merge(Attitude{Roll: ptr(0.2)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(Attitude{Roll: ptr(0.2), Yaw: ptr(0.3)}))
+	})
+	It("refuses a kind that is already registered", func() {
+		Expect(func() { RegisterValueType[Attitude](KindPosition, 200) }).To(Panic())
+	})
+	It("refuses a reserved tag", func() {
+		Expect(func() { RegisterValueType[Attitude]("other", 1) }).To(Panic())
+	})
+
+	It("keeps enums in the binary format", func() {
+		var result Mapped
+		bytes, err := MarshalBinary(NewMapped().AddUpdate(NewUpdate().AddValue(NewValue().WithPath("propulsion.mainEngine.state").WithValue(EngineStateStopped))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(UnmarshalBinary(bytes, &result)).To(Succeed())
+		Expect(result.Updates[0].Values[0].Value).To(Equal(EngineStateStopped))
+	})
+})
+
+func ptrInt(i int) *int {
+	return &i
+}
@@ -0,0 +1,286 @@
+package message
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// The type of the value of a path, numbers and strings are built in, the other kinds are registered value types
+type Kind string
+
+const (
+	KindNumber            Kind = "number"
+	KindString            Kind = "string"
+	KindPosition          Kind = "position"
+	KindVesselInfo        Kind = "vesselInfo"
+	KindVesselType        Kind = "vesselType"
+	KindLength            Kind = "length"
+	KindNotification      Kind = "notification"
+	KindNotifications     Kind = "notifications"
+	KindAlarmNotification Kind = "alarmNotification"
+	KindDraft             Kind = "draft"
+	KindSpectrum          Kind = "spectrum"
+	KindVector3D          Kind = "vector3D"
+	KindAttitude          Kind = "attitude"
+	KindCurrent           Kind = "current"
+	KindSatellitesInView  Kind = "satellitesInView"
+	KindCoursePoint       Kind = "coursePoint"
+	KindActiveRoute       Kind = "activeRoute"
+	KindEngineState       Kind = "engineState"
+)
+
+func (k Kind) Valid() bool {
+	_, ok := LookupValueType(k)
+	return ok || k == KindNumber || k == KindString
+}
+
+// A range of values with the state of the path, see the zones of the SignalK specification
+type Zone struct {
+	Lower   *float64 `json:"lower,omitempty"`
+	Upper   *float64 `json:"upper,omitempty"`
+	State   string   `json:"state"`
+	Message string   `json:"message,omitempty"`
+}
+
+// The meta data of a path as served in the SignalK data model
+type Meta struct {
+	Units       string `json:"units,omitempty"`
+	Description string `json:"description,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Zones       []Zone `json:"zones,omitempty"`
+}
+
+type PathSchema struct {
+	Path string // a * matches exactly one segment of the path
+	Kind Kind   // any value is accepted when empty
+	Meta Meta
+}
+
+// The expected type and meta data per path, paths that are not in the schema accept any value
+type Schema struct {
+	exact    map[string]*PathSchema
+	patterns []*PathSchema
+}
+
+func NewSchema() *Schema {
+	return &Schema{exact: make(map[string]*PathSchema)}
+}
+
+// Adds the path to the schema, a path that is already in the schema is replaced
+func (s *Schema) Add(p *PathSchema) *Schema {
+	if !strings.Contains(p.Path, "*") {
+		s.exact[p.Path] = p
+		return s
+	}
+	for i, existing := range s.patterns {
+		if existing.Path == p.Path {
+			s.patterns[i] = p
+			return s
+		}
+	}
+	s.patterns = append(s.patterns, p)
+	return s
+}
+
+// Exact paths take precedence over patterns, the pattern added last wins when more patterns match
+func (s *Schema) Lookup(path string) (*PathSchema, bool) {
+	if p, ok := s.exact[path]; ok {
+		return p, true
+	}
+	segments := strings.Split(path, ".")
+	for i := len(s.patterns) - 1; i >= 0; i-- {
+		if matchSegments(strings.Split(s.patterns[i].Path, "."), segments) {
+			return s.patterns[i], true
+		}
+	}
+	return nil, false
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Decodes the value with the type of the path, values of unknown paths are decoded by guessing the type. Only values
+// without a kind are decoded by path, e.g. the values of messages of older publishers.
+func (s *Schema) Decode(path string, input interface{}) (interface{}, error) {
+	p, ok := s.Lookup(path)
+	if !ok || p.Kind == "" {
+		return Decode(input)
+	}
+	return decodeKind(p.Kind, input)
+}
+
+// Returns an error when the value doesn't have the type of the path
+func (s *Schema) Validate(path string, value interface{}) error {
+	_, err := s.Coerce(path, value)
+	return err
+}
+
+// Returns the value with the type of the path, maps created by expressions are decoded to the struct of the path
+func (s *Schema) Coerce(path string, value interface{}) (interface{}, error) {
+	p, ok := s.Lookup(path)
+	if !ok || p.Kind == "" {
+		return value, nil
+	}
+	switch p.Kind {
+	case KindNumber:
+		f, ok := toFloat(value)
+		if !ok {
+			return value, fmt.Errorf("the value of %s should be a number but is %T", path, value)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return value, fmt.Errorf("the value of %s is %v", path, f)
+		}
+		return value, nil
+	case KindString:
+		if _, ok := value.(string); !ok {
+			return value, fmt.Errorf("the value of %s should be a string but is %T", path, value)
+		}
+		return value, nil
+	}
+	result, err := decodeKind(p.Kind, value)
+	if err != nil {
+		return value, fmt.Errorf("the value of %s should be a %s but is %T", path, p.Kind, value)
+	}
+	if v, ok := result.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return value, fmt.Errorf("the value of %s is invalid: %w", path, err)
+		}
+	}
+	return result, nil
+}
+
+func decodeKind(kind Kind, input interface{}) (interface{}, error) {
+	switch kind {
+	case KindNumber:
+		if _, ok := toFloat(input); ok {
+			return input, nil
+		}
+		return input, fmt.Errorf("can't decode %v as a number", input)
+	case KindString:
+		if _, ok := input.(string); ok {
+			return input, nil
+		}
+		return input, fmt.Errorf("can't decode %v as a string", input)
+	}
+	t, ok := LookupValueType(kind)
+	if !ok {
+		return input, fmt.Errorf("unknown kind %s", kind)
+	}
+	if reflect.TypeOf(input) == t.Type {
+		return input, nil
+	}
+	result := reflect.New(t.Type)
+	metadata := mapstructure.Metadata{}
+	if err := mapstructure.DecodeMetadata(input, result.Interface(), &metadata); err != nil {
+		return input, fmt.Errorf("can't decode %v as a %s: %w", input, kind, err)
+	}
+	if len(metadata.Unused) != 0 {
+		return input, fmt.Errorf("can't decode %v as a %s, unknown keys %v", input, kind, metadata.Unused)
+	}
+	return result.Elem().Interface(), nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+	return 0, false
+}
+
+var (
+	schemaMutex   sync.RWMutex
+	currentSchema *Schema // set after the built in value types are registered
+)
+
+// The schema used to decode and validate values in this process
+func GetSchema() *Schema {
+	schemaMutex.RLock()
+	defer schemaMutex.RUnlock()
+	return currentSchema
+}
+
+func SetSchema(s *Schema) {
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+	currentSchema = s
+}
+
+// The paths of the registered value types and the paths of the SignalK specification used by gosk, units are SI as in the
+// specification
+func DefaultSchema() *Schema {
+	s := NewSchema()
+	for _, t := range ValueTypes() {
+		for _, p := range t.Paths {
+			s.Add(&PathSchema{Path: p, Kind: t.Kind})
+		}
+	}
+	for _, p := range []*PathSchema{
+		{Path: "design.length", Kind: KindLength, Meta: Meta{Units: "m", Description: "The various lengths of the vessel"}},
+		{Path: "design.draft", Kind: KindDraft, Meta: Meta{Units: "m", Description: "The draft of the vessel"}},
+		{Path: "design.aisShipType", Kind: KindVesselType, Meta: Meta{Description: "The ais ship type"}},
+		{Path: "navigation.position", Kind: KindPosition, Meta: Meta{Description: "The position of the vessel in 2 or 3 dimensions (WGS84 datum)"}},
+		{Path: "navigation.speedOverGround", Kind: KindNumber, Meta: Meta{Units: "m/s", Description: "Vessel speed over ground", DisplayName: "SOG"}},
+		{Path: "navigation.speedThroughWater", Kind: KindNumber, Meta: Meta{Units: "m/s", Description: "Vessel speed through the water", DisplayName: "STW"}},
+		{Path: "navigation.courseOverGroundTrue", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "Course over ground (true)", DisplayName: "COG"}},
+		{Path: "navigation.courseOverGroundMagnetic", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "Course over ground (magnetic)"}},
+		{Path: "navigation.headingTrue", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "The current true north heading of the vessel", DisplayName: "HDG"}},
+		{Path: "navigation.headingMagnetic", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "Current magnetic heading of the vessel"}},
+		{Path: "navigation.rateOfTurn", Kind: KindNumber, Meta: Meta{Units: "rad/s", Description: "Rate of turn (+ve is change to starboard)", DisplayName: "ROT"}},
+		{Path: "navigation.log", Kind: KindNumber, Meta: Meta{Units: "m", Description: "Total distance traveled"}},
+		{Path: "navigation.trip.log", Kind: KindNumber, Meta: Meta{Units: "m", Description: "Total distance traveled on this trip"}},
+		{Path: "environment.depth.belowTransducer", Kind: KindNumber, Meta: Meta{Units: "m", Description: "Depth below Transducer"}},
+		{Path: "environment.depth.belowKeel", Kind: KindNumber, Meta: Meta{Units: "m", Description: "Depth below keel"}},
+		{Path: "environment.depth.belowSurface", Kind: KindNumber, Meta: Meta{Units: "m", Description: "Depth from surface"}},
+		{Path: "environment.wind.speedApparent", Kind: KindNumber, Meta: Meta{Units: "m/s", Description: "Apparent wind speed", DisplayName: "AWS"}},
+		{Path: "environment.wind.angleApparent", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "Apparent wind angle, negative to port", DisplayName: "AWA"}},
+		{Path: "environment.wind.speedTrue", Kind: KindNumber, Meta: Meta{Units: "m/s", Description: "Wind speed over water", DisplayName: "TWS"}},
+		{Path: "environment.wind.angleTrueWater", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "True wind angle based on speed through water, negative to port", DisplayName: "TWA"}},
+		{Path: "environment.water.temperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Current water temperature"}},
+		{Path: "environment.outside.temperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Current outside air temperature"}},
+		{Path: "environment.outside.pressure", Kind: KindNumber, Meta: Meta{Units: "Pa", Description: "Current outside air ambient pressure"}},
+		{Path: "environment.outside.relativeHumidity", Kind: KindNumber, Meta: Meta{Units: "ratio", Description: "Current outside air relative humidity"}},
+		{Path: "propulsion.*.revolutions", Kind: KindNumber, Meta: Meta{Units: "Hz", Description: "Engine revolutions (x60 for RPM)"}},
+		{Path: "propulsion.*.temperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Engine temperature"}},
+		{Path: "propulsion.*.coolantTemperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Engine coolant temperature"}},
+		{Path: "propulsion.*.oilTemperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Oil temperature"}},
+		{Path: "propulsion.*.oilPressure", Kind: KindNumber, Meta: Meta{Units: "Pa", Description: "Oil pressure"}},
+		{Path: "propulsion.*.exhaustTemperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Exhaust temperature"}},
+		{Path: "propulsion.*.runTime", Kind: KindNumber, Meta: Meta{Units: "s", Description: "Total running time for engine (Engine Hours in seconds)"}},
+		{Path: "propulsion.*.engineLoad", Kind: KindNumber, Meta: Meta{Units: "ratio", Description: "Engine load ratio, 0<=ratio<=1, 1 is 100%"}},
+		{Path: "propulsion.*.fuel.rate", Kind: KindNumber, Meta: Meta{Units: "m3/s", Description: "Fuel rate of consumption"}},
+		{Path: "electrical.batteries.*.voltage", Kind: KindNumber, Meta: Meta{Units: "V", Description: "Voltage measured at or as close as possible to the device"}},
+		{Path: "electrical.batteries.*.current", Kind: KindNumber, Meta: Meta{Units: "A", Description: "Current flowing out (+ve) or in (-ve) to the device"}},
+		{Path: "electrical.batteries.*.temperature", Kind: KindNumber, Meta: Meta{Units: "K", Description: "Temperature measured within or on the device"}},
+		{Path: "electrical.batteries.*.capacity.stateOfCharge", Kind: KindNumber, Meta: Meta{Units: "ratio", Description: "State of charge, 1 = 100%"}},
+		{Path: "tanks.*.*.currentLevel", Kind: KindNumber, Meta: Meta{Units: "ratio", Description: "Level of fluid in tank 0-100%"}},
+		{Path: "tanks.*.*.currentVolume", Kind: KindNumber, Meta: Meta{Units: "m3", Description: "Volume of fluid in tank"}},
+		{Path: "tanks.*.*.capacity", Kind: KindNumber, Meta: Meta{Units: "m3", Description: "Total capacity"}},
+		{Path: "navigation.attitude", Kind: KindAttitude, Meta: Meta{Units: "rad", Description: "Vessel attitude: roll, pitch and yaw"}},
+		{Path: "navigation.gnss.satellitesInView", Kind: KindSatellitesInView, Meta: Meta{Description: "Satellites in view"}},
+		{Path: "environment.current", Kind: KindCurrent, Meta: Meta{Description: "Direction and strength of current affecting the vessel"}},
+		{Path: "propulsion.*.state", Kind: KindEngineState, Meta: Meta{Description: "The current state of the engine"}},
+		{Path: "steering.rudderAngle", Kind: KindNumber, Meta: Meta{Units: "rad", Description: "Current rudder angle, +ve is rudder to Starboard"}},
+	} {
+		s.Add(p)
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package message_test
+
+import (
+	"encoding/json"
+	"math"
+
+	. "github.com/munnik/gosk/message"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schema", func() {
+	var schema *Schema
+	BeforeEach(func() {
+		schema = DefaultSchema().Add(&PathSchema{Path: "propulsion.mainEngine.revolutions", Meta: Meta{DisplayName: "Main engine"}})
+	})
+
+	Describe("Lookup", func() {
+		It("matches a segment with a wildcard", func() {
+			p, ok := schema.Lookup("propulsion.auxEngine.revolutions")
+			Expect(ok).To(BeTrue())
+			Expect(p.Kind).To(Equal(KindNumber))
+			Expect(p.Meta.Units).To(Equal("Hz"))
+		})
+		It("prefers an exact path", func() {
+			p, ok := schema.Lookup("propulsion.mainEngine.revolutions")
+			Expect(ok).To(BeTrue())
+			Expect(p.Meta.DisplayName).To(Equal("Main engine"))
+		})
+		It("does not match paths with more segments", func() {
+			_, ok := schema.Lookup("propulsion.mainEngine.revolutions.extra")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	DescribeTable(
+		"Decode",
+		func(path string, input interface{}, expected interface{}, fails bool) {
+			result, err := schema.Decode(path, input)
+			if fails {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("a position", "navigation.position", map[string]interface{}{"latitude": 52.0, "longitude": 5.0}, Position{Latitude: ptr(52.0), Longitude: ptr(5.0)}, false),
+		Entry("a number on a position path", "navigation.position", 52.0, nil, true),
+		Entry("a map with unknown keys", "navigation.position", map[string]interface{}{"lat": 52.0}, nil, true),
+		Entry("an empty map on a length path", "design.length", map[string]interface{}{}, Length{}, false),
+		Entry("a number", "navigation.speedOverGround", 2.0, 2.0, false),
+		Entry("a string on a number path", "navigation.speedOverGround", "fast", nil, true),
+		Entry("an unknown path", "testingPath", map[string]interface{}{"x": 1.0, "y": 2.0, "z": 3.0}, Vector3D{X: 1, Y: 2, Z: 3}, false),
+	)
+
+	DescribeTable(
+		"Validate",
+		func(path string, value interface{}, fails bool) {
+			if fails {
+				Expect(schema.Validate(path, value)).To(HaveOccurred())
+			} else {
+				Expect(schema.Validate(path, value)).NotTo(HaveOccurred())
+			}
+		},
+		Entry("a position", "navigation.position", Position{}, false),
+		Entry("a float on a position path", "navigation.position", 1.0, true),
+		Entry("an int", "navigation.speedOverGround", 2, false),
+		Entry("a uint16", "navigation.speedOverGround", uint16(2), false),
+		Entry("NaN", "navigation.speedOverGround", math.NaN(), true),
+		Entry("a position on a number path", "navigation.speedOverGround", Position{}, true),
+		Entry("any value on a path without a type", "propulsion.mainEngine.revolutions", "fast", false),
+		Entry("any value on an unknown path", "testingPath", Position{}, false),
+	)
+
+	It("decodes values by path when unmarshalling", func() {
+		var v Value
+		Expect(json.Unmarshal([]byte(`{"path":"design.length","value":{}}`), &v)).To(Succeed())
+		Expect(v.Value).To(Equal(Length{}))
+	})
+	DescribeTable("decodes values by their kind when unmarshalling",
+		func(path string, value interface{}) {
+			bytes, err := json.Marshal(NewValue().WithPath(path).WithValue(value))
+			Expect(err).NotTo(HaveOccurred())
+			var v Value
+			Expect(json.Unmarshal(bytes, &v)).To(Succeed())
+			Expect(v.Value).To(Equal(value))
+
+			bytes, err = json.Marshal(SingleValueMapped{Path: path, Value: value})
+			Expect(err).NotTo(HaveOccurred())
+			var svm SingleValueMapped
+			Expect(json.Unmarshal(bytes, &svm)).To(Succeed())
+			Expect(svm.Value).To(Equal(value))
+		},
+		Entry("a notification", "notifications.ais", Notification{State: func() *bool { b := true; return &b }(), Message: ptrString("AIS: Antenna VSWR exceeds limit")}),
+		Entry("an alarm notification", "notifications.engineTemperature", AlarmNotification{State: ptrString("alarm"), Method: []string{"visual"}, Message: ptrString("too hot")}),
+		Entry("notifications", "notifications.engine", Notifications{{Message: ptrString("too hot")}}),
+		Entry("a vector", "navigation.acceleration", Vector3D{X: 1, Y: 2, Z: 3}),
+		Entry("a spectrum", "propulsion.main.vibration.spectrum", Spectrum{NumberOfSamples: 2, FrequencyStepSize: 0.5, Duration: 1, Coefficients: []Coefficient{{Magnitude: 1, Phase: 0.5}}}),
+		Entry("a number", "navigation.speedOverGround", 3.5),
+	)
+	It("doesn't add a kind to numbers and strings", func() {
+		bytes, err := json.Marshal(NewValue().WithPath("navigation.speedOverGround").WithValue(3.5))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes).To(MatchJSON(`{"path":"navigation.speedOverGround","value":3.5}`))
+	})
+})
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -1,10 +1,15 @@
 package mqtt
 
 import (
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/munnik/gosk/config"
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
 	"go.uber.org/zap"
 )
@@ -19,6 +24,9 @@ type Client struct {
 	publishHandler paho.MessageHandler
 	topic          string
 	pahoClient     *paho.Client
+	handlers       sync.WaitGroup // the running publish handlers, Disconnect waits for them
+	connectionLost atomic.Int64   // unix nanoseconds, zero while connected
+	checkName      string         // the name of the readiness check
 }
 
 func New(config *config.MQTTConfig, publishHandler paho.MessageHandler, topic string) *Client {
@@ -26,6 +34,7 @@ func New(config *config.MQTTConfig, publishHandler paho.MessageHandler, topic st
 		config:         config,
 		publishHandler: publishHandler,
 		topic:          topic,
+		checkName:      health.InstanceName("mqtt", redact(config.URLString), topic),
 	}
 
 	pahoClient := paho.NewClient(result.createClientOptions())
@@ -38,6 +47,16 @@ func New(config *config.MQTTConfig, publishHandler paho.MessageHandler, topic st
 		return nil
 	}
 	result.pahoClient = &pahoClient
+	health.Register(result.checkName, func() error {
+		if !pahoClient.IsConnectionOpen() {
+			var since time.Time
+			if lost := result.connectionLost.Load(); lost != 0 {
+				since = time.Unix(0, lost)
+			}
+			return health.FailingSince(since, errors.New("not connected to the MQTT broker"))
+		}
+		return nil
+	})
 
 	return result
 }
@@ -53,8 +72,25 @@ func (c *Client) Publish(topic string, qos byte, retained bool, bytes []byte) {
 	}
 }
 
+// Disconnects after the work in progress is done and waits until the running publish handlers return
 func (c *Client) Disconnect() {
+	health.Unregister(c.checkName)
 	(*c.pahoClient).Disconnect(uint(disconnectWait.Milliseconds()))
+	c.handlers.Wait()
+}
+
+// removes the password from the url so it can be shown
+func redact(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
+}
+
+func (c *Client) handle(pahoClient paho.Client, m paho.Message) {
+	c.handlers.Add(1)
+	defer c.handlers.Done()
+	c.publishHandler(pahoClient, m)
 }
 
 func (c *Client) createClientOptions() *paho.ClientOptions {
@@ -67,9 +103,11 @@ func (c *Client) createClientOptions() *paho.ClientOptions {
 	result.SetKeepAlive(keepAlive)
 	result.SetAutoReconnect(true)
 
-	result.SetDefaultPublishHandler(c.publishHandler)
+	if c.publishHandler != nil {
+		result.SetDefaultPublishHandler(c.handle)
+	}
 	result.SetOnConnectHandler(c.onConnectHandler)
-	result.SetConnectionLostHandler(connectionLostHandler)
+	result.SetConnectionLostHandler(c.connectionLostHandler)
 
 	return result
 }
@@ -78,6 +116,7 @@ func (c *Client) onConnectHandler(pahoClient paho.Client) {
 	logger.GetLogger().Info(
 		"MQTT connection established",
 	)
+	c.connectionLost.Store(0)
 
 	if c.topic == "" {
 		logger.GetLogger().Info(
@@ -104,7 +143,8 @@ func (c *Client) onConnectHandler(pahoClient paho.Client) {
 	)
 }
 
-func connectionLostHandler(c paho.Client, e error) {
+func (c *Client) connectionLostHandler(_ paho.Client, e error) {
+	c.connectionLost.CompareAndSwap(0, time.Now().UnixNano())
 	if e != nil {
 		logger.GetLogger().Warn(
 			"MQTT connection lost",
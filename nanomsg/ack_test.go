@@ -0,0 +1,79 @@
+package nanomsg_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// a bus that delivers the messages of a channel and counts the acknowledgements
+type ackBus struct {
+	messages chan []byte
+	acks     *atomic.Int32
+}
+
+func (b ackBus) Publish(string) (BusPublisher, error) {
+	return nil, errors.New("not supported")
+}
+
+func (b ackBus) Subscribe(string, string, [][]byte) (BusSubscriber, error) {
+	return &ackSubscriber{bus: b, closed: make(chan struct{})}, nil
+}
+
+type ackSubscriber struct {
+	bus    ackBus
+	closed chan struct{}
+}
+
+func (s *ackSubscriber) Recv() ([]byte, error) {
+	select {
+	case m := <-s.bus.messages:
+		return m, nil
+	case <-s.closed:
+		return nil, errors.New("closed")
+	}
+}
+
+func (s *ackSubscriber) Ack() error {
+	s.bus.acks.Add(1)
+	return nil
+}
+
+func (s *ackSubscriber) Close() error {
+	close(s.closed)
+	return nil
+}
+
+var _ = Describe("Subscriber with a bus that acknowledges", func() {
+	It("acknowledges a message after it is handed to the consumer", func() {
+		bus := ackBus{messages: make(chan []byte, 10), acks: new(atomic.Int32)}
+		RegisterBus("ack", bus)
+		for i := 0; i < 5; i++ {
+			bytes, err := json.Marshal(message.NewRaw().WithConnector("a"))
+			Expect(err).NotTo(HaveOccurred())
+			bus.messages <- bytes
+		}
+		subscriber, err := NewSubscriber[message.Raw]("ack://bus", []byte{}, WithSubscriberDropPolicy[message.Raw](DropPolicyBlock))
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		out := make(chan *message.Raw, 1)
+		go subscriber.Receive(ctx, out)
+
+		// one message in the buffer of the consumer, one that waits for room and one in the receive buffer, the next one is
+		// received but not handed over
+		Eventually(bus.acks.Load).WithTimeout(time.Second).Should(Equal(int32(3)))
+		Consistently(bus.acks.Load).WithTimeout(100 * time.Millisecond).Should(Equal(int32(3)))
+		<-out
+		Eventually(bus.acks.Load).WithTimeout(time.Second).Should(Equal(int32(4)))
+		<-out
+		Eventually(bus.acks.Load).WithTimeout(time.Second).Should(Equal(int32(5)))
+	})
+})
@@ -0,0 +1,123 @@
+package nanomsg
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/munnik/gosk/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// What a subscriber does with a received message when its buffer is full
+type DropPolicy string
+
+const (
+	DropPolicyBlock      DropPolicy = "block"      // wait until there is room in the buffer, mangos drops messages when its own queue is full
+	DropPolicyDropNewest DropPolicy = "dropNewest" // drop the received message
+	DropPolicyDropOldest DropPolicy = "dropOldest" // drop the oldest message in the buffer to make room for the received message
+	DropPolicySpill      DropPolicy = "spill"      // write the received messages to disk until there is room in the buffer again
+)
+
+const (
+	dropReasonBufferFull = "bufferFull"
+	dropReasonEvicted    = "evicted"
+	dropReasonSpoolFull  = "spoolFull"
+	dropReasonSpoolError = "spoolError"
+	dropReasonUnmarshal  = "unmarshal"
+	dropReasonMarshal    = "marshal"
+	dropReasonSend       = "send"
+)
+
+var droppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_nanomsg_dropped_messages_total", Help: "total number of messages dropped by subscribers and publishers"}, []string{"reason"})
+
+// The drop policy of subscribers that are created without a drop policy option, unless another default is set
+const DefaultDropPolicy = DropPolicyDropNewest
+
+// the drop policy of subscribers that are created without a drop policy option
+var defaultDropPolicy = DefaultDropPolicy
+
+// where subscribers with the spill policy write the messages that don't fit in the buffer
+var (
+	spillDirectory = ""
+	spillMaxBytes  = int64(1 << 30)
+)
+
+func ParseDropPolicy(name string) (DropPolicy, error) {
+	switch p := DropPolicy(name); p {
+	case DropPolicyBlock, DropPolicyDropNewest, DropPolicyDropOldest, DropPolicySpill:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown drop policy %s, use %s, %s, %s or %s", name, DropPolicyBlock, DropPolicyDropNewest, DropPolicyDropOldest, DropPolicySpill)
+}
+
+// Sets the drop policy of all subscribers in this process that are created without a drop policy option
+func SetDefaultDropPolicy(p DropPolicy) {
+	defaultDropPolicy = p
+}
+
+// Sets the directory and the maximum size of the files of subscribers with the spill policy, the temporary directory is
+// used when the directory is empty
+func SetSpill(directory string, maxBytes int64) {
+	spillDirectory = directory
+	spillMaxBytes = maxBytes
+}
+
+// Puts the item in the buffer according to the policy, returns false when the item is dropped. The spill policy blocks,
+// messages are only spilled before they are unmarshalled.
+func offer[T any](buffer chan T, item T, policy DropPolicy) bool {
+	switch policy {
+	case DropPolicyBlock, DropPolicySpill:
+		buffer <- item
+		return true
+	case DropPolicyDropOldest:
+		for {
+			select {
+			case buffer <- item:
+				return true
+			default:
+			}
+			select {
+			case <-buffer:
+				dropped(dropReasonEvicted)
+			default:
+			}
+		}
+	}
+	select {
+	case buffer <- item:
+		return true
+	default:
+		dropped(dropReasonBufferFull)
+		return false
+	}
+}
+
+const dropLogInterval = 10 * time.Second
+
+var dropLog = struct {
+	sync.Mutex
+	last  time.Time
+	count map[string]int
+}{count: make(map[string]int)}
+
+// counts the dropped message, the number of dropped messages is logged at most once per interval
+func dropped(reason string) {
+	droppedCounter.WithLabelValues(reason).Inc()
+
+	dropLog.Lock()
+	defer dropLog.Unlock()
+	dropLog.count[reason]++
+	if time.Since(dropLog.last) < dropLogInterval {
+		return
+	}
+	logger.GetLogger().Warn(
+		"Dropped messages",
+		zap.Any("Dropped per reason", dropLog.count),
+		zap.Duration("Interval", dropLogInterval),
+	)
+	dropLog.last = time.Now()
+	dropLog.count = make(map[string]int)
+}
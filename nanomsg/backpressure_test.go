@@ -0,0 +1,63 @@
+package nanomsg_test
+
+import (
+	"time"
+
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Offer", func() {
+	DescribeTable("puts the item in a buffer with room",
+		func(policy DropPolicy) {
+			buffer := make(chan int, 2)
+			buffer <- 1
+			Expect(Offer(buffer, 2, policy)).To(BeTrue())
+			Expect(<-buffer).To(Equal(1))
+			Expect(<-buffer).To(Equal(2))
+		},
+		Entry("block", DropPolicyBlock),
+		Entry("dropNewest", DropPolicyDropNewest),
+		Entry("dropOldest", DropPolicyDropOldest),
+		Entry("spill", DropPolicySpill),
+	)
+	DescribeTable("waits for room in a full buffer",
+		func(policy DropPolicy) {
+			buffer := make(chan int, 1)
+			buffer <- 1
+			offered := make(chan bool)
+			go func() { offered <- Offer(buffer, 2, policy) }()
+			Consistently(offered).WithTimeout(50 * time.Millisecond).ShouldNot(Receive())
+			Expect(<-buffer).To(Equal(1))
+			Eventually(offered).WithTimeout(time.Second).Should(Receive(BeTrue()))
+			Expect(<-buffer).To(Equal(2))
+		},
+		Entry("block", DropPolicyBlock),
+		Entry("spill", DropPolicySpill),
+	)
+	It("drops the item when the buffer is full and the policy is dropNewest", func() {
+		buffer := make(chan int, 1)
+		buffer <- 1
+		Expect(Offer(buffer, 2, DropPolicyDropNewest)).To(BeFalse())
+		Expect(<-buffer).To(Equal(1))
+		Expect(buffer).To(BeEmpty())
+	})
+	It("evicts the oldest item when the buffer is full and the policy is dropOldest", func() {
+		buffer := make(chan int, 2)
+		buffer <- 1
+		buffer <- 2
+		Expect(Offer(buffer, 3, DropPolicyDropOldest)).To(BeTrue())
+		Expect(<-buffer).To(Equal(2))
+		Expect(<-buffer).To(Equal(3))
+	})
+	It("parses the drop policies", func() {
+		for _, name := range []string{"block", "dropNewest", "dropOldest", "spill"} {
+			p, err := ParseDropPolicy(name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p)).To(Equal(name))
+		}
+		_, err := ParseDropPolicy("dropAll")
+		Expect(err).To(HaveOccurred())
+	})
+})
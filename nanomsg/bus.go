@@ -0,0 +1,226 @@
+package nanomsg
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"go.nanomsg.org/mangos/v3"
+	"go.nanomsg.org/mangos/v3/protocol/pub"
+	"go.nanomsg.org/mangos/v3/protocol/sub"
+	"go.uber.org/zap"
+
+	// register transports
+	_ "go.nanomsg.org/mangos/v3/transport/all"
+)
+
+// Bus carries the encoded messages from publishers to subscribers, the bus is selected by the scheme of the url. Mangos
+// is used for all schemes that are not registered.
+type Bus interface {
+	Publish(url string) (BusPublisher, error)
+	// kind is raw, mapped or deadLetter, topics are the prefixes of the messages that are received
+	Subscribe(url string, kind string, topics [][]byte) (BusSubscriber, error)
+}
+
+type BusPublisher interface {
+	// the subject is used by buses with subject based routing, other buses ignore it
+	Send(subject string, bytes []byte) error
+	Close() error
+}
+
+type BusSubscriber interface {
+	Recv() ([]byte, error)
+	Close() error
+}
+
+// implemented by the subscribers that deliver a message again until it is acknowledged
+type acknowledger interface {
+	// acknowledges the last received message
+	Ack() error
+}
+
+// implemented by the subscribers that know whether they are connected to a publisher
+type connectionState interface {
+	Connected() bool
+	// when the subscriber lost the connection, zero when it is connected or the time is unknown
+	DisconnectedSince() time.Time
+}
+
+// counts the connections of a socket and remembers since when the socket has no connections
+type connections struct {
+	count        atomic.Int32
+	disconnected atomic.Int64 // unix nanoseconds, zero when connected
+}
+
+// not connected yet, the time is the start of dialling
+func newConnections() *connections {
+	result := &connections{}
+	result.disconnect()
+	return result
+}
+
+// the pipe event hook of the socket
+func (c *connections) hook(e mangos.PipeEvent, _ mangos.Pipe) {
+	switch e {
+	case mangos.PipeEventAttached:
+		if c.count.Add(1) == 1 {
+			c.connect()
+		}
+	case mangos.PipeEventDetached:
+		if c.count.Add(-1) == 0 {
+			c.disconnect()
+		}
+	}
+}
+
+func (c *connections) connect() {
+	c.disconnected.Store(0)
+}
+
+// keeps the time of the first disconnect until connected again
+func (c *connections) disconnect() {
+	c.disconnected.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+func (c *connections) disconnectedSince() time.Time {
+	if d := c.disconnected.Load(); d != 0 {
+		return time.Unix(0, d)
+	}
+	return time.Time{}
+}
+
+var (
+	busesMutex sync.RWMutex
+	buses      = make(map[string]Bus)
+)
+
+// Registers the bus for urls with the scheme, e.g. nats
+func RegisterBus(scheme string, b Bus) {
+	busesMutex.Lock()
+	defer busesMutex.Unlock()
+	buses[scheme] = b
+}
+
+func busFor(url string) Bus {
+	busesMutex.RLock()
+	defer busesMutex.RUnlock()
+	if scheme, _, ok := strings.Cut(url, "://"); ok {
+		if b, ok := buses[scheme]; ok {
+			return b
+		}
+	}
+	return mangosBus{}
+}
+
+// the kind of the messages, used to route and select messages by subject
+func messageKind[T Message]() string {
+	switch any(new(T)).(type) {
+	case *message.Raw:
+		return "raw"
+	case *message.Mapped:
+		return "mapped"
+	}
+	return "deadLetter"
+}
+
+// PUB/SUB sockets, publishers listen and subscribers dial
+type mangosBus struct{}
+
+type mangosSocket struct {
+	mangos.Socket
+}
+
+func (s mangosSocket) Send(subject string, bytes []byte) error {
+	return s.Socket.Send(bytes)
+}
+
+// a SUB socket that counts the connected publishers
+type mangosSubscriber struct {
+	mangos.Socket
+	connections *connections
+}
+
+func (s mangosSubscriber) Connected() bool {
+	return s.connections.count.Load() > 0
+}
+
+func (s mangosSubscriber) DisconnectedSince() time.Time {
+	return s.connections.disconnectedSince()
+}
+
+func (mangosBus) Publish(url string) (BusPublisher, error) {
+	socket, err := pub.NewSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err := socket.Listen(url); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	return mangosSocket{socket}, nil
+}
+
+func (mangosBus) Subscribe(url string, kind string, topics [][]byte) (BusSubscriber, error) {
+	socket, err := sub.NewSocket()
+	if err != nil {
+		return nil, err
+	}
+	connections := newConnections()
+	socket.SetPipeEventHook(connections.hook)
+
+	if asyncDial {
+		// mangos keeps dialling in the background
+		if err := socket.DialOptions(url, map[string]interface{}{mangos.OptionDialAsynch: true}); err != nil {
+			socket.Close()
+			return nil, err
+		}
+	} else {
+		dial(socket, url)
+	}
+	for _, t := range topics {
+		if err := socket.SetOption(mangos.OptionSubscribe, t); err != nil {
+			return nil, err
+		}
+	}
+	return mangosSubscriber{Socket: socket, connections: connections}, nil
+}
+
+// waits until the publisher can be dialled
+func dial(socket mangos.Socket, url string) {
+	b := &backoff.Backoff{
+		//These are the defaults
+		Min:    1 * time.Millisecond,
+		Max:    5 * time.Minute,
+		Factor: 1.5,
+		Jitter: false,
+	}
+	var d time.Duration
+
+	for {
+		err := socket.Dial(url)
+		if err == nil {
+			break
+		}
+		d = b.Duration()
+		logger.GetLogger().Warn(
+			"Could not dial the publisher, will retry",
+			zap.String("URL", url),
+			zap.String("Error", err.Error()),
+			zap.Duration("Back off time", d),
+		)
+		time.Sleep(d)
+	}
+}
+
+// subscribers wait until they are connected to the publisher unless this is true
+var asyncDial = false
+
+// Subscribers dial the publisher in the background instead of waiting until it can be reached, used when the publishers
+// and the subscribers are started in the same process
+func SetAsyncDial(async bool) {
+	asyncDial = async
+}
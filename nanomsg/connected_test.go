@@ -0,0 +1,43 @@
+package nanomsg_test
+
+import (
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscriber", func() {
+	It("knows whether it is connected to the publisher", func() {
+		url := "inproc://connected"
+		in := make(chan *message.Raw, 10)
+		publisher := NewPublisher[message.Raw](url)
+		go publisher.Send(in)
+		subscriber, err := NewSubscriber[message.Raw](url, []byte{})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(subscriber.Connected).WithTimeout(time.Second).Should(BeTrue())
+
+		close(in)
+		Eventually(publisher.Done()).WithTimeout(time.Second).Should(BeClosed())
+		Eventually(subscriber.Connected).WithTimeout(time.Second).Should(BeFalse())
+	})
+	It("knows since when it is disconnected from the publisher", func() {
+		url := "inproc://disconnected-since"
+		in := make(chan *message.Raw, 10)
+		publisher := NewPublisher[message.Raw](url)
+		go publisher.Send(in)
+		subscriber, err := NewSubscriber[message.Raw](url, []byte{})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(subscriber.Connected).WithTimeout(time.Second).Should(BeTrue())
+		Expect(subscriber.DisconnectedSince()).To(BeZero())
+
+		closed := time.Now()
+		close(in)
+		Eventually(subscriber.Connected).WithTimeout(time.Second).Should(BeFalse())
+		since := subscriber.DisconnectedSince()
+		Expect(since).To(BeTemporally(">=", closed))
+		Consistently(subscriber.DisconnectedSince).WithTimeout(50 * time.Millisecond).Should(Equal(since))
+	})
+})
@@ -0,0 +1,53 @@
+package nanomsg
+
+import "github.com/munnik/gosk/message"
+
+// makes the internals available to the tests in nanomsg_test
+
+func Offer(buffer chan int, item int, policy DropPolicy) bool {
+	return offer(buffer, item, policy)
+}
+
+type Spool = spool
+
+var (
+	NewSpool     = newSpool
+	ErrSpoolFull = errSpoolFull
+)
+
+func (s *spool) Push(bytes []byte) error    { return s.push(bytes) }
+func (s *spool) Pop() ([]byte, bool, error) { return s.pop() }
+func (s *spool) Done()                      { s.done() }
+func (s *spool) Len() int                   { return s.len() }
+func (s *spool) Drain(buffer chan []byte)   { s.drain(buffer) }
+func (s *spool) Close()                     { s.close() }
+func (s *spool) Crash()                     { s.file.Close() }
+
+var (
+	Marshal    = marshal
+	Unmarshal  = unmarshal
+	AddTopic   = addTopic
+	SplitTopic = splitTopic
+)
+
+func (f *ProxyFilter) Apply(received []byte) ([]byte, bool) { return f.apply(received) }
+func (f *ProxyFilter) ApplyMapped(m *message.Mapped) bool   { return f.applyMapped(m) }
+
+// the number of kept keys, including the keys of expired messages that are not removed yet
+func (s *Snapshot[T]) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.keys)
+}
+
+var RemoveTopic = removeTopic
+
+// the topics and the messages a publisher with the topic key sends
+func WithTopics[T Message](key TopicKey, m *T) ([]string, []*T) {
+	topics, messages := make([]string, 0), make([]*T, 0)
+	for _, tm := range withTopics(key, m) {
+		topics = append(topics, tm.topic)
+		messages = append(messages, tm.message)
+	}
+	return topics, messages
+}
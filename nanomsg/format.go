@@ -0,0 +1,67 @@
+package nanomsg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/munnik/gosk/message"
+)
+
+// The encoding of the messages on a socket, subscribers detect the format of every message so publishers can switch without
+// restarting the subscribers
+type Format byte
+
+const (
+	FormatJSON     Format = '{'  // json documents start with a {, there is no format byte
+	FormatBinaryV1 Format = 0x01 // the format byte followed by the CBOR encoded message
+)
+
+// a list of json documents, e.g. a snapshot, starts with a [
+const jsonArray Format = '['
+
+const (
+	FormatNameJSON   = "json"
+	FormatNameBinary = "binary"
+)
+
+// the format of publishers that are created without a format option
+var defaultFormat = FormatJSON
+
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case FormatNameJSON:
+		return FormatJSON, nil
+	case FormatNameBinary:
+		return FormatBinaryV1, nil
+	}
+	return 0, fmt.Errorf("unknown format %s, use %s or %s", name, FormatNameJSON, FormatNameBinary)
+}
+
+// Sets the format of all publishers in this process that are created without a format option
+func SetDefaultFormat(f Format) {
+	defaultFormat = f
+}
+
+func marshal(f Format, m any) ([]byte, error) {
+	if f == FormatJSON {
+		return json.Marshal(m)
+	}
+	bytes, err := message.MarshalBinary(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(f)}, bytes...), nil
+}
+
+func unmarshal(bytes []byte, m any) error {
+	if len(bytes) == 0 {
+		return fmt.Errorf("received an empty message")
+	}
+	switch Format(bytes[0]) {
+	case FormatJSON, jsonArray:
+		return json.Unmarshal(bytes, m)
+	case FormatBinaryV1:
+		return message.UnmarshalBinary(bytes[1:], m)
+	}
+	return fmt.Errorf("unknown format byte %#x", bytes[0])
+}
@@ -10,7 +10,7 @@ import (
 )
 
 type Message interface {
-	message.Raw | message.Mapped
+	message.Raw | message.Mapped | message.DeadLetter
 }
 
 func checkBufferSize[T any](buffer chan T, name string, g prometheus.Gauge) {
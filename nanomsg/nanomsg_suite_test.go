@@ -0,0 +1,13 @@
+package nanomsg_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestNanomsg(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Nanomsg Suite")
+}
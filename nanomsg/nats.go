@@ -0,0 +1,334 @@
+package nanomsg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// Urls with this scheme use a NATS server with JetStream, e.g. nats://127.0.0.1:4222. Subscribers select the messages with
+// query parameters:
+//   - subject: the subjects to receive, can be repeated, gosk.raw.>, gosk.mapped.> or gosk.deadLetter.> by default
+//   - deliver: new (default), all, last or lastPerSubject, all replays the messages that are kept in the stream
+//   - durable: the name of a durable consumer, the subscriber continues where it stopped after a restart
+const NATSScheme = "nats"
+
+// all messages are kept in this stream, the subjects are gosk.raw.<connector>, gosk.mapped.<context> and
+// gosk.deadLetter.<mapper>
+const (
+	NATSStream        = "GOSK"
+	natsSubjectPrefix = "gosk"
+)
+
+const natsTimeout = 10 * time.Second
+
+func init() {
+	RegisterBus(NATSScheme, natsBus{})
+}
+
+// the subject of a message, the context of mapped messages is split in tokens on the dots so subscribers can use wildcards
+func subjectOf[T Message](m *T) string {
+	switch v := any(m).(type) {
+	case *message.Raw:
+		return natsSubjectPrefix + ".raw." + natsToken(strings.ReplaceAll(v.Connector, ".", "_"))
+	case *message.Mapped:
+		tokens := strings.Split(v.Context, ".")
+		for i, t := range tokens {
+			tokens[i] = natsToken(t)
+		}
+		return natsSubjectPrefix + ".mapped." + strings.Join(tokens, ".")
+	case *message.DeadLetter:
+		return natsSubjectPrefix + ".deadLetter." + natsToken(strings.ReplaceAll(v.Mapper, ".", "_"))
+	}
+	return natsSubjectPrefix
+}
+
+// replaces the characters that are not allowed in a token of a subject
+func natsToken(t string) string {
+	if t == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '*' || r == '>' || r <= ' ' {
+			return '_'
+		}
+		return r
+	}, t)
+}
+
+type natsBus struct{}
+
+type natsPublisher struct {
+	connection *nats.Conn
+}
+
+func (p natsPublisher) Send(subject string, bytes []byte) error {
+	return p.connection.Publish(subject, bytes)
+}
+
+func (p natsPublisher) Close() error {
+	return p.connection.Drain()
+}
+
+type natsSubscriber struct {
+	connection  *nats.Conn
+	connections *connections // only the time of the disconnect is kept, the connection knows whether it is connected
+	messages    jetstream.MessagesContext
+	ack         bool // durable consumers acknowledge the messages, ordered consumers don't
+	last        jetstream.Msg
+}
+
+func (s *natsSubscriber) Recv() ([]byte, error) {
+	m, err := s.messages.Next()
+	if err != nil {
+		return nil, err
+	}
+	s.last = m
+	return m.Data(), nil
+}
+
+// the last received message is handed to the consumer or dropped, it won't be delivered again
+func (s *natsSubscriber) Ack() error {
+	if !s.ack || s.last == nil {
+		return nil
+	}
+	m := s.last
+	s.last = nil
+	return m.Ack()
+}
+
+func (s *natsSubscriber) Connected() bool {
+	return s.connection.IsConnected()
+}
+
+func (s *natsSubscriber) DisconnectedSince() time.Time {
+	return s.connections.disconnectedSince()
+}
+
+func (s *natsSubscriber) Close() error {
+	s.messages.Stop()
+	return s.connection.Drain()
+}
+
+// connects to the server, keeps reconnecting when the connection is lost, the disconnects are recorded in the
+// connections when not nil
+func natsConnect(u *url.URL, c *connections) (*nats.Conn, error) {
+	server := (&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}).String()
+	return nats.Connect(
+		server,
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if c != nil {
+				c.disconnect()
+			}
+			if err != nil {
+				logger.GetLogger().Warn(
+					"Disconnected from the NATS server",
+					zap.String("URL", server),
+					zap.String("Error", err.Error()),
+				)
+			}
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			if c != nil {
+				c.connect()
+			}
+			logger.GetLogger().Info("Reconnected to the NATS server", zap.String("URL", server))
+		}),
+	)
+}
+
+func (natsBus) Publish(rawURL string) (BusPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := natsConnect(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return natsPublisher{connection: connection}, nil
+}
+
+func (natsBus) Subscribe(rawURL string, kind string, topics [][]byte) (BusSubscriber, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	// the routing key of mangos sockets can't be mapped to subjects, a topic can end in the middle of a token
+	for _, t := range topics {
+		if len(t) > 0 {
+			return nil, fmt.Errorf("the NATS bus can't select messages by topic %q, use the subject query parameter", t)
+		}
+	}
+	query := u.Query()
+	subjects := query["subject"]
+	if len(subjects) == 0 {
+		subjects = []string{natsSubjectPrefix + "." + kind + ".>"}
+	}
+	deliver, err := natsDeliverPolicy(query.Get("deliver"))
+	if err != nil {
+		return nil, err
+	}
+
+	connections := newConnections()
+	connection, err := natsConnect(u, connections)
+	if err != nil {
+		return nil, err
+	}
+	connections.connect()
+	js, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	var consumer jetstream.Consumer
+	durable := query.Get("durable")
+	if durable != "" {
+		consumer, err = js.CreateOrUpdateConsumer(ctx, NATSStream, jetstream.ConsumerConfig{
+			Durable:        durable,
+			FilterSubjects: subjects,
+			DeliverPolicy:  deliver,
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		})
+	} else {
+		consumer, err = js.OrderedConsumer(ctx, NATSStream, jetstream.OrderedConsumerConfig{
+			FilterSubjects: subjects,
+			DeliverPolicy:  deliver,
+		})
+	}
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		err = fmt.Errorf("the stream %s does not exist, start the server with the bus command: %w", NATSStream, err)
+	}
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	messages, err := consumer.Messages()
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return &natsSubscriber{connection: connection, connections: connections, messages: messages, ack: durable != ""}, nil
+}
+
+func natsDeliverPolicy(name string) (jetstream.DeliverPolicy, error) {
+	switch name {
+	case "", "new":
+		return jetstream.DeliverNewPolicy, nil
+	case "all":
+		return jetstream.DeliverAllPolicy, nil
+	case "last":
+		return jetstream.DeliverLastPolicy, nil
+	case "lastPerSubject":
+		return jetstream.DeliverLastPerSubjectPolicy, nil
+	}
+	return 0, fmt.Errorf("unknown deliver policy %s, use new, all, last or lastPerSubject", name)
+}
+
+// NATSServer is a NATS server with JetStream that runs in this process
+type NATSServer struct {
+	server *server.Server
+}
+
+// Starts a server that listens on the host and port of the url and creates the stream, messages are removed from the
+// stream when they are older than maxAge, they are kept until the stream is full when maxAge is zero. The messages are
+// kept in memory when the store directory is empty. A free port is used when the port is 0.
+func StartNATSServer(rawURL string, storeDirectory string, maxAge time.Duration, maxBytes int64) (*NATSServer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host, portString, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, err
+	}
+	// the server uses the default port for 0
+	if port == 0 {
+		port = server.RANDOM_PORT
+	}
+	storage := jetstream.MemoryStorage
+	if storeDirectory != "" {
+		storage = jetstream.FileStorage
+	}
+
+	s, err := server.NewServer(&server.Options{
+		ServerName: "gosk",
+		Host:       host,
+		Port:       port,
+		JetStream:  true,
+		StoreDir:   storeDirectory,
+		NoSigs:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.Start()
+	if !s.ReadyForConnections(natsTimeout) {
+		s.Shutdown()
+		return nil, fmt.Errorf("the NATS server on %s did not start within %s", u.Host, natsTimeout)
+	}
+
+	connection, err := nats.Connect("", nats.InProcessServer(s))
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	defer connection.Close()
+	js, err := jetstream.New(connection)
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	if maxBytes <= 0 {
+		maxBytes = -1
+	}
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     NATSStream,
+		Subjects: []string{natsSubjectPrefix + ".>"},
+		Storage:  storage,
+		MaxAge:   maxAge,
+		MaxBytes: maxBytes,
+		Discard:  jetstream.DiscardOld,
+	}); err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	return &NATSServer{server: s}, nil
+}
+
+// The url clients use to connect to the server
+func (s *NATSServer) ClientURL() string {
+	return s.server.ClientURL()
+}
+
+// Blocks until the server is shut down
+func (s *NATSServer) WaitForShutdown() {
+	s.server.WaitForShutdown()
+}
+
+func (s *NATSServer) Shutdown() {
+	s.server.Shutdown()
+	s.server.WaitForShutdown()
+}
@@ -0,0 +1,94 @@
+package nanomsg_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NATS bus", func() {
+	var (
+		server *NATSServer
+		in     chan *message.Mapped
+	)
+	mapped := func(context string, value float64) *message.Mapped {
+		u := message.NewUpdate().WithSource(*message.NewSource().WithLabel("GPS").WithType("nmea0183")).WithTimestamp(time.Now())
+		u.AddValue(message.NewValue().WithPath("navigation.speedOverGround").WithValue(value))
+		return message.NewMapped().WithContext(context).WithOrigin(context).AddUpdate(u)
+	}
+	subscribe := func(query string) chan *message.Mapped {
+		s, err := NewSubscriber[message.Mapped](server.ClientURL()+query, []byte{})
+		Expect(err).NotTo(HaveOccurred())
+		out := make(chan *message.Mapped, 10)
+		go s.Receive(context.Background(), out)
+		return out
+	}
+	received := func(out chan *message.Mapped) []float64 {
+		result := make([]float64, 0)
+		for {
+			select {
+			case m := <-out:
+				result = append(result, m.Updates[0].Values[0].Value.(float64))
+			case <-time.After(200 * time.Millisecond):
+				return result
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		// a free port
+		server, err = StartNATSServer("nats://127.0.0.1:0", "", time.Hour, 0)
+		Expect(err).NotTo(HaveOccurred())
+		in = make(chan *message.Mapped, 10)
+		go NewPublisher[message.Mapped](server.ClientURL()).Send(in)
+	})
+	AfterEach(func() {
+		server.Shutdown()
+	})
+
+	It("delivers the messages in order", func() {
+		out := subscribe("")
+		for i := 1; i <= 5; i++ {
+			in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", float64(i))
+		}
+		Expect(received(out)).To(Equal([]float64{1, 2, 3, 4, 5}))
+	})
+	It("routes the messages by context", func() {
+		out := subscribe("?subject=gosk.mapped.vessels.urn:mrn:imo:mmsi:234567890")
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 1)
+		in <- mapped("vessels.urn:mrn:imo:mmsi:123456789", 2)
+		Expect(received(out)).To(Equal([]float64{1}))
+	})
+	It("continues after the acknowledged messages of a durable consumer", func() {
+		s, err := NewSubscriber[message.Mapped](server.ClientURL()+"?durable=writer&deliver=all", []byte{})
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan *message.Mapped, 10)
+		go s.Receive(ctx, out)
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 1)
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 2)
+		Expect(received(out)).To(Equal([]float64{1, 2}))
+		cancel()
+		Eventually(out).WithTimeout(time.Second).Should(BeClosed())
+
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 3)
+		Expect(received(subscribe("?durable=writer&deliver=all"))).To(Equal([]float64{3}))
+	})
+	It("can't select the messages by topic", func() {
+		_, err := NewSubscriber[message.Mapped](server.ClientURL(), []byte("navigation"))
+		Expect(err).To(HaveOccurred())
+	})
+	It("replays the stored messages", func() {
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 1)
+		in <- mapped("vessels.urn:mrn:imo:mmsi:234567890", 2)
+		time.Sleep(100 * time.Millisecond)
+		Expect(received(subscribe("?deliver=all"))).To(Equal([]float64{1, 2}))
+		Expect(received(subscribe("?deliver=lastPerSubject"))).To(Equal([]float64{2}))
+		Expect(received(subscribe(""))).To(BeEmpty())
+	})
+})
@@ -1,79 +1,296 @@
 package nanomsg
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.nanomsg.org/mangos/v3"
+	"go.nanomsg.org/mangos/v3/protocol/sub"
 	"go.uber.org/zap"
 
 	// register transports
-	"go.nanomsg.org/mangos/v3"
 	_ "go.nanomsg.org/mangos/v3/transport/all"
 )
 
-// Proxy is a proxy which can subscribe to multiple sockets and publish to a single socket
+var (
+	proxyReceivedCounter  = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_proxy_messages_received_total", Help: "total number of messages received from the upstream"}, []string{"upstream"})
+	proxyForwardedCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_proxy_messages_forwarded_total", Help: "total number of messages of the upstream that are forwarded"}, []string{"upstream"})
+	proxyFilteredCounter  = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_proxy_messages_filtered_total", Help: "total number of messages of the upstream that are removed by the rules"}, []string{"upstream"})
+	proxyConnectedGauge   = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "gosk_proxy_upstream_connected", Help: "1 when the proxy is connected to the upstream"}, []string{"upstream"})
+	proxyAliveGauge       = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "gosk_proxy_upstream_alive", Help: "1 when the upstream sent a message within the liveness timeout"}, []string{"upstream"})
+	proxyLastMessageGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "gosk_proxy_upstream_last_message_timestamp_seconds", Help: "unix time of the last message of the upstream"}, []string{"upstream"})
+)
+
+// Proxy is a proxy which can subscribe to multiple sockets and publish to a single socket, the messages are forwarded
+// unchanged so the topics of the messages are kept. Only the messages that are filtered or rewritten are changed.
 type Proxy struct {
-	publisher    mangos.Socket
-	stopChannels []chan struct{}
+	publisher       BusPublisher
+	mutex           sync.Mutex
+	upstreams       map[string]*upstream
+	filter          atomic.Pointer[ProxyFilter]
+	livenessTimeout atomic.Int64
+	snapshot        *Snapshot[message.Mapped]
+	stopSnapshot    context.CancelFunc
 }
 
-// NewProxy creates a new instance
-func NewProxy(url string) *Proxy {
-	// don't care about the message type, only the internal socket is used
-	p := NewPublisher[message.Raw](url)
-	return &Proxy{publisher: p.socket}
+type upstream struct {
+	url         string
+	socket      mangos.Socket
+	lastMessage atomic.Int64
+	connections *connections // the connections with the publisher
+	stop        chan struct{}
 }
 
-// SubscribeTo a publisher
-func (p *Proxy) SubscribeTo(url string, wg *sync.WaitGroup) {
-	stopChannel := make(chan struct{})
-	p.stopChannels = append(p.stopChannels, stopChannel)
-	topic := []byte("")
-	// don't care about the message type, only the internal socket is used
-	s, err := NewSubscriber[message.Raw](url, topic)
-	if err != nil {
+// NewProxy creates a new instance, the proxy only forwards to and from mangos sockets. A bus with subject based routing
+// doesn't need a proxy.
+func NewProxy(url string) *Proxy {
+	if _, ok := busFor(url).(mangosBus); !ok {
 		logger.GetLogger().Fatal(
-			"Could not subscribe",
+			"The proxy can only publish on mangos sockets",
 			zap.String("URL", url),
-			zap.ByteString("Topic", topic),
-			zap.String("Error", err.Error()),
 		)
 	}
-	socket := s.socket
-	go func(url string, topic []byte) {
-		defer socket.Close()
-		for {
-			select {
-			default:
-				if received, err := socket.Recv(); err != nil {
-					logger.GetLogger().Warn(
-						"Could not receive a message from the publisher",
-						zap.String("Error", err.Error()),
-					)
-				} else {
-					if err := p.publisher.Send(received); err != nil {
-						logger.GetLogger().Warn(
-							"Unable to send the message using NanoMSG",
-							zap.ByteString("Message", received),
-							zap.String("Error", err.Error()),
-						)
-						continue
-					}
-				}
-			case <-stopChannel:
-				wg.Done()
-				return
-			}
+	// don't care about the message type, only the internal socket is used
+	p := NewPublisher[message.Raw](url, WithPublisherSnapshot[message.Raw](""))
+	result := &Proxy{publisher: p.bus, upstreams: make(map[string]*upstream)}
+	result.livenessTimeout.Store(int64(time.Minute))
+	return result
+}
+
+// The rules and context rewrites that are applied to the messages of all upstreams, replaces the running filter
+func (p *Proxy) SetFilter(f *ProxyFilter) {
+	p.filter.Store(f)
+}
+
+// An upstream is not alive when it didn't send a message for this long
+func (p *Proxy) SetLivenessTimeout(d time.Duration) {
+	p.livenessTimeout.Store(int64(d))
+}
+
+// ServeSnapshot keeps the last mapped values of the forwarded messages and serves them on the url, other messages are
+// forwarded without being kept
+func (p *Proxy) ServeSnapshot(url string) error {
+	// the messages are kept with the topic of the upstream publisher, the proxy has no topic key of its own
+	p.snapshot = NewSnapshot[message.Mapped](defaultFormat, TopicKeyNone, defaultSnapshotMaxAge)
+	var ctx context.Context
+	ctx, p.stopSnapshot = context.WithCancel(context.Background())
+	if err := p.snapshot.Serve(ctx, url); err != nil {
+		p.stopSnapshot()
+		return err
+	}
+	return nil
+}
+
+func (p *Proxy) updateSnapshot(received []byte) {
+	topic, payload := splitTopic(received)
+	m := new(message.Mapped)
+	if err := unmarshal(payload, m); err != nil {
+		return
+	}
+	p.snapshot.update(m, topic)
+}
+
+// AddUpstream subscribes to a publisher, the proxy keeps trying to connect when the publisher is not available
+func (p *Proxy) AddUpstream(url string) error {
+	if _, ok := busFor(url).(mangosBus); !ok {
+		return fmt.Errorf("the proxy can only subscribe to mangos sockets")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.upstreams[url]; ok {
+		return nil
+	}
+	socket, err := sub.NewSocket()
+	if err != nil {
+		return err
+	}
+	u := &upstream{url: url, socket: socket, connections: newConnections(), stop: make(chan struct{})}
+	socket.SetPipeEventHook(func(e mangos.PipeEvent, p mangos.Pipe) {
+		u.connections.hook(e, p)
+		switch e {
+		case mangos.PipeEventAttached:
+			proxyConnectedGauge.WithLabelValues(url).Set(1)
+		case mangos.PipeEventDetached:
+			proxyConnectedGauge.WithLabelValues(url).Set(0)
+		}
+	})
+	if err := socket.SetOption(mangos.OptionSubscribe, []byte{}); err != nil {
+		socket.Close()
+		return err
+	}
+	proxyConnectedGauge.WithLabelValues(url).Set(0)
+	proxyAliveGauge.WithLabelValues(url).Set(0)
+	if err := socket.DialOptions(url, map[string]interface{}{mangos.OptionDialAsynch: true}); err != nil {
+		socket.Close()
+		p.removeMetrics(url)
+		return fmt.Errorf("could not dial %s: %w", url, err)
+	}
+	p.upstreams[url] = u
+	health.Register(upstreamCheckName(url), func() error {
+		if u.connections.count.Load() == 0 {
+			return health.FailingSince(u.connections.disconnectedSince(), errors.New("not connected to the upstream"))
 		}
-	}(url, topic)
+		return nil
+	})
+	go p.forward(u)
+	go p.checkLiveness(u)
+	logger.GetLogger().Info("Added upstream", zap.String("URL", url))
+	return nil
+}
+
+// RemoveUpstream stops forwarding the messages of the publisher
+func (p *Proxy) RemoveUpstream(url string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	u, ok := p.upstreams[url]
+	if !ok {
+		return
+	}
+	delete(p.upstreams, url)
+	close(u.stop)
+	u.socket.Close()
+	health.Unregister(upstreamCheckName(url))
+	p.removeMetrics(url)
+	logger.GetLogger().Info("Removed upstream", zap.String("URL", url))
+}
+
+// SetUpstreams adds and removes upstreams so the proxy subscribes to exactly these publishers, upstreams that can't be
+// added are logged and skipped
+func (p *Proxy) SetUpstreams(urls []string) {
+	keep := make(map[string]struct{}, len(urls))
+	for _, url := range urls {
+		keep[url] = struct{}{}
+	}
+	for _, url := range p.Upstreams() {
+		if _, ok := keep[url]; !ok {
+			p.RemoveUpstream(url)
+		}
+	}
+	for _, url := range urls {
+		if err := p.AddUpstream(url); err != nil {
+			logger.GetLogger().Warn(
+				"Could not add the upstream",
+				zap.String("URL", url),
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
+}
+
+func (p *Proxy) Upstreams() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	result := make([]string, 0, len(p.upstreams))
+	for url := range p.upstreams {
+		result = append(result, url)
+	}
+	return result
+}
+
+func upstreamCheckName(url string) string {
+	return "upstream " + redact(url)
+}
+
+func (p *Proxy) removeMetrics(url string) {
+	proxyReceivedCounter.DeleteLabelValues(url)
+	proxyForwardedCounter.DeleteLabelValues(url)
+	proxyFilteredCounter.DeleteLabelValues(url)
+	proxyConnectedGauge.DeleteLabelValues(url)
+	proxyAliveGauge.DeleteLabelValues(url)
+	proxyLastMessageGauge.DeleteLabelValues(url)
+}
+
+func (p *Proxy) forward(u *upstream) {
+	received := proxyReceivedCounter.WithLabelValues(u.url)
+	forwarded := proxyForwardedCounter.WithLabelValues(u.url)
+	filtered := proxyFilteredCounter.WithLabelValues(u.url)
+	lastMessage := proxyLastMessageGauge.WithLabelValues(u.url)
+	for {
+		bytes, err := u.socket.Recv()
+		if err == mangos.ErrClosed {
+			return
+		}
+		if err != nil {
+			logger.GetLogger().Warn(
+				"Could not receive a message from the publisher",
+				zap.String("URL", u.url),
+				zap.String("Error", err.Error()),
+			)
+			continue
+		}
+		now := time.Now()
+		u.lastMessage.Store(now.UnixNano())
+		lastMessage.Set(float64(now.Unix()))
+		received.Inc()
+
+		bytes, ok := p.filter.Load().apply(bytes)
+		if !ok {
+			filtered.Inc()
+			continue
+		}
+		if err := p.publisher.Send("", bytes); err != nil {
+			logger.GetLogger().Warn(
+				"Unable to send the message using NanoMSG",
+				zap.ByteString("Message", bytes),
+				zap.String("Error", err.Error()),
+			)
+			dropped(dropReasonSend)
+			continue
+		}
+		forwarded.Inc()
+		if p.snapshot != nil {
+			p.updateSnapshot(bytes)
+		}
+	}
+}
+
+// logs when the upstream stops or starts sending messages
+func (p *Proxy) checkLiveness(u *upstream) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	alive := false
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+		}
+		was := alive
+		last := u.lastMessage.Load()
+		alive = last != 0 && time.Since(time.Unix(0, last)) < time.Duration(p.livenessTimeout.Load())
+		if alive == was {
+			continue
+		}
+		if alive {
+			proxyAliveGauge.WithLabelValues(u.url).Set(1)
+			logger.GetLogger().Info("Upstream is alive", zap.String("URL", u.url))
+			continue
+		}
+		proxyAliveGauge.WithLabelValues(u.url).Set(0)
+		logger.GetLogger().Warn(
+			"Upstream did not send a message within the liveness timeout",
+			zap.String("URL", u.url),
+			zap.Duration("Liveness timeout", time.Duration(p.livenessTimeout.Load())),
+		)
+	}
 }
 
 // Close stops and removes all subscribers
 func (p *Proxy) Close() {
-	for _, stopChannel := range p.stopChannels {
-		close(stopChannel)
+	for _, url := range p.Upstreams() {
+		p.RemoveUpstream(url)
 	}
-	p.stopChannels = nil
 	p.publisher.Close()
+	if p.stopSnapshot != nil {
+		p.stopSnapshot()
+	}
 }
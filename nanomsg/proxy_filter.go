@@ -0,0 +1,141 @@
+package nanomsg
+
+import (
+	"strings"
+
+	"github.com/munnik/gosk/message"
+)
+
+// A value or raw message matches the rule when all fields that are set match, the path is a prefix. Rules with a context
+// or path never match raw messages.
+type ProxyRule struct {
+	Exclude   bool
+	Context   string
+	Path      string
+	Connector string
+	Type      string
+}
+
+func (r ProxyRule) matchesValue(context string, source message.Source, path string) bool {
+	return (r.Context == "" || r.Context == context) &&
+		(r.Path == "" || strings.HasPrefix(path, r.Path)) &&
+		(r.Connector == "" || r.Connector == source.Label) &&
+		(r.Type == "" || r.Type == source.Type)
+}
+
+func (r ProxyRule) matchesRaw(raw *message.Raw) bool {
+	return r.Context == "" && r.Path == "" &&
+		(r.Connector == "" || r.Connector == raw.Connector) &&
+		(r.Type == "" || r.Type == raw.Type)
+}
+
+// ProxyFilter rewrites the contexts of mapped messages and forwards only the values and raw messages that pass the rules
+type ProxyFilter struct {
+	rules           []ProxyRule
+	includes        bool
+	contextRewrites map[string]string
+}
+
+func NewProxyFilter(rules []ProxyRule, contextRewrites map[string]string) *ProxyFilter {
+	result := &ProxyFilter{rules: rules, contextRewrites: contextRewrites}
+	for _, r := range rules {
+		if !r.Exclude {
+			result.includes = true
+		}
+	}
+	return result
+}
+
+func (f *ProxyFilter) empty() bool {
+	return f == nil || (len(f.rules) == 0 && len(f.contextRewrites) == 0)
+}
+
+// when there are include rules at least one has to match, no exclude rule may match
+func (f *ProxyFilter) passes(matches func(ProxyRule) bool) bool {
+	included := !f.includes
+	for _, r := range f.rules {
+		if !matches(r) {
+			continue
+		}
+		if r.Exclude {
+			return false
+		}
+		included = true
+	}
+	return included
+}
+
+// Returns the bytes to forward, the received bytes are returned unchanged when nothing is filtered or rewritten so the
+// format and the topic are kept. Returns false when nothing is left to forward.
+func (f *ProxyFilter) apply(received []byte) ([]byte, bool) {
+	if f.empty() {
+		return received, true
+	}
+	topic, payload := splitTopic(received)
+	format := FormatJSON
+	if len(payload) > 0 && Format(payload[0]) == FormatBinaryV1 {
+		format = FormatBinaryV1
+	}
+
+	mapped := new(message.Mapped)
+	if err := unmarshal(payload, mapped); err == nil && len(mapped.Updates) > 0 {
+		if !f.applyMapped(mapped) {
+			return received, true
+		}
+		if len(mapped.Updates) == 0 {
+			return nil, false
+		}
+		if to, ok := f.contextRewrites[string(topic)]; ok {
+			topic = []byte(to)
+		}
+		return f.marshal(format, topic, mapped)
+	}
+
+	raw := new(message.Raw)
+	if err := unmarshal(payload, raw); err == nil && raw.Connector != "" {
+		if !f.passes(func(r ProxyRule) bool { return r.matchesRaw(raw) }) {
+			return nil, false
+		}
+	}
+	// dead letters and messages that can't be decoded are forwarded unchanged
+	return received, true
+}
+
+// rewrites the context and removes the values that don't pass, returns false when the message is unchanged
+func (f *ProxyFilter) applyMapped(m *message.Mapped) bool {
+	changed := false
+	if to, ok := f.contextRewrites[m.Context]; ok {
+		m.Context = to
+		changed = true
+	}
+	updates := make([]message.Update, 0, len(m.Updates))
+	for _, u := range m.Updates {
+		values := make([]message.Value, 0, len(u.Values))
+		for _, v := range u.Values {
+			if f.passes(func(r ProxyRule) bool { return r.matchesValue(m.Context, u.Source, v.Path) }) {
+				values = append(values, v)
+			}
+		}
+		if len(values) != len(u.Values) {
+			changed = true
+		}
+		if len(values) > 0 {
+			u.Values = values
+			updates = append(updates, u)
+		}
+	}
+	m.Updates = updates
+	return changed
+}
+
+func (f *ProxyFilter) marshal(format Format, topic []byte, m *message.Mapped) ([]byte, bool) {
+	bytes, err := marshal(format, m)
+	if err != nil {
+		dropped(dropReasonMarshal)
+		return nil, false
+	}
+	if topic != nil {
+		bytes = addTopic(string(topic), bytes)
+	}
+	return bytes, true
+}
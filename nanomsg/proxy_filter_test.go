@@ -0,0 +1,161 @@
+package nanomsg_test
+
+import (
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// two values of connector a and one value of connector b
+func proxyMapped(context string) *message.Mapped {
+	a := message.NewUpdate().WithSource(*message.NewSource().WithLabel("a").WithType("nmea0183")).
+		AddValue(message.NewValue().WithPath("navigation.speedOverGround").WithValue(3.5)).
+		AddValue(message.NewValue().WithPath("navigation.courseOverGround").WithValue(1.2))
+	b := message.NewUpdate().WithSource(*message.NewSource().WithLabel("b").WithType("modbus")).
+		AddValue(message.NewValue().WithPath("propulsion.main.revolutions").WithValue(12.0))
+	return message.NewMapped().WithContext(context).AddUpdate(a).AddUpdate(b)
+}
+
+func encode(format Format, topic string, m any) []byte {
+	bytes, err := Marshal(format, m)
+	Expect(err).NotTo(HaveOccurred())
+	if topic != "" {
+		bytes = AddTopic(topic, bytes)
+	}
+	return bytes
+}
+
+// the topic and the paths of the forwarded message, the format has to be kept
+func decode(format Format, forwarded []byte) (string, *message.Mapped) {
+	topic, payload := SplitTopic(forwarded)
+	Expect(payload).NotTo(BeEmpty())
+	Expect(Format(payload[0])).To(Equal(format))
+	m := new(message.Mapped)
+	Expect(Unmarshal(payload, m)).To(Succeed())
+	return string(topic), m
+}
+
+func paths(m *message.Mapped) []string {
+	result := make([]string, 0)
+	for _, u := range m.Updates {
+		for _, v := range u.Values {
+			result = append(result, v.Path)
+		}
+	}
+	return result
+}
+
+var _ = Describe("ProxyFilter", func() {
+	const context = "vessels.urn:mrn:imo:mmsi:244000000"
+
+	DescribeTable("removes the values that don't pass and keeps the format and the topic",
+		func(format Format, topic string) {
+			f := NewProxyFilter([]ProxyRule{{Exclude: true, Path: "navigation.course"}}, nil)
+			forwarded, ok := f.Apply(encode(format, topic, proxyMapped(context)))
+			Expect(ok).To(BeTrue())
+			forwardedTopic, m := decode(format, forwarded)
+			Expect(forwardedTopic).To(Equal(topic))
+			Expect(m.Context).To(Equal(context))
+			Expect(paths(m)).To(Equal([]string{"navigation.speedOverGround", "propulsion.main.revolutions"}))
+		},
+		Entry("json without a topic", FormatJSON, ""),
+		Entry("json with a topic", FormatJSON, "navigation"),
+		Entry("binary without a topic", FormatBinaryV1, ""),
+		Entry("binary with a topic", FormatBinaryV1, "navigation"),
+	)
+	DescribeTable("forwards the received bytes unchanged when nothing is removed",
+		func(format Format, topic string) {
+			received := encode(format, topic, proxyMapped(context))
+			f := NewProxyFilter([]ProxyRule{{Exclude: true, Path: "environment"}}, nil)
+			forwarded, ok := f.Apply(received)
+			Expect(ok).To(BeTrue())
+			Expect(forwarded).To(Equal(received))
+		},
+		Entry("json without a topic", FormatJSON, ""),
+		Entry("json with a topic", FormatJSON, "navigation"),
+		Entry("binary without a topic", FormatBinaryV1, ""),
+		Entry("binary with a topic", FormatBinaryV1, "navigation"),
+	)
+	DescribeTable("drops the mapped message when no value passes",
+		func(format Format, topic string) {
+			f := NewProxyFilter([]ProxyRule{{Connector: "c"}}, nil)
+			_, ok := f.Apply(encode(format, topic, proxyMapped(context)))
+			Expect(ok).To(BeFalse())
+		},
+		Entry("json without a topic", FormatJSON, ""),
+		Entry("json with a topic", FormatJSON, "navigation"),
+		Entry("binary without a topic", FormatBinaryV1, ""),
+		Entry("binary with a topic", FormatBinaryV1, "navigation"),
+	)
+	DescribeTable("rewrites the context and the topic that is the context",
+		func(format Format, topic string, expectedTopic string) {
+			f := NewProxyFilter(nil, map[string]string{context: "vessels.self"})
+			forwarded, ok := f.Apply(encode(format, topic, proxyMapped(context)))
+			Expect(ok).To(BeTrue())
+			forwardedTopic, m := decode(format, forwarded)
+			Expect(forwardedTopic).To(Equal(expectedTopic))
+			Expect(m.Context).To(Equal("vessels.self"))
+			Expect(paths(m)).To(HaveLen(3))
+		},
+		Entry("json without a topic", FormatJSON, "", ""),
+		Entry("json with the context as topic", FormatJSON, context, "vessels.self"),
+		Entry("json with another topic", FormatJSON, "mapped", "mapped"),
+		Entry("binary without a topic", FormatBinaryV1, "", ""),
+		Entry("binary with the context as topic", FormatBinaryV1, context, "vessels.self"),
+		Entry("binary with another topic", FormatBinaryV1, "mapped", "mapped"),
+	)
+	DescribeTable("applies the include and exclude rules to the mapped values",
+		func(rules []ProxyRule, expected []string) {
+			m := proxyMapped(context)
+			Expect(NewProxyFilter(rules, nil).ApplyMapped(m)).To(Equal(len(expected) != 3))
+			Expect(paths(m)).To(Equal(expected))
+		},
+		Entry("no rules", []ProxyRule{},
+			[]string{"navigation.speedOverGround", "navigation.courseOverGround", "propulsion.main.revolutions"}),
+		Entry("only excludes pass everything else", []ProxyRule{{Exclude: true, Type: "modbus"}},
+			[]string{"navigation.speedOverGround", "navigation.courseOverGround"}),
+		Entry("includes pass only what matches", []ProxyRule{{Path: "propulsion"}},
+			[]string{"propulsion.main.revolutions"}),
+		Entry("one of the includes has to match", []ProxyRule{{Path: "propulsion"}, {Connector: "a", Path: "navigation.speed"}},
+			[]string{"navigation.speedOverGround", "propulsion.main.revolutions"}),
+		Entry("excludes win over includes", []ProxyRule{{Connector: "a"}, {Exclude: true, Path: "navigation.course"}},
+			[]string{"navigation.speedOverGround"}),
+		Entry("the order of the rules doesn't matter", []ProxyRule{{Exclude: true, Path: "navigation.course"}, {Connector: "a"}},
+			[]string{"navigation.speedOverGround"}),
+		Entry("all fields of a rule have to match", []ProxyRule{{Context: "vessels.other", Connector: "a"}, {Connector: "b"}},
+			[]string{"propulsion.main.revolutions"}),
+	)
+	It("reports an unchanged mapped message", func() {
+		m := proxyMapped(context)
+		Expect(NewProxyFilter([]ProxyRule{{Context: context}}, map[string]string{"vessels.other": "vessels.self"}).ApplyMapped(m)).To(BeFalse())
+		Expect(m.Context).To(Equal(context))
+		Expect(paths(m)).To(HaveLen(3))
+	})
+	DescribeTable("applies the include and exclude rules to raw messages",
+		func(format Format, topic string, rules []ProxyRule, passes bool) {
+			received := encode(format, topic, message.NewRaw().WithConnector("a").WithType("nmea0183").WithValue([]byte("$GPRMC")))
+			forwarded, ok := NewProxyFilter(rules, nil).Apply(received)
+			Expect(ok).To(Equal(passes))
+			if passes {
+				Expect(forwarded).To(Equal(received))
+			}
+		},
+		Entry("json included by the connector", FormatJSON, "", []ProxyRule{{Connector: "a"}}, true),
+		Entry("binary included by the connector", FormatBinaryV1, "raw", []ProxyRule{{Connector: "a"}}, true),
+		Entry("json not included", FormatJSON, "raw", []ProxyRule{{Connector: "b"}}, false),
+		Entry("binary not included", FormatBinaryV1, "", []ProxyRule{{Connector: "b"}}, false),
+		Entry("json excluded by the type", FormatJSON, "", []ProxyRule{{Exclude: true, Type: "nmea0183"}}, false),
+		Entry("binary excluded by the type", FormatBinaryV1, "raw", []ProxyRule{{Exclude: true, Type: "nmea0183"}}, false),
+		Entry("excludes win over includes", FormatJSON, "", []ProxyRule{{Connector: "a"}, {Exclude: true, Type: "nmea0183"}}, false),
+		Entry("rules with a path never match", FormatJSON, "", []ProxyRule{{Path: "navigation"}}, false),
+		Entry("excludes with a path never match", FormatBinaryV1, "", []ProxyRule{{Exclude: true, Path: "navigation"}}, true),
+	)
+	It("forwards everything when there is no filter", func() {
+		var f *ProxyFilter
+		received := encode(FormatJSON, "raw", message.NewRaw().WithConnector("a"))
+		forwarded, ok := f.Apply(received)
+		Expect(ok).To(BeTrue())
+		Expect(forwarded).To(Equal(received))
+	})
+})
@@ -0,0 +1,126 @@
+package nanomsg_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// an upstream publisher that sends raw messages of its own connector
+type upstreamPublisher struct {
+	url string
+	in  chan *message.Raw
+}
+
+func newUpstreamPublisher(url string) *upstreamPublisher {
+	result := &upstreamPublisher{url: url, in: make(chan *message.Raw, 10)}
+	go NewPublisher[message.Raw](url).Send(result.in)
+	return result
+}
+
+// sends a message and reports whether a message of the upstream is forwarded, the first messages are lost while the
+// proxy is connecting
+func (u *upstreamPublisher) forwarded(out chan *message.Raw) bool {
+	u.in <- message.NewRaw().WithConnector(u.url)
+	for {
+		select {
+		case r := <-out:
+			if r.Connector == u.url {
+				return true
+			}
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	}
+}
+
+var _ = Describe("Proxy", func() {
+	var (
+		proxy  *Proxy
+		out    chan *message.Raw
+		cancel context.CancelFunc
+	)
+	BeforeEach(func() {
+		url := "inproc://proxy-" + CurrentSpecReport().LeafNodeText
+		proxy = NewProxy(url)
+		subscriber, err := NewSubscriber[message.Raw](url, []byte{})
+		Expect(err).NotTo(HaveOccurred())
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		out = make(chan *message.Raw, 100)
+		go subscriber.Receive(ctx, out)
+	})
+	AfterEach(func() {
+		cancel()
+		proxy.Close()
+	})
+
+	It("forwards the messages of upstreams that are added and removed while running", func() {
+		first := newUpstreamPublisher("inproc://proxy-upstream-first")
+		second := newUpstreamPublisher("inproc://proxy-upstream-second")
+		defer close(first.in)
+		defer close(second.in)
+
+		Expect(proxy.AddUpstream(first.url)).To(Succeed())
+		Expect(proxy.Upstreams()).To(ConsistOf(first.url))
+		Eventually(first.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+
+		Expect(proxy.AddUpstream(second.url)).To(Succeed())
+		Expect(proxy.Upstreams()).To(ConsistOf(first.url, second.url))
+		Eventually(second.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+		Expect(first.forwarded(out)).To(BeTrue())
+
+		proxy.RemoveUpstream(first.url)
+		Expect(proxy.Upstreams()).To(ConsistOf(second.url))
+		Consistently(first.forwarded).WithArguments(out).WithTimeout(200 * time.Millisecond).Should(BeFalse())
+		Expect(second.forwarded(out)).To(BeTrue())
+	})
+	It("subscribes to exactly the upstreams that are set", func() {
+		first := newUpstreamPublisher("inproc://proxy-set-first")
+		second := newUpstreamPublisher("inproc://proxy-set-second")
+		defer close(first.in)
+		defer close(second.in)
+
+		proxy.SetUpstreams([]string{first.url})
+		Expect(proxy.Upstreams()).To(ConsistOf(first.url))
+		Eventually(first.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+
+		proxy.SetUpstreams([]string{second.url})
+		Expect(proxy.Upstreams()).To(ConsistOf(second.url))
+		Eventually(second.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+		Consistently(first.forwarded).WithArguments(out).WithTimeout(200 * time.Millisecond).Should(BeFalse())
+
+		proxy.SetUpstreams(nil)
+		Expect(proxy.Upstreams()).To(BeEmpty())
+		Consistently(second.forwarded).WithArguments(out).WithTimeout(200 * time.Millisecond).Should(BeFalse())
+	})
+	It("connects to an upstream that starts after it is added", func() {
+		url := "inproc://proxy-late-upstream"
+		Expect(proxy.AddUpstream(url)).To(Succeed())
+		Expect(proxy.AddUpstream(url)).To(Succeed())
+		Expect(proxy.Upstreams()).To(ConsistOf(url))
+
+		late := newUpstreamPublisher(url)
+		defer close(late.in)
+		Eventually(late.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+	})
+	It("filters the messages of all upstreams", func() {
+		upstream := newUpstreamPublisher("inproc://proxy-filtered")
+		defer close(upstream.in)
+		Expect(proxy.AddUpstream(upstream.url)).To(Succeed())
+		Eventually(upstream.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+
+		proxy.SetFilter(NewProxyFilter([]ProxyRule{{Exclude: true, Connector: upstream.url}}, nil))
+		Consistently(upstream.forwarded).WithArguments(out).WithTimeout(200 * time.Millisecond).Should(BeFalse())
+		proxy.SetFilter(nil)
+		Eventually(upstream.forwarded).WithArguments(out).WithTimeout(2 * time.Second).Should(BeTrue())
+	})
+	It("only subscribes to mangos sockets", func() {
+		Expect(proxy.AddUpstream("nats://localhost:4222")).NotTo(Succeed())
+		Expect(proxy.Upstreams()).To(BeEmpty())
+	})
+})
@@ -1,20 +1,26 @@
 package nanomsg
 
 import (
-	"encoding/json"
+	"context"
 
 	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
 	"github.com/prometheus/client_golang/prometheus"
-	"go.nanomsg.org/mangos/v3"
-	"go.nanomsg.org/mangos/v3/protocol/pub"
 	"go.uber.org/zap"
-
-	// register transports
-	_ "go.nanomsg.org/mangos/v3/transport/all"
 )
 
+const defaultPublisherWorkers = 4
+
 type Publisher[T Message] struct {
-	socket mangos.Socket
+	bus      BusPublisher
+	format   Format
+	topicKey TopicKey
+	workers  int
+	done     chan struct{}
+
+	snapshotURL  string
+	snapshot     *Snapshot[T]
+	stopSnapshot context.CancelFunc
 
 	receivedCounter   prometheus.Counter
 	marshalledCounter prometheus.Counter
@@ -24,6 +30,34 @@ type Publisher[T Message] struct {
 
 type PublisherOption[T Message] func(*Publisher[T])
 
+func WithPublisherFormat[T Message](f Format) PublisherOption[T] {
+	return func(p *Publisher[T]) {
+		p.format = f
+	}
+}
+
+func WithPublisherTopicKey[T Message](k TopicKey) PublisherOption[T] {
+	return func(p *Publisher[T]) {
+		p.topicKey = k
+	}
+}
+
+// The number of messages that are marshalled at the same time, the order of the messages is kept
+func WithPublisherWorkers[T Message](n int) PublisherOption[T] {
+	return func(p *Publisher[T]) {
+		if n > 0 {
+			p.workers = n
+		}
+	}
+}
+
+// The last messages are kept and served on the url, no snapshot is kept when the url is empty
+func WithPublisherSnapshot[T Message](url string) PublisherOption[T] {
+	return func(p *Publisher[T]) {
+		p.snapshotURL = url
+	}
+}
+
 func WithPublisherReceivedCounter[T Message](c prometheus.Counter) PublisherOption[T] {
 	return func(p *Publisher[T]) {
 		p.receivedCounter = c
@@ -49,34 +83,44 @@ func WithPublisherBufferSizeGauge[T Message](g prometheus.Gauge) PublisherOption
 }
 
 func NewPublisher[T Message](url string, opts ...PublisherOption[T]) *Publisher[T] {
-	socket, err := pub.NewSocket()
+	bus, err := busFor(url).Publish(url)
 	if err != nil {
-		logger.GetLogger().Fatal(
-			"Could not create publisher",
-			zap.String("Error", err.Error()),
-		)
-	}
-	if err := socket.Listen(url); err != nil {
 		logger.GetLogger().Fatal(
 			"Could not listen on the URL",
 			zap.String("URL", url),
 			zap.String("Error", err.Error()),
 		)
 	}
-	result := &Publisher[T]{socket: socket}
+	result := &Publisher[T]{bus: bus, format: defaultFormat, topicKey: defaultTopicKey, workers: defaultPublisherWorkers, done: make(chan struct{})}
+	if _, ok := any(result).(*Publisher[message.DeadLetter]); !ok {
+		result.snapshotURL = defaultSnapshotServeURL
+	}
 	for _, o := range opts {
 		o(result)
 	}
+	if result.snapshotURL != "" {
+		result.snapshot = NewSnapshot[T](result.format, result.topicKey, defaultSnapshotMaxAge)
+		var ctx context.Context
+		ctx, result.stopSnapshot = context.WithCancel(context.Background())
+		if err := result.snapshot.Serve(ctx, result.snapshotURL); err != nil {
+			logger.GetLogger().Fatal(
+				"Could not serve the snapshot on the URL",
+				zap.String("URL", result.snapshotURL),
+				zap.String("Error", err.Error()),
+			)
+		}
+	}
 	return result
 }
 
-func (p *Publisher[T]) send(bytes []byte) {
-	if err := p.socket.Send(bytes); err != nil {
+func (p *Publisher[T]) send(m published) {
+	if err := p.bus.Send(m.subject, m.bytes); err != nil {
 		logger.GetLogger().Warn(
 			"Unable to send the message using NanoMSG",
-			zap.ByteString("Message", bytes),
+			zap.ByteString("Message", m.bytes),
 			zap.String("Error", err.Error()),
 		)
+		dropped(dropReasonSend)
 		return
 	}
 	if p.publishedCounter != nil {
@@ -84,27 +128,80 @@ func (p *Publisher[T]) send(bytes []byte) {
 	}
 }
 
+// Marshals the messages with a number of workers, the messages are sent in the order they are put in the buffer. When the
+// buffer is closed the remaining messages are sent and the socket is closed.
 func (p *Publisher[T]) Send(buffer chan *T) {
 	go checkBufferSize(buffer, "send", p.bufferSizeGauge)
 
+	// the marshalled messages in the order they are received, at most workers messages are marshalled at the same time
+	ordered := make(chan chan []published, p.workers)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for result := range ordered {
+			for _, m := range <-result {
+				p.send(m)
+			}
+		}
+	}()
+	defer func() {
+		close(ordered)
+		<-sent
+		p.bus.Close()
+		if p.stopSnapshot != nil {
+			p.stopSnapshot()
+		}
+		close(p.done)
+	}()
+
+	workers := make(chan struct{}, p.workers)
 	for m := range buffer {
 		if p.receivedCounter != nil {
 			p.receivedCounter.Inc()
 		}
+		if p.snapshot != nil {
+			p.snapshot.Update(m)
+		}
+		result := make(chan []published, 1)
+		workers <- struct{}{}
+		ordered <- result
 		go func(m *T) {
-			var bytes []byte
-			var err error
-			if bytes, err = json.Marshal(m); err != nil {
-				logger.GetLogger().Warn(
-					"Could not marshal the mapped data",
-					zap.String("Error", err.Error()),
-				)
-				return
-			}
-			if p.marshalledCounter != nil {
-				p.marshalledCounter.Inc()
-			}
-			p.send(bytes)
+			defer func() { <-workers }()
+			result <- p.marshal(m)
 		}(m)
 	}
 }
+
+// Closed when Send returned, all messages of the closed buffer are sent
+func (p *Publisher[T]) Done() <-chan struct{} {
+	return p.done
+}
+
+// a marshalled message and the subject it is sent on
+type published struct {
+	subject string
+	bytes   []byte
+}
+
+func (p *Publisher[T]) marshal(m *T) []published {
+	result := make([]published, 0, 1)
+	for _, tm := range withTopics(p.topicKey, m) {
+		bytes, err := marshal(p.format, tm.message)
+		if err != nil {
+			logger.GetLogger().Warn(
+				"Could not marshal the mapped data",
+				zap.String("Error", err.Error()),
+			)
+			dropped(dropReasonMarshal)
+			continue
+		}
+		if p.marshalledCounter != nil {
+			p.marshalledCounter.Inc()
+		}
+		if p.topicKey != TopicKeyNone {
+			bytes = addTopic(tm.topic, bytes)
+		}
+		result = append(result, published{subject: subjectOf(tm.message), bytes: bytes})
+	}
+	return result
+}
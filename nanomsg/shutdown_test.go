@@ -0,0 +1,63 @@
+package nanomsg_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shutdown", func() {
+	It("closes the buffer of the subscriber when the context is done", func() {
+		url := "inproc://shutdown-subscriber"
+		in := make(chan *message.Raw, 10)
+		publisher := NewPublisher[message.Raw](url)
+		go publisher.Send(in)
+		subscriber, err := NewSubscriber[message.Raw](url, []byte{})
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan *message.Raw, 10)
+		go subscriber.Receive(ctx, out)
+		Eventually(func() []*message.Raw {
+			in <- message.NewRaw().WithConnector("test").WithValue([]byte("$GPRMC"))
+			return drain(out)
+		}).WithTimeout(time.Second).ShouldNot(BeEmpty())
+
+		cancel()
+		Eventually(out).WithTimeout(time.Second).Should(BeClosed())
+		close(in)
+		Eventually(publisher.Done()).WithTimeout(time.Second).Should(BeClosed())
+	})
+	It("sends the messages of the closed buffer before it is done", func() {
+		in := make(chan *message.Raw, 10)
+		publisher := NewPublisher[message.Raw]("inproc://shutdown-publisher")
+		go publisher.Send(in)
+		Consistently(publisher.Done()).WithTimeout(50 * time.Millisecond).ShouldNot(BeClosed())
+
+		for i := 0; i < 5; i++ {
+			in <- message.NewRaw().WithConnector("test").WithValue([]byte{byte(i)})
+		}
+		close(in)
+		Eventually(publisher.Done()).WithTimeout(time.Second).Should(BeClosed())
+	})
+})
+
+// the messages that are in the buffer, without waiting for more
+func drain(out chan *message.Raw) []*message.Raw {
+	result := make([]*message.Raw, 0)
+	for {
+		select {
+		case m, ok := <-out:
+			if !ok {
+				return result
+			}
+			result = append(result, m)
+		case <-time.After(20 * time.Millisecond):
+			return result
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package nanomsg
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/munnik/gosk/logger"
+	"github.com/munnik/gosk/message"
+	"go.nanomsg.org/mangos/v3"
+	"go.nanomsg.org/mangos/v3/protocol/rep"
+	"go.nanomsg.org/mangos/v3/protocol/req"
+	"go.uber.org/zap"
+)
+
+// the url publishers serve their snapshot on when they are created without a snapshot option
+var defaultSnapshotServeURL = ""
+
+// the url subscribers fetch a snapshot from when they are created without a snapshot option
+var defaultSnapshotFetchURL = ""
+
+// the messages that are not updated for this long are removed from the snapshots in this process, never when zero
+var defaultSnapshotMaxAge = time.Hour
+
+// how long a subscriber waits for a snapshot before it only consumes the live messages
+const snapshotTimeout = 10 * time.Second
+
+// Sets the url all publishers in this process serve their snapshot on, dead letters are never kept in a snapshot
+func SetDefaultSnapshotServeURL(url string) {
+	defaultSnapshotServeURL = url
+}
+
+// Sets the url all subscribers in this process fetch a snapshot from before they consume the live messages
+func SetDefaultSnapshotFetchURL(url string) {
+	defaultSnapshotFetchURL = url
+}
+
+// Sets how long the snapshots in this process keep a message that is not updated, messages are kept forever when zero
+func SetDefaultSnapshotMaxAge(d time.Duration) {
+	defaultSnapshotMaxAge = d
+}
+
+// Snapshot keeps the last message per key, mapped messages are kept per context and path and raw messages per connector
+// and type. Late joining subscribers request the snapshot so they don't have to wait until each path is updated again.
+type Snapshot[T Message] struct {
+	mutex    sync.RWMutex
+	format   Format
+	topicKey TopicKey // the topics of the messages are served so subscribers only get the messages of their topics
+	maxAge   time.Duration
+	keys     []string // the order the keys were first seen in
+	last     map[string]snapshotMessage[T]
+	evicted  time.Time
+}
+
+type snapshotMessage[T Message] struct {
+	message *T
+	topics  [][]byte // the topics the message is published on, with the separator like they are put in front of the payload
+	updated time.Time
+}
+
+// Messages that are not updated within the max age are removed, messages are kept forever when the max age is zero. The
+// topic key is the key of the publisher of the messages.
+func NewSnapshot[T Message](format Format, topicKey TopicKey, maxAge time.Duration) *Snapshot[T] {
+	return &Snapshot[T]{format: format, topicKey: topicKey, maxAge: maxAge, last: make(map[string]snapshotMessage[T]), evicted: time.Now()}
+}
+
+// Keeps the message, older messages with the same key are replaced
+func (s *Snapshot[T]) Update(m *T) {
+	s.update(m, nil)
+}
+
+// keeps the message that is published on the topic, the topics are taken from the topic key when the topic is nil
+func (s *Snapshot[T]) update(m *T, topic []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for _, k := range snapshotKeys(m) {
+		if _, ok := s.last[k.topic]; !ok {
+			s.keys = append(s.keys, k.topic)
+		}
+		topics := [][]byte{{}}
+		switch {
+		case topic != nil:
+			topics[0] = addTopic(string(topic), nil)
+		case s.topicKey != TopicKeyNone:
+			topics = topics[:0]
+			for _, tm := range withTopics(s.topicKey, k.message) {
+				topics = append(topics, addTopic(tm.topic, nil))
+			}
+		}
+		s.last[k.topic] = snapshotMessage[T]{message: k.message, topics: topics, updated: now}
+	}
+	// the keys are checked once per max age so the messages are removed at most twice the max age after their last update
+	if s.maxAge > 0 && now.Sub(s.evicted) >= s.maxAge {
+		s.evict(now)
+	}
+}
+
+func (s *Snapshot[T]) evict(now time.Time) {
+	keys := s.keys[:0]
+	for _, k := range s.keys {
+		if s.expired(s.last[k], now) {
+			delete(s.last, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	clear(s.keys[len(keys):])
+	s.keys = keys
+	s.evicted = now
+}
+
+func (s *Snapshot[T]) expired(m snapshotMessage[T], now time.Time) bool {
+	return s.maxAge > 0 && now.Sub(m.updated) > s.maxAge
+}
+
+// The last messages in the order their keys were first seen, messages older than the max age are left out
+func (s *Snapshot[T]) Messages() []*T {
+	return s.messages(nil)
+}
+
+// the last messages that are published on one of the topics, all messages when there are no topics
+func (s *Snapshot[T]) messages(topics [][]byte) []*T {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	now := time.Now()
+	result := make([]*T, 0, len(s.keys))
+	for _, k := range s.keys {
+		if m := s.last[k]; !s.expired(m, now) && matchesTopics(m.topics, topics) {
+			result = append(result, m.message)
+		}
+	}
+	return result
+}
+
+// Replies to every request with the last messages until the context is done, the request contains the topics of the
+// subscriber separated by the topic separator and only the messages of those topics are replied
+func (s *Snapshot[T]) Serve(ctx context.Context, url string) error {
+	socket, err := rep.NewSocket()
+	if err != nil {
+		return err
+	}
+	if err := socket.Listen(url); err != nil {
+		socket.Close()
+		return err
+	}
+	// closing the socket stops a blocking receive
+	context.AfterFunc(ctx, func() { socket.Close() })
+	go func() {
+		for {
+			request, err := socket.Recv()
+			if err != nil {
+				if err == mangos.ErrClosed {
+					return
+				}
+				logger.GetLogger().Warn(
+					"Could not receive a snapshot request",
+					zap.String("URL", url),
+					zap.String("Error", err.Error()),
+				)
+				continue
+			}
+			var topics [][]byte
+			if len(request) > 0 {
+				topics = bytes.Split(request, []byte{topicSeparator})
+			}
+			messages := s.messages(topics)
+			reply, err := marshal(s.format, messages)
+			if err != nil {
+				logger.GetLogger().Warn(
+					"Could not marshal the snapshot",
+					zap.String("Error", err.Error()),
+				)
+				// the request socket is waiting for a reply
+				reply, _ = marshal(s.format, []*T{})
+			}
+			if err := socket.Send(reply); err != nil {
+				logger.GetLogger().Warn(
+					"Could not send the snapshot",
+					zap.String("URL", url),
+					zap.String("Error", err.Error()),
+				)
+				continue
+			}
+			logger.GetLogger().Info(
+				"Sent a snapshot",
+				zap.String("URL", url),
+				zap.Int("Messages", len(messages)),
+			)
+		}
+	}()
+	return nil
+}
+
+// Requests the last messages from a snapshot served on the url, only the messages with a topic that starts with one of the
+// topics are fetched
+func FetchSnapshot[T Message](url string, topics ...[]byte) ([]*T, error) {
+	socket, err := req.NewSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer socket.Close()
+	// a snapshot with static data of many vessels can be bigger than the default maximum
+	if err := socket.SetOption(mangos.OptionMaxRecvSize, 0); err != nil {
+		return nil, err
+	}
+	if err := socket.SetOption(mangos.OptionRecvDeadline, snapshotTimeout); err != nil {
+		return nil, err
+	}
+	if err := socket.SetOption(mangos.OptionSendDeadline, snapshotTimeout); err != nil {
+		return nil, err
+	}
+	if err := socket.DialOptions(url, map[string]interface{}{mangos.OptionDialAsynch: true}); err != nil {
+		return nil, err
+	}
+	if err := socket.Send(bytes.Join(topics, []byte{topicSeparator})); err != nil {
+		return nil, err
+	}
+	received, err := socket.Recv()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*T, 0)
+	if err := unmarshal(received, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// the keys of a message in the snapshot with the part of the message that belongs to the key
+func snapshotKeys[T Message](m *T) []topicMessage[T] {
+	switch v := any(m).(type) {
+	case *message.Raw:
+		return []topicMessage[T]{{topic: v.Connector + "/" + v.Type, message: m}}
+	case *message.Mapped:
+		result := make([]topicMessage[T], 0)
+		for _, s := range splitMapped(TopicKeyPath, v) {
+			result = append(result, topicMessage[T]{topic: v.Context + "/" + s.topic, message: any(s.message).(*T)})
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package nanomsg_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	const context1, context2 = "vessels.urn:mrn:imo:mmsi:234567890", "vessels.urn:mrn:imo:mmsi:123456789"
+	// the context and the path with the value of the kept messages
+	values := func(messages []*message.Mapped) []string {
+		result := make([]string, 0)
+		for _, m := range messages {
+			for _, u := range m.Updates {
+				for _, v := range u.Values {
+					result = append(result, fmt.Sprint(m.Context, " ", v.Path, " ", v.Value))
+				}
+			}
+		}
+		return result
+	}
+	mapped := func(context string, pathsAndValues ...any) *message.Mapped {
+		u := message.NewUpdate().WithSource(*message.NewSource().WithLabel("a").WithType("nmea0183"))
+		for i := 0; i < len(pathsAndValues); i += 2 {
+			u.AddValue(message.NewValue().WithPath(pathsAndValues[i].(string)).WithValue(pathsAndValues[i+1]))
+		}
+		return message.NewMapped().WithContext(context).AddUpdate(u)
+	}
+
+	Describe("Update", func() {
+		It("keeps the last value per context and path in the order they were first seen", func() {
+			s := NewSnapshot[message.Mapped](FormatJSON, TopicKeyNone, 0)
+			s.Update(mapped(context1, "navigation.speedOverGround", 1.0, "navigation.headingTrue", 2.0))
+			s.Update(mapped(context2, "navigation.speedOverGround", 3.0))
+			s.Update(mapped(context1, "navigation.speedOverGround", 4.0))
+			Expect(values(s.Messages())).To(Equal([]string{
+				context1 + " navigation.speedOverGround 4",
+				context1 + " navigation.headingTrue 2",
+				context2 + " navigation.speedOverGround 3",
+			}))
+		})
+		It("keeps the last raw message per connector and type", func() {
+			s := NewSnapshot[message.Raw](FormatJSON, TopicKeyNone, 0)
+			s.Update(message.NewRaw().WithConnector("a").WithType("nmea0183").WithValue([]byte("1")))
+			s.Update(message.NewRaw().WithConnector("b").WithType("nmea0183").WithValue([]byte("2")))
+			s.Update(message.NewRaw().WithConnector("a").WithType("nmea0183").WithValue([]byte("3")))
+			s.Update(message.NewRaw().WithConnector("a").WithType("modbus").WithValue([]byte("4")))
+			kept := make([]string, 0)
+			for _, r := range s.Messages() {
+				kept = append(kept, r.Connector+" "+r.Type+" "+string(r.Value))
+			}
+			Expect(kept).To(Equal([]string{"a nmea0183 3", "b nmea0183 2", "a modbus 4"}))
+		})
+		It("removes the values that are not updated within the max age", func() {
+			s := NewSnapshot[message.Mapped](FormatJSON, TopicKeyNone, 100*time.Millisecond)
+			s.Update(mapped(context1, "navigation.speedOverGround", 1.0, "navigation.headingTrue", 2.0))
+			time.Sleep(60 * time.Millisecond)
+			s.Update(mapped(context1, "navigation.headingTrue", 3.0))
+			time.Sleep(60 * time.Millisecond)
+			// the speed is too old, it is not served before it is removed
+			Expect(values(s.Messages())).To(Equal([]string{context1 + " navigation.headingTrue 3"}))
+
+			s.Update(mapped(context2, "navigation.speedOverGround", 4.0))
+			Expect(s.Len()).To(Equal(2))
+			Expect(values(s.Messages())).To(Equal([]string{
+				context1 + " navigation.headingTrue 3",
+				context2 + " navigation.speedOverGround 4",
+			}))
+		})
+		It("keeps the values forever without a max age", func() {
+			s := NewSnapshot[message.Mapped](FormatJSON, TopicKeyNone, 0)
+			s.Update(mapped(context1, "navigation.speedOverGround", 1.0))
+			time.Sleep(20 * time.Millisecond)
+			s.Update(mapped(context2, "navigation.speedOverGround", 2.0))
+			Expect(s.Len()).To(Equal(2))
+			Expect(s.Messages()).To(HaveLen(2))
+		})
+	})
+
+	Describe("Serve and FetchSnapshot", func() {
+		DescribeTable("serve the last values",
+			func(format Format, url string) {
+				s := NewSnapshot[message.Mapped](format, TopicKeyNone, time.Hour)
+				s.Update(mapped(context1, "navigation.speedOverGround", 1.0, "navigation.headingTrue", 2.0))
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				Expect(s.Serve(ctx, url)).To(Succeed())
+
+				fetched, err := FetchSnapshot[message.Mapped](url)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(values(fetched)).To(Equal(values(s.Messages())))
+
+				s.Update(mapped(context1, "navigation.speedOverGround", 3.0))
+				fetched, err = FetchSnapshot[message.Mapped](url)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(values(fetched)).To(Equal([]string{
+					context1 + " navigation.speedOverGround 3",
+					context1 + " navigation.headingTrue 2",
+				}))
+			},
+			Entry("json", FormatJSON, "inproc://snapshot-json"),
+			Entry("binary", FormatBinaryV1, "inproc://snapshot-binary"),
+		)
+		served := 0
+		DescribeTable("serve the last values of the topics of the subscriber",
+			func(key TopicKey, topics []string, expected []string) {
+				served++
+				url := fmt.Sprint("inproc://snapshot-topics-", served)
+				s := NewSnapshot[message.Mapped](FormatJSON, key, time.Hour)
+				s.Update(mapped(context1, "navigation.speedOverGround", 1.0, "navigation.headingTrue", 2.0))
+				s.Update(mapped(context2, "navigation.speedOverGround", 3.0))
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				Expect(s.Serve(ctx, url)).To(Succeed())
+
+				requested := make([][]byte, 0)
+				for _, t := range topics {
+					requested = append(requested, []byte(t))
+				}
+				fetched, err := FetchSnapshot[message.Mapped](url, requested...)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(values(fetched)).To(Equal(expected))
+			},
+			Entry("context", TopicKeyContext, []string{context2}, []string{context2 + " navigation.speedOverGround 3"}),
+			Entry("prefix of the context", TopicKeyContext, []string{"vessels."}, []string{
+				context1 + " navigation.speedOverGround 1",
+				context1 + " navigation.headingTrue 2",
+				context2 + " navigation.speedOverGround 3",
+			}),
+			Entry("path", TopicKeyPath, []string{"navigation.heading"}, []string{context1 + " navigation.headingTrue 2"}),
+			Entry("more topics", TopicKeyPath, []string{"navigation.heading", "environment"}, []string{context1 + " navigation.headingTrue 2"}),
+			Entry("empty topic", TopicKeyPath, []string{""}, []string{
+				context1 + " navigation.speedOverGround 1",
+				context1 + " navigation.headingTrue 2",
+				context2 + " navigation.speedOverGround 3",
+			}),
+			Entry("messages without a topic", TopicKeyNone, []string{context2}, []string{}),
+		)
+		It("sends the subscriber only the snapshot of its topics", func() {
+			url, snapshotURL := "inproc://snapshot-subscriber", "inproc://snapshot-subscriber-snapshot"
+			in := make(chan *message.Mapped, 2)
+			publisher := NewPublisher[message.Mapped](url, WithPublisherTopicKey[message.Mapped](TopicKeyContext), WithPublisherSnapshot[message.Mapped](snapshotURL))
+			go publisher.Send(in)
+			defer close(in)
+			in <- mapped(context1, "navigation.speedOverGround", 1.0)
+			in <- mapped(context2, "navigation.speedOverGround", 2.0)
+			Eventually(func() []*message.Mapped {
+				fetched, _ := FetchSnapshot[message.Mapped](snapshotURL)
+				return fetched
+			}).WithTimeout(time.Second).Should(HaveLen(2))
+
+			subscriber, err := NewSubscriber[message.Mapped](url, []byte(context2), WithSubscriberSnapshot[message.Mapped](snapshotURL))
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out := make(chan *message.Mapped, 10)
+			go subscriber.Receive(ctx, out)
+			var received *message.Mapped
+			Eventually(out).WithTimeout(time.Second).Should(Receive(&received))
+			Expect(values([]*message.Mapped{received})).To(Equal([]string{context2 + " navigation.speedOverGround 2"}))
+			Consistently(out).WithTimeout(200 * time.Millisecond).ShouldNot(Receive())
+		})
+		It("serves an empty snapshot", func() {
+			url := "inproc://snapshot-empty"
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(NewSnapshot[message.Raw](FormatJSON, TopicKeyNone, 0).Serve(ctx, url)).To(Succeed())
+			fetched, err := FetchSnapshot[message.Raw](url)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched).To(BeEmpty())
+		})
+		It("closes the socket when the context is done", func() {
+			url := "inproc://snapshot-closed"
+			ctx, cancel := context.WithCancel(context.Background())
+			Expect(NewSnapshot[message.Raw](FormatJSON, TopicKeyNone, 0).Serve(ctx, url)).To(Succeed())
+			Expect(NewSnapshot[message.Raw](FormatJSON, TopicKeyNone, 0).Serve(context.Background(), url)).NotTo(Succeed())
+			cancel()
+			other, stop := context.WithCancel(context.Background())
+			defer stop()
+			Eventually(func() error {
+				return NewSnapshot[message.Raw](FormatJSON, TopicKeyNone, 0).Serve(other, url)
+			}).WithTimeout(time.Second).Should(Succeed())
+		})
+	})
+})
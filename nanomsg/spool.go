@@ -0,0 +1,274 @@
+package nanomsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// the file starts with the offset of the first message that is not delivered yet
+const spoolHeaderSize = 8
+
+// A first in first out queue of messages in a file, used by subscribers with the spill policy. The file is emptied when all
+// messages are delivered and compacted when the delivered messages take up more space than the pending messages, messages
+// that are not delivered yet are delivered again after a restart.
+type spool struct {
+	mutex       sync.Mutex
+	path        string // empty when the file is a temporary file
+	file        *os.File
+	readOffset  int64
+	writeOffset int64
+	pending     int   // messages in the file and the message that is being delivered
+	maxBytes    int64 // the maximum size of the pending messages
+	available   chan struct{}
+}
+
+// Opens the spool file of the subscriber with the name, the messages that were left in the file are pending. A temporary file
+// is used when the file is locked by another subscriber.
+func newSpool(directory string, name string, maxBytes int64) (*spool, error) {
+	if directory == "" {
+		directory = os.TempDir()
+	}
+	path := filepath.Join(directory, "gosk-spool-"+url.QueryEscape(name))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if file, err = createTemp(directory); err != nil {
+			return nil, err
+		}
+		path = ""
+	}
+	result := &spool{path: path, file: file, maxBytes: maxBytes, available: make(chan struct{}, 1)}
+	if err := result.open(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// reads the header and counts the messages that are not delivered yet
+func (s *spool) open() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	s.writeOffset = info.Size()
+	if s.writeOffset < spoolHeaderSize {
+		s.empty()
+		return nil
+	}
+	header := make([]byte, spoolHeaderSize)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	s.readOffset = int64(binary.BigEndian.Uint64(header))
+	if s.readOffset < spoolHeaderSize || s.readOffset > s.writeOffset {
+		return fmt.Errorf("the spool file %s is corrupt", s.file.Name())
+	}
+	for offset := s.readOffset; offset < s.writeOffset; {
+		size, err := s.sizeAt(offset)
+		if err != nil || offset+4+size > s.writeOffset {
+			// the last message was not written completely
+			s.writeOffset = offset
+			break
+		}
+		offset += 4 + size
+		s.pending++
+	}
+	if s.pending > 0 {
+		s.available <- struct{}{}
+	}
+	return nil
+}
+
+// nobody else can find this file, it is removed when the file is closed
+func createTemp(directory string) (*os.File, error) {
+	file, err := os.CreateTemp(directory, "gosk-spool-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+	return file, nil
+}
+
+func (s *spool) sizeAt(offset int64) (int64, error) {
+	header := make([]byte, 4)
+	if _, err := s.file.ReadAt(header, offset); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint32(header)), nil
+}
+
+// the number of messages that are not delivered yet, received messages are spilled when this is not zero so the order is kept
+func (s *spool) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.pending
+}
+
+func (s *spool) push(bytes []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	size := int64(4 + len(bytes))
+	if s.writeOffset-s.readOffset+size > s.maxBytes {
+		return errSpoolFull
+	}
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record, uint32(len(bytes)))
+	copy(record[4:], bytes)
+	if _, err := s.file.WriteAt(record, s.writeOffset); err != nil {
+		return err
+	}
+	s.writeOffset += size
+	s.pending++
+	select {
+	case s.available <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// the next message, the message stays pending until done is called
+func (s *spool) pop() ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.readOffset >= s.writeOffset {
+		return nil, false, nil
+	}
+	size, err := s.sizeAt(s.readOffset)
+	if err != nil {
+		return nil, false, err
+	}
+	result := make([]byte, size)
+	if _, err := s.file.ReadAt(result, s.readOffset+4); err != nil {
+		return nil, false, err
+	}
+	s.readOffset += 4 + size
+	return result, true, nil
+}
+
+// the popped message is delivered, it is not delivered again after a restart
+func (s *spool) done() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending--
+	if s.pending == 0 {
+		s.empty()
+		return
+	}
+	// the file can become twice as large as the maximum size of the pending messages before it is compacted
+	if delivered := s.readOffset - spoolHeaderSize; delivered >= s.maxBytes/2 && delivered >= s.writeOffset-s.readOffset {
+		if err := s.compact(); err == nil {
+			return
+		}
+	}
+	s.writeHeader()
+}
+
+// Copies the pending messages to a new file that replaces the file, a crash leaves either the old or the new file. The
+// message that is being delivered is done so all messages before the read offset are delivered.
+func (s *spool) compact() error {
+	var file *os.File
+	var err error
+	if s.path == "" {
+		file, err = createTemp(filepath.Dir(s.file.Name()))
+	} else {
+		file, err = os.OpenFile(s.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err == nil {
+			err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		}
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}
+	header := make([]byte, spoolHeaderSize)
+	binary.BigEndian.PutUint64(header, spoolHeaderSize)
+	size := s.writeOffset - s.readOffset
+	if _, err = file.WriteAt(header, 0); err == nil {
+		_, err = io.Copy(io.NewOffsetWriter(file, spoolHeaderSize), io.NewSectionReader(s.file, s.readOffset, size))
+	}
+	if err == nil && s.path != "" {
+		err = os.Rename(file.Name(), s.path)
+	}
+	if err != nil {
+		file.Close()
+		if s.path != "" {
+			os.Remove(s.path + ".compact")
+		}
+		return err
+	}
+	s.file.Close()
+	s.file = file
+	s.readOffset = spoolHeaderSize
+	s.writeOffset = spoolHeaderSize + size
+	return nil
+}
+
+// removes the messages that can't be read, returns the number of removed messages
+func (s *spool) discard() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := s.pending
+	s.pending = 0
+	s.empty()
+	return result
+}
+
+func (s *spool) empty() {
+	s.readOffset = spoolHeaderSize
+	s.writeOffset = spoolHeaderSize
+	s.file.Truncate(spoolHeaderSize)
+	s.writeHeader()
+}
+
+func (s *spool) writeHeader() {
+	header := make([]byte, spoolHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(s.readOffset))
+	s.file.WriteAt(header, 0)
+}
+
+// Moves the messages from the file to the buffer, blocks while the buffer is full. Returns when the spool is closed and
+// all messages are moved.
+func (s *spool) drain(buffer chan []byte) {
+	defer func() {
+		// the file is replaced when it is compacted
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.file.Close()
+	}()
+	for range s.available {
+		for {
+			bytes, ok, err := s.pop()
+			if err != nil {
+				for i := s.discard(); i > 0; i-- {
+					dropped(dropReasonSpoolError)
+				}
+				break
+			}
+			if !ok {
+				break
+			}
+			buffer <- bytes
+			s.done()
+		}
+	}
+}
+
+// no messages are pushed after the spool is closed
+func (s *spool) close() {
+	close(s.available)
+}
+
+var errSpoolFull = errors.New("the spool file is full")
@@ -0,0 +1,153 @@
+package nanomsg_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Spool", func() {
+	var directory string
+	BeforeEach(func() {
+		directory = GinkgoT().TempDir()
+	})
+
+	It("pops the pushed messages in order", func() {
+		s, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Crash()
+		_, ok, err := s.Pop()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		Expect(s.Push([]byte("first"))).To(Succeed())
+		Expect(s.Push([]byte("second"))).To(Succeed())
+		Expect(s.Len()).To(Equal(2))
+		for _, expected := range []string{"first", "second"} {
+			bytes, ok, err := s.Pop()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(string(bytes)).To(Equal(expected))
+			s.Done()
+		}
+		Expect(s.Len()).To(BeZero())
+	})
+	It("refuses messages that don't fit next to the pending messages", func() {
+		s, err := NewSpool(directory, "inproc://spool", 24)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Crash()
+		Expect(s.Push([]byte("0123456789"))).To(Succeed())
+		Expect(s.Push([]byte("0123456789"))).To(MatchError(ErrSpoolFull))
+		Expect(s.Len()).To(Equal(1))
+	})
+	It("keeps accepting messages while they are delivered", func() {
+		const maxBytes = 256
+		s, err := NewSpool(directory, "inproc://spool", maxBytes)
+		Expect(err).ToNot(HaveOccurred())
+		buffer := make(chan []byte)
+		go s.Drain(buffer)
+		defer s.Close()
+		for i := range 1000 {
+			m := []byte(fmt.Sprintf("message %d", i))
+			Expect(s.Push(m)).To(Succeed())
+			Eventually(buffer).WithTimeout(time.Second).Should(Receive(Equal(m)))
+		}
+		info, err := os.Stat(filepath.Join(directory, "gosk-spool-"+url.QueryEscape("inproc://spool")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically("<=", 8+2*maxBytes))
+	})
+	It("delivers the messages that were not delivered before a restart after the file is compacted", func() {
+		s, err := NewSpool(directory, "inproc://spool", 48)
+		Expect(err).ToNot(HaveOccurred())
+		for _, m := range []string{"first", "second", "third", "fourth", "fifth"} {
+			Expect(s.Push([]byte(m))).To(Succeed())
+		}
+		for range 3 {
+			s.Pop()
+			s.Done()
+		}
+		info, err := os.Stat(filepath.Join(directory, "gosk-spool-"+url.QueryEscape("inproc://spool")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically("==", 8+4+len("fourth")+4+len("fifth")))
+		Expect(s.Push([]byte("sixth"))).To(Succeed())
+		s.Crash()
+
+		s, err = NewSpool(directory, "inproc://spool", 48)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Crash()
+		Expect(s.Len()).To(Equal(3))
+		for _, expected := range []string{"fourth", "fifth", "sixth"} {
+			bytes, ok, err := s.Pop()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(string(bytes)).To(Equal(expected))
+			s.Done()
+		}
+	})
+	It("drains the messages to the buffer until it is closed", func() {
+		s, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		buffer := make(chan []byte, 1)
+		drained := make(chan struct{})
+		go func() {
+			s.Drain(buffer)
+			close(drained)
+		}()
+		Expect(s.Push([]byte("first"))).To(Succeed())
+		Expect(s.Push([]byte("second"))).To(Succeed())
+		Eventually(buffer).WithTimeout(time.Second).Should(Receive(Equal([]byte("first"))))
+		s.Close()
+		Eventually(buffer).WithTimeout(time.Second).Should(Receive(Equal([]byte("second"))))
+		Eventually(drained).WithTimeout(time.Second).Should(BeClosed())
+	})
+	It("delivers the messages that were not delivered before a restart", func() {
+		s, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		for _, m := range []string{"first", "second", "third"} {
+			Expect(s.Push([]byte(m))).To(Succeed())
+		}
+		bytes, _, _ := s.Pop()
+		Expect(string(bytes)).To(Equal("first"))
+		s.Done()
+		s.Crash()
+
+		s, err = NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Crash()
+		Expect(s.Len()).To(Equal(2))
+		buffer := make(chan []byte, 2)
+		go s.Drain(buffer)
+		Eventually(buffer).WithTimeout(time.Second).Should(Receive(Equal([]byte("second"))))
+		Eventually(buffer).WithTimeout(time.Second).Should(Receive(Equal([]byte("third"))))
+	})
+	It("starts empty after a restart when all messages were delivered", func() {
+		s, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Push([]byte("first"))).To(Succeed())
+		s.Pop()
+		s.Done()
+		s.Crash()
+
+		s, err = NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Crash()
+		Expect(s.Len()).To(BeZero())
+	})
+	It("uses its own file when another subscriber with the same name has the file", func() {
+		first, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		defer first.Crash()
+		Expect(first.Push([]byte("first"))).To(Succeed())
+
+		second, err := NewSpool(directory, "inproc://spool", 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		defer second.Crash()
+		Expect(second.Len()).To(BeZero())
+	})
+})
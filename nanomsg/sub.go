@@ -1,22 +1,27 @@
 package nanomsg
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
 	"time"
 
-	"github.com/jpillora/backoff"
+	"github.com/munnik/gosk/health"
 	"github.com/munnik/gosk/logger"
 	"github.com/prometheus/client_golang/prometheus"
-	"go.nanomsg.org/mangos/v3"
-	"go.nanomsg.org/mangos/v3/protocol/sub"
 	"go.uber.org/zap"
-
-	// register transports
-	_ "go.nanomsg.org/mangos/v3/transport/all"
 )
 
 type Subscriber[T Message] struct {
-	socket mangos.Socket
+	bus        BusSubscriber
+	topics     [][]byte
+	dropPolicy DropPolicy
+	checkName  string // the name of the readiness check
+	spoolName  string // the name of the spool file, a subscriber to the same url and topics continues with the spilled messages
+
+	snapshotURL string
 
 	receivedCounter     prometheus.Counter
 	unmarshalledCounter prometheus.Counter
@@ -25,6 +30,20 @@ type Subscriber[T Message] struct {
 
 type SubscriberOption[T Message] func(*Subscriber[T])
 
+func WithSubscriberDropPolicy[T Message](p DropPolicy) SubscriberOption[T] {
+	return func(s *Subscriber[T]) {
+		s.dropPolicy = p
+	}
+}
+
+// The last messages are fetched from the url before the live messages are consumed, no snapshot is fetched when the url is
+// empty
+func WithSubscriberSnapshot[T Message](url string) SubscriberOption[T] {
+	return func(s *Subscriber[T]) {
+		s.snapshotURL = url
+	}
+}
+
 func WithSubscriberReceivedCounter[T Message](c prometheus.Counter) SubscriberOption[T] {
 	return func(s *Subscriber[T]) {
 		s.receivedCounter = c
@@ -42,90 +61,199 @@ func WithSubscriberBufferSizeGauge[T Message](g prometheus.Gauge) SubscriberOpti
 	}
 }
 
+// Only the messages with a topic that starts with the topic are received, the default topics are used when the topic is empty
 func NewSubscriber[T Message](url string, topic []byte, opts ...SubscriberOption[T]) (*Subscriber[T], error) {
-	socket, err := sub.NewSocket()
+	topics := [][]byte{topic}
+	if len(topic) == 0 && len(defaultTopics) > 0 {
+		topics = defaultTopics
+	}
+	spoolName := url + " " + string(bytes.Join(topics, []byte(",")))
+	// not ready until the publisher is dialled
+	checkName := health.InstanceName("subscriber", redact(url), string(bytes.Join(topics, []byte(","))))
+	dialling := time.Now()
+	health.Register(checkName, func() error { return health.FailingSince(dialling, errors.New("dialling the publisher")) })
+	bus, err := busFor(url).Subscribe(url, messageKind[T](), topics)
 	if err != nil {
+		health.Register(checkName, func() error { return health.FailingSince(dialling, fmt.Errorf("could not subscribe: %w", err)) })
 		return nil, err
 	}
 
-	b := &backoff.Backoff{
-		//These are the defaults
-		Min:    1 * time.Millisecond,
-		Max:    5 * time.Minute,
-		Factor: 1.5,
-		Jitter: false,
+	result := &Subscriber[T]{bus: bus, topics: topics, dropPolicy: defaultDropPolicy, snapshotURL: defaultSnapshotFetchURL, checkName: checkName, spoolName: spoolName}
+	for _, o := range opts {
+		o(result)
 	}
-	var d time.Duration
+	health.Register(checkName, result.checkConnected)
+	return result, nil
+}
 
-	for {
-		err := socket.Dial(url)
-		if err == nil {
-			break
-		}
-		d = b.Duration()
-		logger.GetLogger().Warn(
-			"Could not dial the publisher, will retry",
-			zap.String("URL", url),
-			zap.String("Error", err.Error()),
-			zap.Duration("Back off time", d),
-		)
-		time.Sleep(d)
+// Connected is false when the bus knows that no publisher is connected
+func (s *Subscriber[T]) Connected() bool {
+	if c, ok := s.bus.(connectionState); ok {
+		return c.Connected()
 	}
-	if err := socket.SetOption(mangos.OptionSubscribe, topic); err != nil {
-		return nil, err
+	return true
+}
+
+// DisconnectedSince is the time the subscriber lost the connection with the publisher, zero when it is connected or the
+// bus doesn't know
+func (s *Subscriber[T]) DisconnectedSince() time.Time {
+	if c, ok := s.bus.(connectionState); ok {
+		return c.DisconnectedSince()
 	}
+	return time.Time{}
+}
 
-	result := &Subscriber[T]{socket: socket}
-	for _, o := range opts {
-		o(result)
+func (s *Subscriber[T]) checkConnected() error {
+	if !s.Connected() {
+		return health.FailingSince(s.DisconnectedSince(), errors.New("not connected to the publisher"))
 	}
-	return result, nil
+	return nil
+}
+
+// removes the password from the url so it can be shown
+func redact(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
 }
 
-func (s *Subscriber[T]) receive(buffer chan []byte) {
+// receives until the context is done, the buffer is closed when the spilled messages are moved to the buffer
+func (s *Subscriber[T]) receive(ctx context.Context, buffer chan []byte) {
+	defer close(buffer)
+	defer health.Unregister(s.checkName)
 	go checkBufferSize(buffer, "receive", s.bufferSizeGauge)
 
+	// closing the socket stops a blocking receive
+	stop := context.AfterFunc(ctx, func() { s.bus.Close() })
+	defer stop()
+
+	var sp *spool
+	if s.dropPolicy == DropPolicySpill {
+		var err error
+		if sp, err = newSpool(spillDirectory, s.spoolName, spillMaxBytes); err != nil {
+			logger.GetLogger().Fatal(
+				"Could not create the spool file",
+				zap.String("Directory", spillDirectory),
+				zap.String("Error", err.Error()),
+			)
+		}
+		drained := make(chan struct{})
+		go func() {
+			sp.drain(buffer)
+			close(drained)
+		}()
+		defer func() {
+			sp.close()
+			<-drained
+		}()
+	}
+
 	for {
-		received, err := s.socket.Recv()
+		received, err := s.bus.Recv()
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			logger.GetLogger().Warn(
 				"Could not receive a message from the publisher",
 				zap.String("Error", err.Error()),
 			)
 			continue
 		}
+		var handed bool
+		if sp != nil {
+			handed = spill(sp, buffer, received)
+		} else {
+			handed = offer(buffer, received, s.dropPolicy)
+		}
+		// the message is acknowledged when it is in the buffer or the spool, or when it is dropped
+		s.ack()
+		if handed && s.receivedCounter != nil {
+			s.receivedCounter.Inc()
+		}
+	}
+}
+
+func (s *Subscriber[T]) ack() {
+	a, ok := s.bus.(acknowledger)
+	if !ok {
+		return
+	}
+	if err := a.Ack(); err != nil {
+		logger.GetLogger().Warn(
+			"Could not acknowledge the received message",
+			zap.String("Error", err.Error()),
+		)
+	}
+}
+
+// the received message is written to the spool when the buffer is full or older messages are waiting in the spool
+func spill(sp *spool, buffer chan []byte, received []byte) bool {
+	if sp.len() == 0 {
 		select {
 		case buffer <- received:
-			if s.receivedCounter != nil {
-				s.receivedCounter.Inc()
-			}
+			return true
 		default:
-			go logger.GetLogger().Warn("Buffer is full, dropping received data")
 		}
 	}
+	if err := sp.push(received); err != nil {
+		if err == errSpoolFull {
+			dropped(dropReasonSpoolFull)
+		} else {
+			dropped(dropReasonSpoolError)
+		}
+		return false
+	}
+	return true
 }
 
-func (s *Subscriber[T]) Receive(buffer chan *T) {
+// Receives messages until the context is done, the messages that are already received are put in the buffer before the
+// buffer is closed
+func (s *Subscriber[T]) Receive(ctx context.Context, buffer chan *T) {
+	defer close(buffer)
 	receiveBuffer := make(chan []byte, cap(buffer))
-	go s.receive(receiveBuffer)
+	go s.receive(ctx, receiveBuffer)
+
+	// the live messages are buffered while the snapshot is fetched, the snapshot is older so it goes first. The snapshot only
+	// contains the messages of the topics of the subscriber.
+	if s.snapshotURL != "" {
+		s.receiveSnapshot(buffer)
+	}
 
 	for bytes := range receiveBuffer {
 		m := new(T)
-		if err := json.Unmarshal(bytes, m); err != nil {
+		if err := unmarshal(removeTopic(bytes), m); err != nil {
 			logger.GetLogger().Warn(
 				"Could not unmarshal the received data",
 				zap.ByteString("Received", bytes),
 				zap.String("Error", err.Error()),
 			)
+			dropped(dropReasonUnmarshal)
 			continue
 		}
-		select {
-		case buffer <- m:
-			if s.unmarshalledCounter != nil {
-				s.unmarshalledCounter.Inc()
-			}
-		default:
-			go logger.GetLogger().Warn("Buffer is full, dropping unmarshalled data")
+		if offer(buffer, m, s.dropPolicy) && s.unmarshalledCounter != nil {
+			s.unmarshalledCounter.Inc()
 		}
 	}
 }
+
+func (s *Subscriber[T]) receiveSnapshot(buffer chan *T) {
+	messages, err := FetchSnapshot[T](s.snapshotURL, s.topics...)
+	if err != nil {
+		logger.GetLogger().Warn(
+			"Could not fetch the snapshot, only live messages are received",
+			zap.String("URL", s.snapshotURL),
+			zap.String("Error", err.Error()),
+		)
+		return
+	}
+	logger.GetLogger().Info(
+		"Received a snapshot",
+		zap.String("URL", s.snapshotURL),
+		zap.Int("Messages", len(messages)),
+	)
+	for _, m := range messages {
+		buffer <- m
+	}
+}
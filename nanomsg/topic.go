@@ -0,0 +1,181 @@
+package nanomsg
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/munnik/gosk/message"
+)
+
+// The routing key that is put in front of each published message, subscribers filter on a prefix of the routing key before
+// the message is unmarshalled
+type TopicKey string
+
+const (
+	TopicKeyNone      TopicKey = ""          // messages are published without a topic
+	TopicKeyMessage   TopicKey = "message"   // raw, mapped or deadLetter
+	TopicKeyContext   TopicKey = "context"   // the context of mapped messages
+	TopicKeyPath      TopicKey = "path"      // the path of mapped values, mapped messages are split per path
+	TopicKeyConnector TopicKey = "connector" // the connector of raw messages or the source label of mapped messages
+	TopicKeyType      TopicKey = "type"      // the protocol of raw messages or the source type of mapped messages
+)
+
+// the topic ends with this byte, it can't be part of a topic and it isn't a format byte
+const topicSeparator = 0x00
+
+// the topic key of publishers that are created without a topic key option
+var defaultTopicKey = TopicKeyNone
+
+// the topics of subscribers that are created without a topic
+var defaultTopics [][]byte
+
+func ParseTopicKey(name string) (TopicKey, error) {
+	switch k := TopicKey(name); k {
+	case TopicKeyNone, TopicKeyMessage, TopicKeyContext, TopicKeyPath, TopicKeyConnector, TopicKeyType:
+		return k, nil
+	}
+	return TopicKeyNone, fmt.Errorf("unknown topic key %s, use %s, %s, %s, %s or %s", name, TopicKeyMessage, TopicKeyContext, TopicKeyPath, TopicKeyConnector, TopicKeyType)
+}
+
+// Sets the topic key of all publishers in this process that are created without a topic key option
+func SetDefaultTopicKey(k TopicKey) {
+	defaultTopicKey = k
+}
+
+// Sets the topics of all subscribers in this process that are created with an empty topic
+func SetDefaultTopics(topics []string) {
+	defaultTopics = nil
+	for _, t := range topics {
+		defaultTopics = append(defaultTopics, []byte(t))
+	}
+}
+
+// a message and the topic it is published on
+type topicMessage[T Message] struct {
+	topic   string
+	message *T
+}
+
+// Returns the messages to publish with their topic, mapped messages are split when the key differs per update or value
+func withTopics[T Message](key TopicKey, m *T) []topicMessage[T] {
+	if key == TopicKeyNone {
+		return []topicMessage[T]{{message: m}}
+	}
+	switch v := any(m).(type) {
+	case *message.Raw:
+		return []topicMessage[T]{{topic: rawTopic(key, v), message: m}}
+	case *message.DeadLetter:
+		return []topicMessage[T]{{topic: deadLetterTopic(key, v), message: m}}
+	case *message.Mapped:
+		result := make([]topicMessage[T], 0)
+		for _, s := range splitMapped(key, v) {
+			result = append(result, topicMessage[T]{topic: s.topic, message: any(s.message).(*T)})
+		}
+		return result
+	}
+	return []topicMessage[T]{{message: m}}
+}
+
+func rawTopic(key TopicKey, r *message.Raw) string {
+	switch key {
+	case TopicKeyMessage:
+		return "raw"
+	case TopicKeyConnector:
+		return r.Connector
+	case TopicKeyType:
+		return r.Type
+	}
+	return ""
+}
+
+func deadLetterTopic(key TopicKey, d *message.DeadLetter) string {
+	switch key {
+	case TopicKeyMessage:
+		return "deadLetter"
+	case TopicKeyPath:
+		return d.Mapping
+	}
+	if d.Raw != nil {
+		return rawTopic(key, d.Raw)
+	}
+	if d.Mapped != nil && key == TopicKeyContext {
+		return d.Mapped.Context
+	}
+	return ""
+}
+
+// the updates and values are grouped by the topic, the order of the topics is the order they first appear in
+func splitMapped(key TopicKey, m *message.Mapped) []topicMessage[message.Mapped] {
+	switch key {
+	case TopicKeyMessage:
+		return []topicMessage[message.Mapped]{{topic: "mapped", message: m}}
+	case TopicKeyContext:
+		return []topicMessage[message.Mapped]{{topic: m.Context, message: m}}
+	}
+
+	result := make([]topicMessage[message.Mapped], 0)
+	byTopic := make(map[string]*message.Mapped)
+	add := func(topic string, u message.Update) {
+		if existing, ok := byTopic[topic]; ok {
+			existing.AddUpdate(&u)
+			return
+		}
+		byTopic[topic] = message.NewMapped().WithContext(m.Context).WithOrigin(m.Origin).AddUpdate(&u)
+		result = append(result, topicMessage[message.Mapped]{topic: topic, message: byTopic[topic]})
+	}
+	for _, u := range m.Updates {
+		switch key {
+		case TopicKeyConnector:
+			add(u.Source.Label, u)
+		case TopicKeyType:
+			add(u.Source.Type, u)
+		case TopicKeyPath:
+			for _, v := range u.Values {
+				single := u
+				single.Values = []message.Value{v}
+				add(v.Path, single)
+			}
+		}
+	}
+	return result
+}
+
+func addTopic(topic string, payload []byte) []byte {
+	result := make([]byte, 0, len(topic)+1+len(payload))
+	result = append(result, topic...)
+	result = append(result, topicSeparator)
+	return append(result, payload...)
+}
+
+// Matches the topics of a message like a subscriber matches the received bytes, the topics of the message are put in
+// front of the payload with the separator. All messages match when the subscriber has no topics.
+func matchesTopics(messageTopics [][]byte, topics [][]byte) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	for _, mt := range messageTopics {
+		for _, t := range topics {
+			if bytes.HasPrefix(mt, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Removes the topic from the received bytes, messages without a topic start with the format byte
+func removeTopic(received []byte) []byte {
+	_, payload := splitTopic(received)
+	return payload
+}
+
+// the topic is nil when the message has no topic
+func splitTopic(received []byte) ([]byte, []byte) {
+	if len(received) == 0 || Format(received[0]) == FormatJSON || Format(received[0]) == FormatBinaryV1 {
+		return nil, received
+	}
+	if i := bytes.IndexByte(received, topicSeparator); i >= 0 {
+		return received[:i], received[i+1:]
+	}
+	return nil, received
+}
@@ -0,0 +1,189 @@
+package nanomsg_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/munnik/gosk/message"
+	. "github.com/munnik/gosk/nanomsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Topic", func() {
+	const vessel = "vessels.urn:mrn:imo:mmsi:234567890"
+	raw := message.NewRaw().WithConnector("gps").WithType("nmea0183").WithValue([]byte("$GPRMC"))
+
+	DescribeTable("of raw messages",
+		func(key TopicKey, expected string) {
+			topics, messages := WithTopics(key, raw)
+			Expect(topics).To(Equal([]string{expected}))
+			Expect(messages).To(Equal([]*message.Raw{raw}))
+		},
+		Entry("none", TopicKeyNone, ""),
+		Entry("message", TopicKeyMessage, "raw"),
+		Entry("connector", TopicKeyConnector, "gps"),
+		Entry("type", TopicKeyType, "nmea0183"),
+		Entry("context", TopicKeyContext, ""),
+		Entry("path", TopicKeyPath, ""),
+	)
+	DescribeTable("of dead letters",
+		func(d *message.DeadLetter, key TopicKey, expected string) {
+			topics, messages := WithTopics(key, d)
+			Expect(topics).To(Equal([]string{expected}))
+			Expect(messages).To(Equal([]*message.DeadLetter{d}))
+		},
+		Entry("message", message.NewDeadLetter().WithMapping("navigation.position").WithRaw(raw), TopicKeyMessage, "deadLetter"),
+		Entry("path", message.NewDeadLetter().WithMapping("navigation.position").WithRaw(raw), TopicKeyPath, "navigation.position"),
+		Entry("connector of the raw message", message.NewDeadLetter().WithRaw(raw), TopicKeyConnector, "gps"),
+		Entry("type of the raw message", message.NewDeadLetter().WithRaw(raw), TopicKeyType, "nmea0183"),
+		Entry("context of the mapped message", message.NewDeadLetter().WithMapped(message.NewMapped().WithContext(vessel)), TopicKeyContext, vessel),
+		Entry("context without a mapped message", message.NewDeadLetter().WithRaw(raw), TopicKeyContext, ""),
+	)
+
+	Describe("of mapped messages", func() {
+		var m *message.Mapped
+		BeforeEach(func() {
+			gps := message.NewUpdate().WithSource(*message.NewSource().WithLabel("gps").WithType("nmea0183")).
+				AddValue(message.NewValue().WithPath("navigation.speedOverGround").WithValue(3.5)).
+				AddValue(message.NewValue().WithPath("navigation.courseOverGroundTrue").WithValue(1.2))
+			engine := message.NewUpdate().WithSource(*message.NewSource().WithLabel("engine").WithType("modbus")).
+				AddValue(message.NewValue().WithPath("propulsion.main.revolutions").WithValue(12.0))
+			log := message.NewUpdate().WithSource(*message.NewSource().WithLabel("log").WithType("nmea0183")).
+				AddValue(message.NewValue().WithPath("navigation.speedOverGround").WithValue(3.4))
+			m = message.NewMapped().WithContext(vessel).WithOrigin(vessel).AddUpdate(gps).AddUpdate(engine).AddUpdate(log)
+		})
+		sourcePaths := func(m *message.Mapped) []string {
+			result := make([]string, 0)
+			for _, u := range m.Updates {
+				for _, v := range u.Values {
+					result = append(result, u.Source.Label+" "+v.Path)
+				}
+			}
+			return result
+		}
+
+		DescribeTable("are not split when the key is the same for all values",
+			func(key TopicKey, expected string) {
+				topics, messages := WithTopics(key, m)
+				Expect(topics).To(Equal([]string{expected}))
+				Expect(messages).To(Equal([]*message.Mapped{m}))
+			},
+			Entry("none", TopicKeyNone, ""),
+			Entry("message", TopicKeyMessage, "mapped"),
+			Entry("context", TopicKeyContext, vessel),
+		)
+		DescribeTable("are split per key in the order the keys first appear",
+			func(key TopicKey, expectedTopics []string, expectedPaths [][]string) {
+				topics, messages := WithTopics(key, m)
+				Expect(topics).To(Equal(expectedTopics))
+				Expect(messages).To(HaveLen(len(expectedPaths)))
+				for i, s := range messages {
+					Expect(s.Context).To(Equal(vessel))
+					Expect(s.Origin).To(Equal(vessel))
+					Expect(sourcePaths(s)).To(Equal(expectedPaths[i]))
+				}
+			},
+			Entry("path", TopicKeyPath,
+				[]string{"navigation.speedOverGround", "navigation.courseOverGroundTrue", "propulsion.main.revolutions"},
+				[][]string{
+					{"gps navigation.speedOverGround", "log navigation.speedOverGround"},
+					{"gps navigation.courseOverGroundTrue"},
+					{"engine propulsion.main.revolutions"},
+				},
+			),
+			Entry("connector", TopicKeyConnector,
+				[]string{"gps", "engine", "log"},
+				[][]string{
+					{"gps navigation.speedOverGround", "gps navigation.courseOverGroundTrue"},
+					{"engine propulsion.main.revolutions"},
+					{"log navigation.speedOverGround"},
+				},
+			),
+			Entry("type", TopicKeyType,
+				[]string{"nmea0183", "modbus"},
+				[][]string{
+					{"gps navigation.speedOverGround", "gps navigation.courseOverGroundTrue", "log navigation.speedOverGround"},
+					{"engine propulsion.main.revolutions"},
+				},
+			),
+		)
+	})
+
+	DescribeTable("is put in front of the payload and removed again",
+		func(format Format, topic string) {
+			payload, err := Marshal(format, raw)
+			Expect(err).NotTo(HaveOccurred())
+			received := payload
+			if topic != "" {
+				received = AddTopic(topic, payload)
+				Expect(received).To(HaveLen(len(topic) + 1 + len(payload)))
+			}
+			Expect(RemoveTopic(received)).To(Equal(payload))
+			t, p := SplitTopic(received)
+			Expect(p).To(Equal(payload))
+			if topic == "" {
+				Expect(t).To(BeNil())
+			} else {
+				Expect(string(t)).To(Equal(topic))
+			}
+			result := new(message.Raw)
+			Expect(Unmarshal(RemoveTopic(received), result)).To(Succeed())
+			Expect(result.Connector).To(Equal("gps"))
+		},
+		Entry("json without a topic", FormatJSON, ""),
+		Entry("json with a topic", FormatJSON, "navigation.speedOverGround"),
+		Entry("binary without a topic", FormatBinaryV1, ""),
+		Entry("binary with a topic", FormatBinaryV1, "navigation.speedOverGround"),
+		Entry("binary with a topic of one character", FormatBinaryV1, "a"),
+	)
+
+	DescribeTable("selects the messages a subscriber receives",
+		func(format Format, url string) {
+			in := make(chan *message.Mapped, 10)
+			publisher := NewPublisher[message.Mapped](url, WithPublisherFormat[message.Mapped](format), WithPublisherTopicKey[message.Mapped](TopicKeyPath))
+			go publisher.Send(in)
+			defer close(in)
+			navigation, err := NewSubscriber[message.Mapped](url, []byte("navigation."))
+			Expect(err).NotTo(HaveOccurred())
+			all, err := NewSubscriber[message.Mapped](url, []byte{})
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			navigationOut := make(chan *message.Mapped, 100)
+			allOut := make(chan *message.Mapped, 100)
+			go navigation.Receive(ctx, navigationOut)
+			go all.Receive(ctx, allOut)
+
+			receivedPaths := func(out chan *message.Mapped, received map[string]bool) {
+				for {
+					select {
+					case m := <-out:
+						Expect(m.Context).To(Equal(vessel))
+						for _, u := range m.Updates {
+							Expect(u.Values).To(HaveLen(1))
+							received[u.Values[0].Path] = true
+						}
+					case <-time.After(20 * time.Millisecond):
+						return
+					}
+				}
+			}
+			navigationPaths, allPaths := map[string]bool{}, map[string]bool{}
+			Eventually(func() int {
+				u := message.NewUpdate().WithSource(*message.NewSource().WithLabel("gps").WithType("nmea0183")).
+					AddValue(message.NewValue().WithPath("navigation.speedOverGround").WithValue(3.5)).
+					AddValue(message.NewValue().WithPath("propulsion.main.revolutions").WithValue(12.0))
+				in <- message.NewMapped().WithContext(vessel).AddUpdate(u)
+				receivedPaths(navigationOut, navigationPaths)
+				receivedPaths(allOut, allPaths)
+				return len(navigationPaths) + len(allPaths)
+			}).WithTimeout(2 * time.Second).Should(Equal(3))
+			Expect(navigationPaths).To(HaveKey("navigation.speedOverGround"))
+			Expect(allPaths).To(HaveKey("navigation.speedOverGround"))
+			Expect(allPaths).To(HaveKey("propulsion.main.revolutions"))
+		},
+		Entry("json", FormatJSON, "inproc://topic-json"),
+		Entry("binary", FormatBinaryV1, "inproc://topic-binary"),
+	)
+})
@@ -1,9 +1,12 @@
 package reader
 
 import (
-	"go.nanomsg.org/mangos/v3"
+	"context"
+
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
 )
 
 type MappedReader interface {
-	ReadMapped(publisher mangos.Socket)
+	ReadMapped(ctx context.Context, publisher *nanomsg.Publisher[message.Mapped])
 }
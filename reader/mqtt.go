@@ -1,8 +1,8 @@
 package reader
 
 import (
+	"context"
 	"encoding/json"
-	"sync"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
@@ -48,18 +48,18 @@ func NewMqttReader(c *config.MQTTConfig) *MqttReader {
 	}
 }
 
-func (r *MqttReader) ReadMapped(publisher *nanomsg.Publisher[message.Mapped]) {
+// Reads until the context is done, the messages that are received before disconnecting are sent
+func (r *MqttReader) ReadMapped(ctx context.Context, publisher *nanomsg.Publisher[message.Mapped]) {
 	r.sendBuffer = make(chan *message.Mapped, bufferCapacity)
-	defer close(r.sendBuffer)
 	go publisher.Send(r.sendBuffer)
 
 	m := mqtt.New(r.mqttConfig, r.messageHandler, mqttTopic)
-	defer m.Disconnect()
+	<-ctx.Done()
 
-	// never exit
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait()
+	// the handlers stop sending after the disconnect
+	m.Disconnect()
+	close(r.sendBuffer)
+	<-publisher.Done()
 }
 
 func (r *MqttReader) messageHandler(c paho.Client, m paho.Message) {
@@ -0,0 +1,81 @@
+package supervisor
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const componentLabel = "component"
+
+var scrapeClient = &http.Client{Timeout: 2 * time.Second}
+
+// gathers the metrics of the running components, the metrics of components that can't be scraped are left out
+type componentsGatherer struct {
+	supervisor *Supervisor
+}
+
+func (g componentsGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var (
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		errs   []error
+		byName = make(map[string]*dto.MetricFamily)
+	)
+	for _, c := range g.supervisor.components {
+		if c.MetricsURL == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(c *supervised) {
+			defer wg.Done()
+			families, err := scrape(c.MetricsURL)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not scrape the metrics of %s: %w", c.Name, err))
+				return
+			}
+			for name, f := range families {
+				for _, m := range f.Metric {
+					m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(componentLabel), Value: proto.String(c.Name)})
+				}
+				if existing, ok := byName[name]; ok {
+					existing.Metric = append(existing.Metric, f.Metric...)
+					continue
+				}
+				byName[name] = f
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	result := make([]*dto.MetricFamily, 0, len(byName))
+	for _, f := range byName {
+		result = append(result, f)
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%v", errs)
+	}
+	return result, nil
+}
+
+func scrape(url string) (map[string]*dto.MetricFamily, error) {
+	response, err := scrapeClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	return parser.TextToMetricFamilies(response.Body)
+}
@@ -0,0 +1,344 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/munnik/gosk/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+var (
+	restartsCounter = promauto.NewCounterVec(prometheus.CounterOpts{Name: "gosk_supervisor_restarts_total", Help: "total number of restarts of the component"}, []string{"component"})
+	upGauge         = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "gosk_supervisor_component_up", Help: "1 when the component is running"}, []string{"component"})
+)
+
+const (
+	StateRunning  = "running"
+	StateBackoff  = "backoff" // the component failed and waits to be restarted
+	StateStopped  = "stopped"
+	StateStarting = "starting"
+)
+
+// A process that is started by the supervisor, or a function that is run in a goroutine of the supervisor when Run is set
+type Component struct {
+	Name       string
+	Path       string
+	Args       []string
+	MetricsURL string                          // the url of the prometheus metrics of the component, the metrics are not combined when empty
+	Run        func(ctx context.Context) error // runs the component in this process until the context is done, Path is not used
+}
+
+type Status struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Pid      int       `json:"pid,omitempty"`
+	Restarts int       `json:"restarts"`
+	Since    time.Time `json:"since"` // when the component got its current state
+	LastExit string    `json:"lastExit,omitempty"`
+	Args     []string  `json:"args"`
+}
+
+type supervised struct {
+	Component
+	mutex   sync.Mutex
+	status  Status
+	process *os.Process
+	cancel  context.CancelFunc // stops the component that runs in a goroutine
+}
+
+func (s *supervised) setState(state string, pid int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status.State != state {
+		s.status.Since = time.Now()
+	}
+	s.status.State = state
+	s.status.Pid = pid
+	if state == StateRunning {
+		upGauge.WithLabelValues(s.Name).Set(1)
+	} else {
+		upGauge.WithLabelValues(s.Name).Set(0)
+	}
+}
+
+// Supervisor starts the components as child processes or goroutines and restarts the components that stop, the time between
+// restarts doubles after each failure. The backoff is reset when a component ran longer than the maximum backoff. Child
+// processes that don't stop within the stop timeout are killed.
+type Supervisor struct {
+	components  []*supervised
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	stopTimeout time.Duration
+	stopping    chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewSupervisor(components []Component, minBackoff time.Duration, maxBackoff time.Duration, stopTimeout time.Duration) *Supervisor {
+	result := &Supervisor{minBackoff: minBackoff, maxBackoff: maxBackoff, stopTimeout: stopTimeout, stopping: make(chan struct{})}
+	for _, c := range components {
+		result.components = append(result.components, &supervised{
+			Component: c,
+			status:    Status{Name: c.Name, State: StateStarting, Since: time.Now(), Args: c.Args},
+		})
+	}
+	return result
+}
+
+// Starts all components, returns immediately
+func (s *Supervisor) Start() {
+	for _, c := range s.components {
+		s.wg.Add(1)
+		go s.supervise(c)
+	}
+}
+
+func (s *Supervisor) supervise(c *supervised) {
+	defer s.wg.Done()
+	b := &backoff.Backoff{
+		Min:    s.minBackoff,
+		Max:    s.maxBackoff,
+		Factor: 2,
+		Jitter: false,
+	}
+	for {
+		started := time.Now()
+		var err error
+		if c.Run != nil {
+			err = s.runInProcess(c)
+		} else {
+			err = s.run(c)
+		}
+		select {
+		case <-s.stopping:
+			c.setState(StateStopped, 0)
+			return
+		default:
+		}
+
+		if time.Since(started) > s.maxBackoff {
+			b.Reset()
+		}
+		d := b.Duration()
+		exit := "exited"
+		if err != nil {
+			exit = err.Error()
+		}
+		c.mutex.Lock()
+		c.status.LastExit = exit
+		c.mutex.Unlock()
+		c.setState(StateBackoff, 0)
+		logger.GetLogger().Warn(
+			"Component stopped, will restart",
+			zap.String("Component", c.Name),
+			zap.String("Exit", exit),
+			zap.Duration("Back off time", d),
+		)
+
+		select {
+		case <-s.stopping:
+			c.setState(StateStopped, 0)
+			return
+		case <-time.After(d):
+		}
+		c.mutex.Lock()
+		c.status.Restarts++
+		c.mutex.Unlock()
+		restartsCounter.WithLabelValues(c.Name).Inc()
+	}
+}
+
+// runs the process until it exits
+func (s *Supervisor) run(c *supervised) error {
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// a signal of the terminal is not sent to the components, they are stopped by the supervisor so they get one signal
+	// and can shut down gracefully
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.mutex.Lock()
+	// Stop signals the processes while it holds the lock, a process that is started after that would keep running
+	if s.isStopping() {
+		c.mutex.Unlock()
+		return errStopping
+	}
+	if err := cmd.Start(); err != nil {
+		c.mutex.Unlock()
+		return err
+	}
+	c.process = cmd.Process
+	c.mutex.Unlock()
+	c.setState(StateRunning, cmd.Process.Pid)
+	logger.GetLogger().Info(
+		"Component started",
+		zap.String("Component", c.Name),
+		zap.Int("Pid", cmd.Process.Pid),
+		zap.Strings("Args", c.Args),
+	)
+	err := cmd.Wait()
+	c.mutex.Lock()
+	c.process = nil
+	c.mutex.Unlock()
+	return err
+}
+
+// runs the component in a goroutine until it returns
+func (s *Supervisor) runInProcess(c *supervised) error {
+	c.mutex.Lock()
+	if s.isStopping() {
+		c.mutex.Unlock()
+		return errStopping
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.cancel = cancel
+	c.mutex.Unlock()
+	c.setState(StateRunning, 0)
+	logger.GetLogger().Info(
+		"Component started",
+		zap.String("Component", c.Name),
+		zap.Strings("Args", c.Args),
+	)
+	err := runGoroutine(ctx, c.Run)
+	c.mutex.Lock()
+	c.cancel = nil
+	c.mutex.Unlock()
+	return err
+}
+
+// Runs the function in its own goroutine, a panic or a call to runtime.Goexit, e.g. by a fatal log message, only stops the
+// component
+func runGoroutine(ctx context.Context, run func(ctx context.Context) error) error {
+	result := make(chan error, 1)
+	go func() {
+		returned := false
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			} else if !returned {
+				result <- errors.New("stopped on a fatal error")
+			}
+		}()
+		err := run(ctx)
+		returned = true
+		result <- err
+	}()
+	return <-result
+}
+
+func (s *Supervisor) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stops all components without restarting them and waits until they are stopped. Child processes that are still running
+// after the stop timeout are killed, the supervisor stops waiting for goroutines after twice the stop timeout.
+func (s *Supervisor) Stop() {
+	close(s.stopping)
+	for _, c := range s.components {
+		c.mutex.Lock()
+		if c.process != nil {
+			c.process.Signal(os.Interrupt)
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.mutex.Unlock()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return
+	case <-time.After(s.stopTimeout):
+	}
+	for _, c := range s.components {
+		c.mutex.Lock()
+		if c.process != nil {
+			logger.GetLogger().Warn(
+				"Component did not stop within the stop timeout, killing it",
+				zap.String("Component", c.Name),
+				zap.Int("Pid", c.process.Pid),
+			)
+			// the process is the leader of its own group, the processes it started are killed as well
+			syscall.Kill(-c.process.Pid, syscall.SIGKILL)
+		}
+		c.mutex.Unlock()
+	}
+	select {
+	case <-stopped:
+	case <-time.After(s.stopTimeout):
+		for _, status := range s.Statuses() {
+			if status.State == StateRunning {
+				logger.GetLogger().Error(
+					"Component did not stop",
+					zap.String("Component", status.Name),
+				)
+			}
+		}
+	}
+}
+
+var errStopping = errors.New("the supervisor is stopping")
+
+func (s *Supervisor) Statuses() []Status {
+	result := make([]Status, 0, len(s.components))
+	for _, c := range s.components {
+		c.mutex.Lock()
+		status := c.status
+		c.mutex.Unlock()
+		result = append(result, status)
+	}
+	return result
+}
+
+// Serves the status of the components on /status and the metrics of the supervisor and the components on /metrics, the
+// metrics of the components get a component label
+func (s *Supervisor) Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Statuses()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, componentsGatherer{s}},
+		promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError},
+	))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.GetLogger().Warn(
+				"Stopped serving the status",
+				zap.String("Address", address),
+				zap.String("Error", err.Error()),
+			)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,93 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+
+	. "github.com/munnik/gosk/supervisor"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisor", func() {
+	status := func(s *Supervisor, name string) func() Status {
+		return func() Status {
+			for _, st := range s.Statuses() {
+				if st.Name == name {
+					return st
+				}
+			}
+			return Status{}
+		}
+	}
+
+	It("restarts a component that stops", func() {
+		s := NewSupervisor([]Component{{Name: "failing", Path: "sh", Args: []string{"-c", "exit 1"}}}, 10*time.Millisecond, 20*time.Millisecond, time.Second)
+		s.Start()
+		Eventually(status(s, "failing")).Should(HaveField("Restarts", BeNumerically(">=", 2)))
+		Expect(status(s, "failing")().LastExit).To(Equal("exit status 1"))
+		s.Stop()
+		Expect(status(s, "failing")().State).To(Equal(StateStopped))
+	})
+	It("stops the running components", func() {
+		s := NewSupervisor([]Component{{Name: "sleeping", Path: "sleep", Args: []string{"60"}}}, time.Second, time.Second, time.Second)
+		s.Start()
+		Eventually(status(s, "sleeping")).Should(HaveField("State", StateRunning))
+		Expect(status(s, "sleeping")().Pid).NotTo(BeZero())
+		s.Stop()
+		Expect(status(s, "sleeping")()).To(And(HaveField("State", StateStopped), HaveField("Restarts", 0)))
+	})
+	It("does not start a component when it is stopped", func() {
+		for i := 0; i < 20; i++ {
+			s := NewSupervisor([]Component{{Name: "sleeping", Path: "sleep", Args: []string{"60"}}}, time.Second, time.Second, time.Minute)
+			s.Start()
+			stopped := make(chan struct{})
+			go func() {
+				s.Stop()
+				close(stopped)
+			}()
+			Eventually(stopped).WithTimeout(5 * time.Second).Should(BeClosed())
+			Expect(status(s, "sleeping")().State).To(Equal(StateStopped))
+		}
+	})
+	It("kills a component that does not stop within the stop timeout", func() {
+		s := NewSupervisor([]Component{{Name: "stubborn", Path: "sh", Args: []string{"-c", "trap '' INT; sleep 60"}}}, time.Second, time.Second, 100*time.Millisecond)
+		s.Start()
+		Eventually(status(s, "stubborn")).Should(HaveField("State", StateRunning))
+		stopped := make(chan struct{})
+		go func() {
+			s.Stop()
+			close(stopped)
+		}()
+		Eventually(stopped).WithTimeout(5 * time.Second).Should(BeClosed())
+		Expect(status(s, "stubborn")().State).To(Equal(StateStopped))
+	})
+	DescribeTable("restarts a component in a goroutine that stops",
+		func(run func(ctx context.Context) error, lastExit string) {
+			s := NewSupervisor([]Component{{Name: "failing", Run: run}}, 10*time.Millisecond, 20*time.Millisecond, time.Second)
+			s.Start()
+			Eventually(status(s, "failing")).Should(HaveField("Restarts", BeNumerically(">=", 2)))
+			Expect(status(s, "failing")().LastExit).To(Equal(lastExit))
+			s.Stop()
+			Expect(status(s, "failing")().State).To(Equal(StateStopped))
+		},
+		Entry("with an error", func(ctx context.Context) error { return errors.New("failed") }, "failed"),
+		Entry("with a panic", func(ctx context.Context) error { panic("failed") }, "panic: failed"),
+		Entry("with a fatal error", func(ctx context.Context) error {
+			runtime.Goexit()
+			return nil
+		}, "stopped on a fatal error"),
+	)
+	It("stops the components in goroutines", func() {
+		s := NewSupervisor([]Component{{Name: "waiting", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}}, time.Second, time.Second, time.Second)
+		s.Start()
+		Eventually(status(s, "waiting")).Should(HaveField("State", StateRunning))
+		s.Stop()
+		Expect(status(s, "waiting")()).To(And(HaveField("State", StateStopped), HaveField("Restarts", 0)))
+	})
+})
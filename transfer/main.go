@@ -1,6 +1,7 @@
 package transfer
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,3 +29,13 @@ type ResponseMessage struct {
 	PeriodStart time.Time `json:"period_start"`
 	DataPoints  int       `json:"data_points"`
 }
+
+// sleeps for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
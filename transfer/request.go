@@ -1,6 +1,7 @@
 package transfer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -62,14 +63,16 @@ func NewTransferRequester(c *config.TransferConfig) *TransferRequester {
 	return result
 }
 
-func (t *TransferRequester) Run() {
+// Sends requests until the context is done
+func (t *TransferRequester) Run(ctx context.Context) {
+	defer t.db.Close()
 	t.mqttClient = mqtt.New(t.mqttConfig, t.messageReceived, fmt.Sprintf(respondTopic, "#"))
 	defer t.mqttClient.Disconnect()
 
 	// send count requests
 	go func() {
-		for {
-			t.sendCountRequests()
+		for ctx.Err() == nil {
+			t.sendCountRequests(ctx)
 		}
 	}()
 
@@ -78,17 +81,15 @@ func (t *TransferRequester) Run() {
 		for i := 0; i < t.numberOfRequestWorkers; i++ {
 			go t.sendDataRequestWorker(t.dataRequestChannel)
 		}
-		for {
-			t.sendDataRequests()
+		for ctx.Err() == nil {
+			t.sendDataRequests(ctx)
 		}
 	}()
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait() // never exit
+	<-ctx.Done()
 }
 
-func (t *TransferRequester) sendCountRequests() {
+func (t *TransferRequester) sendCountRequests(ctx context.Context) {
 	origins, err := t.db.SelectFirstMappedDataPerOrigin()
 	if err != nil {
 		logger.GetLogger().Warn(
@@ -97,7 +98,7 @@ func (t *TransferRequester) sendCountRequests() {
 			zap.Time("NextRequestAt", time.Now().Add(t.sleepBetweenCountRequests)),
 		)
 
-		time.Sleep(t.sleepBetweenCountRequests)
+		sleep(ctx, t.sleepBetweenCountRequests)
 		return
 	}
 
@@ -116,7 +117,7 @@ func (t *TransferRequester) sendCountRequests() {
 			zap.Time("NextRequestAt", time.Now().Add(t.sleepBetweenCountRequests)),
 		)
 
-		time.Sleep(t.sleepBetweenCountRequests)
+		sleep(ctx, t.sleepBetweenCountRequests)
 		return
 	}
 
@@ -124,14 +125,14 @@ func (t *TransferRequester) sendCountRequests() {
 	wg.Add(len(origins) + 1)
 
 	go func() {
-		time.Sleep(t.sleepBetweenCountRequests)
+		sleep(ctx, t.sleepBetweenCountRequests)
 		wg.Done()
 	}()
 
 	for origin, start := range origins {
 		go func(origin string, start time.Time) {
 			// wait random amount of time before processing to spread the workload
-			time.Sleep(time.Duration(rand.Intn(int(t.sleepBetweenCountRequests))))
+			sleep(ctx, time.Duration(rand.Intn(int(t.sleepBetweenCountRequests))))
 
 			periods := make([]time.Time, 0)
 			for p := start; p.Before(time.Now().Add(-countRequestCoolDown)); p = p.Add(periodDuration) {
@@ -170,7 +171,7 @@ func (t *TransferRequester) countResponseReceived(origin string, response Respon
 	t.countResponsesReceived.With(prometheus.Labels{"origin": origin}).Inc()
 }
 
-func (t *TransferRequester) sendDataRequests() {
+func (t *TransferRequester) sendDataRequests(ctx context.Context) {
 	incompletePeriods, err := t.db.SelectIncompletePeriods(t.completenessFactor)
 	if err != nil {
 		logger.GetLogger().Warn(
@@ -179,7 +180,7 @@ func (t *TransferRequester) sendDataRequests() {
 			zap.Time("NextRequestAt", time.Now().Add(t.sleepBetweenDataRequests)),
 		)
 
-		time.Sleep(t.sleepBetweenDataRequests)
+		sleep(ctx, t.sleepBetweenDataRequests)
 		return
 	}
 
@@ -195,7 +196,7 @@ func (t *TransferRequester) sendDataRequests() {
 	wg.Add(1)
 
 	go func() {
-		time.Sleep(t.sleepBetweenDataRequests)
+		sleep(ctx, t.sleepBetweenDataRequests)
 		wg.Done()
 	}()
 	for origin, incompletePeriods := range incompletePeriodsGrouped {
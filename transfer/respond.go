@@ -1,10 +1,9 @@
 package transfer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"sync"
-	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
@@ -26,6 +25,7 @@ type TransferResponder struct {
 	db                    *database.PostgresqlDatabase
 	config                *config.TransferConfig
 	mqttClient            *mqtt.Client
+	ctx                   context.Context // the handlers stop sending data when the context is done
 	sendBuffer            chan *message.Mapped
 	countRequestsReceived prometheus.Counter
 	countRequestsHandled  prometheus.Counter
@@ -48,18 +48,20 @@ func NewTransferResponder(c *config.TransferConfig) *TransferResponder {
 	}
 }
 
-func (t *TransferResponder) Run(publisher *nanomsg.Publisher[message.Mapped]) {
+// Responds to requests until the context is done
+func (t *TransferResponder) Run(ctx context.Context, publisher *nanomsg.Publisher[message.Mapped]) {
+	defer t.db.Close()
 	// listen for requests
+	t.ctx = ctx
 	t.sendBuffer = make(chan *message.Mapped, bufferCapacity)
-	defer close(t.sendBuffer)
 	go publisher.Send(t.sendBuffer)
 	t.mqttClient = mqtt.New(&t.config.MQTTConfig, t.messageReceived, fmt.Sprintf(requestTopic, t.config.Origin))
-	defer t.mqttClient.Disconnect()
+	<-ctx.Done()
 
-	// never exit
-	var wg sync.WaitGroup
-	wg.Add(1)
-	wg.Wait()
+	// the handlers stop sending after the disconnect
+	t.mqttClient.Disconnect()
+	close(t.sendBuffer)
+	<-publisher.Done()
 }
 
 func (t *TransferResponder) messageReceived(c paho.Client, m paho.Message) {
@@ -160,11 +162,14 @@ func (t *TransferResponder) injectData(requestMessage RequestMessage) {
 		return
 	}
 	for _, delta := range deltas {
+		if t.ctx.Err() != nil {
+			return
+		}
 		for i := range delta.Updates {
 			delta.Updates[i].Source.TransferUuid = requestMessage.UUID
 		}
 		t.sendBuffer <- delta
 		t.recordsTransmitted.Inc()
-		time.Sleep(t.config.SleepBetweenRespondDeltas)
+		sleep(t.ctx, t.config.SleepBetweenRespondDeltas)
 	}
 }
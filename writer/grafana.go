@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -44,13 +45,12 @@ func (w *GrafanaWriter) sendMQTT(delta *message.Mapped) {
 	}
 }
 
-func (w *GrafanaWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mapped]) {
+func (w *GrafanaWriter) WriteMapped(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped]) {
 	w.mqttClient = mqtt.New(w.mqttConfig, nil, "")
 	defer w.mqttClient.Disconnect()
 
 	receiveBuffer := make(chan *message.Mapped, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for mapped := range receiveBuffer {
 		w.sendMQTT(mapped)
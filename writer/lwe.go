@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sync"
@@ -130,10 +131,9 @@ func NewLWEWriter(c *config.LWEConfig) *LWEWriter {
 		IncludeLineCount:          c.IncludeLineCount,
 	}
 }
-func (w *LWEWriter) WriteRaw(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (w *LWEWriter) WriteRaw(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	receiveBuffer := make(chan *message.Raw, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for raw := range receiveBuffer {
 		w.multicast(raw)
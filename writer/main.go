@@ -1,15 +1,18 @@
 package writer
 
 import (
-	"go.nanomsg.org/mangos/v3"
+	"context"
+
+	"github.com/munnik/gosk/message"
+	"github.com/munnik/gosk/nanomsg"
 )
 
-// RawWriter interface
+// RawWriter interface, the writers return when the context is done and the received messages are written
 type RawWriter interface {
-	WriteRaw(subscriber mangos.Socket)
+	WriteRaw(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw])
 }
 
-// RawWriter interface
+// MappedWriter interface
 type MappedWriter interface {
-	WriteMapped(subscriber mangos.Socket)
+	WriteMapped(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped])
 }
@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -32,6 +33,7 @@ type MqttWriter struct {
 	lastFlush      time.Time
 	encoder        *zstd.Encoder
 	writeMutex     sync.Mutex
+	sending        sync.WaitGroup
 }
 
 func NewMqttWriter(c *config.MQTTConfig) *MqttWriter {
@@ -54,7 +56,9 @@ func (w *MqttWriter) sendMQTT(deltas []message.Mapped) {
 		)
 		return
 	}
+	w.sending.Add(1)
 	go func(context string, bytes []byte) {
+		defer w.sending.Done()
 		if w.mqttConfig.Compress {
 			w.mqttClient.Publish(context, 0, true, w.encoder.EncodeAll(bytes, make([]byte, 0, len(bytes))))
 		} else {
@@ -63,12 +67,14 @@ func (w *MqttWriter) sendMQTT(deltas []message.Mapped) {
 	}(fmt.Sprintf(writeTopic, w.mqttConfig.Username), bytes)
 }
 
-func (w *MqttWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mapped]) {
+// Writes the received messages until the context is done, the cached messages are sent before disconnecting
+func (w *MqttWriter) WriteMapped(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped]) {
 	w.mqttClient = mqtt.New(w.mqttConfig, nil, "")
 	defer w.mqttClient.Disconnect()
+	defer w.sending.Wait()
+	defer w.flushCache()
 	receiveBuffer := make(chan *message.Mapped, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for mapped := range receiveBuffer {
 		bytes, err := json.Marshal(mapped)
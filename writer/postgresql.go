@@ -1,11 +1,16 @@
 package writer
 
 import (
+	"context"
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
 
 	"github.com/munnik/gosk/config"
 	"github.com/munnik/gosk/database"
+	"github.com/munnik/gosk/logger"
 	"github.com/munnik/gosk/message"
 	"github.com/munnik/gosk/nanomsg"
 )
@@ -22,14 +27,19 @@ func NewPostgresqlWriter[T nanomsg.Message](c *config.PostgresqlConfig) *Postgre
 	}
 }
 
-func (w *PostgresqlWriter[T]) Write(subscriber *nanomsg.Subscriber[T]) {
+// Writes the received messages until the context is done, the queued messages are flushed to the database before returning
+func (w *PostgresqlWriter[T]) Write(ctx context.Context, subscriber *nanomsg.Subscriber[T]) {
 	receiveBuffer := make(chan *T, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
+	var writes sync.WaitGroup
+	defer w.db.Close()
+	defer writes.Wait()
 	if receiveBufferRaw, ok := any(receiveBuffer).(chan *message.Raw); ok {
 		for raw := range receiveBufferRaw {
+			writes.Add(1)
 			go func(raw *message.Raw) {
+				defer writes.Done()
 				w.db.WriteRaw(raw)
 				w.writtenCounter.Inc()
 			}(raw)
@@ -37,10 +47,25 @@ func (w *PostgresqlWriter[T]) Write(subscriber *nanomsg.Subscriber[T]) {
 	}
 	if receiveBufferMapped, ok := any(receiveBuffer).(chan *message.Mapped); ok {
 		for mapped := range receiveBufferMapped {
+			writes.Add(1)
 			go func(mapped *message.Mapped) {
+				defer writes.Done()
 				w.db.WriteMapped(mapped)
 				w.writtenCounter.Inc()
 			}(mapped)
 		}
 	}
+	if receiveBufferDeadLetter, ok := any(receiveBuffer).(chan *message.DeadLetter); ok {
+		for deadLetter := range receiveBufferDeadLetter {
+			if err := w.db.WriteDeadLetter(deadLetter); err != nil {
+				logger.GetLogger().Warn(
+					"Could not write the dead letter",
+					zap.Any("Dead letter", deadLetter),
+					zap.String("Error", err.Error()),
+				)
+				continue
+			}
+			w.writtenCounter.Inc()
+		}
+	}
 }
@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -33,7 +34,7 @@ func NewSignalKWriter(c *config.SignalKConfig) *SignalKWriter {
 	}
 }
 
-func (w *SignalKWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mapped]) {
+func (w *SignalKWriter) WriteMapped(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped]) {
 	// fill the cache with data from the database
 	w.readFromDatabase()
 	h := NewHanlder(w)
@@ -44,17 +45,19 @@ func (w *SignalKWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mappe
 	})
 	logger.GetLogger().Info("SignalK server is ready to serve")
 
+	received := make(chan struct{})
 	go func() {
+		defer close(received)
 		receiveBuffer := make(chan *message.Mapped, bufferCapacity)
-		defer close(receiveBuffer)
-		go subscriber.Receive(receiveBuffer)
+		go subscriber.Receive(ctx, receiveBuffer)
 		for mapped := range receiveBuffer {
 			w.updateFullDataModel(mapped)
 			h.Broadcast(mapped)
 		}
 	}()
 
-	http.HandleFunc(SignalKWSPath, func(writer http.ResponseWriter, request *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(SignalKWSPath, func(writer http.ResponseWriter, request *http.Request) {
 		socket, err := upgrader.Upgrade(writer, request)
 		if err != nil {
 			return
@@ -63,12 +66,22 @@ func (w *SignalKWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mappe
 			socket.ReadLoop() // Blocking prevents the context from being GC.
 		}()
 	})
-	http.HandleFunc(SignalKEndpointsPath, w.serveEndpoints)
-	http.HandleFunc(SignalKHTTPPath+"*", w.serveFullDataModel)
+	mux.HandleFunc(SignalKEndpointsPath, w.serveEndpoints)
+	mux.HandleFunc(SignalKHTTPPath+"*", w.serveFullDataModel)
+
+	server := &http.Server{Addr: w.config.URL.Host, Handler: mux}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	defer w.database.Close()
+	defer func() { <-received }()
 
 	// listen to port
-	err := http.ListenAndServe(w.config.URL.Host, nil)
-	if err != nil {
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		logger.GetLogger().Fatal(
 			"Could not listen and serve",
 			zap.String("Host", w.config.URL.Host),
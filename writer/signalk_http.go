@@ -46,6 +46,7 @@ func (w *SignalKWriter) serveFullDataModel(rw http.ResponseWriter, r *http.Reque
 	jsonObj.Set(w.config.Version, "version")
 	jsonObj.Set(w.config.SelfContext, "self")
 
+	schema := message.GetSchema()
 	var jsonPath []string
 	for _, m := range mapped {
 		for _, sm := range m.ToSingleValueMapped() {
@@ -71,6 +72,9 @@ func (w *SignalKWriter) serveFullDataModel(rw http.ResponseWriter, r *http.Reque
 			jsonObj.Set(sm.Source.Label, append(jsonPath, "source", "label")...)
 			jsonObj.Set(sm.Source.Type, append(jsonPath, "source", "type")...)
 			jsonObj.Set(sm.Source.Uuid, append(jsonPath, "source", "uuid")...)
+			if p, ok := schema.Lookup(sm.Path); ok {
+				jsonObj.Set(p.Meta, append(jsonPath, "meta")...)
+			}
 		}
 	}
 
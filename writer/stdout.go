@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -17,10 +18,9 @@ func NewStdOutWriter() *StdOutWriter {
 	return &StdOutWriter{}
 }
 
-func (w *StdOutWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mapped]) {
+func (w *StdOutWriter) WriteMapped(ctx context.Context, subscriber *nanomsg.Subscriber[message.Mapped]) {
 	receiveBuffer := make(chan *message.Mapped, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for mapped := range receiveBuffer {
 		jsonData, _ := json.MarshalIndent(*mapped, "", "  ")
@@ -28,7 +28,7 @@ func (w *StdOutWriter) WriteMapped(subscriber *nanomsg.Subscriber[message.Mapped
 	}
 }
 
-func (w *StdOutWriter) WriteRaw(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (w *StdOutWriter) WriteRaw(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	type rawBytes struct {
 		Connector string
 		Timestamp time.Time
@@ -38,8 +38,7 @@ func (w *StdOutWriter) WriteRaw(subscriber *nanomsg.Subscriber[message.Raw]) {
 	}
 	var rb = rawBytes{}
 	receiveBuffer := make(chan *message.Raw, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for raw := range receiveBuffer {
 		rb.Connector = raw.Connector
@@ -52,7 +51,7 @@ func (w *StdOutWriter) WriteRaw(subscriber *nanomsg.Subscriber[message.Raw]) {
 	}
 }
 
-func (w *StdOutWriter) WriteRawString(subscriber *nanomsg.Subscriber[message.Raw]) {
+func (w *StdOutWriter) WriteRawString(ctx context.Context, subscriber *nanomsg.Subscriber[message.Raw]) {
 	type rawString struct {
 		Connector string
 		Timestamp time.Time
@@ -62,8 +61,7 @@ func (w *StdOutWriter) WriteRawString(subscriber *nanomsg.Subscriber[message.Raw
 	}
 	var rs = rawString{}
 	receiveBuffer := make(chan *message.Raw, bufferCapacity)
-	defer close(receiveBuffer)
-	go subscriber.Receive(receiveBuffer)
+	go subscriber.Receive(ctx, receiveBuffer)
 
 	for raw := range receiveBuffer {
 		rs.Connector = raw.Connector